@@ -163,6 +163,12 @@ func (uc *UpdateChecker) DownloadAndInstall(release *GitHubRelease) error {
 	return nil
 }
 
+// latestReleaseURL is the download page for the newest release, for when
+// we haven't found out which release that is
+func latestReleaseURL() string {
+	return fmt.Sprintf("https://github.com/%s/releases/latest", githubRepo)
+}
+
 func checkAndPromptForUpdate(gr *GameRoom) {
 	checker := NewUpdateChecker()
 
@@ -0,0 +1,86 @@
+package main
+
+import (
+	"image/color"
+	"sync"
+
+	"github.com/hajimehoshi/ebiten/v2"
+	"github.com/hajimehoshi/ebiten/v2/ebitenutil"
+	"github.com/hajimehoshi/ebiten/v2/inpututil"
+	"github.com/hajimehoshi/ebiten/v2/vector"
+)
+
+const (
+	chatMaxLines  = 5
+	chatMaxInput  = 48
+	chatBoxWidth  = 320
+	chatBoxHeight = 120
+)
+
+// ChatBox is a small chat panel drawn over the game, used by spectators to
+// talk amongst themselves. Type to chat, Enter sends.
+type ChatBox struct {
+	networkClient *NetworkClient
+	lines         []string
+	input         []rune
+	mu            sync.Mutex
+}
+
+func NewChatBox(nc *NetworkClient) *ChatBox {
+	return &ChatBox{
+		networkClient: nc,
+	}
+}
+
+// AddMessage is called from the network goroutine when a chat arrives
+func (c *ChatBox) AddMessage(name, text string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.lines = append(c.lines, name+": "+text)
+	if len(c.lines) > chatMaxLines {
+		c.lines = c.lines[len(c.lines)-chatMaxLines:]
+	}
+}
+
+func (c *ChatBox) Update() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.input = ebiten.AppendInputChars(c.input)
+	if len(c.input) > chatMaxInput {
+		c.input = c.input[:chatMaxInput]
+	}
+
+	if inpututil.IsKeyJustPressed(ebiten.KeyBackspace) && len(c.input) > 0 {
+		c.input = c.input[:len(c.input)-1]
+	}
+
+	if inpututil.IsKeyJustPressed(ebiten.KeyEnter) && len(c.input) > 0 {
+		c.networkClient.SendChat(string(c.input))
+		c.input = c.input[:0]
+	}
+}
+
+func (c *ChatBox) Draw(screen *ebiten.Image) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	x := float32(screenWidth - chatBoxWidth - 10)
+	y := float32(screenHeight - chatBoxHeight - 50)
+
+	vector.DrawFilledRect(screen, x, y, chatBoxWidth, chatBoxHeight, color.RGBA{30, 50, 80, 200}, false)
+	vector.StrokeRect(screen, x, y, chatBoxWidth, chatBoxHeight, 2, color.RGBA{100, 150, 220, 255}, false)
+
+	ebitenutil.DebugPrintAt(screen, "SPECTATOR CHAT", int(x)+8, int(y)+4)
+	for i, line := range c.lines {
+		if len(line) > 50 {
+			line = line[:50]
+		}
+		ebitenutil.DebugPrintAt(screen, line, int(x)+8, int(y)+20+i*14)
+	}
+
+	// Input line
+	vector.DrawFilledRect(screen, x+4, y+chatBoxHeight-20, chatBoxWidth-8, 16, color.RGBA{20, 30, 50, 255}, false)
+	ebitenutil.DebugPrintAt(screen, "> "+string(c.input)+"_", int(x)+8, int(y+chatBoxHeight-20))
+}
@@ -4,50 +4,66 @@ import (
 	"encoding/json"
 	"fmt"
 	"image/color"
+	"math/rand"
+	"time"
 
 	"github.com/hajimehoshi/ebiten/v2"
 	"github.com/hajimehoshi/ebiten/v2/ebitenutil"
 	"github.com/hajimehoshi/ebiten/v2/inpututil"
 	"github.com/hajimehoshi/ebiten/v2/vector"
+
+	"olive_and_millies_game_room/protocol"
+	"olive_and_millies_game_room/rules"
+	"olive_and_millies_game_room/rules/connectfour"
 )
 
 const (
-	cf_rows    = 6
-	cf_cols    = 7
+	cf_rows    = connectfour.Rows
+	cf_cols    = connectfour.Cols
 	cf_cellSize = 65
-)
 
-type ConnectFourMove struct {
-	Column int `json:"column"`
-}
+	// The computer takes at least this long over a move, so it doesn't
+	// answer before the player's piece has landed
+	cf_computerDelay = 600 * time.Millisecond
+)
 
 type ConnectFourPlayer struct {
 	id     int
 	name   string
 	avatar AvatarType
+	rating int
 }
 
 type ConnectFourGame struct {
-	board         [cf_rows][cf_cols]int // 0 = empty, 1 = player 1, 2 = player 2
-	currentPlayer int
-	winner        int // 0 = no winner, 1 = player 1, 2 = player 2
+	state         *connectfour.State
 	boardOffsetX  float32
 	boardOffsetY  float32
 	hoveredCol    int
 	networkClient *NetworkClient
 	myPlayerNum   int // 1 or 2 (determined by join order)
 	players       []*ConnectFourPlayer
+	turnTimer     *TurnTimer               // The room's time control, nil if it has none
+	roster        []protocol.PlayerInfo    // Who plays an offline game, for the next one
+	computers     map[int]rules.Difficulty // Seats the computer plays offline, and how well
+	computerMove  chan connectfour.Move    // The computer's move once it has thought, nil when it isn't thinking
+	rng           *rand.Rand
 }
 
 func NewConnectFourGame() *ConnectFourGame {
 	return NewConnectFourGameWithNetwork(nil, 1)
 }
 
+// NewConnectFourGameVsComputer starts an offline game against the
+// computer, with the player going first
+func NewConnectFourGameVsComputer(level rules.Difficulty) *ConnectFourGame {
+	return NewConnectFourGameWithPlayers(nil, 0, vsComputer(level))
+}
+
 func NewConnectFourGameWithNetwork(nc *NetworkClient, playerNum int) *ConnectFourGame {
 	return NewConnectFourGameWithPlayers(nc, playerNum, nil)
 }
 
-func NewConnectFourGameWithPlayers(nc *NetworkClient, playerNum int, playerData []map[string]interface{}) *ConnectFourGame {
+func NewConnectFourGameWithPlayers(nc *NetworkClient, playerNum int, playerData []protocol.PlayerInfo) *ConnectFourGame {
 	boardWidth := float32(cf_cols * cf_cellSize)
 	boardHeight := float32(cf_rows * cf_cellSize)
 
@@ -57,43 +73,50 @@ func NewConnectFourGameWithPlayers(nc *NetworkClient, playerNum int, playerData
 	boardCenterY := topSpace + (availableHeight-boardHeight)/2
 
 	g := &ConnectFourGame{
-		currentPlayer: 1,
-		winner:        0,
+		state:         connectfour.New(),
 		boardOffsetX:  (screenWidth - boardWidth) / 2,
 		boardOffsetY:  boardCenterY,
 		hoveredCol:    -1,
 		networkClient: nc,
 		myPlayerNum:   playerNum + 1, // Connect Four uses 1/2
 		players:       make([]*ConnectFourPlayer, 2),
+		roster:        playerData,
+		computers:     localComputers(nc, playerData),
+		rng:           rand.New(rand.NewSource(time.Now().UnixNano())),
 	}
 
 	// Initialize players with server data
 	for i := 0; i < 2; i++ {
 		name := fmt.Sprintf("Player %d", i+1)
 		avatar := i % int(AvatarNumTypes)
+		rating := 0
 
 		if playerData != nil && i < len(playerData) {
-			if n, ok := playerData[i]["name"].(string); ok {
-				name = n
-			}
-			if a, ok := playerData[i]["avatar"].(float64); ok {
-				avatar = int(a)
-			}
+			name = playerData[i].Name
+			avatar = playerData[i].Avatar
+			rating = playerData[i].Rating
 		}
 
 		g.players[i] = &ConnectFourPlayer{
 			id:     i + 1,
 			name:   name,
 			avatar: AvatarType(avatar),
+			rating: rating,
 		}
 	}
 
 	// Register network handler for opponent moves
 	if nc != nil {
-		nc.RegisterHandler(MsgGameMove, func(msg Message) {
-			var move ConnectFourMove
+		nc.RegisterHandler(protocol.MsgGameMove, func(msg protocol.Message) {
+			var move connectfour.Move
 			if err := json.Unmarshal(msg.Data, &move); err == nil {
-				g.dropPiece(move.Column)
+				g.applyMove(move)
+			}
+		})
+		nc.RegisterHandler(protocol.MsgGameState, func(msg protocol.Message) {
+			state := connectfour.New()
+			if err := json.Unmarshal(msg.Data, state); err == nil {
+				g.state = state
 			}
 		})
 	}
@@ -102,7 +125,7 @@ func NewConnectFourGameWithPlayers(nc *NetworkClient, playerNum int, playerData
 }
 
 func (g *ConnectFourGame) Reset() {
-	*g = *NewConnectFourGame()
+	*g = *NewConnectFourGameWithPlayers(nil, 0, g.roster)
 }
 
 func (g *ConnectFourGame) Update(gr *GameRoom) error {
@@ -122,12 +145,17 @@ func (g *ConnectFourGame) Update(gr *GameRoom) error {
 		g.hoveredCol = -1
 	}
 
-	if g.winner != 0 {
+	if g.state.IsOver() {
+		return nil
+	}
+
+	if level, ok := g.computers[g.state.CurrentPlayer-1]; ok {
+		g.updateComputer(level)
 		return nil
 	}
 
 	// Only allow input if it's my turn (or if no network client)
-	isMyTurn := g.networkClient == nil || g.currentPlayer == g.myPlayerNum
+	isMyTurn := g.networkClient == nil || g.state.CurrentPlayer == g.myPlayerNum
 
 	if isMyTurn && inpututil.IsMouseButtonJustPressed(ebiten.MouseButtonLeft) {
 		if g.hoveredCol >= 0 {
@@ -135,7 +163,7 @@ func (g *ConnectFourGame) Update(gr *GameRoom) error {
 
 			// Send move to opponent
 			if g.networkClient != nil {
-				move := ConnectFourMove{Column: g.hoveredCol}
+				move := connectfour.Move{Column: g.hoveredCol}
 				g.networkClient.SendGameMove(move)
 			}
 		}
@@ -144,78 +172,41 @@ func (g *ConnectFourGame) Update(gr *GameRoom) error {
 	return nil
 }
 
-func (g *ConnectFourGame) dropPiece(col int) {
-	// Find lowest empty row in this column
-	for row := cf_rows - 1; row >= 0; row-- {
-		if g.board[row][col] == 0 {
-			g.board[row][col] = g.currentPlayer
-			if g.checkWin(row, col) {
-				g.winner = g.currentPlayer
-			} else {
-				// Switch players
-				g.currentPlayer = 3 - g.currentPlayer // Toggle between 1 and 2
-			}
-			return
-		}
-	}
-}
-
-func (g *ConnectFourGame) checkWin(row, col int) bool {
-	player := g.board[row][col]
-
-	// Check horizontal
-	count := 1
-	// Check left
-	for c := col - 1; c >= 0 && g.board[row][c] == player; c-- {
-		count++
-	}
-	// Check right
-	for c := col + 1; c < cf_cols && g.board[row][c] == player; c++ {
-		count++
-	}
-	if count >= 4 {
-		return true
-	}
-
-	// Check vertical
-	count = 1
-	// Check down
-	for r := row + 1; r < cf_rows && g.board[r][col] == player; r++ {
-		count++
-	}
-	if count >= 4 {
-		return true
+// Have the computer think about its move in the background, so a deep
+// search doesn't hold up drawing, and play it once it's ready
+func (g *ConnectFourGame) updateComputer(level rules.Difficulty) {
+	if g.computerMove == nil {
+		// The search gets a generator of its own, as a rand.Rand isn't safe
+		// to share with the update loop
+		state := *g.state
+		rng := rand.New(rand.NewSource(g.rng.Int63()))
+		moves := make(chan connectfour.Move, 1)
+		g.computerMove = moves
+		go func() {
+			start := time.Now()
+			move := state.BestMove(level, rng)
+			time.Sleep(cf_computerDelay - time.Since(start))
+			moves <- move
+		}()
+		return
 	}
 
-	// Check diagonal (top-left to bottom-right)
-	count = 1
-	// Check up-left
-	for r, c := row-1, col-1; r >= 0 && c >= 0 && g.board[r][c] == player; r, c = r-1, c-1 {
-		count++
-	}
-	// Check down-right
-	for r, c := row+1, col+1; r < cf_rows && c < cf_cols && g.board[r][c] == player; r, c = r+1, c+1 {
-		count++
-	}
-	if count >= 4 {
-		return true
+	select {
+	case move := <-g.computerMove:
+		g.computerMove = nil
+		g.dropPiece(move.Column)
+	default:
 	}
+}
 
-	// Check diagonal (top-right to bottom-left)
-	count = 1
-	// Check up-right
-	for r, c := row-1, col+1; r >= 0 && c < cf_cols && g.board[r][c] == player; r, c = r-1, c+1 {
-		count++
-	}
-	// Check down-left
-	for r, c := row+1, col-1; r < cf_rows && c >= 0 && g.board[r][c] == player; r, c = r+1, c-1 {
-		count++
-	}
-	if count >= 4 {
-		return true
-	}
+func (g *ConnectFourGame) dropPiece(col int) {
+	g.applyMove(connectfour.Move{Column: col})
+}
 
-	return false
+// applyMove plays a move for the current player. Illegal drops (e.g. a
+// full column) are simply ignored.
+func (g *ConnectFourGame) applyMove(move connectfour.Move) {
+	g.state.Apply(g.state.CurrentPlayer-1, move)
 }
 
 func (g *ConnectFourGame) Draw(screen *ebiten.Image, gr *GameRoom) {
@@ -227,7 +218,7 @@ func (g *ConnectFourGame) Draw(screen *ebiten.Image, gr *GameRoom) {
 	g.drawPieces(screen)
 	g.drawPlayerInfo(screen)
 
-	if g.winner != 0 {
+	if g.state.IsOver() {
 		g.drawWinner(screen)
 	}
 }
@@ -248,8 +239,8 @@ func (g *ConnectFourGame) drawGameInfo(screen *ebiten.Image) {
 	vector.StrokeRect(screen, infoX, 70, infoWidth, 50, 2, color.RGBA{100, 150, 220, 255}, false)
 
 	var phaseText string
-	if g.winner == 0 {
-		phaseText = fmt.Sprintf("%s's Turn", g.players[g.currentPlayer-1].name)
+	if !g.state.IsOver() {
+		phaseText = fmt.Sprintf("%s's Turn", g.players[g.state.CurrentPlayer-1].name)
 	} else {
 		phaseText = "Game Over"
 	}
@@ -277,7 +268,7 @@ func (g *ConnectFourGame) drawBoard(screen *ebiten.Image) {
 	}
 
 	// Highlight hovered column
-	if g.hoveredCol >= 0 && g.winner == 0 {
+	if g.hoveredCol >= 0 && !g.state.IsOver() {
 		x := g.boardOffsetX + float32(g.hoveredCol*cf_cellSize)
 		vector.StrokeRect(screen, x, g.boardOffsetY, cf_cellSize, boardHeight, 3, color.RGBA{255, 255, 100, 200}, false)
 	}
@@ -286,12 +277,12 @@ func (g *ConnectFourGame) drawBoard(screen *ebiten.Image) {
 func (g *ConnectFourGame) drawPieces(screen *ebiten.Image) {
 	for row := 0; row < cf_rows; row++ {
 		for col := 0; col < cf_cols; col++ {
-			if g.board[row][col] != 0 {
+			if g.state.Board[row][col] != 0 {
 				x := g.boardOffsetX + float32(col*cf_cellSize) + cf_cellSize/2
 				y := g.boardOffsetY + float32(row*cf_cellSize) + cf_cellSize/2
 
 				var pieceColor color.RGBA
-				if g.board[row][col] == 1 {
+				if g.state.Board[row][col] == 1 {
 					pieceColor = color.RGBA{255, 100, 100, 255} // Red for player 1
 				} else {
 					pieceColor = color.RGBA{255, 220, 100, 255} // Yellow for player 2
@@ -333,13 +324,26 @@ func (g *ConnectFourGame) drawPlayerInfo(screen *ebiten.Image) {
 		player := g.players[i]
 		DrawAvatar(screen, player.avatar, x+10, y+10, 1.5)
 
-		playerName := player.name
+		playerName := ratedName(player.name, player.rating)
 		ebitenutil.DebugPrintAt(screen, playerName, int(x+90), int(y+30))
 		ebitenutil.DebugPrintAt(screen, playerName, int(x+91), int(y+30))
 
-		if g.currentPlayer == i+1 {
+		if g.state.CurrentPlayer == i+1 {
 			ebitenutil.DebugPrintAt(screen, "Current Turn", int(x+90), int(y+50))
 		}
+		g.turnTimer.DrawRing(screen, i, x+280, y+50, 26)
+	}
+}
+
+func (g *ConnectFourGame) SetTurnTimer(t *TurnTimer) {
+	g.turnTimer = t
+}
+
+func (g *ConnectFourGame) SetRatings(ratings []int) {
+	for i, rating := range ratings {
+		if i < len(g.players) {
+			g.players[i].rating = rating
+		}
 	}
 }
 
@@ -358,7 +362,10 @@ func (g *ConnectFourGame) drawWinner(screen *ebiten.Image) {
 	vector.DrawFilledRect(screen, bannerX-20, bannerY+40, 10, 10, starColor, false)
 	vector.DrawFilledRect(screen, bannerX+bannerWidth+8, bannerY+40, 10, 10, starColor, false)
 
-	winnerText := fmt.Sprintf("WINNER: %s", g.players[g.winner-1].name)
+	winnerText := "IT'S A DRAW!"
+	if g.state.Winner != 0 {
+		winnerText = fmt.Sprintf("WINNER: %s", g.players[g.state.Winner-1].name)
+	}
 	winnerTextX := int(bannerX + (bannerWidth-float32(len(winnerText)*6))/2)
 	ebitenutil.DebugPrintAt(screen, winnerText, winnerTextX, int(bannerY+25))
 	ebitenutil.DebugPrintAt(screen, winnerText, winnerTextX+1, int(bannerY+25))
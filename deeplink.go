@@ -0,0 +1,30 @@
+//go:build !js
+
+package main
+
+import (
+	"os"
+	"strings"
+)
+
+// startupJoinCode is the room code from a "--join CODE" (or "--join=CODE")
+// launch argument, for opening the app straight into a private room
+func startupJoinCode() string {
+	args := os.Args[1:]
+	for i, arg := range args {
+		arg = strings.TrimLeft(arg, "-")
+		if code, ok := strings.CutPrefix(arg, "join="); ok {
+			return code
+		}
+		if arg == "join" && i+1 < len(args) {
+			return args[i+1]
+		}
+	}
+	return ""
+}
+
+// inviteLink is a link that opens the game in a room. The desktop app has
+// no link of its own; players share the code instead.
+func inviteLink(code string) string {
+	return ""
+}
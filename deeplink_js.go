@@ -0,0 +1,29 @@
+//go:build js
+
+package main
+
+import (
+	"net/url"
+	"syscall/js"
+)
+
+// startupJoinCode is the room code from the page's ?join=CODE query, for
+// invite links that open straight into a private room
+func startupJoinCode() string {
+	query, err := url.ParseQuery(js.Global().Get("location").Get("search").String())
+	if err != nil {
+		return ""
+	}
+	return query.Get("join")
+}
+
+// inviteLink is this page's URL with the room's code attached
+func inviteLink(code string) string {
+	location := js.Global().Get("location")
+	u, err := url.Parse(location.Get("origin").String() + location.Get("pathname").String())
+	if err != nil {
+		return ""
+	}
+	u.RawQuery = url.Values{"join": {code}}.Encode()
+	return u.String()
+}
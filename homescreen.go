@@ -3,16 +3,29 @@ package main
 import (
 	"image/color"
 	"log"
+	"strings"
 
 	"github.com/hajimehoshi/ebiten/v2"
 	"github.com/hajimehoshi/ebiten/v2/ebitenutil"
 	"github.com/hajimehoshi/ebiten/v2/inpututil"
 	"github.com/hajimehoshi/ebiten/v2/vector"
+
+	"olive_and_millies_game_room/rules"
 )
 
 type HomeScreen struct {
-	gameButtons []*Button
-	retryButton *Button
+	gameButtons   []*Button
+	retryButton   *Button
+	updateButton  *Button         // Shown when the server needs a newer version
+	localButton   *Button         // Sets up a game for several people on this device
+	computerGames []*computerGame // Games to play against the computer offline
+}
+
+// A game that can be played against the computer without a connection
+type computerGame struct {
+	name    string
+	start   func(level rules.Difficulty) GameInterface
+	buttons []*Button // One per difficulty
 }
 
 func NewHomeScreen() *HomeScreen {
@@ -67,13 +80,62 @@ func NewHomeScreen() *HomeScreen {
 	// Add "Retry" button (only shown when connection fails)
 	hs.retryButton = &Button{
 		x:       float64(screenWidth/2) - 100,
-		y:       float64(screenHeight) - 100,
+		y:       float64(screenHeight) - 70,
 		width:   200,
 		height:  60,
 		text:    "RETRY CONNECTION",
 		enabled: true,
 	}
 
+	// Add "Get update" button (only shown when the server turned us away)
+	hs.updateButton = &Button{
+		x:       float64(screenWidth/2) - 100,
+		y:       float64(screenHeight) - 70,
+		width:   200,
+		height:  60,
+		text:    "GET UPDATE",
+		enabled: true,
+	}
+
+	// Add "Play on this device" button, for a game with no server
+	hs.localButton = &Button{
+		x:       float64(screenWidth/2) - 130,
+		y:       290,
+		width:   260,
+		height:  50,
+		text:    "PLAY ON THIS DEVICE",
+		enabled: true,
+	}
+
+	// Add a row of buttons, one per difficulty, for each game that can
+	// be played against the computer offline
+	hs.computerGames = []*computerGame{
+		{name: "CONNECT FOUR", start: func(level rules.Difficulty) GameInterface {
+			return NewConnectFourGameVsComputer(level)
+		}},
+		{name: "SANTORINI", start: func(level rules.Difficulty) GameInterface {
+			return NewSantoriniGameVsComputer(level)
+		}},
+		{name: "YAHTZEE", start: func(level rules.Difficulty) GameInterface {
+			return NewYahtzeeGameVsComputer(level)
+		}},
+		{name: "MEMORY MATCH", start: func(level rules.Difficulty) GameInterface {
+			return NewMemoryGameVsComputer(level)
+		}},
+	}
+	for row, game := range hs.computerGames {
+		for i, level := range rules.Difficulties {
+			game.buttons = append(game.buttons, &Button{
+				x:       float64(screenWidth/2) - 60 + float64(i)*130,
+				y:       float64(490 + row*50),
+				width:   120,
+				height:  40,
+				text:    strings.ToUpper(level.String()),
+				enabled: true,
+			})
+		}
+	}
+
 	return hs
 }
 
@@ -87,12 +149,43 @@ func (hs *HomeScreen) Update(gr *GameRoom) error {
 			hs.retryButton.hovered = hs.retryButton.Contains(x, y)
 		}
 
+		if gr.connectionState == StateOutdated {
+			hs.updateButton.hovered = hs.updateButton.Contains(x, y)
+		}
+		hs.localButton.hovered = hs.localButton.Contains(x, y)
+		for _, game := range hs.computerGames {
+			for _, btn := range game.buttons {
+				btn.hovered = btn.Contains(x, y)
+			}
+		}
+
 		// Handle retry button click
 		if inpututil.IsMouseButtonJustPressed(ebiten.MouseButtonLeft) {
 			if gr.connectionState == StateFailed && hs.retryButton != nil && hs.retryButton.hovered {
 				log.Println("Retry button clicked - attempting to reconnect")
 				gr.TryGoOnline()
 			}
+			if gr.connectionState == StateOutdated && hs.updateButton.hovered {
+				// The update check may have found the exact release
+				updateURL := gr.updateURL
+				if updateURL == "" {
+					updateURL = latestReleaseURL()
+				}
+				log.Printf("Opening update URL: %s", updateURL)
+				OpenBrowser(updateURL)
+			}
+			if hs.localButton.hovered {
+				log.Println("Setting up a game on this device")
+				gr.localSetup = NewLocalSetupScreen()
+			}
+			for _, game := range hs.computerGames {
+				for i, btn := range game.buttons {
+					if btn.hovered {
+						log.Printf("Playing %s against the computer (%s)", game.name, rules.Difficulties[i])
+						gr.SwitchToGame(game.start(rules.Difficulties[i]))
+					}
+				}
+			}
 		}
 	}
 
@@ -142,6 +235,9 @@ func (hs *HomeScreen) Draw(screen *ebiten.Image, gr *GameRoom) {
 	case StateConnected:
 		statusText = "Connected!"
 		statusColor = color.RGBA{80, 200, 80, 255}
+	case StateOutdated:
+		statusText = "Please update to play online"
+		statusColor = color.RGBA{230, 190, 80, 255}
 	}
 
 	// Draw status box
@@ -156,8 +252,9 @@ func (hs *HomeScreen) Draw(screen *ebiten.Image, gr *GameRoom) {
 	ebitenutil.DebugPrintAt(screen, statusText, textX, int(statusY+17))
 	ebitenutil.DebugPrintAt(screen, statusText, textX+1, int(statusY+17)) // Bold
 
-	// Draw error message if failed
-	if gr.connectionState == StateFailed && gr.connectionError != "" {
+	// Draw error message if failed, or the server's reason for wanting an
+	// update
+	if (gr.connectionState == StateFailed || gr.connectionState == StateOutdated) && gr.connectionError != "" {
 		errorX := screenWidth/2 - len(gr.connectionError)*3
 		ebitenutil.DebugPrintAt(screen, gr.connectionError, errorX, int(statusY+60))
 	}
@@ -166,6 +263,24 @@ func (hs *HomeScreen) Draw(screen *ebiten.Image, gr *GameRoom) {
 	if gr.connectionState == StateFailed && hs.retryButton != nil {
 		DrawButton(screen, hs.retryButton)
 	}
+	if gr.connectionState == StateOutdated {
+		DrawButton(screen, hs.updateButton)
+	}
+
+	// Playing on this device works without a connection
+	if gr.connectionState != StateConnected {
+		DrawButton(screen, hs.localButton)
+	}
+
+	// Playing the computer works without a connection. Each game's label
+	// sits to the left of its row of buttons.
+	for row, game := range hs.computerGames {
+		offlineText := "PLAY " + game.name + " AGAINST THE COMPUTER"
+		ebitenutil.DebugPrintAt(screen, offlineText, screenWidth/2-80-len(offlineText)*6, 503+row*50)
+		for _, btn := range game.buttons {
+			DrawButton(screen, btn)
+		}
+	}
 	
 }
 
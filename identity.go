@@ -0,0 +1,41 @@
+package main
+
+import (
+	"encoding/json"
+	"log"
+)
+
+// Identity is our account on the game server. The server hands out the ID
+// and key the first time we connect; we keep them so ratings and match
+// history follow us from session to session.
+type Identity struct {
+	PlayerID string `json:"player_id"`
+	Key      string `json:"key"`
+	Name     string `json:"name"`
+	Avatar   int    `json:"avatar"`
+}
+
+// loadIdentity reads our saved identity, or returns an empty one if we've
+// never connected before
+func loadIdentity() Identity {
+	var identity Identity
+	data, err := readIdentityData()
+	if err != nil || len(data) == 0 {
+		return identity
+	}
+	if err := json.Unmarshal(data, &identity); err != nil {
+		log.Printf("Ignoring unreadable saved identity: %v", err)
+		return Identity{}
+	}
+	return identity
+}
+
+func saveIdentity(identity Identity) {
+	data, err := json.Marshal(identity)
+	if err != nil {
+		return
+	}
+	if err := writeIdentityData(data); err != nil {
+		log.Printf("Failed to save identity: %v", err)
+	}
+}
@@ -0,0 +1,41 @@
+//go:build !js
+
+package main
+
+import (
+	"os"
+	"path/filepath"
+)
+
+// The desktop app keeps its identity in the user's config directory
+func identityPath() (string, error) {
+	dir, err := os.UserConfigDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, "com.oliveandmillie.gameroom", "identity.json"), nil
+}
+
+func readIdentityData() ([]byte, error) {
+	path, err := identityPath()
+	if err != nil {
+		return nil, err
+	}
+	data, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	return data, err
+}
+
+func writeIdentityData(data []byte) error {
+	path, err := identityPath()
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		return err
+	}
+	// The key is a credential, so keep it private to the user
+	return os.WriteFile(path, data, 0600)
+}
@@ -0,0 +1,29 @@
+//go:build js
+
+package main
+
+import "syscall/js"
+
+// The web build keeps its identity in the browser's local storage
+const identityStorageKey = "oam_identity"
+
+func readIdentityData() ([]byte, error) {
+	storage := js.Global().Get("localStorage")
+	if storage.IsUndefined() || storage.IsNull() {
+		return nil, nil
+	}
+	value := storage.Call("getItem", identityStorageKey)
+	if value.IsNull() {
+		return nil, nil
+	}
+	return []byte(value.String()), nil
+}
+
+func writeIdentityData(data []byte) error {
+	storage := js.Global().Get("localStorage")
+	if storage.IsUndefined() || storage.IsNull() {
+		return nil
+	}
+	storage.Call("setItem", identityStorageKey, string(data))
+	return nil
+}
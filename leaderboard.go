@@ -0,0 +1,168 @@
+package main
+
+import (
+	"fmt"
+	"image/color"
+	"log"
+	"math"
+
+	"github.com/hajimehoshi/ebiten/v2"
+	"github.com/hajimehoshi/ebiten/v2/ebitenutil"
+	"github.com/hajimehoshi/ebiten/v2/inpututil"
+	"github.com/hajimehoshi/ebiten/v2/vector"
+)
+
+const leaderboardRows = 25
+
+var leaderboardGames = []string{"santorini", "connect_four", "yahtzee", "memory"}
+
+// LeaderboardEntry is one player's rating from the server
+type LeaderboardEntry struct {
+	Name   string  `json:"name"`
+	Rating float64 `json:"rating"`
+	Games  int     `json:"games"`
+	Wins   int     `json:"wins"`
+}
+
+// LeaderboardScreen shows the top rated players in each game
+type LeaderboardScreen struct {
+	gameButtons []*Button
+	backButton  *Button
+	selected    int // Index into leaderboardGames
+	entries     []LeaderboardEntry
+	loading     bool
+	status      string
+}
+
+func NewLeaderboardScreen(gameType string) *LeaderboardScreen {
+	ls := &LeaderboardScreen{
+		backButton: &Button{x: 20, y: float64(screenHeight - 70), width: 150, height: 50, text: "BACK", enabled: true},
+	}
+
+	buttonWidth := 200.0
+	startX := float64(screenWidth)/2 - (buttonWidth*4+30)/2
+	for i, game := range leaderboardGames {
+		ls.gameButtons = append(ls.gameButtons, &Button{
+			x:       startX + float64(i)*(buttonWidth+10),
+			y:       80,
+			width:   buttonWidth,
+			height:  40,
+			text:    gameTitle(game),
+			enabled: true,
+		})
+		if game == gameType {
+			ls.selected = i
+		}
+	}
+
+	ls.load()
+	return ls
+}
+
+// Fetch the selected game's ratings from the server
+func (ls *LeaderboardScreen) load() {
+	ls.loading = true
+	ls.status = "Loading ratings..."
+	gameType := leaderboardGames[ls.selected]
+
+	go func() {
+		var data struct {
+			Ratings []LeaderboardEntry `json:"ratings"`
+		}
+		if err := fetchJSON(serverHTTPURL("/leaderboard/"+gameType), &data); err != nil {
+			log.Printf("Failed to load %s leaderboard: %v", gameType, err)
+			ls.status = "Couldn't load the leaderboard"
+			ls.loading = false
+			return
+		}
+		if leaderboardGames[ls.selected] != gameType {
+			return // Switched games while loading
+		}
+		ls.entries = data.Ratings
+		ls.status = ""
+		if len(ls.entries) == 0 {
+			ls.status = "Nobody has played a rated game yet"
+		}
+		ls.loading = false
+	}()
+}
+
+func (ls *LeaderboardScreen) Update(gr *GameRoom) error {
+	mx, my := ebiten.CursorPosition()
+	clicked := inpututil.IsMouseButtonJustPressed(ebiten.MouseButtonLeft)
+
+	if IsLogoClicked() {
+		gr.leaderboardScreen = nil
+		return nil
+	}
+
+	ls.backButton.hovered = ls.backButton.Contains(mx, my)
+	for _, btn := range ls.gameButtons {
+		btn.hovered = btn.Contains(mx, my)
+	}
+
+	if clicked {
+		if ls.backButton.hovered {
+			gr.leaderboardScreen = nil
+			return nil
+		}
+		for i, btn := range ls.gameButtons {
+			if btn.hovered && i != ls.selected {
+				ls.selected = i
+				ls.entries = nil
+				ls.load()
+			}
+		}
+	}
+	return nil
+}
+
+func (ls *LeaderboardScreen) Draw(screen *ebiten.Image, gr *GameRoom) {
+	DrawForestBackground(screen)
+	DrawKodamaSpirits(screen)
+	DrawOMLogo(screen)
+
+	titleWidth := float32(400)
+	titleX := float32(screenWidth/2) - titleWidth/2
+	vector.DrawFilledRect(screen, titleX, 15, titleWidth, 45, color.RGBA{30, 50, 80, 255}, false)
+	vector.StrokeRect(screen, titleX, 15, titleWidth, 45, 2, color.RGBA{100, 150, 220, 255}, false)
+	titleText := "LEADERBOARD"
+	titleTextX := int(titleX + (titleWidth-float32(len(titleText)*6))/2)
+	ebitenutil.DebugPrintAt(screen, titleText, titleTextX, 32)
+	ebitenutil.DebugPrintAt(screen, titleText, titleTextX+1, 32)
+
+	for i, btn := range ls.gameButtons {
+		btn.enabled = i != ls.selected // Grey out the game we're showing
+		DrawButton(screen, btn)
+	}
+
+	// Table of ratings
+	tableWidth := float32(600)
+	tableX := float32(screenWidth/2) - tableWidth/2
+	tableY := float32(140)
+	vector.DrawFilledRect(screen, tableX, tableY, tableWidth, 30+leaderboardRows*18, color.RGBA{30, 50, 80, 220}, false)
+	vector.StrokeRect(screen, tableX, tableY, tableWidth, 30+leaderboardRows*18, 2, color.RGBA{100, 150, 220, 255}, false)
+
+	header := fmt.Sprintf("%-4s  %-24s  %6s  %5s  %4s", "#", "PLAYER", "RATING", "GAMES", "WINS")
+	ebitenutil.DebugPrintAt(screen, header, int(tableX)+20, int(tableY)+8)
+
+	if ls.status != "" {
+		ebitenutil.DebugPrintAt(screen, ls.status, screenWidth/2-len(ls.status)*3, int(tableY)+40)
+		DrawButton(screen, ls.backButton)
+		return
+	}
+
+	for i, entry := range ls.entries {
+		if i >= leaderboardRows {
+			break
+		}
+		name := entry.Name
+		if len(name) > 24 {
+			name = name[:24]
+		}
+		row := fmt.Sprintf("%-4d  %-24s  %6d  %5d  %4d", i+1, name, int(math.Round(entry.Rating)), entry.Games, entry.Wins)
+		ebitenutil.DebugPrintAt(screen, row, int(tableX)+20, int(tableY)+30+i*18)
+	}
+
+	DrawButton(screen, ls.backButton)
+}
@@ -6,11 +6,22 @@ import (
 	"log"
 	"math/rand"
 	"os"
+	"strings"
 
 	"github.com/hajimehoshi/ebiten/v2"
 	"github.com/hajimehoshi/ebiten/v2/ebitenutil"
 	"github.com/hajimehoshi/ebiten/v2/inpututil"
 	"github.com/hajimehoshi/ebiten/v2/vector"
+
+	"olive_and_millies_game_room/protocol"
+	"olive_and_millies_game_room/rules"
+)
+
+const (
+	memberListY       = 172 // Where the waiting room's member list starts
+	memberRowHeight   = 26
+	maxPasswordLength = 32
+	roomCodeLength    = 6
 )
 
 type LobbyScreen struct {
@@ -20,14 +31,44 @@ type LobbyScreen struct {
 	createRoomButton    *Button   // Button to create new room
 	backButton          *Button
 	startButton         *Button
+	startAnywayButton   *Button   // Host: start without waiting for everyone to be ready
+	readyButton         *Button   // Toggles whether we're ready to start
+	replaysButton       *Button   // Opens the replay viewer
+	leaderboardButton   *Button   // Opens the leaderboards
+	joinCodeButton      *Button   // Opens the join-by-code form
+	joinButton          *Button   // Submits the join-by-code form
+	createButton        *Button   // Submits the create room form
+	privateButton       *Button   // Toggles whether a new room is private
+	timeControlButton   *Button   // Cycles through the new room's time controls
+	lockButton          *Button   // Host: lock or unlock the room
+	fewerSeatsButton    *Button   // Host: one less seat
+	moreSeatsButton     *Button   // Host: one more seat
+	botLevelButton      *Button   // Host: cycles the difficulty of the next computer player
+	addBotButton        *Button   // Host: seats a computer player
+	kickButtons         []*Button // Host: one per room member, nil for ourselves
+	makeHostButtons     []*Button // Host: one per room member, nil for ourselves
 	avatarButtons       []*Button // Avatar selection buttons
 	randomAvatarButton  *Button   // Random avatar selection button
 	selectedGame        string
+	botLevel            rules.Difficulty // How well the next computer player the host adds plays
 	selectedAvatar      AvatarType
+	nameField           *TextField // Display name, edited on the avatar screen
+	roomNameField       *TextField
+	createPasswordField *TextField
+	codeField           *TextField
+	joinPasswordField   *TextField
+	createPrivate       bool   // The room being created will be private
+	createTimeLimit     int    // Time control for the room being created, 0 for none
+	errorText           string // Last error from the server, shown on the forms
+	pendingJoinCode     string // From an invite link, joined once we're connected
+	browsing            string // Game type whose room list we've asked the server for
 	showingRooms        bool
 	inRoom              bool
 	waitingForGame      bool
+	countdown           int // Seconds until the game starts, 0 when not counting down
 	showAvatarSelect    bool
+	showCreateRoom      bool
+	showJoinCode        bool
 	updateMessageHovered bool
 }
 
@@ -37,7 +78,9 @@ func NewLobbyScreen(nc *NetworkClient) *LobbyScreen {
 		createButtons:  make([]*Button, 4),
 		roomButtons:    make([]*Button, 0),
 		avatarButtons:  make([]*Button, int(AvatarNumTypes)),
-		selectedAvatar: AvatarHuman,
+		selectedAvatar: AvatarType(nc.GetIdentity().Avatar),
+		botLevel:       rules.Medium,
+		pendingJoinCode: startupJoinCode(),
 		showingRooms:   false,
 		inRoom:         false,
 	}
@@ -77,6 +120,32 @@ func NewLobbyScreen(nc *NetworkClient) *LobbyScreen {
 		enabled: true,
 	}
 
+	// Replays, leaderboard and join by code buttons (below the game buttons)
+	ls.replaysButton = &Button{
+		x:       float64(screenWidth/2) - 320,
+		y:       startY + 2*spacingY + 10,
+		width:   200,
+		height:  50,
+		text:    "REPLAYS",
+		enabled: true,
+	}
+	ls.leaderboardButton = &Button{
+		x:       float64(screenWidth/2) - 100,
+		y:       startY + 2*spacingY + 10,
+		width:   200,
+		height:  50,
+		text:    "LEADERBOARD",
+		enabled: true,
+	}
+	ls.joinCodeButton = &Button{
+		x:       float64(screenWidth/2) + 120,
+		y:       startY + 2*spacingY + 10,
+		width:   200,
+		height:  50,
+		text:    "JOIN BY CODE",
+		enabled: true,
+	}
+
 	// Start game button (when in room)
 	ls.startButton = &Button{
 		x:       float64(screenWidth/2) - 100,
@@ -86,6 +155,22 @@ func NewLobbyScreen(nc *NetworkClient) *LobbyScreen {
 		text:    "START GAME",
 		enabled: true,
 	}
+	ls.startAnywayButton = &Button{
+		x:       float64(screenWidth/2) - 100,
+		y:       470,
+		width:   200,
+		height:  30,
+		text:    "START ANYWAY",
+		enabled: true,
+	}
+	ls.readyButton = &Button{
+		x:       float64(screenWidth/2) - 100,
+		y:       400,
+		width:   200,
+		height:  60,
+		text:    "READY",
+		enabled: true,
+	}
 
 	// Create new room button (when viewing room list)
 	ls.createRoomButton = &Button{
@@ -159,18 +244,138 @@ func NewLobbyScreen(nc *NetworkClient) *LobbyScreen {
 		enabled: true,
 	}
 
+	ls.nameField = &TextField{
+		x:         float64(screenWidth/2) - 150,
+		y:         100,
+		width:     300,
+		label:     "Your name (type to change):",
+		maxLength: protocol.MaxNameLength,
+		focused:   true,
+	}
+
+	// Host controls in the waiting room
+	ls.lockButton = &Button{
+		x:       float64(screenWidth) - 240,
+		y:       210,
+		width:   200,
+		height:  40,
+		text:    "LOCK ROOM",
+		enabled: true,
+	}
+	ls.fewerSeatsButton = &Button{
+		x:       float64(screenWidth) - 240,
+		y:       160,
+		width:   40,
+		height:  30,
+		text:    "-",
+		enabled: true,
+	}
+	ls.botLevelButton = &Button{
+		x:       float64(screenWidth) - 240,
+		y:       270,
+		width:   200,
+		height:  30,
+		text:    "COMPUTER: MEDIUM",
+		enabled: true,
+	}
+	ls.addBotButton = &Button{
+		x:       float64(screenWidth) - 240,
+		y:       310,
+		width:   200,
+		height:  40,
+		text:    "ADD COMPUTER",
+		enabled: true,
+	}
+	ls.moreSeatsButton = &Button{
+		x:       float64(screenWidth) - 80,
+		y:       160,
+		width:   40,
+		height:  30,
+		text:    "+",
+		enabled: true,
+	}
+
+	// Create room form
+	ls.roomNameField = &TextField{
+		x:         float64(screenWidth/2) - 150,
+		y:         180,
+		width:     300,
+		label:     "Room name:",
+		maxLength: protocol.MaxRoomNameLength,
+	}
+	ls.privateButton = &Button{
+		x:       float64(screenWidth/2) - 150,
+		y:       230,
+		width:   300,
+		height:  40,
+		text:    "PUBLIC ROOM",
+		enabled: true,
+	}
+	ls.createPasswordField = &TextField{
+		x:         float64(screenWidth/2) - 150,
+		y:         310,
+		width:     300,
+		label:     "Password (optional):",
+		maxLength: maxPasswordLength,
+		masked:    true,
+	}
+	ls.timeControlButton = &Button{
+		x:       float64(screenWidth/2) - 150,
+		y:       350,
+		width:   300,
+		height:  40,
+		text:    "NO TIME LIMIT",
+		enabled: true,
+	}
+	ls.createButton = &Button{
+		x:       float64(screenWidth/2) - 100,
+		y:       410,
+		width:   200,
+		height:  60,
+		text:    "CREATE ROOM",
+		enabled: true,
+	}
+
+	// Join by code form
+	ls.codeField = &TextField{
+		x:         float64(screenWidth/2) - 150,
+		y:         180,
+		width:     300,
+		label:     "Room code:",
+		maxLength: roomCodeLength,
+	}
+	ls.joinPasswordField = &TextField{
+		x:         float64(screenWidth/2) - 150,
+		y:         240,
+		width:     300,
+		label:     "Password (if the room has one):",
+		maxLength: maxPasswordLength,
+		masked:    true,
+	}
+	ls.joinButton = &Button{
+		x:       float64(screenWidth/2) - 100,
+		y:       300,
+		width:   200,
+		height:  60,
+		text:    "JOIN ROOM",
+		enabled: true,
+	}
+
 	// Register network handlers
-	nc.RegisterHandler(MsgStartGame, func(msg Message) {
+	nc.RegisterHandler(protocol.MsgStartGame, func(msg protocol.Message) {
 		ls.waitingForGame = false
+		ls.countdown = 0
 		// Game will be started by the handler in main.go
 	})
 
-	nc.RegisterHandler(MessageType("player_joined"), func(msg Message) {
+	nc.RegisterHandler(protocol.MsgPlayerJoined, func(msg protocol.Message) {
 		// Only set inRoom if we're the one who joined
 		if msg.PlayerID == nc.GetPlayerID() {
 			ls.inRoom = true
 			ls.waitingForGame = false
 			ls.showingRooms = false
+			ls.showJoinCode = false
+			ls.errorText = ""
 			// Update network client's current room
 			nc.mu.Lock()
 			nc.currentRoom = msg.RoomID
@@ -178,22 +383,25 @@ func NewLobbyScreen(nc *NetworkClient) *LobbyScreen {
 		}
 	})
 
-	nc.RegisterHandler(MessageType("room_created"), func(msg Message) {
+	nc.RegisterHandler(protocol.MsgRoomCreated, func(msg protocol.Message) {
 		ls.inRoom = true
 		ls.waitingForGame = false  // Don't set to true until we actually start the game
 		ls.showingRooms = false
+		ls.showCreateRoom = false
+		ls.errorText = ""
 		// Update network client's current room
 		nc.mu.Lock()
 		nc.currentRoom = msg.RoomID
 		nc.mu.Unlock()
 	})
 
-	nc.RegisterHandler(MessageType("player_left"), func(msg Message) {
+	nc.RegisterHandler(protocol.MsgPlayerLeft, func(msg protocol.Message) {
 		// If we're the one who left, reset state
 		if msg.PlayerID == nc.GetPlayerID() {
 			ls.inRoom = false
 			ls.showingRooms = false
 			ls.waitingForGame = false
+			ls.countdown = 0
 			// Clear network client's current room
 			nc.mu.Lock()
 			nc.currentRoom = ""
@@ -201,35 +409,143 @@ func NewLobbyScreen(nc *NetworkClient) *LobbyScreen {
 		}
 	})
 
-	nc.RegisterHandler(MessageType("game_ended"), func(msg Message) {
+	nc.RegisterHandler(protocol.MsgGameEnded, func(msg protocol.Message) {
 		// Reset lobby state when game ends
 		ls.inRoom = false
 		ls.showingRooms = false
 		ls.waitingForGame = false
+		ls.countdown = 0
 		// Clear network client's current room
 		nc.mu.Lock()
 		nc.currentRoom = ""
 		nc.mu.Unlock()
 	})
+
+	nc.RegisterHandler(protocol.MsgKicked, func(msg protocol.Message) {
+		ls.inRoom = false
+		ls.showingRooms = true
+		ls.selectedGame = msg.GameType
+		ls.waitingForGame = false
+		ls.countdown = 0
+		ls.errorText = "The host removed you from the room"
+		nc.mu.Lock()
+		nc.currentRoom = ""
+		nc.mu.Unlock()
+	})
+
+	// The server counts down to the game for the whole room; 0 means the
+	// countdown was called off
+	nc.RegisterHandler(protocol.MsgCountdown, func(msg protocol.Message) {
+		var data protocol.Countdown
+		if err := msg.Decode(&data); err == nil {
+			ls.countdown = data.Seconds
+			ls.waitingForGame = data.Seconds > 0
+		}
+	})
+
+	// Show why a create or join didn't work, e.g. a wrong password
+	nc.RegisterHandler(protocol.MsgError, func(msg protocol.Message) {
+		var data protocol.Error
+		if err := msg.Decode(&data); err != nil {
+			return
+		}
+		ls.errorText = errorText(data)
+		if data.Code == protocol.ErrPasswordRequired || data.Code == protocol.ErrWrongPassword {
+			// Straight to the password so they can try again
+			ls.codeField.focused = false
+			ls.joinPasswordField.focused = true
+		}
+	})
 	
 	return ls
 }
 
+// errorText explains an error from the server, in words for the player
+// where we know what went wrong
+func errorText(err protocol.Error) string {
+	switch err.Code {
+	case protocol.ErrRoomNotFound:
+		return "No room with that code - check it and try again"
+	case protocol.ErrPasswordRequired:
+		return "That room needs a password"
+	case protocol.ErrWrongPassword:
+		return "Wrong password - try again"
+	case protocol.ErrRoomFull:
+		return "That room is full"
+	case protocol.ErrRoomLocked:
+		return "The host has locked that room"
+	case protocol.ErrGameStarted:
+		return "That game has already started"
+	case protocol.ErrRemoved:
+		return "The host removed you from that room"
+	}
+	return err.Message
+}
+
 func (ls *LobbyScreen) Reset() {
 	ls.inRoom = false
 	ls.showingRooms = false
+	ls.showCreateRoom = false
+	ls.showJoinCode = false
 	ls.waitingForGame = false
+	ls.countdown = 0
 	ls.selectedGame = ""
 }
 
-// ShowAvatarSelection opens the avatar selection screen
+// ShowAvatarSelection opens the avatar selection screen, where the player
+// also picks their name
 func (ls *LobbyScreen) ShowAvatarSelection() {
 	ls.showAvatarSelect = true
+	ls.nameField.SetText(ls.networkClient.GetIdentity().Name)
+}
+
+// Open the join by code form, filled in with the code if we have one
+func (ls *LobbyScreen) openJoinCode(code string) {
+	ls.showJoinCode = true
+	ls.errorText = ""
+	ls.codeField.SetText(strings.ToUpper(code))
+	ls.joinPasswordField.SetText("")
+	ls.codeField.focused = code == ""
+	ls.joinPasswordField.focused = code != ""
+}
+
+// Open the create room form for the selected game
+func (ls *LobbyScreen) openCreateRoom() {
+	ls.showCreateRoom = true
+	ls.errorText = ""
+	ls.createPrivate = false
+	ls.privateButton.text = "PUBLIC ROOM"
+	ls.createTimeLimit = 0
+	ls.timeControlButton.text = strings.ToUpper(timeControlText(ls.selectedGame, 0))
+	ls.roomNameField.SetText(fmt.Sprintf("%s's Room", ls.networkClient.GetIdentity().Name))
+	ls.roomNameField.focused = true
+	ls.createPasswordField.SetText("")
+	ls.createPasswordField.focused = false
+}
+
+// Close the avatar selection screen, saving the name if it changed
+func (ls *LobbyScreen) closeAvatarSelection() {
+	ls.showAvatarSelect = false
+	name := protocol.CleanName(ls.nameField.Text())
+	if name != "" && name != ls.networkClient.GetIdentity().Name {
+		ls.networkClient.SetName(name)
+	}
 }
 
 func (ls *LobbyScreen) Update(gr *GameRoom) error {
 	mx, my := ebiten.CursorPosition()
 
+	// Follow the room list for the game being browsed, and none once we're
+	// in a room, so the server only sends the rooms we can see
+	browse := ls.selectedGame
+	if ls.inRoom {
+		browse = ""
+	}
+	if browse != ls.browsing {
+		ls.networkClient.BrowseRooms(browse)
+		ls.browsing = browse
+	}
+
 	// Update hover state for update message (bottom left)
 	if gr.updateAvailable {
 		updateMsgX := float64(20)
@@ -249,6 +565,13 @@ func (ls *LobbyScreen) Update(gr *GameRoom) error {
 	}
 
 	if ls.showAvatarSelect {
+		// Typing edits the name; Enter saves it along with the current avatar
+		ls.nameField.Update()
+		if inpututil.IsKeyJustPressed(ebiten.KeyEnter) {
+			ls.closeAvatarSelection()
+			return nil
+		}
+
 		// Avatar selection mode
 		for _, btn := range ls.avatarButtons {
 			btn.hovered = btn.Contains(mx, my)
@@ -261,7 +584,7 @@ func (ls *LobbyScreen) Update(gr *GameRoom) error {
 				if btn.hovered {
 					ls.selectedAvatar = AvatarType(i)
 					ls.networkClient.SetAvatar(i)
-					ls.showAvatarSelect = false
+					ls.closeAvatarSelection()
 					if AvatarType(i) == AvatarPuppy {
 						PlaySweetPuppyPawsSound()
 					}
@@ -273,27 +596,60 @@ func (ls *LobbyScreen) Update(gr *GameRoom) error {
 				randomAvatar := rand.Intn(int(AvatarNumTypes))
 				ls.selectedAvatar = AvatarType(randomAvatar)
 				ls.networkClient.SetAvatar(randomAvatar)
-				ls.showAvatarSelect = false
+				ls.closeAvatarSelection()
 				if AvatarType(randomAvatar) == AvatarPuppy {
 					PlaySweetPuppyPawsSound()
 				}
 			}
 			if ls.backButton.hovered {
-				ls.showAvatarSelect = false
+				ls.closeAvatarSelection()
 			}
 		}
 		return nil
 	}
 
+	// An invite link joins its room as soon as we're connected
+	if ls.pendingJoinCode != "" && ls.networkClient.GetPlayerID() != "" {
+		ls.openJoinCode(ls.pendingJoinCode)
+		ls.networkClient.JoinRoomByCode(ls.pendingJoinCode, "")
+		ls.pendingJoinCode = ""
+	}
+
+	if ls.showJoinCode {
+		ls.updateJoinCode(mx, my)
+		return nil
+	}
+	if ls.showCreateRoom {
+		ls.updateCreateRoom(mx, my)
+		return nil
+	}
+
 	if ls.inRoom {
-		// In a room - update start button
+		// In a room - update start button and, for the host, room controls
+		room := ls.currentRoomInfo()
+		isHost := room != nil && room.Host == ls.networkClient.GetPlayerID()
+		ready := room != nil && room.IsReady(ls.networkClient.GetPlayerID())
+		ls.startButton.enabled = room != nil && room.EveryoneReady()
 		ls.startButton.hovered = ls.startButton.Contains(mx, my)
+		ls.startAnywayButton.hovered = ls.startAnywayButton.Contains(mx, my)
+		ls.readyButton.hovered = ls.readyButton.Contains(mx, my)
+		ls.readyButton.text = "READY"
+		if ready {
+			ls.readyButton.text = "NOT READY"
+		}
 		ls.backButton.hovered = ls.backButton.Contains(mx, my)
+		if isHost {
+			ls.updateHostControls(room, mx, my)
+		}
 
+		// The countdown starts when the server says so, for everyone at once
 		if inpututil.IsMouseButtonJustPressed(ebiten.MouseButtonLeft) {
-			if ls.startButton.hovered {
-				ls.networkClient.StartGame()
-				ls.waitingForGame = true
+			if isHost && !ls.waitingForGame && ls.startButton.hovered && ls.startButton.enabled {
+				ls.networkClient.StartGame(false)
+			} else if isHost && !ls.waitingForGame && ls.startAnywayButton.hovered && !ls.startButton.enabled {
+				ls.networkClient.StartGame(true)
+			} else if !isHost && room != nil && ls.readyButton.hovered {
+				ls.networkClient.SetReady(!ready)
 			} else if ls.backButton.hovered {
 				ls.networkClient.LeaveRoom()
 				ls.inRoom = false
@@ -312,18 +668,12 @@ func (ls *LobbyScreen) Update(gr *GameRoom) error {
 		if inpututil.IsMouseButtonJustPressed(ebiten.MouseButtonLeft) {
 			for i, btn := range ls.roomButtons {
 				if btn.hovered {
-					rooms := ls.networkClient.GetRooms()
-					availableRooms := make([]RoomInfo, 0)
-					for _, room := range rooms {
-						if room.GameType == ls.selectedGame && !room.Started {
-							// For multi-player games, always show if not started
-							// For 2-player games, only show if not full
-							if room.MaxPlayers > 2 || room.Players < room.MaxPlayers {
-								availableRooms = append(availableRooms, room)
-							}
-						}
-					}
-					if i < len(availableRooms) {
+					availableRooms := ls.availableRooms()
+					if i < len(availableRooms) && availableRooms[i].Started {
+						log.Printf("Spectating room %s", availableRooms[i].ID)
+						ls.networkClient.Spectate(availableRooms[i].ID)
+						// The game screen opens when the server sends start_game
+					} else if i < len(availableRooms) {
 						log.Printf("Joining room %s", availableRooms[i].ID)
 						ls.networkClient.JoinRoom(availableRooms[i].ID)
 						// Don't set inRoom here - wait for the player_joined message
@@ -331,9 +681,7 @@ func (ls *LobbyScreen) Update(gr *GameRoom) error {
 				}
 			}
 			if ls.createRoomButton.hovered {
-				roomName := fmt.Sprintf("%s Room", ls.selectedGame)
-				ls.networkClient.CreateRoom(ls.selectedGame, roomName)
-				// Don't set inRoom here - wait for the room_created message
+				ls.openCreateRoom()
 			}
 			if ls.backButton.hovered {
 				ls.showingRooms = false
@@ -344,6 +692,9 @@ func (ls *LobbyScreen) Update(gr *GameRoom) error {
 		for _, btn := range ls.createButtons {
 			btn.hovered = btn.Contains(mx, my)
 		}
+		ls.replaysButton.hovered = ls.replaysButton.Contains(mx, my)
+		ls.leaderboardButton.hovered = ls.leaderboardButton.Contains(mx, my)
+		ls.joinCodeButton.hovered = ls.joinCodeButton.Contains(mx, my)
 
 		// Check if clicked on current avatar (to change it)
 		avatarX := float64(screenWidth) - 100
@@ -351,7 +702,7 @@ func (ls *LobbyScreen) Update(gr *GameRoom) error {
 		if mx >= int(avatarX) && mx <= int(avatarX)+50 && 
 		   my >= int(avatarY) && my <= int(avatarY)+50 {
 			if inpututil.IsMouseButtonJustPressed(ebiten.MouseButtonLeft) {
-				ls.showAvatarSelect = true
+				ls.ShowAvatarSelection()
 			}
 		}
 
@@ -364,43 +715,221 @@ func (ls *LobbyScreen) Update(gr *GameRoom) error {
 					ls.showRoomsForGame(games[i])
 				}
 			}
+			if ls.replaysButton.hovered {
+				gr.replayScreen = NewReplayScreen()
+			}
+			if ls.leaderboardButton.hovered {
+				gr.leaderboardScreen = NewLeaderboardScreen(ls.selectedGame)
+			}
+			if ls.joinCodeButton.hovered {
+				ls.openJoinCode("")
+			}
 		}
 	}
 
 	return nil
 }
 
+// The room we're in, from the latest room list
+func (ls *LobbyScreen) currentRoomInfo() *protocol.RoomInfo {
+	currentRoom := ls.networkClient.GetCurrentRoom()
+	for _, room := range ls.networkClient.GetRooms() {
+		if room.ID == currentRoom {
+			return &room
+		}
+	}
+	return nil
+}
+
+// Lay out the host's kick and make-host buttons next to each member, and
+// handle clicks on them and on the room settings
+func (ls *LobbyScreen) updateHostControls(room *protocol.RoomInfo, mx, my int) {
+	myID := ls.networkClient.GetPlayerID()
+	ls.kickButtons = make([]*Button, len(room.Members))
+	ls.makeHostButtons = make([]*Button, len(room.Members))
+	for i, member := range room.Members {
+		if member.ID == myID {
+			continue
+		}
+		y := float64(memberListY + i*memberRowHeight - 4)
+		ls.kickButtons[i] = &Button{x: 250, y: y, width: 50, height: 20, text: "KICK", enabled: true}
+		// Computer players can be removed but can't run the room
+		if member.Bot == "" {
+			ls.makeHostButtons[i] = &Button{x: 305, y: y, width: 50, height: 20, text: "HOST", enabled: true}
+		}
+	}
+
+	min, max := protocol.SeatLimits(room.GameType)
+	ls.fewerSeatsButton.enabled = room.MaxPlayers > min && room.MaxPlayers > room.Players
+	ls.moreSeatsButton.enabled = room.MaxPlayers < max
+	ls.lockButton.text = "LOCK ROOM"
+	if room.Locked {
+		ls.lockButton.text = "UNLOCK ROOM"
+	}
+
+	ls.botLevelButton.text = "COMPUTER: " + strings.ToUpper(ls.botLevel.String())
+	ls.addBotButton.enabled = room.Players < room.MaxPlayers
+
+	buttons := append([]*Button{ls.lockButton, ls.fewerSeatsButton, ls.moreSeatsButton, ls.botLevelButton, ls.addBotButton}, ls.kickButtons...)
+	buttons = append(buttons, ls.makeHostButtons...)
+	for _, btn := range buttons {
+		if btn != nil {
+			btn.hovered = btn.Contains(mx, my)
+		}
+	}
+
+	if !inpututil.IsMouseButtonJustPressed(ebiten.MouseButtonLeft) {
+		return
+	}
+	for i, member := range room.Members {
+		if ls.kickButtons[i] != nil && ls.kickButtons[i].hovered {
+			ls.networkClient.KickPlayer(member.ID)
+		}
+		if ls.makeHostButtons[i] != nil && ls.makeHostButtons[i].hovered {
+			ls.networkClient.TransferHost(member.ID)
+		}
+	}
+	if ls.lockButton.hovered {
+		ls.networkClient.SetRoomSettings(room.MaxPlayers, !room.Locked)
+	}
+	if ls.fewerSeatsButton.hovered && ls.fewerSeatsButton.enabled {
+		ls.networkClient.SetRoomSettings(room.MaxPlayers-1, room.Locked)
+	}
+	if ls.moreSeatsButton.hovered && ls.moreSeatsButton.enabled {
+		ls.networkClient.SetRoomSettings(room.MaxPlayers+1, room.Locked)
+	}
+	if protocol.HasComputerPlayers(room.GameType) {
+		if ls.botLevelButton.hovered {
+			ls.botLevel = (ls.botLevel + 1) % rules.Difficulty(len(rules.Difficulties))
+		}
+		if ls.addBotButton.hovered && ls.addBotButton.enabled {
+			ls.networkClient.AddBot(ls.botLevel)
+		}
+	}
+}
+
+func (ls *LobbyScreen) updateJoinCode(mx, my int) {
+	focusTextField(mx, my, ls.codeField, ls.joinPasswordField)
+	ls.codeField.Update()
+	ls.joinPasswordField.Update()
+	ls.joinButton.hovered = ls.joinButton.Contains(mx, my)
+	ls.backButton.hovered = ls.backButton.Contains(mx, my)
+
+	submit := inpututil.IsKeyJustPressed(ebiten.KeyEnter)
+	if inpututil.IsMouseButtonJustPressed(ebiten.MouseButtonLeft) {
+		if ls.backButton.hovered {
+			ls.showJoinCode = false
+			return
+		}
+		submit = submit || ls.joinButton.hovered
+	}
+
+	code := strings.TrimSpace(ls.codeField.Text())
+	if submit && code != "" {
+		ls.errorText = ""
+		ls.networkClient.JoinRoomByCode(code, ls.joinPasswordField.Text())
+		// Don't close the form here - wait for the player_joined message
+	}
+}
+
+func (ls *LobbyScreen) updateCreateRoom(mx, my int) {
+	if ls.createPrivate {
+		focusTextField(mx, my, ls.roomNameField, ls.createPasswordField)
+	} else {
+		focusTextField(mx, my, ls.roomNameField)
+	}
+	ls.roomNameField.Update()
+	ls.createPasswordField.Update()
+	ls.privateButton.hovered = ls.privateButton.Contains(mx, my)
+	ls.timeControlButton.hovered = ls.timeControlButton.Contains(mx, my)
+	ls.createButton.hovered = ls.createButton.Contains(mx, my)
+	ls.backButton.hovered = ls.backButton.Contains(mx, my)
+
+	submit := inpututil.IsKeyJustPressed(ebiten.KeyEnter)
+	if inpututil.IsMouseButtonJustPressed(ebiten.MouseButtonLeft) {
+		if ls.backButton.hovered {
+			ls.showCreateRoom = false
+			return
+		}
+		if ls.privateButton.hovered {
+			ls.createPrivate = !ls.createPrivate
+			ls.privateButton.text = "PUBLIC ROOM"
+			if ls.createPrivate {
+				ls.privateButton.text = "PRIVATE ROOM"
+			} else {
+				ls.createPasswordField.focused = false
+			}
+		}
+		if ls.timeControlButton.hovered {
+			ls.createTimeLimit = nextTimeControl(ls.selectedGame, ls.createTimeLimit)
+			ls.timeControlButton.text = strings.ToUpper(timeControlText(ls.selectedGame, ls.createTimeLimit))
+		}
+		submit = submit || ls.createButton.hovered
+	}
+
+	if submit {
+		password := ""
+		if ls.createPrivate {
+			password = ls.createPasswordField.Text()
+		}
+		ls.errorText = ""
+		ls.networkClient.CreateRoom(ls.selectedGame, ls.roomNameField.Text(), ls.createPrivate, password, ls.createTimeLimit)
+		// Don't close the form here - wait for the room_created message
+	}
+}
+
 func (ls *LobbyScreen) showRoomsForGame(gameType string) {
 	// Always show room list so players can choose which room to join
 	// or create a new one
 	ls.showingRooms = true
+	ls.errorText = ""
 }
 
-func (ls *LobbyScreen) getRoomDisplayText(room RoomInfo) string {
+func (ls *LobbyScreen) getRoomDisplayText(room protocol.RoomInfo) string {
+	// Games in progress can only be watched
+	if room.Started {
+		return fmt.Sprintf("%s (in progress, %d watching) - WATCH", room.Name, room.Watchers)
+	}
 	// For games that support many players, show range
 	if room.MaxPlayers > 2 {
 		if room.GameType == "yahtzee" || room.GameType == "memory" {
 			return fmt.Sprintf("%s (%d players, 1-%d)", room.Name, room.Players, room.MaxPlayers)
 		}
 	}
-	// For 2-player games, show traditional format
+	// For 2-player games, show traditional format, with who's waiting so
+	// players can find an opponent at their level
+	if len(room.Members) == 1 {
+		host := room.Members[0]
+		return fmt.Sprintf("%s (%d/%d) - %s", room.Name, room.Players, room.MaxPlayers, ratedName(host.Name, host.Rating))
+	}
 	return fmt.Sprintf("%s (%d/%d)", room.Name, room.Players, room.MaxPlayers)
 }
 
-func (ls *LobbyScreen) updateRoomButtons() {
+// Rooms for the selected game that can be joined, followed by games in
+// progress that can be watched
+func (ls *LobbyScreen) availableRooms() []protocol.RoomInfo {
 	rooms := ls.networkClient.GetRooms()
-	availableRooms := make([]RoomInfo, 0)
+	availableRooms := make([]protocol.RoomInfo, 0)
+	inProgress := make([]protocol.RoomInfo, 0)
 
 	for _, room := range rooms {
-		if room.GameType == ls.selectedGame && !room.Started {
-			// For multi-player games, always show if not started
-			// For 2-player games, only show if not full
-			if room.MaxPlayers > 2 || room.Players < room.MaxPlayers {
-				availableRooms = append(availableRooms, room)
-			}
+		if room.GameType != ls.selectedGame {
+			continue
+		}
+		if room.Started {
+			inProgress = append(inProgress, room)
+		} else if !room.Locked && room.Players < room.MaxPlayers {
+			// Only show rooms with a free seat that the host hasn't locked
+			availableRooms = append(availableRooms, room)
 		}
 	}
 
+	return append(availableRooms, inProgress...)
+}
+
+func (ls *LobbyScreen) updateRoomButtons() {
+	availableRooms := ls.availableRooms()
+
 	ls.roomButtons = make([]*Button, len(availableRooms))
 	buttonWidth := 400.0
 	buttonHeight := 60.0
@@ -425,6 +954,10 @@ func (ls *LobbyScreen) Draw(screen *ebiten.Image, gr *GameRoom) {
 
 	if ls.showAvatarSelect {
 		ls.drawAvatarSelection(screen)
+	} else if ls.showJoinCode {
+		ls.drawJoinCode(screen)
+	} else if ls.showCreateRoom {
+		ls.drawCreateRoom(screen)
 	} else if ls.inRoom {
 		ls.drawRoomWaiting(screen)
 	} else if ls.showingRooms {
@@ -468,15 +1001,21 @@ func (ls *LobbyScreen) drawGameSelection(screen *ebiten.Image) {
 	for _, btn := range ls.createButtons {
 		ls.drawButton(screen, btn)
 	}
+	ls.drawButton(screen, ls.replaysButton)
+	ls.drawButton(screen, ls.leaderboardButton)
+	ls.drawButton(screen, ls.joinCodeButton)
 
 	// Draw current avatar in bottom right
 	avatarX := float64(screenWidth) - 100
 	avatarY := float64(screenHeight) - 100
 	DrawAvatar(screen, ls.selectedAvatar, float32(avatarX), float32(avatarY), 1)
 	
-	// Draw "Click to change" text
+	// Draw who we're playing as and "Click to change" text
+	nameText := "Playing as " + ls.networkClient.GetIdentity().Name
+	textX := int(avatarX - float64(len(nameText)*3) + 25)
+	ebitenutil.DebugPrintAt(screen, nameText, textX, int(avatarY)-36)
 	changeText := "Click avatar to change"
-	textX := int(avatarX - float64(len(changeText)*3) + 25)
+	textX = int(avatarX - float64(len(changeText)*3) + 25)
 	ebitenutil.DebugPrintAt(screen, changeText, textX, int(avatarY)-20)
 }
 
@@ -502,6 +1041,11 @@ func (ls *LobbyScreen) drawRoomList(screen *ebiten.Image) {
 		}
 	}
 
+	// Why the last join didn't work, e.g. the room filled up
+	if ls.errorText != "" {
+		ebitenutil.DebugPrintAt(screen, ls.errorText, screenWidth/2-len(ls.errorText)*3, screenHeight-125)
+	}
+
 	// Create new room button
 	ls.drawButton(screen, ls.createRoomButton)
 
@@ -521,16 +1065,8 @@ func (ls *LobbyScreen) drawRoomWaiting(screen *ebiten.Image) {
 	ebitenutil.DebugPrintAt(screen, titleText, titleTextX+1, 32)
 
 	// Status
-	rooms := ls.networkClient.GetRooms()
-	currentRoom := ls.networkClient.GetCurrentRoom()
-
-	var roomInfo *RoomInfo
-	for _, room := range rooms {
-		if room.ID == currentRoom {
-			roomInfo = &room
-			break
-		}
-	}
+	roomInfo := ls.currentRoomInfo()
+	isHost := roomInfo != nil && roomInfo.Host == ls.networkClient.GetPlayerID()
 
 	statusY := 200
 	if roomInfo == nil {
@@ -544,17 +1080,30 @@ func (ls *LobbyScreen) drawRoomWaiting(screen *ebiten.Image) {
 	ebitenutil.DebugPrintAt(screen, statusText, screenWidth/2-len(statusText)*3, statusY)
 
 	playerText := fmt.Sprintf("Players: %d/%d", roomInfo.Players, roomInfo.MaxPlayers)
+	if roomInfo.Locked {
+		playerText += " - locked"
+	}
 	ebitenutil.DebugPrintAt(screen, playerText, screenWidth/2-len(playerText)*3, statusY+30)
 
-	// Check if we can start the game
-	canStart := false
-	if roomInfo.GameType == "yahtzee" || roomInfo.GameType == "memory" {
-		// Multi-player games can start with 1+ players
-		canStart = roomInfo.Players >= 1
-	} else {
-		// 2-player games need exactly 2 players
-		canStart = roomInfo.Players == roomInfo.MaxPlayers
+	// The room code, for inviting people in
+	codeText := fmt.Sprintf("Room code: %s", roomInfo.Code)
+	if roomInfo.Private {
+		codeText += " (private)"
+	}
+	ebitenutil.DebugPrintAt(screen, codeText, screenWidth/2-len(codeText)*3, statusY+50)
+	if roomInfo.TimeLimit > 0 {
+		timeText := "Time control: " + timeControlText(roomInfo.GameType, roomInfo.TimeLimit)
+		ebitenutil.DebugPrintAt(screen, timeText, screenWidth/2-len(timeText)*3, statusY+65)
 	}
+	if link := inviteLink(roomInfo.Code); link != "" {
+		linkText := "Invite link: " + link
+		ebitenutil.DebugPrintAt(screen, linkText, screenWidth/2-len(linkText)*3, 530)
+	}
+
+	// Check if we can start the game: multi-player games can start with
+	// 1+ players, 2-player games need exactly 2
+	minPlayers, _ := protocol.SeatLimits(roomInfo.GameType)
+	canStart := roomInfo.Players >= minPlayers
 	
 	if !canStart {
 		// Only show waiting message for 2-player games
@@ -571,11 +1120,57 @@ func (ls *LobbyScreen) drawRoomWaiting(screen *ebiten.Image) {
 		} else {
 			readyText = "Ready to start!"
 		}
+		if isHost && !roomInfo.EveryoneReady() {
+			readyText = "Waiting for everyone to be ready..."
+		} else if !isHost && roomInfo.IsReady(ls.networkClient.GetPlayerID()) {
+			readyText = "Waiting for the host to start the game..."
+		} else if !isHost {
+			readyText = "Click READY when you're ready to play"
+		}
 		ebitenutil.DebugPrintAt(screen, readyText, screenWidth/2-len(readyText)*3, statusY+80)
-		ls.drawButton(screen, ls.startButton)
+		if isHost {
+			ls.drawButton(screen, ls.startButton)
+			if !roomInfo.EveryoneReady() {
+				ls.drawButton(screen, ls.startAnywayButton)
+			}
+		} else {
+			ls.drawButton(screen, ls.readyButton)
+		}
 	} else {
-		startingText := "Starting game..."
-		ebitenutil.DebugPrintAt(screen, startingText, screenWidth/2-len(startingText)*3, statusY+80)
+		ls.drawCountdown(screen)
+		// Backing out stops the countdown
+		if !isHost {
+			ls.drawButton(screen, ls.readyButton)
+		}
+	}
+
+	// Everyone in the room, with their ratings, and the host's controls
+	ebitenutil.DebugPrintAt(screen, "PLAYERS", 40, 150)
+	for i, member := range roomInfo.Members {
+		memberText := ratedName(member.Name, member.Rating)
+		if member.ID == roomInfo.Host {
+			memberText += " [host]"
+		} else if member.Ready {
+			memberText += " - ready"
+		}
+		ebitenutil.DebugPrintAt(screen, memberText, 40, memberListY+i*memberRowHeight)
+		if isHost && i < len(ls.kickButtons) && ls.kickButtons[i] != nil {
+			ls.drawButton(screen, ls.kickButtons[i])
+			if ls.makeHostButtons[i] != nil {
+				ls.drawButton(screen, ls.makeHostButtons[i])
+			}
+		}
+	}
+	if isHost {
+		seatsText := fmt.Sprintf("Seats: %d", roomInfo.MaxPlayers)
+		ebitenutil.DebugPrintAt(screen, seatsText, screenWidth-140-len(seatsText)*3, 168)
+		ls.drawButton(screen, ls.fewerSeatsButton)
+		ls.drawButton(screen, ls.moreSeatsButton)
+		ls.drawButton(screen, ls.lockButton)
+		if protocol.HasComputerPlayers(roomInfo.GameType) {
+			ls.drawButton(screen, ls.botLevelButton)
+			ls.drawButton(screen, ls.addBotButton)
+		}
 	}
 
 	// Player ID
@@ -589,6 +1184,74 @@ func (ls *LobbyScreen) drawRoomWaiting(screen *ebiten.Image) {
 	ls.drawButton(screen, ls.backButton)
 }
 
+// The seconds left before the game starts, the same on every client in
+// the room
+func (ls *LobbyScreen) drawCountdown(screen *ebiten.Image) {
+	boxWidth := float32(240)
+	boxX := float32(screenWidth/2) - boxWidth/2
+	vector.DrawFilledRect(screen, boxX, 300, boxWidth, 60, color.RGBA{30, 50, 80, 255}, false)
+	vector.StrokeRect(screen, boxX, 300, boxWidth, 60, 2, color.RGBA{150, 200, 255, 255}, false)
+
+	countdownText := "Starting game..."
+	if ls.countdown > 0 {
+		countdownText = fmt.Sprintf("GAME STARTS IN %d", ls.countdown)
+	}
+	ebitenutil.DebugPrintAt(screen, countdownText, screenWidth/2-len(countdownText)*3, 324)
+	ebitenutil.DebugPrintAt(screen, countdownText, screenWidth/2-len(countdownText)*3+1, 324)
+}
+
+func (ls *LobbyScreen) drawCreateRoom(screen *ebiten.Image) {
+	// Title
+	titleWidth := float32(400)
+	titleX := float32(screenWidth/2) - titleWidth/2
+	vector.DrawFilledRect(screen, titleX, 15, titleWidth, 45, color.RGBA{30, 50, 80, 255}, false)
+	vector.StrokeRect(screen, titleX, 15, titleWidth, 45, 2, color.RGBA{100, 150, 220, 255}, false)
+	titleText := "CREATE " + gameTitle(ls.selectedGame) + " ROOM"
+	titleTextX := int(titleX + (titleWidth-float32(len(titleText)*6))/2)
+	ebitenutil.DebugPrintAt(screen, titleText, titleTextX, 32)
+	ebitenutil.DebugPrintAt(screen, titleText, titleTextX+1, 32)
+
+	DrawTextField(screen, ls.roomNameField)
+	ls.drawButton(screen, ls.privateButton)
+	if ls.createPrivate {
+		DrawTextField(screen, ls.createPasswordField)
+		infoText := "Private rooms aren't listed - share the room code to invite people"
+		ebitenutil.DebugPrintAt(screen, infoText, screenWidth/2-len(infoText)*3, 485)
+	}
+	ls.drawButton(screen, ls.timeControlButton)
+	ls.drawButton(screen, ls.createButton)
+
+	if ls.errorText != "" {
+		ebitenutil.DebugPrintAt(screen, ls.errorText, screenWidth/2-len(ls.errorText)*3, 510)
+	}
+
+	// Back button
+	ls.drawButton(screen, ls.backButton)
+}
+
+func (ls *LobbyScreen) drawJoinCode(screen *ebiten.Image) {
+	// Title
+	titleWidth := float32(400)
+	titleX := float32(screenWidth/2) - titleWidth/2
+	vector.DrawFilledRect(screen, titleX, 15, titleWidth, 45, color.RGBA{30, 50, 80, 255}, false)
+	vector.StrokeRect(screen, titleX, 15, titleWidth, 45, 2, color.RGBA{100, 150, 220, 255}, false)
+	titleText := "JOIN BY CODE"
+	titleTextX := int(titleX + (titleWidth-float32(len(titleText)*6))/2)
+	ebitenutil.DebugPrintAt(screen, titleText, titleTextX, 32)
+	ebitenutil.DebugPrintAt(screen, titleText, titleTextX+1, 32)
+
+	DrawTextField(screen, ls.codeField)
+	DrawTextField(screen, ls.joinPasswordField)
+	ls.drawButton(screen, ls.joinButton)
+
+	if ls.errorText != "" {
+		ebitenutil.DebugPrintAt(screen, ls.errorText, screenWidth/2-len(ls.errorText)*3, 380)
+	}
+
+	// Back button
+	ls.drawButton(screen, ls.backButton)
+}
+
 func (ls *LobbyScreen) drawButton(screen *ebiten.Image, btn *Button) {
 	bgColor := color.RGBA{30, 50, 80, 255}
 	borderColor := color.RGBA{100, 150, 220, 255}
@@ -631,10 +1294,13 @@ func (ls *LobbyScreen) drawAvatarSelection(screen *ebiten.Image) {
 	ebitenutil.DebugPrintAt(screen, titleText, titleTextX, 32)
 	ebitenutil.DebugPrintAt(screen, titleText, titleTextX+1, 32)
 
+	// Name field - the name other players see, separate from the avatar
+	DrawTextField(screen, ls.nameField)
+
 	// Info text
 	infoText := "Choose your avatar:"
 	infoX := screenWidth/2 - len(infoText)*3
-	ebitenutil.DebugPrintAt(screen, infoText, infoX, 80)
+	ebitenutil.DebugPrintAt(screen, infoText, infoX, 150)
 
 	// Draw avatar options
 	for i := 0; i < int(AvatarNumTypes); i++ {
@@ -0,0 +1,266 @@
+package main
+
+import (
+	"fmt"
+	"image/color"
+	"log"
+	"strings"
+
+	"github.com/hajimehoshi/ebiten/v2"
+	"github.com/hajimehoshi/ebiten/v2/ebitenutil"
+	"github.com/hajimehoshi/ebiten/v2/inpututil"
+	"github.com/hajimehoshi/ebiten/v2/vector"
+
+	"olive_and_millies_game_room/protocol"
+	"olive_and_millies_game_room/rules"
+)
+
+// The most seats a game on one device can have, as many as fit on the
+// setup screen
+const localMaxSeats = 8
+
+const (
+	localSeatsY     = 190 // Top of the first seat's row
+	localSeatHeight = 55
+)
+
+var localGames = []string{"yahtzee", "santorini", "connect_four", "memory"}
+
+// LocalSetupScreen sets up a game played on this device with no server:
+// which game, how many seats, and each seat's name, avatar and whether a
+// person or the computer plays it. People take turns at the same screen.
+type LocalSetupScreen struct {
+	gameButtons []*Button
+	fewerButton *Button
+	moreButton  *Button
+	startButton *Button
+	backButton  *Button
+	selected    int // Index into localGames
+	numSeats    int
+	seats       []*localSeat // Always localMaxSeats, the first numSeats of them in use
+}
+
+// One seat on the setup screen
+type localSeat struct {
+	nameField  *TextField
+	avatar     AvatarType
+	computer   bool
+	level      rules.Difficulty // How well the computer plays the seat
+	prevAvatar *Button
+	nextAvatar *Button
+	kindButton *Button // Cycles between a person and each computer level
+}
+
+func NewLocalSetupScreen() *LocalSetupScreen {
+	ls := &LocalSetupScreen{
+		fewerButton: &Button{x: float64(screenWidth/2) + 50, y: 136, width: 30, height: 30, text: "-", enabled: true},
+		moreButton:  &Button{x: float64(screenWidth/2) + 90, y: 136, width: 30, height: 30, text: "+", enabled: true},
+		startButton: &Button{x: float64(screenWidth - 170), y: float64(screenHeight - 70), width: 150, height: 50, text: "START", enabled: true},
+		backButton:  &Button{x: 20, y: float64(screenHeight - 70), width: 150, height: 50, text: "BACK", enabled: true},
+		numSeats:    2,
+	}
+
+	buttonWidth := 200.0
+	startX := float64(screenWidth)/2 - (buttonWidth*4+30)/2
+	for i, game := range localGames {
+		ls.gameButtons = append(ls.gameButtons, &Button{
+			x:       startX + float64(i)*(buttonWidth+10),
+			y:       80,
+			width:   buttonWidth,
+			height:  40,
+			text:    gameTitle(game),
+			enabled: true,
+		})
+	}
+
+	rowX := float64(screenWidth/2) - 300
+	for i := 0; i < localMaxSeats; i++ {
+		y := float64(localSeatsY + i*localSeatHeight)
+		seat := &localSeat{
+			nameField: &TextField{
+				x:         rowX + 130,
+				y:         y + 13,
+				width:     250,
+				maxLength: protocol.MaxNameLength,
+			},
+			avatar:     AvatarType(i % int(AvatarNumTypes)),
+			prevAvatar: &Button{x: rowX, y: y + 10, width: 30, height: 30, text: "<", enabled: true},
+			nextAvatar: &Button{x: rowX + 90, y: y + 10, width: 30, height: 30, text: ">", enabled: true},
+			kindButton: &Button{x: rowX + 400, y: y + 10, width: 200, height: 30, enabled: true},
+		}
+		seat.nameField.SetText(defaultSeatName(i, seat))
+		ls.seats = append(ls.seats, seat)
+	}
+	ls.seats[0].nameField.focused = true
+	return ls
+}
+
+// What a seat is called until someone types a name in: the computer's
+// name if it plays the seat, otherwise "Player" and the seat's number
+func defaultSeatName(i int, seat *localSeat) string {
+	if seat.computer {
+		return seat.level.ComputerName()
+	}
+	return fmt.Sprintf("Player %d", i+1)
+}
+
+func (ls *LocalSetupScreen) Update(gr *GameRoom) error {
+	mx, my := ebiten.CursorPosition()
+	clicked := inpututil.IsMouseButtonJustPressed(ebiten.MouseButtonLeft)
+
+	if IsLogoClicked() {
+		gr.localSetup = nil
+		gr.ReturnHome()
+		return nil
+	}
+
+	seats := ls.seats[:ls.numSeats]
+	fields := make([]*TextField, len(seats))
+	for i, seat := range seats {
+		fields[i] = seat.nameField
+	}
+	focusTextField(mx, my, fields...)
+	for _, field := range fields {
+		field.Update()
+	}
+
+	minSeats, maxSeats := ls.seatLimits()
+	ls.fewerButton.enabled = ls.numSeats > minSeats
+	ls.moreButton.enabled = ls.numSeats < maxSeats
+	buttons := []*Button{ls.fewerButton, ls.moreButton, ls.startButton, ls.backButton}
+	buttons = append(buttons, ls.gameButtons...)
+	for _, seat := range seats {
+		buttons = append(buttons, seat.prevAvatar, seat.nextAvatar, seat.kindButton)
+	}
+	for _, btn := range buttons {
+		btn.hovered = btn.Contains(mx, my)
+	}
+
+	if !clicked {
+		return nil
+	}
+	switch {
+	case ls.backButton.hovered:
+		gr.localSetup = nil
+		gr.ReturnHome()
+		return nil
+	case ls.startButton.hovered:
+		ls.start(gr)
+		return nil
+	case ls.fewerButton.hovered && ls.fewerButton.enabled:
+		ls.numSeats--
+	case ls.moreButton.hovered && ls.moreButton.enabled:
+		ls.numSeats++
+	}
+	for i, btn := range ls.gameButtons {
+		if btn.hovered {
+			ls.selected = i
+			minSeats, maxSeats := ls.seatLimits()
+			ls.numSeats = max(minSeats, min(ls.numSeats, maxSeats))
+		}
+	}
+	for i, seat := range seats {
+		switch {
+		case seat.prevAvatar.hovered:
+			seat.avatar = (seat.avatar + AvatarNumTypes - 1) % AvatarNumTypes
+		case seat.nextAvatar.hovered:
+			seat.avatar = (seat.avatar + 1) % AvatarNumTypes
+		case seat.kindButton.hovered:
+			// A seat that hasn't been renamed takes the new default name
+			renamed := seat.nameField.Text() != defaultSeatName(i, seat)
+			switch {
+			case !seat.computer:
+				seat.computer, seat.level = true, rules.Difficulties[0]
+			case int(seat.level) < len(rules.Difficulties)-1:
+				seat.level++
+			default:
+				seat.computer = false
+			}
+			if !renamed {
+				seat.nameField.SetText(defaultSeatName(i, seat))
+			}
+		}
+	}
+	return nil
+}
+
+// The fewest and most seats the selected game can have on one device
+func (ls *LocalSetupScreen) seatLimits() (int, int) {
+	minSeats, maxSeats := protocol.SeatLimits(localGames[ls.selected])
+	return minSeats, min(maxSeats, localMaxSeats)
+}
+
+// Start the selected game with the seats as they're set up
+func (ls *LocalSetupScreen) start(gr *GameRoom) {
+	players := make([]protocol.PlayerInfo, ls.numSeats)
+	for i, seat := range ls.seats[:ls.numSeats] {
+		name := strings.TrimSpace(seat.nameField.Text())
+		if name == "" {
+			name = defaultSeatName(i, seat)
+		}
+		players[i] = protocol.PlayerInfo{Name: name, Avatar: int(seat.avatar)}
+		if seat.computer {
+			players[i].Bot = seat.level.String()
+		}
+	}
+
+	gameType := localGames[ls.selected]
+	log.Printf("Playing %s on this device with %d seats", gameType, len(players))
+	var game GameInterface
+	switch gameType {
+	case "yahtzee":
+		game = NewYahtzeeGameWithPlayers(nil, 0, players)
+	case "santorini":
+		game = NewSantoriniGameWithPlayers(nil, 0, players)
+	case "connect_four":
+		game = NewConnectFourGameWithPlayers(nil, 0, players)
+	case "memory":
+		game = NewMemoryGameWithPlayers(nil, 0, players, nil)
+	}
+	gr.localSetup = nil
+	gr.SwitchToGame(game)
+}
+
+func (ls *LocalSetupScreen) Draw(screen *ebiten.Image, gr *GameRoom) {
+	DrawForestBackground(screen)
+	DrawKodamaSpirits(screen)
+	DrawOMLogo(screen)
+
+	titleWidth := float32(400)
+	titleX := float32(screenWidth/2) - titleWidth/2
+	vector.DrawFilledRect(screen, titleX, 15, titleWidth, 45, color.RGBA{30, 50, 80, 255}, false)
+	vector.StrokeRect(screen, titleX, 15, titleWidth, 45, 2, color.RGBA{100, 150, 220, 255}, false)
+	titleText := "PLAY ON THIS DEVICE"
+	titleTextX := int(titleX + (titleWidth-float32(len(titleText)*6))/2)
+	ebitenutil.DebugPrintAt(screen, titleText, titleTextX, 32)
+	ebitenutil.DebugPrintAt(screen, titleText, titleTextX+1, 32)
+
+	for i, btn := range ls.gameButtons {
+		btn.enabled = i != ls.selected // Grey out the game we're setting up
+		DrawButton(screen, btn)
+	}
+
+	seatsText := fmt.Sprintf("Seats: %d", ls.numSeats)
+	ebitenutil.DebugPrintAt(screen, seatsText, screenWidth/2-len(seatsText)*6, 145)
+	DrawButton(screen, ls.fewerButton)
+	DrawButton(screen, ls.moreButton)
+
+	// A row per seat: avatar, name, and who plays it
+	for _, seat := range ls.seats[:ls.numSeats] {
+		DrawButton(screen, seat.prevAvatar)
+		DrawAvatar(screen, seat.avatar, float32(seat.prevAvatar.x+37), float32(seat.prevAvatar.y-2), 0.7)
+		DrawButton(screen, seat.nextAvatar)
+		DrawTextField(screen, seat.nameField)
+		seat.kindButton.text = "PERSON"
+		if seat.computer {
+			seat.kindButton.text = "COMPUTER: " + strings.ToUpper(seat.level.String())
+		}
+		DrawButton(screen, seat.kindButton)
+	}
+
+	hint := "Click a name to change it. Everyone takes turns at this screen."
+	ebitenutil.DebugPrintAt(screen, hint, screenWidth/2-len(hint)*3, localSeatsY+localMaxSeats*localSeatHeight+10)
+
+	DrawButton(screen, ls.backButton)
+	DrawButton(screen, ls.startButton)
+}
@@ -1,12 +1,19 @@
 package main
 
 import (
-	"encoding/json"
+	"encoding/hex"
 	"fmt"
+	"image/color"
 	"log"
 	"time"
 
 	"github.com/hajimehoshi/ebiten/v2"
+	"github.com/hajimehoshi/ebiten/v2/ebitenutil"
+	"github.com/hajimehoshi/ebiten/v2/vector"
+
+	"olive_and_millies_game_room/protocol"
+	"olive_and_millies_game_room/rules"
+	"olive_and_millies_game_room/rules/memory"
 )
 
 const (
@@ -22,12 +29,16 @@ const (
 	StateConnecting ConnectionState = iota
 	StateConnected
 	StateFailed
+	StateOutdated // The server needs a newer version of the game
 )
 
 type GameRoom struct {
 	currentGame            GameInterface
 	homeScreen             *HomeScreen
 	lobbyScreen            *LobbyScreen
+	replayScreen           *ReplayScreen      // Shown over the lobby while watching replays
+	leaderboardScreen      *LeaderboardScreen // Shown over the lobby
+	localSetup             *LocalSetupScreen  // Shown over the home screen while setting up a game on this device
 	introScreen            *IntroScreen
 	networkClient          *NetworkClient
 	isOnlineMode           bool
@@ -38,6 +49,13 @@ type GameRoom struct {
 	updateURL              string
 	connectionState        ConnectionState
 	connectionError        string
+	spectatorChat          *ChatBox      // Set while we're watching someone else's game
+	seedCommitment         string        // The server's commitment to this game's seed
+	fairnessText           string        // Result of checking the seed once the game ends
+	mySeat                 int           // Our seat in the online game, -1 when watching
+	ratingText             string        // Our new rating once a rated game ends
+	rematch                *RematchPanel // Set once the online game is over
+	turnTimer              *TurnTimer    // The online game's time control
 }
 
 func (gr *GameRoom) Update() error {
@@ -48,17 +66,38 @@ func (gr *GameRoom) Update() error {
 	if !gr.introComplete && gr.introScreen != nil {
 		return gr.introScreen.Update(gr)
 	}
+	// The server won't play with this version of the game
+	if gr.networkClient != nil {
+		if reason := gr.networkClient.Outdated(); reason != "" {
+			gr.showOutdated(reason)
+		}
+	}
 	// Check if we need to show avatar select after intro
 	if gr.needsAvatarSelectShow && gr.lobbyScreen != nil {
 		gr.lobbyScreen.ShowAvatarSelection()
 		gr.needsAvatarSelectShow = false
 	}
+	if gr.isOnlineMode && gr.replayScreen != nil {
+		return gr.replayScreen.Update(gr)
+	}
+	if gr.isOnlineMode && gr.leaderboardScreen != nil {
+		return gr.leaderboardScreen.Update(gr)
+	}
 	if gr.isOnlineMode && gr.lobbyScreen != nil {
 		return gr.lobbyScreen.Update(gr)
 	}
 	if gr.currentGame != nil {
+		if gr.spectatorChat != nil {
+			gr.spectatorChat.Update()
+		}
+		if gr.rematch != nil {
+			gr.rematch.Update()
+		}
 		return gr.currentGame.Update(gr)
 	}
+	if gr.localSetup != nil {
+		return gr.localSetup.Update(gr)
+	}
 	return gr.homeScreen.Update(gr)
 }
 
@@ -68,13 +107,103 @@ func (gr *GameRoom) Draw(screen *ebiten.Image) {
 		gr.introScreen.Draw(screen)
 		return
 	}
-	if gr.isOnlineMode && gr.lobbyScreen != nil {
+	if gr.isOnlineMode && gr.replayScreen != nil {
+		gr.replayScreen.Draw(screen, gr)
+	} else if gr.isOnlineMode && gr.leaderboardScreen != nil {
+		gr.leaderboardScreen.Draw(screen, gr)
+	} else if gr.isOnlineMode && gr.lobbyScreen != nil {
 		gr.lobbyScreen.Draw(screen, gr)
 	} else if gr.currentGame != nil {
 		gr.currentGame.Draw(screen, gr)
+		if gr.spectatorChat != nil {
+			gr.spectatorChat.Draw(screen)
+			gr.drawSpectating(screen)
+		}
+		if gr.fairnessText != "" {
+			ebitenutil.DebugPrintAt(screen, gr.fairnessText, 20, screenHeight-20)
+		}
+		if gr.ratingText != "" {
+			ebitenutil.DebugPrintAt(screen, gr.ratingText, 20, screenHeight-36)
+		}
+		if gr.rematch != nil {
+			gr.rematch.Draw(screen)
+		}
+	} else if gr.localSetup != nil {
+		gr.localSetup.Draw(screen, gr)
 	} else {
 		gr.homeScreen.Draw(screen, gr)
 	}
+
+	if gr.networkClient != nil && gr.networkClient.IsReconnecting() {
+		gr.drawReconnecting(screen)
+	} else if gr.networkClient != nil && gr.networkClient.IsConnected() {
+		gr.drawConnectionQuality(screen)
+	}
+}
+
+// Remind spectators they're only watching
+func (gr *GameRoom) drawSpectating(screen *ebiten.Image) {
+	msgWidth := float32(300)
+	msgHeight := float32(30)
+	msgX := float32(screenWidth)/2 - msgWidth/2
+	msgY := float32(screenHeight - 40)
+
+	vector.DrawFilledRect(screen, msgX, msgY, msgWidth, msgHeight, color.RGBA{30, 50, 80, 220}, false)
+	vector.StrokeRect(screen, msgX, msgY, msgWidth, msgHeight, 2, color.RGBA{100, 150, 220, 255}, false)
+
+	message := "Spectating - click the logo to leave"
+	textX := int(msgX + (msgWidth-float32(len(message)*6))/2)
+	textY := int(msgY + msgHeight/2 - 4)
+	ebitenutil.DebugPrintAt(screen, message, textX, textY)
+}
+
+// Let the player know we lost the server and are trying to get back in
+func (gr *GameRoom) drawReconnecting(screen *ebiten.Image) {
+	msgWidth := float32(300)
+	msgHeight := float32(30)
+	msgX := float32(screenWidth)/2 - msgWidth/2
+	msgY := float32(screenHeight - 40)
+
+	vector.DrawFilledRect(screen, msgX, msgY, msgWidth, msgHeight, color.RGBA{80, 40, 40, 220}, false)
+	vector.StrokeRect(screen, msgX, msgY, msgWidth, msgHeight, 2, color.RGBA{160, 80, 80, 255}, false)
+
+	message := "Connection lost - reconnecting..."
+	textX := int(msgX + (msgWidth-float32(len(message)*6))/2)
+	textY := int(msgY + msgHeight/2 - 4)
+	ebitenutil.DebugPrintAt(screen, message, textX, textY)
+}
+
+// Show how quick our connection to the server is, as signal bars and the
+// round trip time in the top right corner
+func (gr *GameRoom) drawConnectionQuality(screen *ebiten.Image) {
+	rtt := gr.networkClient.RTT()
+	if rtt == 0 {
+		return
+	}
+
+	bars := 1
+	barColor := color.RGBA{220, 80, 80, 255}
+	if rtt < 100*time.Millisecond {
+		bars = 3
+		barColor = color.RGBA{120, 200, 120, 255}
+	} else if rtt < 250*time.Millisecond {
+		bars = 2
+		barColor = color.RGBA{230, 190, 80, 255}
+	}
+
+	x := float32(screenWidth - 90)
+	y := float32(6)
+	vector.DrawFilledRect(screen, x, y, 84, 18, color.RGBA{30, 50, 80, 200}, false)
+	for i := 0; i < 3; i++ {
+		barHeight := float32(4 + i*4)
+		fill := color.RGBA{80, 80, 90, 255}
+		if i < bars {
+			fill = barColor
+		}
+		vector.DrawFilledRect(screen, x+6+float32(i)*5, y+15-barHeight, 3, barHeight, fill, false)
+	}
+	rttText := fmt.Sprintf("%d ms", rtt.Milliseconds())
+	ebitenutil.DebugPrintAt(screen, rttText, int(x)+26, int(y)+1)
 }
 
 func (gr *GameRoom) Layout(outsideWidth, outsideHeight int) (int, int) {
@@ -87,6 +216,11 @@ func (gr *GameRoom) SwitchToGame(game GameInterface) {
 
 func (gr *GameRoom) ReturnHome() {
 	gr.currentGame = nil
+	gr.spectatorChat = nil
+	gr.fairnessText = ""
+	gr.ratingText = ""
+	gr.rematch = nil
+	gr.turnTimer = nil
 	// Return to lobby if we have a network client
 	if gr.networkClient != nil && gr.networkClient.IsConnected() {
 		gr.isOnlineMode = true
@@ -103,6 +237,30 @@ func (gr *GameRoom) ReturnHome() {
 	}
 }
 
+// Go back to the home screen to ask the player to update, after the server
+// turned this version of the game away
+func (gr *GameRoom) showOutdated(reason string) {
+	log.Println("Server asked us to update:", reason)
+	gr.networkClient.Close()
+	gr.networkClient = nil
+	gr.currentGame = nil
+	gr.isOnlineMode = false
+	gr.connectionState = StateOutdated
+	gr.connectionError = reason
+}
+
+// Go back to the waiting room of the room we're still in, e.g. when someone
+// leaves after the game instead of playing a rematch
+func (gr *GameRoom) ReturnToRoom() {
+	gr.currentGame = nil
+	gr.spectatorChat = nil
+	gr.fairnessText = ""
+	gr.ratingText = ""
+	gr.rematch = nil
+	gr.turnTimer = nil
+	gr.isOnlineMode = true
+}
+
 func (gr *GameRoom) SwitchToOnline() {
 	gr.isOnlineMode = true
 }
@@ -132,28 +290,42 @@ func (gr *GameRoom) TryGoOnline() {
 		gr.connectionState = StateConnected
 		gr.networkClient = networkClient
 		gr.lobbyScreen = NewLobbyScreen(networkClient)
-		gr.isOnlineMode = true
-		// Send initial avatar selection
-		networkClient.SetAvatar(0) // Default Human avatar
+		// Someone playing offline, or setting up a game on this device,
+		// sees the lobby once they go back home
+		gr.isOnlineMode = gr.currentGame == nil && gr.localSetup == nil
 
 		// Register handlers
-		networkClient.RegisterHandler(MsgStartGame, func(msg Message) {
+		networkClient.RegisterHandler(protocol.MsgStartGame, func(msg protocol.Message) {
 			log.Printf("Starting game: %s\n", msg.GameType)
 
 			// Get player number and game info from server
-			var data struct {
-				PlayerNumber int                      `json:"player_number"`
-				TotalPlayers int                      `json:"total_players"`
-				Players      []map[string]interface{} `json:"players"`
-			}
+			var data protocol.StartGame
 			playerNum := 0
 			totalPlayers := 2
-			if err := json.Unmarshal(msg.Data, &data); err == nil {
+			if err := msg.Decode(&data); err == nil {
 				playerNum = data.PlayerNumber
 				totalPlayers = data.TotalPlayers
 			}
 			log.Printf("I am player number: %d (total players: %d)\n", playerNum, totalPlayers)
 
+			// Spectators get the same game with no seat, so it never
+			// becomes their turn
+			gr.seedCommitment = data.SeedCommitment
+			gr.fairnessText = ""
+			gr.ratingText = ""
+			gr.mySeat = playerNum // -1 for spectators
+			gr.spectatorChat = nil
+			gr.rematch = nil
+			gr.lobbyScreen.waitingForGame = false
+			gr.lobbyScreen.countdown = 0
+			if data.Spectator {
+				log.Println("Spectating game in progress")
+				networkClient.mu.Lock()
+				networkClient.currentRoom = msg.RoomID
+				networkClient.mu.Unlock()
+				gr.spectatorChat = NewChatBox(networkClient)
+			}
+
 			// Switch to the appropriate game with network support
 			switch msg.GameType {
 			case "yahtzee":
@@ -163,12 +335,120 @@ func (gr *GameRoom) TryGoOnline() {
 			case "connect_four":
 				gr.SwitchToGame(NewConnectFourGameWithPlayers(networkClient, playerNum, data.Players))
 			case "memory":
-				gr.SwitchToGame(NewMemoryGameWithPlayers(networkClient, playerNum, data.Players))
+				gr.SwitchToGame(NewMemoryGameWithPlayers(networkClient, playerNum, data.Players, memory.Hidden(data.Cards)))
+			}
+			gr.turnTimer = NewTurnTimer()
+			if timed, ok := gr.currentGame.(TimedGame); ok {
+				timed.SetTurnTimer(gr.turnTimer)
 			}
 			gr.isOnlineMode = false
 		})
 
-		networkClient.RegisterHandler("game_ended", func(msg Message) {
+		// After a dropped connection the server either resumes our session,
+		// and resyncs us itself, or starts us over in the lobby. Either way
+		// it remembers our account's avatar. Only a seat in an online room
+		// is lost with the session; a game on this device carries on.
+		networkClient.RegisterHandler(protocol.MsgConnected, func(msg protocol.Message) {
+			var data protocol.Connected
+			msg.Decode(&data)
+			gr.lobbyScreen.selectedAvatar = AvatarType(data.Avatar)
+			if data.Resumed || networkClient.LostRoom() == "" {
+				return
+			}
+			log.Println("Session expired - returning to lobby")
+			gr.ReturnHome()
+		})
+
+		// Once the game is over the server reveals the seed behind its dice
+		// and shuffles, which we check against the commitment it made at
+		// the start
+		networkClient.RegisterHandler(protocol.MsgSeedReveal, func(msg protocol.Message) {
+			var data protocol.SeedReveal
+			if err := msg.Decode(&data); err != nil {
+				return
+			}
+			seed, err := hex.DecodeString(data.Seed)
+			fair := err == nil && rules.Commit(seed) == gr.seedCommitment
+			if verifier, ok := gr.currentGame.(SeedVerifier); ok && fair {
+				fair = verifier.VerifySeed(seed, data)
+			}
+			if fair {
+				gr.fairnessText = "Fair play verified against the server's sealed seed"
+			} else {
+				gr.fairnessText = "WARNING: the server's seed didn't match its commitment"
+			}
+			log.Println(gr.fairnessText)
+		})
+
+		networkClient.RegisterHandler(protocol.MsgRatingUpdate, func(msg protocol.Message) {
+			var data protocol.RatingUpdate
+			if err := msg.Decode(&data); err != nil {
+				return
+			}
+			ratings := make([]int, len(data.Ratings))
+			for i, r := range data.Ratings {
+				ratings[i] = r.Rating
+			}
+			if rated, ok := gr.currentGame.(RatedGame); ok {
+				rated.SetRatings(ratings)
+			}
+			if seat := gr.mySeat; seat >= 0 && seat < len(data.Ratings) {
+				gr.ratingText = fmt.Sprintf("Rating: %d (%+d)", data.Ratings[seat].Rating, data.Ratings[seat].Change)
+			}
+		})
+
+		// Once the game is over the server tells us who wants a rematch and
+		// the series so far. If someone leaves instead, the rest of us go
+		// back to the room to wait for the next game.
+		networkClient.RegisterHandler(protocol.MsgRematch, func(msg protocol.Message) {
+			var data protocol.RematchStatus
+			if err := msg.Decode(&data); err != nil || gr.currentGame == nil {
+				return
+			}
+			if data.Cancelled {
+				if gr.mySeat >= 0 {
+					log.Println("Rematch called off - back to the room")
+					gr.ReturnToRoom()
+				}
+				return
+			}
+			if gr.rematch == nil {
+				gr.rematch = NewRematchPanel(networkClient, gr.mySeat >= 0)
+			}
+			gr.rematch.SetStatus(data.Accepted, data.Series, data.Games)
+		})
+
+		// Going quiet in a room for too long gets us moved out of it, even
+		// in the middle of a game
+		networkClient.RegisterHandler(protocol.MsgIdleTimeout, func(msg protocol.Message) {
+			log.Println("Moved out of the room for being idle")
+			networkClient.mu.Lock()
+			networkClient.currentRoom = ""
+			networkClient.mu.Unlock()
+			gr.ReturnHome()
+			gr.lobbyScreen.showingRooms = true
+			gr.lobbyScreen.selectedGame = msg.GameType
+			gr.lobbyScreen.errorText = "You were moved out of the room for being idle"
+		})
+
+		// In a room with a time control the server times every turn and
+		// tells us whose time is running whenever the turn changes
+		networkClient.RegisterHandler(protocol.MsgTurnTimer, func(msg protocol.Message) {
+			var data protocol.TurnTimer
+			if err := msg.Decode(&data); err != nil || gr.turnTimer == nil {
+				return
+			}
+			gr.turnTimer.Set(data.Seat, data.SecondsLeft, data.Limit, data.Clocks)
+		})
+
+		networkClient.RegisterHandler(protocol.MsgChat, func(msg protocol.Message) {
+			var data protocol.Chat
+			if err := msg.Decode(&data); err == nil && gr.spectatorChat != nil {
+				gr.spectatorChat.AddMessage(data.Name, data.Text)
+			}
+		})
+
+		networkClient.RegisterHandler(protocol.MsgGameEnded, func(msg protocol.Message) {
 			log.Println("Game ended - player left")
 			gr.ReturnHome()
 		})
@@ -11,6 +11,10 @@ import (
 	"github.com/hajimehoshi/ebiten/v2/ebitenutil"
 	"github.com/hajimehoshi/ebiten/v2/inpututil"
 	"github.com/hajimehoshi/ebiten/v2/vector"
+
+	"olive_and_millies_game_room/protocol"
+	"olive_and_millies_game_room/rules"
+	"olive_and_millies_game_room/rules/memory"
 )
 
 const (
@@ -18,7 +22,11 @@ const (
 	mem_cardHeight = 100
 	mem_gridCols   = 6
 	mem_gridRows   = 4
-	mem_totalPairs = 12
+
+	// The computer pauses for this many frames, and up to
+	// mem_computerJitter more, before turning each card over
+	mem_computerWait   = 40
+	mem_computerJitter = 30
 )
 
 type CardType int
@@ -39,92 +47,88 @@ const (
 )
 
 type Card struct {
-	cardType  CardType
-	x         float32
-	y         float32
-	flipped   bool
-	matched   bool
-	index     int
-}
-
-type MemoryMove struct {
-	CardIndex int `json:"card_index"`
+	x     float32
+	y     float32
+	index int
 }
 
 type MemoryPlayer struct {
 	name   string
 	avatar AvatarType
-	score  int
+	rating int
 }
 
 type MemoryGame struct {
-	cards          []*Card
-	flippedIndices []int
-	currentPlayer  int
-	players        []*MemoryPlayer
-	winner         int
-	gameOver       bool
-	flipDelay      int
-	networkClient  *NetworkClient
-	myPlayerNum    int
-	numPlayers     int
+	state         *memory.State
+	cards         []*Card
+	players       []*MemoryPlayer
+	flipDelay     int
+	networkClient *NetworkClient
+	myPlayerNum   int
+	numPlayers    int
+	turnTimer     *TurnTimer               // The room's time control, nil if it has none
+	roster        []protocol.PlayerInfo    // Who plays an offline game, for the next one
+	computers     map[int]rules.Difficulty // Seats the computer plays offline, and how well
+	recalls       map[int]*memory.Recall   // The cards each computer seat remembers seeing
+	computerWait  int                      // Frames until the computer turns its next card over
+	rng           *rand.Rand
 }
 
 func NewMemoryGame() *MemoryGame {
 	return NewMemoryGameWithNetwork(nil, 0)
 }
 
-func NewMemoryGameWithPlayers(nc *NetworkClient, playerNum int, playerData []map[string]interface{}) *MemoryGame {
+// NewMemoryGameVsComputer starts an offline game against the computer,
+// with the player going first
+func NewMemoryGameVsComputer(level rules.Difficulty) *MemoryGame {
+	return NewMemoryGameWithPlayers(nil, 0, vsComputer(level), nil)
+}
+
+// NewMemoryGameWithPlayers starts an online game with the cards the server
+// dealt face down, memory.Hidden, or an offline one with a layout of its own
+func NewMemoryGameWithPlayers(nc *NetworkClient, playerNum int, playerData []protocol.PlayerInfo, layout []int) *MemoryGame {
 	numPlayers := len(playerData)
 	if numPlayers == 0 {
 		numPlayers = 2
 	}
 
 	g := &MemoryGame{
-		currentPlayer:  0,
-		players:        make([]*MemoryPlayer, numPlayers),
-		winner:         -1,
-		gameOver:       false,
-		flipDelay:      0,
-		flippedIndices: make([]int, 0),
-		networkClient:  nc,
-		myPlayerNum:    playerNum,
-		numPlayers:     numPlayers,
+		players:       make([]*MemoryPlayer, numPlayers),
+		flipDelay:     0,
+		networkClient: nc,
+		myPlayerNum:   playerNum,
+		numPlayers:    numPlayers,
+		roster:        playerData,
+		computers:     localComputers(nc, playerData),
+		recalls:       make(map[int]*memory.Recall),
+		rng:           rand.New(rand.NewSource(time.Now().UnixNano())),
+	}
+	for seat, level := range g.computers {
+		g.recalls[seat] = memory.NewRecall(memory.ForgetRates[level], g.rng)
 	}
 
 	// Initialize players from server data
 	for i := 0; i < numPlayers; i++ {
 		name := fmt.Sprintf("Player %d", i+1)
 		avatar := i % int(AvatarNumTypes)
-		
+		rating := 0
+
 		if i < len(playerData) {
-			if n, ok := playerData[i]["name"].(string); ok {
-				name = n
-			}
-			if a, ok := playerData[i]["avatar"].(float64); ok {
-				avatar = int(a)
-			}
+			name = playerData[i].Name
+			avatar = playerData[i].Avatar
+			rating = playerData[i].Rating
 		}
-		
+
 		g.players[i] = &MemoryPlayer{
 			name:   name,
 			avatar: AvatarType(avatar),
-			score:  0,
+			rating: rating,
 		}
 	}
 
 	// Setup game board
-	g.setupBoard(nc)
-
-	// Register network handler for opponent moves
-	if nc != nil {
-		nc.RegisterHandler(MsgGameMove, func(msg Message) {
-			var move MemoryMove
-			if err := json.Unmarshal(msg.Data, &move); err == nil {
-				g.flipCard(move.CardIndex)
-			}
-		})
-	}
+	g.setupBoard(layout)
+	g.registerHandlers(nc)
 
 	return g
 }
@@ -132,15 +136,11 @@ func NewMemoryGameWithPlayers(nc *NetworkClient, playerNum int, playerData []map
 func NewMemoryGameWithNetwork(nc *NetworkClient, playerNum int) *MemoryGame {
 	// Default to 2 players for backward compatibility
 	g := &MemoryGame{
-		currentPlayer:  0,
-		players:        make([]*MemoryPlayer, 2),
-		winner:         -1,
-		gameOver:       false,
-		flipDelay:      0,
-		flippedIndices: make([]int, 0),
-		networkClient:  nc,
-		myPlayerNum:    playerNum,
-		numPlayers:     2,
+		players:       make([]*MemoryPlayer, 2),
+		flipDelay:     0,
+		networkClient: nc,
+		myPlayerNum:   playerNum,
+		numPlayers:    2,
 	}
 
 	// Initialize default players
@@ -148,43 +148,41 @@ func NewMemoryGameWithNetwork(nc *NetworkClient, playerNum int) *MemoryGame {
 		g.players[i] = &MemoryPlayer{
 			name:   fmt.Sprintf("Player %d", i+1),
 			avatar: AvatarType(i),
-			score:  0,
 		}
 	}
 
 	// Setup game board
-	g.setupBoard(nc)
-
-	// Register network handler for opponent moves
-	if nc != nil {
-		nc.RegisterHandler(MsgGameMove, func(msg Message) {
-			var move MemoryMove
-			if err := json.Unmarshal(msg.Data, &move); err == nil {
-				g.flipCard(move.CardIndex)
-			}
-		})
-	}
+	g.setupBoard(nil)
+	g.registerHandlers(nc)
 
 	return g
 }
 
-func (g *MemoryGame) setupBoard(nc *NetworkClient) {
-	// Create pairs of cards
-	cardTypes := make([]CardType, mem_totalPairs*2)
-	for i := 0; i < mem_totalPairs; i++ {
-		cardTypes[i*2] = CardType(i)
-		cardTypes[i*2+1] = CardType(i)
+// Register network handlers for opponent moves and server state
+func (g *MemoryGame) registerHandlers(nc *NetworkClient) {
+	if nc == nil {
+		return
 	}
+	nc.RegisterHandler(protocol.MsgGameMove, func(msg protocol.Message) {
+		var move memory.Move
+		if err := json.Unmarshal(msg.Data, &move); err == nil {
+			g.applyMove(move)
+		}
+	})
+	nc.RegisterHandler(protocol.MsgGameState, func(msg protocol.Message) {
+		var state memory.State
+		if err := json.Unmarshal(msg.Data, &state); err == nil {
+			g.syncState(&state)
+		}
+	})
+}
 
-	// Shuffle cards with fixed seed for network games (both players have same layout)
-	if nc != nil {
-		rand.Seed(12345) // Fixed seed so both players have same board
-	} else {
-		rand.Seed(time.Now().UnixNano())
+func (g *MemoryGame) setupBoard(layout []int) {
+	// Shuffle our own cards unless the server dealt them
+	if len(layout) != memory.NumCards {
+		layout = memory.Shuffle(rand.New(rand.NewSource(time.Now().UnixNano())))
 	}
-	rand.Shuffle(len(cardTypes), func(i, j int) {
-		cardTypes[i], cardTypes[j] = cardTypes[j], cardTypes[i]
-	})
+	g.state = memory.New(g.numPlayers, layout)
 
 	// Create card grid
 	g.cards = make([]*Card, mem_gridRows*mem_gridCols)
@@ -195,12 +193,9 @@ func (g *MemoryGame) setupBoard(nc *NetworkClient) {
 	for row := 0; row < mem_gridRows; row++ {
 		for col := 0; col < mem_gridCols; col++ {
 			g.cards[idx] = &Card{
-				cardType: cardTypes[idx],
-				x:        startX + float32(col*(mem_cardWidth+5)),
-				y:        startY + float32(row*(mem_cardHeight+5)),
-				flipped:  false,
-				matched:  false,
-				index:    idx,
+				x:     startX + float32(col*(mem_cardWidth+5)),
+				y:     startY + float32(row*(mem_cardHeight+5)),
+				index: idx,
 			}
 			idx++
 		}
@@ -208,7 +203,7 @@ func (g *MemoryGame) setupBoard(nc *NetworkClient) {
 }
 
 func (g *MemoryGame) Reset() {
-	*g = *NewMemoryGame()
+	*g = *NewMemoryGameWithPlayers(nil, 0, g.roster, nil)
 }
 
 func (g *MemoryGame) Update(gr *GameRoom) error {
@@ -217,7 +212,7 @@ func (g *MemoryGame) Update(gr *GameRoom) error {
 		return nil
 	}
 
-	if g.gameOver {
+	if g.state.GameOver {
 		return nil
 	}
 
@@ -225,38 +220,38 @@ func (g *MemoryGame) Update(gr *GameRoom) error {
 	if g.flipDelay > 0 {
 		g.flipDelay--
 		if g.flipDelay == 0 {
-			// Unflip non-matched cards
-			for _, idx := range g.flippedIndices {
-				if !g.cards[idx].matched {
-					g.cards[idx].flipped = false
-				}
-			}
-			g.flippedIndices = make([]int, 0)
+			g.state.TurnBack()
 		}
 		return nil
 	}
 
+	if recall, ok := g.recalls[g.state.CurrentPlayer]; ok {
+		g.updateComputer(recall)
+		return nil
+	}
+
 	// Only allow input if it's my turn (or if no network client)
-	isMyTurn := g.networkClient == nil || g.currentPlayer == g.myPlayerNum
+	isMyTurn := g.networkClient == nil || g.state.CurrentPlayer == g.myPlayerNum
 
 	// Handle card clicks
 	if isMyTurn && inpututil.IsMouseButtonJustPressed(ebiten.MouseButtonLeft) {
 		mx, my := ebiten.CursorPosition()
 
 		for _, card := range g.cards {
-			if card.matched || card.flipped {
+			c := g.state.Cards[card.index]
+			if c.Matched || c.Flipped {
 				continue
 			}
 
 			if float32(mx) >= card.x && float32(mx) <= card.x+mem_cardWidth &&
 				float32(my) >= card.y && float32(my) <= card.y+mem_cardHeight {
 
-				g.flipCard(card.index)
-
-				// Send move to opponent
+				// Online, the card is turned over once the server sends
+				// back its face
 				if g.networkClient != nil {
-					move := MemoryMove{CardIndex: card.index}
-					g.networkClient.SendGameMove(move)
+					g.networkClient.SendGameMove(memory.Move{CardIndex: card.index})
+				} else {
+					g.flipCard(card.index)
 				}
 
 				break
@@ -267,55 +262,79 @@ func (g *MemoryGame) Update(gr *GameRoom) error {
 	return nil
 }
 
-func (g *MemoryGame) flipCard(cardIndex int) {
-	card := g.cards[cardIndex]
-	if card.matched || card.flipped {
+// The computer turns its cards over one at a time after a pause, like a
+// person would. Update holds it back while a mismatched pair is face up,
+// the same as it does the player.
+func (g *MemoryGame) updateComputer(recall *memory.Recall) {
+	if g.computerWait == 0 {
+		g.computerWait = mem_computerWait + g.rng.Intn(mem_computerJitter+1)
 		return
 	}
+	g.computerWait--
+	if g.computerWait == 0 {
+		g.flipCard(recall.BestMove(g.state).CardIndex)
+	}
+}
 
-	card.flipped = true
-	g.flippedIndices = append(g.flippedIndices, card.index)
+func (g *MemoryGame) flipCard(cardIndex int) {
+	g.applyMove(memory.Move{CardIndex: cardIndex})
+}
 
-	// Check if two cards are flipped
-	if len(g.flippedIndices) == 2 {
-		card1 := g.cards[g.flippedIndices[0]]
-		card2 := g.cards[g.flippedIndices[1]]
+// applyMove plays a move for the current player: a card turned over, or a
+// pass when they ran out of time
+func (g *MemoryGame) applyMove(move memory.Move) {
+	if err := g.state.Apply(g.state.CurrentPlayer, move); err != nil {
+		return
+	}
+	if move.Pass {
+		g.flipDelay = 0
+		return
+	}
+	for _, recall := range g.recalls {
+		recall.See(move.CardIndex, g.state.Cards[move.CardIndex].Type)
+	}
 
-		if card1.cardType == card2.cardType {
-			// Match!
-			card1.matched = true
-			card2.matched = true
-			g.players[g.currentPlayer].score++
-			g.flippedIndices = make([]int, 0)
+	// No match, leave the pair face up for a moment
+	if g.state.MismatchPending() {
+		g.flipDelay = 60 // 1 second
+	}
+}
 
-			// Check if game is over
-			allMatched := true
-			for _, c := range g.cards {
-				if !c.matched {
-					allMatched = false
-					break
-				}
-			}
-			if allMatched {
-				g.gameOver = true
-				// Find winner
-				maxScore := -1
-				g.winner = -1
-				for i, player := range g.players {
-					if player.score > maxScore {
-						maxScore = player.score
-						g.winner = i
-					} else if player.score == maxScore {
-						g.winner = -1 // Tie
-					}
-				}
-			}
-		} else {
-			// No match, switch to next player and set delay
-			g.currentPlayer = (g.currentPlayer + 1) % g.numPlayers
-			g.flipDelay = 60 // 1 second
+// syncState replaces the local game with the server's authoritative state.
+// The server hides face-down cards, so we keep the faces we've seen.
+func (g *MemoryGame) syncState(state *memory.State) {
+	if len(state.Cards) != len(g.state.Cards) {
+		return
+	}
+	for i := range state.Cards {
+		if state.Cards[i].Type < 0 {
+			state.Cards[i].Type = g.state.Cards[i].Type
 		}
 	}
+	if state.MismatchPending() {
+		if g.flipDelay == 0 && !g.state.MismatchPending() {
+			// We already turned the mismatched pair back over
+			state.TurnBack()
+		} else if g.flipDelay == 0 {
+			g.flipDelay = 60
+		}
+	}
+	g.state = state
+}
+
+// VerifySeed checks every card we saw turned over against the layout the
+// server's revealed seed deals
+func (g *MemoryGame) VerifySeed(seed []byte, reveal protocol.SeedReveal) bool {
+	layout := memory.Shuffle(rules.NewRand(seed))
+	if len(layout) != len(g.state.Cards) {
+		return false
+	}
+	for i, card := range g.state.Cards {
+		if card.Type >= 0 && card.Type != layout[i] {
+			return false
+		}
+	}
+	return true
 }
 
 func (g *MemoryGame) Draw(screen *ebiten.Image, gr *GameRoom) {
@@ -326,7 +345,7 @@ func (g *MemoryGame) Draw(screen *ebiten.Image, gr *GameRoom) {
 	g.drawCards(screen)
 	g.drawPlayerInfo(screen)
 
-	if g.gameOver {
+	if g.state.GameOver {
 		g.drawWinner(screen)
 	}
 }
@@ -347,10 +366,10 @@ func (g *MemoryGame) drawGameInfo(screen *ebiten.Image) {
 	vector.StrokeRect(screen, infoX, 70, infoWidth, 50, 2, color.RGBA{100, 150, 220, 255}, false)
 
 	var turnText string
-	if g.gameOver {
+	if g.state.GameOver {
 		turnText = "Game Over!"
 	} else {
-		turnText = fmt.Sprintf("%s's Turn", g.players[g.currentPlayer].name)
+		turnText = fmt.Sprintf("%s's Turn", g.players[g.state.CurrentPlayer].name)
 	}
 
 	turnTextX := int(infoX + (infoWidth-float32(len(turnText)*6))/2)
@@ -359,7 +378,7 @@ func (g *MemoryGame) drawGameInfo(screen *ebiten.Image) {
 
 func (g *MemoryGame) drawCards(screen *ebiten.Image) {
 	for _, card := range g.cards {
-		if card.flipped || card.matched {
+		if c := g.state.Cards[card.index]; c.Flipped || c.Matched {
 			g.drawCardFace(screen, card)
 		} else {
 			g.drawCardBack(screen, card)
@@ -394,7 +413,7 @@ func (g *MemoryGame) drawCardFace(screen *ebiten.Image, card *Card) {
 	cx := card.x + mem_cardWidth/2
 	cy := card.y + mem_cardHeight/2
 
-	switch card.cardType {
+	switch CardType(g.state.Cards[card.index].Type) {
 	case CardTotoro:
 		g.drawTotoro(screen, cx, cy)
 	case CardNoFace:
@@ -674,7 +693,7 @@ func (g *MemoryGame) drawPlayerPanel(screen *ebiten.Image, player *MemoryPlayer,
 	borderColor := color.RGBA{100, 150, 220, 255}
 	
 	// Highlight current player
-	if index == g.currentPlayer && !g.gameOver {
+	if index == g.state.CurrentPlayer && !g.state.GameOver {
 		borderColor = color.RGBA{255, 200, 100, 255}
 		panelColor = color.RGBA{50, 70, 100, 255}
 	}
@@ -702,26 +721,49 @@ func (g *MemoryGame) drawPlayerPanel(screen *ebiten.Image, player *MemoryPlayer,
 	// Use smaller font for very compact layouts
 	if height < 70 {
 		// For very small panels, put text on single line
-		combinedText := fmt.Sprintf("%s: %d pairs", player.name, player.score)
+		combinedText := fmt.Sprintf("%s: %d pairs", player.name, g.state.Scores[index])
 		ebitenutil.DebugPrintAt(screen, combinedText, textX, int(y+height/2-4))
-		if index == g.currentPlayer && !g.gameOver {
+		if index == g.state.CurrentPlayer && !g.state.GameOver {
 			ebitenutil.DebugPrintAt(screen, combinedText, textX+1, int(y+height/2-4))
 		}
 	} else {
-		// Normal two-line display
-		ebitenutil.DebugPrintAt(screen, player.name, textX, nameY)
-		if index == g.currentPlayer && !g.gameOver {
-			ebitenutil.DebugPrintAt(screen, player.name, textX+1, nameY)
+		// Normal two-line display, with the rating if it fits
+		nameText := ratedName(player.name, player.rating)
+		if float64(len(nameText)*6) > width-avatarSize-15 {
+			nameText = player.name
+		}
+		ebitenutil.DebugPrintAt(screen, nameText, textX, nameY)
+		if index == g.state.CurrentPlayer && !g.state.GameOver {
+			ebitenutil.DebugPrintAt(screen, nameText, textX+1, nameY)
 		}
 		
-		pairsText := fmt.Sprintf("Pairs: %d", player.score)
+		pairsText := fmt.Sprintf("Pairs: %d", g.state.Scores[index])
 		ebitenutil.DebugPrintAt(screen, pairsText, textX, scoreY)
 		
 		// Show "Your turn!" for current player if space allows
-		if index == g.currentPlayer && !g.gameOver && height >= 90 {
+		if index == g.state.CurrentPlayer && !g.state.GameOver && height >= 90 {
 			ebitenutil.DebugPrintAt(screen, "Your turn!", textX, int(y+height*0.85))
 		}
 	}
+
+	// The turn timer, on the right of the panel
+	radius := height * 0.35
+	if radius > 22 {
+		radius = 22
+	}
+	g.turnTimer.DrawRing(screen, index, float32(x+width-radius-6), float32(y+height/2), float32(radius))
+}
+
+func (g *MemoryGame) SetRatings(ratings []int) {
+	for i, rating := range ratings {
+		if i < len(g.players) {
+			g.players[i].rating = rating
+		}
+	}
+}
+
+func (g *MemoryGame) SetTurnTimer(t *TurnTimer) {
+	g.turnTimer = t
 }
 
 func (g *MemoryGame) drawWinner(screen *ebiten.Image) {
@@ -740,18 +782,18 @@ func (g *MemoryGame) drawWinner(screen *ebiten.Image) {
 	vector.DrawFilledRect(screen, bannerX+bannerWidth+8, bannerY+40, 10, 10, starColor, false)
 
 	var winnerText string
-	if g.winner == -1 {
+	if g.state.Winner == -1 {
 		winnerText = "IT'S A TIE!"
 	} else {
-		winnerText = fmt.Sprintf("WINNER: %s", g.players[g.winner].name)
+		winnerText = fmt.Sprintf("WINNER: %s", g.players[g.state.Winner].name)
 	}
 
 	winnerTextX := int(bannerX + (bannerWidth-float32(len(winnerText)*6))/2)
 	ebitenutil.DebugPrintAt(screen, winnerText, winnerTextX, int(bannerY+20))
 	ebitenutil.DebugPrintAt(screen, winnerText, winnerTextX+1, int(bannerY+20))
 	
-	if g.winner != -1 {
-		scoreText := fmt.Sprintf("Score: %d pairs!", g.players[g.winner].score)
+	if g.state.Winner != -1 {
+		scoreText := fmt.Sprintf("Score: %d pairs!", g.state.Scores[g.state.Winner])
 		scoreTextX := int(bannerX + (bannerWidth-float32(len(scoreText)*6))/2)
 		ebitenutil.DebugPrintAt(screen, scoreText, scoreTextX, int(bannerY+45))
 	}
@@ -5,57 +5,47 @@ import (
 	"fmt"
 	"log"
 	"net/http"
+	"net/url"
+	"strconv"
 	"sync"
 	"time"
 
 	"github.com/gorilla/websocket"
-)
 
-type MessageType string
+	"olive_and_millies_game_room/protocol"
+	"olive_and_millies_game_room/rules"
+)
 
 const (
-	MsgJoinLobby    MessageType = "join_lobby"
-	MsgLeaveLobby   MessageType = "leave_lobby"
-	MsgCreateRoom   MessageType = "create_room"
-	MsgJoinRoom     MessageType = "join_room"
-	MsgLeaveRoom    MessageType = "leave_room"
-	MsgStartGame    MessageType = "start_game"
-	MsgGameMove     MessageType = "game_move"
-	MsgGameState    MessageType = "game_state"
-	MsgPlayerList   MessageType = "player_list"
-	MsgRoomList     MessageType = "room_list"
-	MsgError        MessageType = "error"
-	MsgChat         MessageType = "chat"
-	MsgSetAvatar    MessageType = "set_avatar"
-	MsgPlayerUpdate MessageType = "player_update"
+	maxReconnectAttempts = 10
+	maxReconnectDelay    = 15 * time.Second
+
+	// We ping the server to measure the round trip, and treat the
+	// connection as dropped if it goes quiet for longer than pongWait
+	pingPeriod = 5 * time.Second
+	pongWait   = 20 * time.Second
+	writeWait  = 10 * time.Second
 )
 
-type Message struct {
-	Type      MessageType     `json:"type"`
-	PlayerID  string          `json:"player_id,omitempty"`
-	RoomID    string          `json:"room_id,omitempty"`
-	GameType  string          `json:"game_type,omitempty"`
-	Data      json.RawMessage `json:"data,omitempty"`
-	Timestamp time.Time       `json:"timestamp"`
-}
-
-type RoomInfo struct {
-	ID         string `json:"id"`
-	Name       string `json:"name"`
-	GameType   string `json:"game_type"`
-	Players    int    `json:"players"`
-	MaxPlayers int    `json:"max_players"`
-	Started    bool   `json:"started"`
-}
-
 type NetworkClient struct {
-	conn        *websocket.Conn
-	playerID    string
-	currentRoom string
-	rooms       []RoomInfo
-	mu          sync.RWMutex
-	msgHandlers map[MessageType]func(Message)
-	connected   bool
+	conn         *websocket.Conn
+	serverURL    string
+	playerID     string
+	sessionToken string   // Lets us take our seat back after a dropped connection
+	identity     Identity // Our account, saved between runs
+	currentRoom  string
+	lostRoom     string // The room our last expired session had a seat in
+	rooms        []protocol.RoomInfo
+	mu           sync.RWMutex
+	msgHandlers  map[protocol.MessageType]func(protocol.Message)
+	connected    bool
+	reconnecting bool
+	closed       bool              // Set once we've closed the connection on purpose
+	rtt          time.Duration     // Latest round trip to the server, 0 until measured
+	outdated     string            // Why the server turned this version of the game away
+	encoding     protocol.Encoding // How the server wants our messages
+	version      int               // The protocol version agreed with the server
+	browsing     string            // Game type whose rooms we're following, "" for none
 }
 
 func NewNetworkClient(serverURL string) (*NetworkClient, error) {
@@ -70,9 +60,14 @@ func NewNetworkClientWithRetry(serverURL string, maxRetries int, retryDelaySecon
 
 	// Create a dialer with timeout
 	dialer := websocket.Dialer{
-		HandshakeTimeout: 5 * time.Second,
+		HandshakeTimeout:  5 * time.Second,
+		EnableCompression: true,
 	}
 
+	// Sign in with our saved account, if we have one
+	identity := loadIdentity()
+	dialURL := connectURL(serverURL, identity)
+
 	for attempt := 0; attempt < maxRetries; attempt++ {
 		if attempt > 0 {
 			log.Printf("Connection attempt %d/%d (waiting %ds)...\n", attempt+1, maxRetries, retryDelaySeconds)
@@ -80,7 +75,7 @@ func NewNetworkClientWithRetry(serverURL string, maxRetries int, retryDelaySecon
 		}
 
 		log.Printf("Attempting to connect to: %s", serverURL)
-		conn, resp, err = dialer.Dial(serverURL, nil)
+		conn, resp, err = dialer.Dial(dialURL, nil)
 		if err == nil {
 			break
 		}
@@ -97,27 +92,38 @@ func NewNetworkClientWithRetry(serverURL string, maxRetries int, retryDelaySecon
 
 	nc := &NetworkClient{
 		conn:        conn,
-		msgHandlers: make(map[MessageType]func(Message)),
+		serverURL:   serverURL,
+		identity:    identity,
+		msgHandlers: make(map[protocol.MessageType]func(protocol.Message)),
 		connected:   true,
 	}
 
 	// Start listening for messages
-	go nc.listen()
+	go nc.listen(conn)
 
 	return nc, nil
 }
 
-func (nc *NetworkClient) listen() {
+func (nc *NetworkClient) listen(conn *websocket.Conn) {
+	stopPings := make(chan struct{})
+	nc.startHeartbeat(conn, stopPings)
 	defer func() {
+		close(stopPings)
+		conn.Close()
 		nc.mu.Lock()
 		nc.connected = false
+		nc.rtt = 0
+		lost := !nc.closed
+		nc.reconnecting = lost
 		nc.mu.Unlock()
-		nc.conn.Close()
+
+		if lost {
+			go nc.reconnect()
+		}
 	}()
 
 	for {
-		var msg Message
-		err := nc.conn.ReadJSON(&msg)
+		msg, err := protocol.ReadMessage(conn)
 		if err != nil {
 			if websocket.IsUnexpectedCloseError(err, websocket.CloseGoingAway, websocket.CloseAbnormalClosure) {
 				log.Printf("WebSocket error: %v", err)
@@ -129,20 +135,189 @@ func (nc *NetworkClient) listen() {
 	}
 }
 
-func (nc *NetworkClient) handleMessage(msg Message) {
+// Ping the server until stop is closed, timing each pong that comes back.
+// If the pongs stop, the next read fails and we reconnect.
+func (nc *NetworkClient) startHeartbeat(conn *websocket.Conn, stop chan struct{}) {
+	conn.SetReadDeadline(time.Now().Add(pongWait))
+	conn.SetPongHandler(func(appData string) error {
+		if sent, err := strconv.ParseInt(appData, 10, 64); err == nil {
+			nc.mu.Lock()
+			nc.rtt = time.Since(time.Unix(0, sent))
+			nc.mu.Unlock()
+		}
+		return conn.SetReadDeadline(time.Now().Add(pongWait))
+	})
+
+	go func() {
+		ticker := time.NewTicker(pingPeriod)
+		defer ticker.Stop()
+		for {
+			// The ping carries the time it was sent, which the pong echoes
+			sent := strconv.FormatInt(time.Now().UnixNano(), 10)
+			err := conn.WriteControl(websocket.PingMessage, []byte(sent), time.Now().Add(writeWait))
+			if err != nil {
+				return
+			}
+			select {
+			case <-stop:
+				return
+			case <-ticker.C:
+			}
+		}
+	}()
+}
+
+// reconnect redials the server after a dropped connection, backing off
+// between attempts, and presents our session token so the server gives us
+// our old seat back
+func (nc *NetworkClient) reconnect() {
+	dialer := websocket.Dialer{
+		HandshakeTimeout:  5 * time.Second,
+		EnableCompression: true,
+	}
+	delay := time.Second
+
+	for attempt := 1; attempt <= maxReconnectAttempts; attempt++ {
+		nc.mu.RLock()
+		closed := nc.closed
+		resumeURL := nc.resumeURL()
+		nc.mu.RUnlock()
+		if closed {
+			return
+		}
+
+		log.Printf("Connection lost, reconnecting (attempt %d/%d)...\n", attempt, maxReconnectAttempts)
+		conn, _, err := dialer.Dial(resumeURL, nil)
+		if err == nil {
+			nc.mu.Lock()
+			if nc.closed {
+				nc.mu.Unlock()
+				conn.Close()
+				return
+			}
+			nc.conn = conn
+			nc.connected = true
+			nc.reconnecting = false
+			nc.mu.Unlock()
+
+			log.Println("Reconnected to server")
+			go nc.listen(conn)
+			return
+		}
+		log.Printf("Reconnect failed: %v", err)
+
+		time.Sleep(delay)
+		delay *= 2
+		if delay > maxReconnectDelay {
+			delay = maxReconnectDelay
+		}
+	}
+
+	log.Println("Giving up on reconnecting to server")
+	nc.mu.Lock()
+	nc.reconnecting = false
+	nc.mu.Unlock()
+}
+
+// resumeURL is the server URL with our session token and account attached,
+// so the server knows who we are even if the session has expired.
+// Must be called with nc.mu held.
+func (nc *NetworkClient) resumeURL() string {
+	signedIn := connectURL(nc.serverURL, nc.identity)
+	u, err := url.Parse(signedIn)
+	if err != nil || nc.sessionToken == "" {
+		return signedIn
+	}
+	q := u.Query()
+	q.Set("session", nc.sessionToken)
+	u.RawQuery = q.Encode()
+	return u.String()
+}
+
+// connectURL is the server URL with our hello, saying which version of the
+// game this is and asking for the compact binary encoding, and our account
+// credential attached
+func connectURL(serverURL string, identity Identity) string {
+	u, err := url.Parse(serverURL)
+	if err != nil {
+		return serverURL
+	}
+	q := u.Query()
+	hello := protocol.Hello{
+		ClientVersion:   currentVersion,
+		ProtocolVersion: protocol.Version,
+		Encoding:        protocol.EncodingBinary,
+	}
+	hello.Add(q)
+	if identity.PlayerID != "" && identity.Key != "" {
+		q.Set("player_id", identity.PlayerID)
+		q.Set("player_key", identity.Key)
+	}
+	u.RawQuery = q.Encode()
+	return u.String()
+}
+
+// serverHTTPURL is an HTTP endpoint on the game server, e.g. /history
+func serverHTTPURL(path string) string {
+	u, err := url.Parse(serverURL)
+	if err != nil {
+		return ""
+	}
+	if u.Scheme == "wss" {
+		u.Scheme = "https"
+	} else {
+		u.Scheme = "http"
+	}
+	u.Path = path
+	return u.String()
+}
+
+// historyURL is one match in the server's match history
+func historyURL(matchID string) string {
+	return serverHTTPURL("/history/" + url.PathEscape(matchID))
+}
+
+// historyPageURL lists a page of the server's match history, newest first
+func historyPageURL(offset, limit int) string {
+	return serverHTTPURL("/history") + fmt.Sprintf("?offset=%d&limit=%d", offset, limit)
+}
+
+func (nc *NetworkClient) handleMessage(msg protocol.Message) {
 	// Handle special messages
 	switch msg.Type {
-	case "connected":
+	case protocol.MsgConnected:
+		var data protocol.Connected
+		msg.Decode(&data)
 		nc.mu.Lock()
 		nc.playerID = msg.PlayerID
+		nc.sessionToken = data.SessionToken
+		nc.lostRoom = ""
+		if !data.Resumed {
+			// Our old session expired, so we no longer have a seat anywhere
+			nc.lostRoom = nc.currentRoom
+			nc.currentRoom = ""
+		}
+		if data.PlayerKey != "" {
+			nc.identity.Key = data.PlayerKey
+		}
+		nc.identity.PlayerID = msg.PlayerID
+		nc.identity.Name = data.Name
+		nc.identity.Avatar = data.Avatar
+		nc.encoding = data.Encoding
+		nc.version = data.ProtocolVersion
+		identity := nc.identity
+		browsing := nc.browsing
 		nc.mu.Unlock()
-		log.Printf("Connected as player %s\n", msg.PlayerID)
-
-	case MsgRoomList:
-		var data struct {
-			Rooms []RoomInfo `json:"rooms"`
+		saveIdentity(identity)
+		log.Printf("Connected as player %s (resumed=%v, protocol %d)\n", msg.PlayerID, data.Resumed, data.ProtocolVersion)
+		if browsing != "" {
+			// A new session starts out following nothing
+			nc.BrowseRooms(browsing)
 		}
-		if err := json.Unmarshal(msg.Data, &data); err == nil {
+
+	case protocol.MsgRoomList:
+		var data protocol.RoomList
+		if err := msg.Decode(&data); err == nil {
 			nc.mu.Lock()
 			nc.rooms = data.Rooms
 			nc.mu.Unlock()
@@ -153,12 +328,31 @@ func (nc *NetworkClient) handleMessage(msg Message) {
 			}
 		}
 
-	case MsgError:
-		var errData struct {
-			Error string `json:"error"`
+	case protocol.MsgRoomAdded, protocol.MsgRoomUpdated:
+		var room protocol.RoomInfo
+		if err := msg.Decode(&room); err == nil {
+			nc.mu.Lock()
+			nc.rooms = upsertRoom(nc.rooms, room)
+			nc.mu.Unlock()
 		}
-		if err := json.Unmarshal(msg.Data, &errData); err == nil {
-			log.Printf("Server error: %s\n", errData.Error)
+
+	case protocol.MsgRoomRemoved:
+		nc.mu.Lock()
+		nc.rooms = removeRoom(nc.rooms, msg.RoomID)
+		nc.mu.Unlock()
+
+	case protocol.MsgError:
+		var errData protocol.Error
+		if err := msg.Decode(&errData); err == nil {
+			log.Printf("Server error (%s): %s\n", errData.Code, errData.Message)
+		}
+		if errData.Code == protocol.ErrUpdateRequired {
+			// The server is about to hang up, and will again however
+			// often we reconnect
+			nc.mu.Lock()
+			nc.outdated = errData.Message
+			nc.closed = true
+			nc.mu.Unlock()
 		}
 	}
 
@@ -172,13 +366,13 @@ func (nc *NetworkClient) handleMessage(msg Message) {
 	}
 }
 
-func (nc *NetworkClient) RegisterHandler(msgType MessageType, handler func(Message)) {
+func (nc *NetworkClient) RegisterHandler(msgType protocol.MessageType, handler func(protocol.Message)) {
 	nc.mu.Lock()
 	defer nc.mu.Unlock()
 	nc.msgHandlers[msgType] = handler
 }
 
-func (nc *NetworkClient) SendMessage(msg Message) error {
+func (nc *NetworkClient) SendMessage(msg protocol.Message) error {
 	nc.mu.Lock()
 	defer nc.mu.Unlock()
 
@@ -188,46 +382,101 @@ func (nc *NetworkClient) SendMessage(msg Message) error {
 	}
 
 	log.Printf("CLIENT: Sending message type=%s\n", msg.Type)
-	return nc.conn.WriteJSON(msg)
+	return protocol.WriteMessage(nc.conn, nc.encoding, msg)
 }
 
-func (nc *NetworkClient) CreateRoom(gameType, roomName string) error {
-	data, _ := json.Marshal(map[string]string{
-		"game_type": gameType,
-		"room_name": roomName,
-	})
-
-	return nc.SendMessage(Message{
-		Type:      MsgCreateRoom,
-		Data:      data,
-		Timestamp: time.Now(),
-	})
+// CreateRoom opens a new room. Private rooms stay out of the room list and
+// are joined by code, with the password if one is set.
+func (nc *NetworkClient) CreateRoom(gameType, roomName string, private bool, password string, timeLimit int) error {
+	return nc.SendMessage(protocol.NewMessage(protocol.MsgCreateRoom, protocol.CreateRoom{
+		GameType:  gameType,
+		RoomName:  roomName,
+		Private:   private,
+		Password:  password,
+		TimeLimit: timeLimit,
+	}))
 }
 
 func (nc *NetworkClient) JoinRoom(roomID string) error {
-	data, _ := json.Marshal(map[string]string{
-		"room_id": roomID,
-	})
+	return nc.SendMessage(protocol.NewMessage(protocol.MsgJoinRoom, protocol.JoinRoom{
+		RoomID: roomID,
+	}))
+}
 
-	return nc.SendMessage(Message{
-		Type:      MsgJoinRoom,
-		Data:      data,
-		Timestamp: time.Now(),
-	})
+// JoinRoomByCode joins a room by the code its host shared
+func (nc *NetworkClient) JoinRoomByCode(code, password string) error {
+	return nc.SendMessage(protocol.NewMessage(protocol.MsgJoinRoom, protocol.JoinRoom{
+		Code:     code,
+		Password: password,
+	}))
+}
+
+// Spectate watches a game in progress without taking a seat
+func (nc *NetworkClient) Spectate(roomID string) error {
+	return nc.SendMessage(protocol.NewMessage(protocol.MsgSpectate, protocol.Spectate{
+		RoomID: roomID,
+	}))
+}
+
+// KickPlayer removes a player from the room we're hosting
+func (nc *NetworkClient) KickPlayer(playerID string) error {
+	return nc.SendMessage(protocol.NewMessage(protocol.MsgKickPlayer, protocol.KickPlayer{
+		PlayerID: playerID,
+	}))
+}
+
+// TransferHost hands host rights for our room to another player
+func (nc *NetworkClient) TransferHost(playerID string) error {
+	return nc.SendMessage(protocol.NewMessage(protocol.MsgTransferHost, protocol.TransferHost{
+		PlayerID: playerID,
+	}))
+}
+
+// SetRoomSettings changes the seat count and lock on the room we're hosting
+func (nc *NetworkClient) SetRoomSettings(maxPlayers int, locked bool) error {
+	return nc.SendMessage(protocol.NewMessage(protocol.MsgRoomSettings, protocol.RoomSettings{
+		MaxPlayers: maxPlayers,
+		Locked:     locked,
+	}))
+}
+
+func (nc *NetworkClient) SendChat(text string) error {
+	return nc.SendMessage(protocol.NewMessage(protocol.MsgChat, protocol.Chat{
+		Text: text,
+	}))
 }
 
 func (nc *NetworkClient) LeaveRoom() error {
-	return nc.SendMessage(Message{
-		Type:      MsgLeaveRoom,
-		Timestamp: time.Now(),
-	})
+	return nc.SendMessage(protocol.NewMessage(protocol.MsgLeaveRoom, nil))
 }
 
-func (nc *NetworkClient) StartGame() error {
-	return nc.SendMessage(Message{
-		Type:      MsgStartGame,
-		Timestamp: time.Now(),
-	})
+// StartGame asks the server to count down to the game. With force the host
+// starts without waiting for everyone to be ready.
+func (nc *NetworkClient) StartGame(force bool) error {
+	return nc.SendMessage(protocol.NewMessage(protocol.MsgStartGame, protocol.StartRequest{
+		Force: force,
+	}))
+}
+
+// Rematch votes to play the room's game again once it's over, or takes
+// the vote back
+func (nc *NetworkClient) Rematch(accept bool) error {
+	return nc.SendMessage(protocol.NewMessage(protocol.MsgRematch, protocol.RematchVote{
+		Accept: accept,
+	}))
+}
+
+// AddBot seats a computer player in the room we're hosting
+func (nc *NetworkClient) AddBot(level rules.Difficulty) error {
+	return nc.SendMessage(protocol.NewMessage(protocol.MsgAddBot, protocol.AddBot{
+		Difficulty: level.String(),
+	}))
+}
+
+func (nc *NetworkClient) SetReady(ready bool) error {
+	return nc.SendMessage(protocol.NewMessage(protocol.MsgSetReady, protocol.SetReady{
+		Ready: ready,
+	}))
 }
 
 func (nc *NetworkClient) SendGameMove(moveData interface{}) error {
@@ -236,14 +485,58 @@ func (nc *NetworkClient) SendGameMove(moveData interface{}) error {
 		return err
 	}
 
-	return nc.SendMessage(Message{
-		Type:      MsgGameMove,
+	return nc.SendMessage(protocol.Message{
+		Type:      protocol.MsgGameMove,
 		Data:      data,
 		Timestamp: time.Now(),
 	})
 }
 
-func (nc *NetworkClient) GetRooms() []RoomInfo {
+// BrowseRooms follows the room list for a game type, or stops following it
+// when gameType is "". Servers from before room list subscriptions send
+// every room whatever we're looking at, so there's nothing to ask for.
+func (nc *NetworkClient) BrowseRooms(gameType string) error {
+	nc.mu.Lock()
+	nc.browsing = gameType
+	version := nc.version
+	nc.mu.Unlock()
+	if version < 3 {
+		return nil
+	}
+
+	if gameType == "" {
+		return nc.SendMessage(protocol.NewMessage(protocol.MsgLeaveLobby, nil))
+	}
+	return nc.SendMessage(protocol.NewMessage(protocol.MsgJoinLobby, protocol.JoinLobby{
+		GameType: gameType,
+	}))
+}
+
+// The room list with a room added or brought up to date. The list is
+// copied, as GetRooms hands it out.
+func upsertRoom(rooms []protocol.RoomInfo, room protocol.RoomInfo) []protocol.RoomInfo {
+	updated := make([]protocol.RoomInfo, len(rooms), len(rooms)+1)
+	copy(updated, rooms)
+	for i, r := range updated {
+		if r.ID == room.ID {
+			updated[i] = room
+			return updated
+		}
+	}
+	return append(updated, room)
+}
+
+func removeRoom(rooms []protocol.RoomInfo, roomID string) []protocol.RoomInfo {
+	updated := make([]protocol.RoomInfo, 0, len(rooms))
+	for _, r := range rooms {
+		if r.ID != roomID {
+			updated = append(updated, r)
+		}
+	}
+	return updated
+}
+
+func (nc *NetworkClient) GetRooms() []protocol.RoomInfo {
 	nc.mu.RLock()
 	defer nc.mu.RUnlock()
 	return nc.rooms
@@ -261,29 +554,86 @@ func (nc *NetworkClient) GetCurrentRoom() string {
 	return nc.currentRoom
 }
 
+// LostRoom is the room we had a seat in when our session expired, "" if
+// we weren't in one or the session was resumed
+func (nc *NetworkClient) LostRoom() string {
+	nc.mu.RLock()
+	defer nc.mu.RUnlock()
+	return nc.lostRoom
+}
+
 func (nc *NetworkClient) IsConnected() bool {
 	nc.mu.RLock()
 	defer nc.mu.RUnlock()
 	return nc.connected
 }
 
+// RTT is the latest round trip time to the server, 0 if we haven't
+// measured one on this connection yet
+func (nc *NetworkClient) RTT() time.Duration {
+	nc.mu.RLock()
+	defer nc.mu.RUnlock()
+	return nc.rtt
+}
+
+// IsReconnecting reports whether the connection dropped and we're trying
+// to get it back
+func (nc *NetworkClient) IsReconnecting() bool {
+	nc.mu.RLock()
+	defer nc.mu.RUnlock()
+	return nc.reconnecting
+}
+
+// Outdated returns the server's reason for turning this version of the game
+// away, or "" if it hasn't
+func (nc *NetworkClient) Outdated() string {
+	nc.mu.RLock()
+	defer nc.mu.RUnlock()
+	return nc.outdated
+}
+
+// GetIdentity returns our account, including the name and avatar we play as
+func (nc *NetworkClient) GetIdentity() Identity {
+	nc.mu.RLock()
+	defer nc.mu.RUnlock()
+	return nc.identity
+}
+
 func (nc *NetworkClient) SetAvatar(avatarType int) error {
-	data, _ := json.Marshal(map[string]int{
-		"avatar": avatarType,
-	})
+	nc.mu.Lock()
+	nc.identity.Avatar = avatarType
+	identity := nc.identity
+	nc.mu.Unlock()
+	saveIdentity(identity)
+
+	return nc.SendMessage(protocol.NewMessage(protocol.MsgSetAvatar, protocol.SetAvatar{
+		Avatar: avatarType,
+	}))
+}
 
-	return nc.SendMessage(Message{
-		Type:      MsgSetAvatar,
-		Data:      data,
-		Timestamp: time.Now(),
-	})
+// SetName changes the display name other players see
+func (nc *NetworkClient) SetName(name string) error {
+	nc.mu.Lock()
+	nc.identity.Name = name
+	identity := nc.identity
+	nc.mu.Unlock()
+	saveIdentity(identity)
+
+	return nc.SendMessage(protocol.NewMessage(protocol.MsgSetName, protocol.SetName{
+		Name: name,
+	}))
 }
 
 func (nc *NetworkClient) Close() {
 	nc.mu.Lock()
 	defer nc.mu.Unlock()
 
+	nc.closed = true
 	if nc.connected {
+		// A normal close tells the server we left on purpose, so it
+		// doesn't hold our seat
+		nc.conn.WriteMessage(websocket.CloseMessage,
+			websocket.FormatCloseMessage(websocket.CloseNormalClosure, ""))
 		nc.conn.Close()
 		nc.connected = false
 	}
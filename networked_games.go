@@ -5,6 +5,8 @@ import (
 	"log"
 
 	"github.com/hajimehoshi/ebiten/v2"
+
+	"olive_and_millies_game_room/protocol"
 )
 
 // NetworkedGame wraps any game with network synchronization
@@ -24,7 +26,7 @@ func NewNetworkedGame(game GameInterface, nc *NetworkClient) *NetworkedGame {
 	}
 
 	// Register handler for receiving opponent moves
-	nc.RegisterHandler(MsgGameMove, func(msg Message) {
+	nc.RegisterHandler(protocol.MsgGameMove, func(msg protocol.Message) {
 		ng.handleOpponentMove(msg.Data)
 	})
 
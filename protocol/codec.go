@@ -0,0 +1,155 @@
+package protocol
+
+import (
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+// Encoding is how messages are written on a connection. Each side asks for
+// the encoding it wants to receive: the client in its hello, the server
+// back in connected. Either way the frame type gives the encoding away, so
+// every message can be read whichever encoding the sender chose.
+type Encoding string
+
+const (
+	// EncodingJSON sends each message as a JSON text frame, as every
+	// version of the client understands
+	EncodingJSON Encoding = "json"
+
+	// EncodingBinary sends each message as a binary frame with a compact
+	// envelope: the type as a number, the IDs, the timestamp in
+	// milliseconds and then the payload's JSON as it is
+	EncodingBinary Encoding = "binary"
+)
+
+// The message types by their number in the binary encoding. Numbers are
+// part of the protocol, so new types only ever go on the end. Number 0 is
+// left for a type spelled out in full, e.g. one newer than this list.
+var binaryTypes = []MessageType{
+	"",
+	MsgConnected, MsgJoinLobby, MsgLeaveLobby, MsgCreateRoom, MsgRoomCreated,
+	MsgJoinRoom, MsgPlayerJoined, MsgLeaveRoom, MsgPlayerLeft, MsgStartGame,
+	MsgGameMove, MsgGameState, MsgGameEnded, MsgPlayerList, MsgRoomList,
+	MsgError, MsgChat, MsgSetAvatar, MsgPlayerUpdate, MsgSpectate,
+	MsgSeedReveal, MsgRatingUpdate, MsgSetName, MsgKickPlayer, MsgKicked,
+	MsgTransferHost, MsgRoomSettings, MsgSetReady, MsgCountdown, MsgRematch,
+	MsgTurnTimer, MsgIdleTimeout, MsgRoomAdded, MsgRoomUpdated, MsgRoomRemoved,
+	MsgAddBot,
+}
+
+var binaryTypeNumbers = func() map[MessageType]uint64 {
+	numbers := make(map[MessageType]uint64, len(binaryTypes))
+	for i, t := range binaryTypes[1:] {
+		numbers[t] = uint64(i + 1)
+	}
+	return numbers
+}()
+
+var errShortMessage = errors.New("binary message cut short")
+
+// WriteMessage writes a message to the connection in the given encoding
+func WriteMessage(conn *websocket.Conn, encoding Encoding, msg Message) error {
+	if encoding == EncodingBinary {
+		return conn.WriteMessage(websocket.BinaryMessage, MarshalBinary(msg))
+	}
+	return conn.WriteJSON(msg)
+}
+
+// ReadMessage reads the next message from the connection, in whichever
+// encoding it was sent
+func ReadMessage(conn *websocket.Conn) (Message, error) {
+	frameType, data, err := conn.ReadMessage()
+	if err != nil {
+		return Message{}, err
+	}
+	if frameType == websocket.BinaryMessage {
+		return UnmarshalBinary(data)
+	}
+	var msg Message
+	err = json.Unmarshal(data, &msg)
+	return msg, err
+}
+
+// MarshalBinary encodes a message in the binary encoding
+func MarshalBinary(msg Message) []byte {
+	size := 3*binary.MaxVarintLen64 + len(msg.PlayerID) + len(msg.RoomID) +
+		len(msg.GameType) + 2*binary.MaxVarintLen64 + len(msg.Data)
+	buf := make([]byte, 0, size)
+
+	number, known := binaryTypeNumbers[msg.Type]
+	buf = binary.AppendUvarint(buf, number)
+	if !known {
+		buf = appendString(buf, string(msg.Type))
+	}
+	buf = appendString(buf, msg.PlayerID)
+	buf = appendString(buf, msg.RoomID)
+	buf = appendString(buf, msg.GameType)
+	var millis int64
+	if !msg.Timestamp.IsZero() {
+		millis = msg.Timestamp.UnixMilli()
+	}
+	buf = binary.AppendVarint(buf, millis)
+	return append(buf, msg.Data...)
+}
+
+// UnmarshalBinary decodes a message in the binary encoding
+func UnmarshalBinary(data []byte) (Message, error) {
+	var msg Message
+
+	number, n := binary.Uvarint(data)
+	if n <= 0 {
+		return msg, errShortMessage
+	}
+	data = data[n:]
+	if number == 0 {
+		name, rest, err := readString(data)
+		if err != nil {
+			return msg, err
+		}
+		msg.Type, data = MessageType(name), rest
+	} else if number < uint64(len(binaryTypes)) {
+		msg.Type = binaryTypes[number]
+	} else {
+		return msg, fmt.Errorf("unknown message type %d", number)
+	}
+
+	for _, field := range []*string{&msg.PlayerID, &msg.RoomID, &msg.GameType} {
+		value, rest, err := readString(data)
+		if err != nil {
+			return msg, err
+		}
+		*field, data = value, rest
+	}
+
+	millis, n := binary.Varint(data)
+	if n <= 0 {
+		return msg, errShortMessage
+	}
+	if millis != 0 {
+		msg.Timestamp = time.UnixMilli(millis)
+	}
+	if rest := data[n:]; len(rest) > 0 {
+		msg.Data = json.RawMessage(rest)
+	}
+	return msg, nil
+}
+
+// Strings are written as their length and then their bytes
+func appendString(buf []byte, s string) []byte {
+	buf = binary.AppendUvarint(buf, uint64(len(s)))
+	return append(buf, s...)
+}
+
+func readString(data []byte) (string, []byte, error) {
+	length, n := binary.Uvarint(data)
+	if n <= 0 || uint64(len(data)-n) < length {
+		return "", nil, errShortMessage
+	}
+	end := n + int(length)
+	return string(data[n:end]), data[end:], nil
+}
@@ -0,0 +1,161 @@
+package protocol
+
+import (
+	"bytes"
+	"compress/flate"
+	"encoding/json"
+	"errors"
+	"math/rand"
+	"sync"
+	"testing"
+	"time"
+
+	"olive_and_millies_game_room/rules/yahtzee"
+)
+
+func TestBinaryRoundTrip(t *testing.T) {
+	sent := time.UnixMilli(1792259662123)
+	tests := []Message{
+		// A type newer than the numbered list is spelled out in full
+		{Type: "future_type", PlayerID: "p1", Data: json.RawMessage(`{"a":1}`)},
+		{Type: MsgChat},
+		{Type: MsgChat, Timestamp: sent},
+	}
+	for _, msgType := range binaryTypes[1:] {
+		tests = append(tests, Message{
+			Type:      msgType,
+			PlayerID:  "20261017175422q98nn8",
+			RoomID:    "20261017175422w85k3j",
+			GameType:  "yahtzee",
+			Data:      json.RawMessage(`{"text":"hi"}`),
+			Timestamp: sent,
+		})
+	}
+	for _, msg := range tests {
+		data := MarshalBinary(msg)
+		got, err := UnmarshalBinary(data)
+		if err != nil {
+			t.Errorf("%s: %v", msg.Type, err)
+			continue
+		}
+		if got.Type != msg.Type || got.PlayerID != msg.PlayerID || got.RoomID != msg.RoomID ||
+			got.GameType != msg.GameType || !bytes.Equal(got.Data, msg.Data) || !got.Timestamp.Equal(msg.Timestamp) {
+			t.Errorf("sent %+v, got back %+v", msg, got)
+		}
+
+		// Cut anywhere before the payload, the message can't be read
+		header := len(MarshalBinary(Message{Type: msg.Type, PlayerID: msg.PlayerID, RoomID: msg.RoomID,
+			GameType: msg.GameType, Timestamp: msg.Timestamp}))
+		for n := 0; n < header; n++ {
+			if _, err := UnmarshalBinary(data[:n]); !errors.Is(err, errShortMessage) {
+				t.Errorf("%s cut to %d bytes: got %v", msg.Type, n, err)
+			}
+		}
+	}
+}
+
+// The benchmarks measure what a move costs on the wire in a full, 20-player
+// Yahtzee room: every player gets the move and the game state after it,
+// each encoded separately for each player's connection, as the server's
+// writers do. Compression is measured the way the server negotiates it,
+// without context takeover, so every message is compressed on its own.
+//
+//	go test -bench . ./protocol
+const benchRoomSize = 20
+
+type wireSetup struct {
+	name     string
+	encoding Encoding
+	deflate  bool
+}
+
+var wireSetups = []wireSetup{
+	{"JSON", EncodingJSON, false},
+	{"JSON+deflate", EncodingJSON, true},
+	{"Binary", EncodingBinary, false},
+	{"Binary+deflate", EncodingBinary, true},
+}
+
+// BenchmarkMoveBroadcast reports the server's time to encode a move for the
+// whole room, and the bytes each player receives for it
+func BenchmarkMoveBroadcast(b *testing.B) {
+	move, state := sampleMove()
+	for _, s := range wireSetups {
+		b.Run(s.name, func(b *testing.B) {
+			b.ReportAllocs()
+			for i := 0; i < b.N; i++ {
+				for p := 0; p < benchRoomSize; p++ {
+					s.encode(move)
+					s.encode(state)
+				}
+			}
+			b.ReportMetric(float64(len(s.encode(move))), "move-bytes")
+			b.ReportMetric(float64(len(s.encode(state))), "state-bytes")
+		})
+	}
+}
+
+// A roll partway through the game, and the state it leaves the room in
+func sampleMove() (Message, Message) {
+	rng := rand.New(rand.NewSource(1))
+	state := yahtzee.New(benchRoomSize)
+
+	// Play six rounds so the scorecards are partly filled in
+	for turn := 0; turn < 6*benchRoomSize; turn++ {
+		seat := state.CurrentPlayer
+		state.Apply(seat, state.RollMove(rng))
+		state.Apply(seat, yahtzee.Move{Action: "score", Category: int(state.BestCategory())})
+	}
+	roll := state.RollMove(rng)
+	state.Apply(state.CurrentPlayer, roll)
+
+	// IDs shaped like the server's
+	roomID := "20261017175422w85k3j"
+	playerID := "20261017175422q98nn8"
+	moveMsg := Message{
+		Type:      MsgGameMove,
+		PlayerID:  playerID,
+		RoomID:    roomID,
+		GameType:  "yahtzee",
+		Data:      Encode(roll),
+		Timestamp: time.Now(),
+	}
+	stateMsg := Message{
+		Type:      MsgGameState,
+		RoomID:    roomID,
+		GameType:  "yahtzee",
+		Data:      Encode(state),
+		Timestamp: time.Now(),
+	}
+	return moveMsg, stateMsg
+}
+
+// The message's frame payload, leaving out the few bytes of WebSocket frame
+// header
+func (s wireSetup) encode(msg Message) []byte {
+	var data []byte
+	if s.encoding == EncodingBinary {
+		data = MarshalBinary(msg)
+	} else {
+		data, _ = json.Marshal(msg)
+	}
+	if !s.deflate {
+		return data
+	}
+
+	// As permessage-deflate does it: the fastest level, with the empty
+	// block that ends each flush left off, reusing writers the way
+	// gorilla/websocket pools them
+	var buf bytes.Buffer
+	fw := flateWriters.Get().(*flate.Writer)
+	fw.Reset(&buf)
+	fw.Write(data)
+	fw.Flush()
+	flateWriters.Put(fw)
+	return buf.Bytes()[:buf.Len()-4]
+}
+
+var flateWriters = sync.Pool{New: func() interface{} {
+	fw, _ := flate.NewWriter(nil, flate.BestSpeed)
+	return fw
+}}
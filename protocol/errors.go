@@ -0,0 +1,38 @@
+package protocol
+
+// ErrorCode says what went wrong with a request, for the client to act on.
+// The message that comes with it is for people.
+type ErrorCode string
+
+const (
+	ErrBadRequest       ErrorCode = "bad_request"     // Malformed or out of range data
+	ErrUpdateRequired   ErrorCode = "update_required" // The server won't talk to this client version
+	ErrNotInRoom        ErrorCode = "not_in_room"
+	ErrRoomNotFound     ErrorCode = "room_not_found"
+	ErrPlayerNotFound   ErrorCode = "player_not_found"
+	ErrPasswordRequired ErrorCode = "password_required"
+	ErrWrongPassword    ErrorCode = "wrong_password"
+	ErrRemoved          ErrorCode = "removed" // The host kicked the player out of this room
+	ErrRoomLocked       ErrorCode = "room_locked"
+	ErrRoomFull         ErrorCode = "room_full"
+	ErrGameStarted      ErrorCode = "game_started" // Or about to, once the countdown's begun
+	ErrGameNotStarted   ErrorCode = "game_not_started"
+	ErrGameNotOver      ErrorCode = "game_not_over"
+	ErrNotHost          ErrorCode = "not_host"
+	ErrSpectator        ErrorCode = "spectator" // Spectators can't do that
+	ErrNotEnoughPlayers ErrorCode = "not_enough_players"
+	ErrNotReady         ErrorCode = "not_ready"
+	ErrNotYourTurn      ErrorCode = "not_your_turn"
+	ErrIllegalMove      ErrorCode = "illegal_move"
+)
+
+// Error is the payload of an error message
+type Error struct {
+	Code    ErrorCode `json:"code"`
+	Message string    `json:"error"`
+}
+
+// NewError builds an error message
+func NewError(code ErrorCode, message string) Message {
+	return NewMessage(MsgError, Error{Code: code, Message: message})
+}
@@ -0,0 +1,79 @@
+package protocol
+
+// The game tables below are what the client offers and the server
+// enforces, kept here so the two can't disagree.
+
+// GameTypes lists every game the server hosts.
+var GameTypes = []string{"connect_four", "santorini", "yahtzee", "memory"}
+
+// KnownGame reports whether gameType is one of GameTypes.
+func KnownGame(gameType string) bool {
+	for _, g := range GameTypes {
+		if g == gameType {
+			return true
+		}
+	}
+	return false
+}
+
+// SeatLimits is the fewest and most players a game can seat. Hosts can
+// lower a room's seat count anywhere within these.
+func SeatLimits(gameType string) (min, max int) {
+	switch gameType {
+	case "yahtzee", "memory":
+		return 1, 20
+	default:
+		return 2, 2
+	}
+}
+
+// TimeControls lists the time limits, in seconds, a room can pick for its
+// game, starting with 0 for no limit. Memory times every card turned over,
+// Yahtzee every turn, and the two-player board games give each player a
+// chess clock for the whole game.
+func TimeControls(gameType string) []int {
+	switch gameType {
+	case "memory":
+		return []int{0, 10, 20, 30}
+	case "yahtzee":
+		return []int{0, 30, 60, 120}
+	case "connect_four":
+		return []int{0, 60, 180, 300}
+	case "santorini":
+		return []int{0, 180, 300, 600}
+	default:
+		return []int{0}
+	}
+}
+
+// ValidTimeControl reports whether seconds is one of the game's time
+// controls.
+func ValidTimeControl(gameType string, seconds int) bool {
+	for _, limit := range TimeControls(gameType) {
+		if limit == seconds {
+			return true
+		}
+	}
+	return false
+}
+
+// ClockedGame reports whether the game is played on a chess clock, where
+// each player's time only runs down on their own turns and running out
+// loses the game.
+func ClockedGame(gameType string) bool {
+	return gameType == "connect_four" || gameType == "santorini"
+}
+
+// botGames are the games that can seat computer players
+var botGames = map[string]bool{
+	"connect_four": true,
+	"santorini":    true,
+	"yahtzee":      true,
+	"memory":       true,
+}
+
+// HasComputerPlayers reports whether a room for the game can seat computer
+// players.
+func HasComputerPlayers(gameType string) bool {
+	return botGames[gameType]
+}
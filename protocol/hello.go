@@ -0,0 +1,43 @@
+package protocol
+
+import (
+	"net/url"
+	"strconv"
+)
+
+// Hello is what a client says about itself when it connects: which release
+// it is, the newest protocol version it speaks and the encoding it would
+// like messages in. It rides on the
+// WebSocket handshake's query string, so the server knows who it's talking
+// to before it sends anything.
+type Hello struct {
+	ClientVersion   string // e.g. "1.0.21"
+	ProtocolVersion int
+	Encoding        Encoding
+}
+
+// Add the hello to a connection URL's query
+func (h Hello) Add(q url.Values) {
+	q.Set("client_version", h.ClientVersion)
+	q.Set("protocol_version", strconv.Itoa(h.ProtocolVersion))
+	if h.Encoding != "" {
+		q.Set("encoding", string(h.Encoding))
+	}
+}
+
+// ReadHello reads the hello from a connection's query. Clients from before
+// the handshake don't send one, and are taken to speak version 1 in JSON.
+func ReadHello(q url.Values) Hello {
+	hello := Hello{
+		ClientVersion:   q.Get("client_version"),
+		ProtocolVersion: 1,
+		Encoding:        EncodingJSON,
+	}
+	if Encoding(q.Get("encoding")) == EncodingBinary {
+		hello.Encoding = EncodingBinary
+	}
+	if v, err := strconv.Atoi(q.Get("protocol_version")); err == nil {
+		hello.ProtocolVersion = v
+	}
+	return hello
+}
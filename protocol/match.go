@@ -0,0 +1,35 @@
+package protocol
+
+import (
+	"encoding/json"
+	"time"
+)
+
+// MatchRecord is a finished game as the server keeps it in its match
+// history and serves it to replays
+type MatchRecord struct {
+	ID        string        `json:"id"`
+	GameType  string        `json:"game_type"`
+	Players   []MatchPlayer `json:"players"` // In seat order
+	Moves     []MatchMove   `json:"moves,omitempty"`
+	Scores    []int         `json:"scores,omitempty"` // Per seat, for games that keep score
+	Winner    int           `json:"winner"`           // Winning seat, -1 for a draw or tie
+	Seed      string        `json:"seed"`             // Revealed seed, replays the dice and shuffles
+	StartedAt time.Time     `json:"started_at"`
+	EndedAt   time.Time     `json:"ended_at"`
+}
+
+type MatchPlayer struct {
+	ID     string `json:"id"`
+	Name   string `json:"name"`
+	Avatar int    `json:"avatar"`
+	Bot    string `json:"bot,omitempty"` // A computer player's difficulty
+}
+
+// MatchMove is one move as the server applied it, with anything the server
+// filled in (like Yahtzee dice), so a replay doesn't need the RNG
+type MatchMove struct {
+	Seat int             `json:"seat"`
+	Data json.RawMessage `json:"data"`
+	Time time.Time       `json:"time"`
+}
@@ -0,0 +1,233 @@
+package protocol
+
+import "olive_and_millies_game_room/rules/yahtzee"
+
+// Payloads the client sends. Moves (game_move) carry the game's own move
+// type from its rules package, and game_state carries its State.
+
+// JoinLobby subscribes to the room list for a game type, replacing any
+// earlier subscription; leave_lobby ends it. From protocol version 3.
+type JoinLobby struct {
+	GameType string `json:"game_type"`
+}
+
+// CreateRoom opens a new room for the sender
+type CreateRoom struct {
+	GameType  string `json:"game_type"`
+	RoomName  string `json:"room_name"`
+	Private   bool   `json:"private"`
+	Password  string `json:"password,omitempty"` // Optional, private rooms only
+	TimeLimit int    `json:"time_limit"`         // One of the game's time controls, 0 for none
+}
+
+// JoinRoom takes a seat in a room from the room list by ID, or in any room
+// by its code
+type JoinRoom struct {
+	RoomID   string `json:"room_id,omitempty"`
+	Code     string `json:"code,omitempty"`
+	Password string `json:"password,omitempty"`
+}
+
+type Spectate struct {
+	RoomID string `json:"room_id"`
+}
+
+// StartRequest asks to count down to the game. Force lets the host start
+// without waiting for everyone to be ready.
+type StartRequest struct {
+	Force bool `json:"force"`
+}
+
+type SetReady struct {
+	Ready bool `json:"ready"`
+}
+
+// RematchVote is for, or taking back a vote for, playing again
+type RematchVote struct {
+	Accept bool `json:"accept"`
+}
+
+type SetAvatar struct {
+	Avatar int `json:"avatar"`
+}
+
+type SetName struct {
+	Name string `json:"name"`
+}
+
+type KickPlayer struct {
+	PlayerID string `json:"player_id"`
+}
+
+type TransferHost struct {
+	PlayerID string `json:"player_id"`
+}
+
+type RoomSettings struct {
+	MaxPlayers int  `json:"max_players"`
+	Locked     bool `json:"locked"`
+}
+
+// AddBot seats a computer player in the host's room, playing at "easy",
+// "medium" or "hard"
+type AddBot struct {
+	Difficulty string `json:"difficulty"`
+}
+
+// Chat goes both ways; the server fills in the sender's name
+type Chat struct {
+	Name string `json:"name,omitempty"`
+	Text string `json:"text"`
+}
+
+// Payloads the server sends
+
+// Connected tells a player who they are once their connection is set up.
+// The account key is only sent when the account is new. ProtocolVersion is
+// the version agreed for this connection, which may be older than the
+// client's own, and Encoding is how the server would like messages back.
+type Connected struct {
+	SessionToken    string   `json:"session_token"`
+	Resumed         bool     `json:"resumed"`
+	Name            string   `json:"name"`
+	Avatar          int      `json:"avatar"`
+	PlayerKey       string   `json:"player_key,omitempty"`
+	ProtocolVersion int      `json:"protocol_version"`
+	Encoding        Encoding `json:"encoding,omitempty"`
+}
+
+// RoomCreated confirms a new room, with the code to share
+type RoomCreated struct {
+	Code    string `json:"code"`
+	Private bool   `json:"private"`
+}
+
+// RoomList is every room the player can see. From protocol version 3 it's
+// a snapshot of the player's subscription, and the changes in between come
+// as room_added and room_updated, each carrying a RoomInfo, and
+// room_removed, with just the message's RoomID.
+type RoomList struct {
+	Rooms []RoomInfo `json:"rooms"`
+}
+
+type RoomInfo struct {
+	ID         string       `json:"id"`
+	Name       string       `json:"name"`
+	GameType   string       `json:"game_type"`
+	Players    int          `json:"players"`
+	MaxPlayers int          `json:"max_players"`
+	Started    bool         `json:"started"`
+	Watchers   int          `json:"watchers"`
+	Members    []RoomMember `json:"members"`
+	Code       string       `json:"code"`                 // Shared to invite people in
+	Private    bool         `json:"private,omitempty"`    // Only listed for its members
+	Host       string       `json:"host"`                 // Player ID of the room's host
+	Locked     bool         `json:"locked,omitempty"`     // Closed to new players
+	TimeLimit  int          `json:"time_limit,omitempty"` // The room's time control, 0 for none
+}
+
+// RoomMember is a seated player as shown in the room list
+type RoomMember struct {
+	ID     string `json:"id"`
+	Name   string `json:"name"`
+	Rating int    `json:"rating,omitempty"` // Unset for unrated games
+	Ready  bool   `json:"ready"`
+	Bot    string `json:"bot,omitempty"` // A computer player's difficulty, unset for people
+}
+
+// IsReady is whether the player has said they're ready to start
+func (room *RoomInfo) IsReady(playerID string) bool {
+	for _, member := range room.Members {
+		if member.ID == playerID {
+			return member.Ready
+		}
+	}
+	return false
+}
+
+// EveryoneReady is whether every player but the host is ready, which lets
+// the host start the game
+func (room *RoomInfo) EveryoneReady() bool {
+	for _, member := range room.Members {
+		if member.ID != room.Host && !member.Ready {
+			return false
+		}
+	}
+	return true
+}
+
+// PlayerUpdate is a player in the room changing their name or avatar
+type PlayerUpdate struct {
+	PlayerID string `json:"player_id"`
+	Avatar   int    `json:"avatar"`
+	Name     string `json:"name"`
+}
+
+// Countdown is the seconds left before the game starts, 0 if it's been
+// called off
+type Countdown struct {
+	Seconds int `json:"seconds"`
+}
+
+// StartGame starts the game for one player, or for a spectator with a
+// PlayerNumber of -1
+type StartGame struct {
+	PlayerNumber   int          `json:"player_number"`
+	Spectator      bool         `json:"spectator"`
+	TotalPlayers   int          `json:"total_players"`
+	Players        []PlayerInfo `json:"players"`
+	SeedCommitment string       `json:"seed_commitment"` // SHA-256 of the game's seed
+	Cards          int          `json:"cards,omitempty"` // How many cards Memory is dealt, face down
+}
+
+// PlayerInfo is a seated player as the game shows them
+type PlayerInfo struct {
+	ID     string `json:"id"`
+	Name   string `json:"name"`
+	Avatar int    `json:"avatar"`
+	Rating int    `json:"rating,omitempty"`
+	Bot    string `json:"bot,omitempty"` // A computer player's difficulty
+}
+
+// SeedReveal gives away the seed behind a finished game, along with
+// everything the game drew from it
+type SeedReveal struct {
+	Seed       string         `json:"seed"` // Hex
+	Commitment string         `json:"commitment"`
+	Rolls      []yahtzee.Roll `json:"rolls,omitempty"` // Every Yahtzee roll, in order
+}
+
+// RatingUpdate is everyone's new rating after a rated game, by seat
+type RatingUpdate struct {
+	Ratings []RatingChange `json:"ratings"`
+}
+
+type RatingChange struct {
+	Rating int `json:"rating"`
+	Change int `json:"change"`
+}
+
+// RematchStatus is who wants a rematch so far and the series tally in seat
+// order. Cancelled means someone left and the room is back to waiting.
+type RematchStatus struct {
+	Accepted  []string      `json:"accepted"`
+	Games     int           `json:"games"`
+	Series    []SeriesScore `json:"series"`
+	Cancelled bool          `json:"cancelled"`
+}
+
+// SeriesScore is a player's running tally over every game in the room
+type SeriesScore struct {
+	ID     string `json:"id"`
+	Name   string `json:"name"`
+	Wins   int    `json:"wins"`
+	Points int    `json:"points"`
+}
+
+// TurnTimer is whose time is running and how much of it is left
+type TurnTimer struct {
+	Seat        int       `json:"seat"` // -1 once the game is over
+	SecondsLeft float64   `json:"seconds_left"`
+	Limit       int       `json:"limit"`
+	Clocks      []float64 `json:"clocks,omitempty"` // Every seat's clock, for chess clocks
+}
@@ -0,0 +1,99 @@
+// Package protocol defines the messages the client and server exchange over
+// the WebSocket connection.
+//
+// Every message is a Message envelope whose Data holds one of this
+// package's payload structs, chosen by its Type. Both sides import the same
+// definitions, so they can't drift apart.
+package protocol
+
+import (
+	"encoding/json"
+	"time"
+)
+
+// Version is bumped whenever a change to the messages would break a client
+// or server that doesn't know about it. Each connection speaks the older of
+// the client's and the server's versions.
+const Version = 4
+
+// MinVersion is the oldest version the server still talks to. Memory
+// games need version 4, which turns cards over with their faces in the
+// moves rather than dealing every client the layout, so older clients,
+// and those from before the hello handshake that count as version 1, are
+// asked to update.
+const MinVersion = 4
+
+type MessageType string
+
+const (
+	MsgConnected    MessageType = "connected"
+	MsgJoinLobby    MessageType = "join_lobby"
+	MsgLeaveLobby   MessageType = "leave_lobby"
+	MsgCreateRoom   MessageType = "create_room"
+	MsgRoomCreated  MessageType = "room_created"
+	MsgJoinRoom     MessageType = "join_room"
+	MsgPlayerJoined MessageType = "player_joined"
+	MsgLeaveRoom    MessageType = "leave_room"
+	MsgPlayerLeft   MessageType = "player_left"
+	MsgStartGame    MessageType = "start_game"
+	MsgGameMove     MessageType = "game_move"
+	MsgGameState    MessageType = "game_state"
+	MsgGameEnded    MessageType = "game_ended"
+	MsgPlayerList   MessageType = "player_list"
+	MsgRoomList     MessageType = "room_list"
+	MsgError        MessageType = "error"
+	MsgChat         MessageType = "chat"
+	MsgSetAvatar    MessageType = "set_avatar"
+	MsgPlayerUpdate MessageType = "player_update"
+	MsgSpectate     MessageType = "spectate"
+	MsgSeedReveal   MessageType = "seed_reveal"
+	MsgRatingUpdate MessageType = "rating_update"
+	MsgSetName      MessageType = "set_name"
+	MsgKickPlayer   MessageType = "kick_player"
+	MsgKicked       MessageType = "kicked"
+	MsgTransferHost MessageType = "transfer_host"
+	MsgRoomSettings MessageType = "room_settings"
+	MsgSetReady     MessageType = "set_ready"
+	MsgCountdown    MessageType = "countdown"
+	MsgRematch      MessageType = "rematch"
+	MsgTurnTimer    MessageType = "turn_timer"
+	MsgIdleTimeout  MessageType = "idle_timeout"
+	MsgRoomAdded    MessageType = "room_added"
+	MsgRoomUpdated  MessageType = "room_updated"
+	MsgRoomRemoved  MessageType = "room_removed"
+	MsgAddBot       MessageType = "add_bot"
+)
+
+type Message struct {
+	Type      MessageType     `json:"type"`
+	PlayerID  string          `json:"player_id,omitempty"`
+	RoomID    string          `json:"room_id,omitempty"`
+	GameType  string          `json:"game_type,omitempty"`
+	Data      json.RawMessage `json:"data,omitempty"`
+	Timestamp time.Time       `json:"timestamp"`
+}
+
+// NewMessage builds a message of the given type carrying payload, which is
+// left out if it's nil
+func NewMessage(msgType MessageType, payload interface{}) Message {
+	msg := Message{
+		Type:      msgType,
+		Timestamp: time.Now(),
+	}
+	if payload != nil {
+		msg.Data = Encode(payload)
+	}
+	return msg
+}
+
+// Encode marshals a payload. Payloads are plain data, so this can't fail
+// for any of the types in this package.
+func Encode(payload interface{}) json.RawMessage {
+	data, _ := json.Marshal(payload)
+	return data
+}
+
+// Decode unmarshals the message's payload into v
+func (m Message) Decode(v interface{}) error {
+	return json.Unmarshal(m.Data, v)
+}
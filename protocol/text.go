@@ -0,0 +1,35 @@
+package protocol
+
+import (
+	"strings"
+	"unicode"
+)
+
+// The longest display and room names, in characters
+const (
+	MaxNameLength     = 20
+	MaxRoomNameLength = 32
+)
+
+// CleanText collapses whitespace, drops control characters and cuts the
+// text down to maxLength characters. The client tidies what's typed the
+// same way the server will, so what the player sees is what's saved.
+func CleanText(text string, maxLength int) string {
+	text = strings.Map(func(r rune) rune {
+		if unicode.IsControl(r) {
+			return ' '
+		}
+		return r
+	}, text)
+	text = strings.Join(strings.Fields(text), " ")
+	if runes := []rune(text); len(runes) > maxLength {
+		text = strings.TrimSpace(string(runes[:maxLength]))
+	}
+	return text
+}
+
+// CleanName tidies a display name, returning "" if there's nothing usable
+// left.
+func CleanName(name string) string {
+	return CleanText(name, MaxNameLength)
+}
@@ -0,0 +1,123 @@
+package main
+
+import (
+	"fmt"
+	"image/color"
+	"sync"
+
+	"github.com/hajimehoshi/ebiten/v2"
+	"github.com/hajimehoshi/ebiten/v2/ebitenutil"
+	"github.com/hajimehoshi/ebiten/v2/inpututil"
+	"github.com/hajimehoshi/ebiten/v2/vector"
+
+	"olive_and_millies_game_room/protocol"
+)
+
+const (
+	rematchPanelWidth = 450
+	rematchPanelY     = screenHeight/2 + 70 // Just under the winner banner
+)
+
+// RematchPanel is drawn under the result once an online game is over. It
+// shows the series so far and lets the players vote to go again; the
+// server restarts the room when everyone has.
+type RematchPanel struct {
+	networkClient *NetworkClient
+	button        *Button
+	seated        bool // Spectators see the tally but don't vote
+	accepted      []string
+	series        []protocol.SeriesScore
+	games         int
+	mu            sync.Mutex
+}
+
+func NewRematchPanel(nc *NetworkClient, seated bool) *RematchPanel {
+	return &RematchPanel{
+		networkClient: nc,
+		seated:        seated,
+		button: &Button{
+			x:       float64(screenWidth/2) - 100,
+			width:   200,
+			height:  40,
+			text:    "REMATCH",
+			enabled: true,
+		},
+	}
+}
+
+// SetStatus is called from the network goroutine with the latest votes
+func (p *RematchPanel) SetStatus(accepted []string, series []protocol.SeriesScore, games int) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	p.accepted = accepted
+	p.series = series
+	p.games = games
+	p.button.y = float64(rematchPanelY + 32 + len(series)*16)
+}
+
+// Whether we've voted for the rematch. Must be called with p.mu held.
+func (p *RematchPanel) accepting() bool {
+	myID := p.networkClient.GetPlayerID()
+	for _, id := range p.accepted {
+		if id == myID {
+			return true
+		}
+	}
+	return false
+}
+
+func (p *RematchPanel) Update() {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if !p.seated {
+		return
+	}
+
+	mx, my := ebiten.CursorPosition()
+	p.button.hovered = p.button.Contains(mx, my)
+	if p.button.hovered && inpututil.IsMouseButtonJustPressed(ebiten.MouseButtonLeft) {
+		p.networkClient.Rematch(!p.accepting())
+	}
+}
+
+func (p *RematchPanel) Draw(screen *ebiten.Image) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	height := float32(50 + len(p.series)*16)
+	if p.seated {
+		height += 50
+	}
+	x := float32(screenWidth/2) - rematchPanelWidth/2
+	y := float32(rematchPanelY)
+	vector.DrawFilledRect(screen, x, y, rematchPanelWidth, height, color.RGBA{30, 50, 80, 240}, false)
+	vector.StrokeRect(screen, x, y, rematchPanelWidth, height, 2, color.RGBA{100, 150, 220, 255}, false)
+
+	titleText := fmt.Sprintf("SERIES - %d GAMES", p.games)
+	if p.games == 1 {
+		titleText = "SERIES - 1 GAME"
+	}
+	ebitenutil.DebugPrintAt(screen, titleText, screenWidth/2-len(titleText)*3, int(y)+8)
+	ebitenutil.DebugPrintAt(screen, titleText, screenWidth/2-len(titleText)*3+1, int(y)+8)
+
+	for i, score := range p.series {
+		scoreText := fmt.Sprintf("%s: %d wins", score.Name, score.Wins)
+		if score.Points > 0 {
+			scoreText += fmt.Sprintf(", %d points", score.Points)
+		}
+		ebitenutil.DebugPrintAt(screen, scoreText, screenWidth/2-len(scoreText)*3, int(y)+26+i*16)
+	}
+
+	votesText := fmt.Sprintf("%d of %d want a rematch", len(p.accepted), len(p.series))
+	ebitenutil.DebugPrintAt(screen, votesText, screenWidth/2-len(votesText)*3, int(y+height)-20)
+
+	if p.seated {
+		p.button.text = "REMATCH"
+		if p.accepting() {
+			p.button.text = "CANCEL REMATCH"
+		}
+		DrawButton(screen, p.button)
+	}
+}
@@ -0,0 +1,446 @@
+package main
+
+import (
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"image/color"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/hajimehoshi/ebiten/v2"
+	"github.com/hajimehoshi/ebiten/v2/ebitenutil"
+	"github.com/hajimehoshi/ebiten/v2/inpututil"
+	"github.com/hajimehoshi/ebiten/v2/vector"
+
+	"olive_and_millies_game_room/protocol"
+	"olive_and_millies_game_room/rules"
+	"olive_and_millies_game_room/rules/connectfour"
+	"olive_and_millies_game_room/rules/memory"
+	"olive_and_millies_game_room/rules/santorini"
+	"olive_and_millies_game_room/rules/yahtzee"
+)
+
+const (
+	replaysPerPage = 7
+	replayBaseTick = 60 // Ticks between moves at 1x speed
+)
+
+var replaySpeeds = []float64{0.5, 1, 2, 4}
+
+// ReplayScreen lists recorded games and plays them back move by move
+type ReplayScreen struct {
+	matches      []*protocol.MatchRecord // The page of matches on show
+	total        int                     // How many matches the server has
+	page         int
+	loading      bool // Waiting on a page or a match from the server
+	status       string
+	pages        chan historyPage           // Pages fetched in the background
+	loaded       chan *protocol.MatchRecord // Matches fetched in the background, nil if one couldn't be
+	matchButtons []*Button
+	prevButton   *Button
+	nextButton   *Button
+	backButton   *Button
+
+	// Playing back a match
+	match      *protocol.MatchRecord
+	game       GameInterface
+	position   int // Number of moves applied
+	playing    bool
+	speedIndex int
+	ticks      int
+	controls   []*Button // Start, step back, play/pause, step forward, speed
+}
+
+// A page of the match history as fetched, err set if it couldn't be
+type historyPage struct {
+	page    int
+	matches []*protocol.MatchRecord
+	total   int
+	err     error
+}
+
+func NewReplayScreen() *ReplayScreen {
+	rs := &ReplayScreen{
+		status:     "Loading past games...",
+		pages:      make(chan historyPage, 1),
+		loaded:     make(chan *protocol.MatchRecord, 1),
+		speedIndex: 1,
+		prevButton: &Button{x: float64(screenWidth/2) - 220, y: float64(screenHeight - 100), width: 200, height: 50, text: "NEWER", enabled: true},
+		nextButton: &Button{x: float64(screenWidth/2) + 20, y: float64(screenHeight - 100), width: 200, height: 50, text: "OLDER", enabled: true},
+		backButton: &Button{x: 20, y: float64(screenHeight - 70), width: 150, height: 50, text: "BACK", enabled: true},
+	}
+
+	labels := []string{"|<", "<", "PLAY", ">", "1x"}
+	controlWidth := 90.0
+	startX := float64(screenWidth)/2 - (controlWidth*float64(len(labels))+10*float64(len(labels)-1))/2
+	for i, label := range labels {
+		rs.controls = append(rs.controls, &Button{
+			x:       startX + float64(i)*(controlWidth+10),
+			y:       float64(screenHeight - 45),
+			width:   controlWidth,
+			height:  36,
+			text:    label,
+			enabled: true,
+		})
+	}
+
+	rs.loadMatches(0)
+	return rs
+}
+
+// Fetch a page of past matches from the server in the background. Only
+// one fetch runs at a time, and Update takes its result.
+func (rs *ReplayScreen) loadMatches(page int) {
+	rs.loading = true
+	go func() {
+		var data struct {
+			Matches []*protocol.MatchRecord `json:"matches"`
+			Total   int                     `json:"total"`
+		}
+		err := fetchJSON(historyPageURL(page*replaysPerPage, replaysPerPage), &data)
+		rs.pages <- historyPage{page: page, matches: data.Matches, total: data.Total, err: err}
+	}()
+}
+
+// Fetch one match with its moves in the background, for Update to start
+// playing back
+func (rs *ReplayScreen) loadMatch(id string) {
+	rs.loading = true
+	rs.status = "Loading game..."
+	go func() {
+		var match protocol.MatchRecord
+		if err := fetchJSON(historyURL(id), &match); err != nil {
+			log.Printf("Failed to load match %s: %v", id, err)
+			rs.loaded <- nil
+			return
+		}
+		rs.loaded <- &match
+	}()
+}
+
+// Take whatever the background fetches have finished
+func (rs *ReplayScreen) receive() {
+	select {
+	case page := <-rs.pages:
+		rs.loading = false
+		if page.err != nil {
+			log.Printf("Failed to load match history: %v", page.err)
+			rs.status = "Couldn't load past games"
+			return
+		}
+		rs.matches = page.matches
+		rs.total = page.total
+		rs.page = page.page
+		rs.status = ""
+		if rs.total == 0 {
+			rs.status = "No games have been played yet"
+		}
+	case match := <-rs.loaded:
+		rs.loading = false
+		if match == nil {
+			rs.status = "Couldn't load that game"
+			return
+		}
+		rs.match = match
+		rs.position = 0
+		rs.playing = false
+		rs.ticks = 0
+		rs.game = rs.newGame()
+		rs.status = ""
+	default:
+	}
+}
+
+func fetchJSON(url string, v interface{}) error {
+	client := &http.Client{Timeout: 10 * time.Second}
+	resp, err := client.Get(url)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("server returned %s", resp.Status)
+	}
+	return json.NewDecoder(resp.Body).Decode(v)
+}
+
+// Set up the match's game as it was before the first move
+func (rs *ReplayScreen) newGame() GameInterface {
+	players := make([]protocol.PlayerInfo, len(rs.match.Players))
+	for i, p := range rs.match.Players {
+		players[i] = protocol.PlayerInfo{Name: p.Name, Avatar: p.Avatar}
+	}
+
+	switch rs.match.GameType {
+	case "connect_four":
+		return NewConnectFourGameWithPlayers(nil, 0, players)
+	case "santorini":
+		return NewSantoriniGameWithPlayers(nil, 0, players)
+	case "yahtzee":
+		return NewYahtzeeGameWithPlayers(nil, 0, players)
+	case "memory":
+		// Each recorded flip carries its card's face, but games recorded
+		// before they did need the layout dealt from the game's seed
+		layout := memory.Hidden(memory.NumCards)
+		if seed, err := hex.DecodeString(rs.match.Seed); err == nil && len(seed) > 0 {
+			layout = memory.Shuffle(rules.NewRand(seed))
+		}
+		return NewMemoryGameWithPlayers(nil, 0, players, layout)
+	}
+	return nil
+}
+
+// Play the next recorded move through the game's own move code
+func (rs *ReplayScreen) stepForward() {
+	if rs.position >= len(rs.match.Moves) {
+		rs.playing = false
+		return
+	}
+	data := rs.match.Moves[rs.position].Data
+	rs.position++
+
+	switch g := rs.game.(type) {
+	case *ConnectFourGame:
+		var move connectfour.Move
+		if json.Unmarshal(data, &move) == nil {
+			g.applyMove(move)
+		}
+	case *SantoriniGame:
+		var move santorini.Move
+		if json.Unmarshal(data, &move) == nil {
+			g.applyMove(move)
+		}
+	case *YahtzeeGame:
+		var move yahtzee.Move
+		if json.Unmarshal(data, &move) == nil {
+			if move.Action == "score" {
+				g.scoreCategory(yahtzee.Category(move.Category))
+			} else {
+				g.applyMove(move)
+			}
+			g.updateButtons()
+		}
+	case *MemoryGame:
+		var move memory.Move
+		if json.Unmarshal(data, &move) == nil {
+			g.applyMove(move)
+		}
+	}
+}
+
+// Games can't be undone, so stepping back replays from the start
+func (rs *ReplayScreen) stepBack() {
+	target := rs.position - 1
+	if target < 0 {
+		return
+	}
+	rs.seek(target)
+}
+
+func (rs *ReplayScreen) seek(position int) {
+	rs.game = rs.newGame()
+	rs.position = 0
+	for rs.position < position {
+		rs.stepForward()
+	}
+}
+
+func (rs *ReplayScreen) Update(gr *GameRoom) error {
+	mx, my := ebiten.CursorPosition()
+	clicked := inpututil.IsMouseButtonJustPressed(ebiten.MouseButtonLeft)
+
+	rs.receive()
+	if rs.match != nil {
+		return rs.updatePlayback(mx, my, clicked)
+	}
+
+	if IsLogoClicked() {
+		gr.replayScreen = nil
+		return nil
+	}
+
+	rs.backButton.hovered = rs.backButton.Contains(mx, my)
+	if clicked && rs.backButton.hovered {
+		gr.replayScreen = nil
+		return nil
+	}
+	if rs.loading {
+		return nil
+	}
+
+	rs.updateMatchButtons()
+	rs.prevButton.enabled = rs.page > 0
+	rs.nextButton.enabled = (rs.page+1)*replaysPerPage < rs.total
+	rs.prevButton.hovered = rs.prevButton.Contains(mx, my)
+	rs.nextButton.hovered = rs.nextButton.Contains(mx, my)
+	for _, btn := range rs.matchButtons {
+		btn.hovered = btn.Contains(mx, my)
+	}
+
+	if clicked {
+		switch {
+		case rs.prevButton.enabled && rs.prevButton.hovered:
+			rs.loadMatches(rs.page - 1)
+		case rs.nextButton.enabled && rs.nextButton.hovered:
+			rs.loadMatches(rs.page + 1)
+		}
+		for i, btn := range rs.matchButtons {
+			if btn.hovered && !rs.loading {
+				rs.loadMatch(rs.matches[i].ID)
+			}
+		}
+	}
+	return nil
+}
+
+func (rs *ReplayScreen) updatePlayback(mx, my int, clicked bool) error {
+	// The logo goes back to the list of games
+	if IsLogoClicked() {
+		rs.match = nil
+		rs.game = nil
+		return nil
+	}
+
+	for _, btn := range rs.controls {
+		btn.hovered = btn.Contains(mx, my)
+	}
+
+	if clicked {
+		switch {
+		case rs.controls[0].hovered:
+			rs.playing = false
+			rs.seek(0)
+		case rs.controls[1].hovered:
+			rs.playing = false
+			rs.stepBack()
+		case rs.controls[2].hovered:
+			rs.playing = !rs.playing
+			if rs.playing && rs.position >= len(rs.match.Moves) {
+				rs.seek(0) // Play again from the start
+			}
+			rs.ticks = 0
+		case rs.controls[3].hovered:
+			rs.playing = false
+			rs.stepForward()
+		case rs.controls[4].hovered:
+			rs.speedIndex = (rs.speedIndex + 1) % len(replaySpeeds)
+		}
+	}
+
+	if rs.playing {
+		rs.ticks++
+		if float64(rs.ticks) >= replayBaseTick/replaySpeeds[rs.speedIndex] {
+			rs.ticks = 0
+			rs.stepForward()
+		}
+	}
+
+	rs.controls[2].text = "PLAY"
+	if rs.playing {
+		rs.controls[2].text = "PAUSE"
+	}
+	rs.controls[4].text = fmt.Sprintf("%gx", replaySpeeds[rs.speedIndex])
+	return nil
+}
+
+func (rs *ReplayScreen) updateMatchButtons() {
+	rs.matchButtons = rs.matchButtons[:0]
+	buttonWidth := 700.0
+	for i, match := range rs.matches {
+		rs.matchButtons = append(rs.matchButtons, &Button{
+			x:       float64(screenWidth/2) - buttonWidth/2,
+			y:       140 + float64(i)*70,
+			width:   buttonWidth,
+			height:  60,
+			text:    matchSummary(match),
+			enabled: true,
+		})
+	}
+}
+
+// One line description of a match for the list, e.g.
+// "SANTORINI: Owlive vs Teddy - won by Owlive (Oct 17 14:05)"
+func matchSummary(match *protocol.MatchRecord) string {
+	names := ""
+	for i, p := range match.Players {
+		if i > 0 {
+			names += " vs "
+		}
+		names += p.Name
+	}
+	if len(names) > 50 {
+		names = fmt.Sprintf("%d players", len(match.Players))
+	}
+
+	result := "a draw"
+	if match.Winner >= 0 && match.Winner < len(match.Players) {
+		result = "won by " + match.Players[match.Winner].Name
+	}
+	return fmt.Sprintf("%s: %s - %s (%s)", gameTitle(match.GameType), names, result,
+		match.EndedAt.Local().Format("Jan 2 15:04"))
+}
+
+func gameTitle(gameType string) string {
+	switch gameType {
+	case "connect_four":
+		return "CONNECT FOUR"
+	case "santorini":
+		return "SANTORINI"
+	case "yahtzee":
+		return "YAHTZEE"
+	case "memory":
+		return "MEMORY MATCH"
+	}
+	return gameType
+}
+
+func (rs *ReplayScreen) Draw(screen *ebiten.Image, gr *GameRoom) {
+	if rs.match != nil && rs.game != nil {
+		rs.game.Draw(screen, gr)
+		rs.drawControls(screen)
+		return
+	}
+
+	DrawForestBackground(screen)
+	DrawKodamaSpirits(screen)
+	DrawOMLogo(screen)
+
+	titleWidth := float32(400)
+	titleX := float32(screenWidth/2) - titleWidth/2
+	vector.DrawFilledRect(screen, titleX, 15, titleWidth, 45, color.RGBA{30, 50, 80, 255}, false)
+	vector.StrokeRect(screen, titleX, 15, titleWidth, 45, 2, color.RGBA{100, 150, 220, 255}, false)
+	titleText := "REPLAYS"
+	titleTextX := int(titleX + (titleWidth-float32(len(titleText)*6))/2)
+	ebitenutil.DebugPrintAt(screen, titleText, titleTextX, 32)
+	ebitenutil.DebugPrintAt(screen, titleText, titleTextX+1, 32)
+
+	if rs.status != "" {
+		ebitenutil.DebugPrintAt(screen, rs.status, screenWidth/2-len(rs.status)*3, 100)
+	}
+
+	if !rs.loading {
+		for _, btn := range rs.matchButtons {
+			DrawButton(screen, btn)
+		}
+		if rs.total > replaysPerPage {
+			DrawButton(screen, rs.prevButton)
+			DrawButton(screen, rs.nextButton)
+		}
+	}
+	DrawButton(screen, rs.backButton)
+}
+
+func (rs *ReplayScreen) drawControls(screen *ebiten.Image) {
+	barY := float32(screenHeight - 52)
+	vector.DrawFilledRect(screen, 0, barY, screenWidth, 52, color.RGBA{20, 30, 50, 220}, false)
+
+	for _, btn := range rs.controls {
+		DrawButton(screen, btn)
+	}
+
+	progress := fmt.Sprintf("Move %d/%d", rs.position, len(rs.match.Moves))
+	ebitenutil.DebugPrintAt(screen, progress, 20, screenHeight-32)
+}
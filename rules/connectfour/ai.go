@@ -0,0 +1,165 @@
+package connectfour
+
+import (
+	"math/rand"
+
+	"olive_and_millies_game_room/rules"
+)
+
+// How many moves ahead the computer looks at each level, and how often the
+// easy level just drops a piece anywhere instead
+const (
+	easyDepth   = 2
+	mediumDepth = 4
+	hardDepth   = 8
+	easyBlunder = 0.4
+)
+
+// Scores for a position, from the point of view of the player to move.
+// A win scores higher the sooner it comes.
+const (
+	winScore = 1000000
+	infinity = 2 * winScore
+)
+
+// Columns in the order the search tries them, middle first, as central
+// moves are usually best and trying them first prunes more of the tree
+var searchOrder = [Cols]int{3, 2, 4, 1, 5, 0, 6}
+
+// BestMove picks the computer's move for the player whose turn it is. Easy
+// sometimes plays at random and only looks a move or two ahead; hard
+// searches deep enough that it rarely misses a threat. Moves that score
+// the same are picked between at random, so games vary.
+func (s *State) BestMove(level rules.Difficulty, rng *rand.Rand) Move {
+	moves := s.legalColumns()
+	if len(moves) == 0 {
+		return Move{Column: -1}
+	}
+
+	// Every level takes a win on the spot, even easy, whose blunders are in
+	// everything else, and without searching the other columns first
+	for _, col := range moves {
+		child := *s
+		child.Apply(s.CurrentPlayer-1, Move{Column: col})
+		if child.Winner != 0 {
+			return Move{Column: col}
+		}
+	}
+
+	depth := hardDepth
+	switch level {
+	case rules.Easy:
+		if rng.Float64() < easyBlunder {
+			return Move{Column: moves[rng.Intn(len(moves))]}
+		}
+		depth = easyDepth
+	case rules.Medium:
+		depth = mediumDepth
+	}
+
+	best := -infinity
+	var bestMoves []int
+	for _, col := range moves {
+		child := *s
+		child.Apply(s.CurrentPlayer-1, Move{Column: col})
+		// A column is only searched until it can't equal the best column
+		// so far; one that does equal it is scored exactly, so it joins the
+		// columns picked between
+		score := -child.negamax(depth-1, -infinity, 1-best)
+		if score > best {
+			best = score
+			bestMoves = bestMoves[:0]
+		}
+		if score == best {
+			bestMoves = append(bestMoves, col)
+		}
+	}
+	return Move{Column: bestMoves[rng.Intn(len(bestMoves))]}
+}
+
+// negamax scores the position for the player to move, searching depth
+// moves ahead with alpha-beta pruning. A finished game was won by the
+// player who just moved, so it scores as a loss.
+func (s *State) negamax(depth, alpha, beta int) int {
+	if s.Winner != 0 {
+		return -winScore - depth
+	}
+	if s.Draw {
+		return 0
+	}
+	if depth == 0 {
+		return s.evaluate(s.CurrentPlayer) - s.evaluate(3-s.CurrentPlayer)
+	}
+
+	for _, col := range searchOrder {
+		if s.Board[0][col] != 0 {
+			continue
+		}
+		child := *s
+		child.Apply(s.CurrentPlayer-1, Move{Column: col})
+		score := -child.negamax(depth-1, -beta, -alpha)
+		if score > alpha {
+			alpha = score
+		}
+		if alpha >= beta {
+			break
+		}
+	}
+	return alpha
+}
+
+// evaluate scores how well placed a player's pieces are: every line of
+// four they could still complete counts, more so the more of it they
+// already have, and pieces in the middle column count a little extra
+func (s *State) evaluate(player int) int {
+	score := 0
+	for row := 0; row < Rows; row++ {
+		if s.Board[row][Cols/2] == player {
+			score += 3
+		}
+	}
+
+	directions := [][2]int{{0, 1}, {1, 0}, {1, 1}, {1, -1}}
+	for row := 0; row < Rows; row++ {
+		for col := 0; col < Cols; col++ {
+			for _, d := range directions {
+				endRow, endCol := row+3*d[0], col+3*d[1]
+				if !inBounds(endRow, endCol) {
+					continue
+				}
+				mine := 0
+				for i := 0; i < 4; i++ {
+					switch s.Board[row+i*d[0]][col+i*d[1]] {
+					case player:
+						mine++
+					case 0:
+					default:
+						mine = -1
+					}
+					if mine < 0 {
+						break
+					}
+				}
+				switch mine {
+				case 3:
+					score += 50
+				case 2:
+					score += 10
+				case 1:
+					score += 1
+				}
+			}
+		}
+	}
+	return score
+}
+
+func (s *State) legalColumns() []int {
+	cols := make([]int, 0, Cols)
+	for _, col := range searchOrder {
+		if s.Board[0][col] == 0 {
+			cols = append(cols, col)
+		}
+	}
+	return cols
+}
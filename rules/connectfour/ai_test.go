@@ -0,0 +1,78 @@
+package connectfour
+
+import (
+	"math/rand"
+	"testing"
+
+	"olive_and_millies_game_room/rules"
+)
+
+// How many times each position is tried, as the computer picks between
+// equally good moves at random. Hard searches deep enough to be slow on an
+// open board, so it gets fewer.
+func tries(level rules.Difficulty) int {
+	if level == rules.Hard {
+		return 3
+	}
+	return 20
+}
+
+func TestBestMoveWins(t *testing.T) {
+	// Both players have three in a column; seat 0 to move wins in column 0
+	s := New()
+	play(t, s, 0, 6, 0, 6, 0, 6)
+	for _, level := range rules.Difficulties {
+		rng := rand.New(rand.NewSource(1))
+		for i := 0; i < tries(level); i++ {
+			if move := s.BestMove(level, rng); move.Column != 0 {
+				t.Errorf("%s played column %d, not the win in column 0", level, move.Column)
+				break
+			}
+		}
+	}
+}
+
+func TestBestMoveBlocks(t *testing.T) {
+	// Seat 0 threatens four in column 0, and seat 1 has nothing as good
+	s := New()
+	play(t, s, 0, 6, 0, 6, 0)
+	for _, level := range []rules.Difficulty{rules.Medium, rules.Hard} {
+		rng := rand.New(rand.NewSource(1))
+		for i := 0; i < tries(level); i++ {
+			if move := s.BestMove(level, rng); move.Column != 0 {
+				t.Errorf("%s played column %d, not the block in column 0", level, move.Column)
+				break
+			}
+		}
+	}
+}
+
+func TestBestMoveIsLegal(t *testing.T) {
+	// Columns 2 and 3 are full, with no four in a row
+	s := New()
+	play(t, s, 3, 3, 3, 3, 3, 3, 2, 2, 2, 2, 2, 2)
+	// and only column 2 is left open
+	last := &State{
+		Board: [Rows][Cols]int{
+			{1, 1, 0, 2, 1, 1, 2},
+			{1, 1, 2, 2, 1, 1, 2},
+			{2, 2, 1, 1, 2, 2, 1},
+			{1, 1, 2, 2, 1, 1, 2},
+			{2, 2, 1, 1, 2, 2, 1},
+			{1, 2, 2, 1, 1, 2, 2},
+		},
+		CurrentPlayer: 2,
+	}
+	for _, state := range []*State{s, last} {
+		for _, level := range rules.Difficulties {
+			rng := rand.New(rand.NewSource(1))
+			for i := 0; i < tries(level); i++ {
+				move := state.BestMove(level, rng)
+				child := *state
+				if err := child.Apply(state.CurrentPlayer-1, move); err != nil {
+					t.Fatalf("%s played column %d: %v", level, move.Column, err)
+				}
+			}
+		}
+	}
+}
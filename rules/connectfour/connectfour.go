@@ -0,0 +1,120 @@
+// Package connectfour implements the rules of Connect Four.
+package connectfour
+
+import (
+	"errors"
+
+	"olive_and_millies_game_room/rules"
+)
+
+const (
+	Rows = 6
+	Cols = 7
+)
+
+// Move drops a piece into a column, or concedes the game, e.g. when the
+// player runs out of time.
+type Move struct {
+	Column  int  `json:"column"`
+	Forfeit bool `json:"forfeit,omitempty"`
+}
+
+// State is a Connect Four game. Board holds 0 for an empty cell and 1 or 2
+// for a piece; the player in seat 0 plays 1s and seat 1 plays 2s.
+type State struct {
+	Board         [Rows][Cols]int `json:"board"`
+	CurrentPlayer int             `json:"current_player"` // 1 or 2
+	Winner        int             `json:"winner"`         // 0 = no winner
+	Draw          bool            `json:"draw"`
+}
+
+func New() *State {
+	return &State{CurrentPlayer: 1}
+}
+
+// Apply validates a move by the player in the given seat and applies it.
+func (s *State) Apply(seat int, move Move) error {
+	if s.IsOver() {
+		return rules.ErrGameOver
+	}
+	if seat+1 != s.CurrentPlayer {
+		return rules.ErrNotYourTurn
+	}
+	if move.Forfeit {
+		s.Forfeit(seat)
+		return nil
+	}
+	if move.Column < 0 || move.Column >= Cols {
+		return errors.New("Column out of range")
+	}
+
+	row := s.DropRow(move.Column)
+	if row < 0 {
+		return errors.New("Column is full")
+	}
+	s.Board[row][move.Column] = s.CurrentPlayer
+	if s.CheckWin(row, move.Column) {
+		s.Winner = s.CurrentPlayer
+	} else if s.boardFull() {
+		s.Draw = true
+	} else {
+		s.CurrentPlayer = 3 - s.CurrentPlayer // Toggle between 1 and 2
+	}
+	return nil
+}
+
+// Forfeit ends the game with a win for the other player, e.g. when the
+// player in seat runs out of time.
+func (s *State) Forfeit(seat int) {
+	if s.IsOver() {
+		return
+	}
+	s.Winner = 2 - seat
+}
+
+// DropRow returns the row a piece dropped in col would land in, or -1 if
+// the column is full.
+func (s *State) DropRow(col int) int {
+	for row := Rows - 1; row >= 0; row-- {
+		if s.Board[row][col] == 0 {
+			return row
+		}
+	}
+	return -1
+}
+
+// CheckWin reports whether the piece at row, col is part of four in a row.
+func (s *State) CheckWin(row, col int) bool {
+	player := s.Board[row][col]
+	directions := [][2]int{{0, 1}, {1, 0}, {1, 1}, {1, -1}}
+	for _, d := range directions {
+		count := 1
+		for r, c := row+d[0], col+d[1]; inBounds(r, c) && s.Board[r][c] == player; r, c = r+d[0], c+d[1] {
+			count++
+		}
+		for r, c := row-d[0], col-d[1]; inBounds(r, c) && s.Board[r][c] == player; r, c = r-d[0], c-d[1] {
+			count++
+		}
+		if count >= 4 {
+			return true
+		}
+	}
+	return false
+}
+
+func (s *State) IsOver() bool {
+	return s.Winner != 0 || s.Draw
+}
+
+func (s *State) boardFull() bool {
+	for col := 0; col < Cols; col++ {
+		if s.Board[0][col] == 0 {
+			return false
+		}
+	}
+	return true
+}
+
+func inBounds(row, col int) bool {
+	return row >= 0 && row < Rows && col >= 0 && col < Cols
+}
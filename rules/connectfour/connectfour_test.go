@@ -0,0 +1,129 @@
+package connectfour
+
+import (
+	"testing"
+
+	"olive_and_millies_game_room/rules"
+)
+
+// play applies moves in order, alternating seats from seat 0
+func play(t *testing.T, s *State, columns ...int) {
+	t.Helper()
+	for i, col := range columns {
+		if err := s.Apply(i%2, Move{Column: col}); err != nil {
+			t.Fatalf("move %d in column %d: %v", i, col, err)
+		}
+	}
+}
+
+func TestApply(t *testing.T) {
+	full := New()
+	for i := 0; i < Rows; i++ {
+		full.Apply(i%2, Move{Column: 3})
+	}
+
+	tests := []struct {
+		name    string
+		state   *State
+		seat    int
+		column  int
+		wantErr error // nil for a legal move; any error when wantAny
+		wantAny bool
+	}{
+		{name: "first move", state: New(), seat: 0, column: 3},
+		{name: "wrong seat", state: New(), seat: 1, column: 3, wantErr: rules.ErrNotYourTurn},
+		{name: "column too low", state: New(), seat: 0, column: -1, wantAny: true},
+		{name: "column too high", state: New(), seat: 0, column: Cols, wantAny: true},
+		{name: "full column", state: full, seat: 0, column: 3, wantAny: true},
+		{name: "game over", state: &State{CurrentPlayer: 1, Winner: 2}, seat: 0, column: 0, wantErr: rules.ErrGameOver},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			before := *tt.state
+			err := tt.state.Apply(tt.seat, Move{Column: tt.column})
+			switch {
+			case tt.wantAny:
+				if err == nil {
+					t.Fatal("illegal move was accepted")
+				}
+			case err != tt.wantErr:
+				t.Fatalf("got error %v, want %v", err, tt.wantErr)
+			}
+			if err != nil {
+				if *tt.state != before {
+					t.Error("refused move changed the state")
+				}
+				return
+			}
+			row := before.DropRow(tt.column)
+			if got := tt.state.Board[row][tt.column]; got != tt.seat+1 {
+				t.Errorf("landed piece is %d, want %d", got, tt.seat+1)
+			}
+			if tt.state.CurrentPlayer == before.CurrentPlayer {
+				t.Error("turn didn't pass to the other player")
+			}
+		})
+	}
+}
+
+func TestWins(t *testing.T) {
+	tests := []struct {
+		name    string
+		columns []int
+		winner  int
+	}{
+		{name: "horizontal", columns: []int{0, 0, 1, 1, 2, 2, 3}, winner: 1},
+		{name: "vertical", columns: []int{0, 1, 0, 1, 0, 1, 0}, winner: 1},
+		{name: "vertical second player", columns: []int{0, 1, 0, 1, 0, 1, 6, 1}, winner: 2},
+		{name: "rising diagonal", columns: []int{0, 1, 1, 2, 2, 3, 2, 3, 3, 6, 3}, winner: 1},
+		{name: "falling diagonal", columns: []int{6, 5, 5, 4, 4, 3, 4, 3, 3, 0, 3}, winner: 1},
+		{name: "three in a row", columns: []int{0, 0, 1, 1, 2, 2}, winner: 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := New()
+			play(t, s, tt.columns...)
+			if s.Winner != tt.winner {
+				t.Errorf("winner is %d, want %d", s.Winner, tt.winner)
+			}
+			if s.IsOver() != (tt.winner != 0) {
+				t.Errorf("IsOver is %v with winner %d", s.IsOver(), s.Winner)
+			}
+		})
+	}
+}
+
+func TestForfeit(t *testing.T) {
+	s := New()
+	play(t, s, 3)
+	if err := s.Apply(0, Move{Forfeit: true}); err != rules.ErrNotYourTurn {
+		t.Errorf("forfeiting out of turn: got %v", err)
+	}
+	if err := s.Apply(1, Move{Forfeit: true}); err != nil {
+		t.Fatal(err)
+	}
+	if !s.IsOver() || s.Winner != 1 || s.Board[Rows-1][3] != 1 {
+		t.Errorf("after seat 1 forfeits: over %v, winner %d", s.IsOver(), s.Winner)
+	}
+}
+
+func TestFullBoardIsDraw(t *testing.T) {
+	// A full board with no four in a row, less the last piece
+	s := &State{
+		Board: [Rows][Cols]int{
+			{1, 1, 0, 2, 1, 1, 2},
+			{1, 1, 2, 2, 1, 1, 2},
+			{2, 2, 1, 1, 2, 2, 1},
+			{1, 1, 2, 2, 1, 1, 2},
+			{2, 2, 1, 1, 2, 2, 1},
+			{1, 2, 2, 1, 1, 2, 2},
+		},
+		CurrentPlayer: 2,
+	}
+	if err := s.Apply(1, Move{Column: 2}); err != nil {
+		t.Fatal(err)
+	}
+	if !s.Draw || s.Winner != 0 || !s.IsOver() {
+		t.Errorf("full board: draw %v, winner %d, over %v", s.Draw, s.Winner, s.IsOver())
+	}
+}
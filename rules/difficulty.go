@@ -0,0 +1,49 @@
+package rules
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Difficulty is how well a computer player plays.
+type Difficulty int
+
+const (
+	Easy Difficulty = iota
+	Medium
+	Hard
+)
+
+// Difficulties lists every level, easiest first.
+var Difficulties = []Difficulty{Easy, Medium, Hard}
+
+var difficultyNames = map[Difficulty]string{
+	Easy:   "easy",
+	Medium: "medium",
+	Hard:   "hard",
+}
+
+// String is the level's name as it is sent over the wire.
+func (d Difficulty) String() string {
+	if name, ok := difficultyNames[d]; ok {
+		return name
+	}
+	return fmt.Sprintf("Difficulty(%d)", int(d))
+}
+
+// ComputerName is what a computer player at this level is called, e.g.
+// "Computer (Easy)".
+func (d Difficulty) ComputerName() string {
+	name := d.String()
+	return "Computer (" + strings.ToUpper(name[:1]) + name[1:] + ")"
+}
+
+// ParseDifficulty reads a level from its name.
+func ParseDifficulty(name string) (Difficulty, error) {
+	for d, n := range difficultyNames {
+		if n == name {
+			return d, nil
+		}
+	}
+	return Easy, fmt.Errorf("Unknown difficulty %q", name)
+}
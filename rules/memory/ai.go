@@ -0,0 +1,87 @@
+package memory
+
+import (
+	"math/rand"
+
+	"olive_and_millies_game_room/rules"
+)
+
+// ForgetRates is how likely a computer player at each level is to forget
+// each card it remembers whenever another card is turned over. Easy soon
+// loses track of what it has seen, so children can keep up with it.
+var ForgetRates = map[rules.Difficulty]float64{
+	rules.Easy:   0.25,
+	rules.Medium: 0.1,
+	rules.Hard:   0.02,
+}
+
+// Recall is what a computer player remembers of the cards it has seen
+// turned over, its own and everyone else's. It only knows a card it has
+// seen, and may forget it again, so it plays like a person rather than
+// looking at the layout.
+type Recall struct {
+	forget float64
+	rng    *rand.Rand
+	cards  map[int]int // Card index to card type
+}
+
+// NewRecall starts a computer player's memory with nothing in it. Each
+// time a card is turned over, every other card it remembers is forgotten
+// with chance forget.
+func NewRecall(forget float64, rng *rand.Rand) *Recall {
+	return &Recall{forget: forget, rng: rng, cards: make(map[int]int)}
+}
+
+// See tells the computer a card was turned over and what it was.
+func (r *Recall) See(index, cardType int) {
+	for i := range r.cards {
+		if i != index && r.rng.Float64() < r.forget {
+			delete(r.cards, i)
+		}
+	}
+	r.cards[index] = cardType
+}
+
+// BestMove picks the card the computer turns over next. It finishes a
+// pair it remembers both cards of, or matches the card it has just turned
+// over if it remembers where the other one is, and otherwise tries a card
+// it doesn't remember.
+func (r *Recall) BestMove(s *State) Move {
+	// The cards it could turn over, and what it remembers of them
+	var known, unknown []int
+	for i, card := range s.Cards {
+		if card.Matched || (card.Flipped && !s.MismatchPending()) {
+			continue
+		}
+		if _, ok := r.cards[i]; ok {
+			known = append(known, i)
+		} else {
+			unknown = append(unknown, i)
+		}
+	}
+
+	if len(s.Flipped) == 1 {
+		cardType := s.Cards[s.Flipped[0]].Type
+		for _, i := range known {
+			if r.cards[i] == cardType {
+				return Move{CardIndex: i}
+			}
+		}
+	} else {
+		seen := make(map[int]int)
+		for _, i := range known {
+			if first, ok := seen[r.cards[i]]; ok {
+				return Move{CardIndex: first}
+			}
+			seen[r.cards[i]] = i
+		}
+	}
+
+	candidates := unknown
+	if len(candidates) == 0 {
+		// Remembering every card left means remembering a pair, so this
+		// doesn't happen, but turn something over all the same
+		candidates = known
+	}
+	return Move{CardIndex: candidates[r.rng.Intn(len(candidates))]}
+}
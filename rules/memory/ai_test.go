@@ -0,0 +1,84 @@
+package memory
+
+import (
+	"math/rand"
+	"testing"
+)
+
+// Four pairs: 0 and 4, 1 and 5, 2 and 6, 3 and 7
+var aiLayout = []int{0, 1, 2, 3, 0, 1, 2, 3}
+
+// flip turns a card over for seat 0 and shows it to the recall
+func flip(t *testing.T, s *State, r *Recall, i int) {
+	t.Helper()
+	if err := s.Apply(s.CurrentPlayer, Move{CardIndex: i}); err != nil {
+		t.Fatalf("flipping %d: %v", i, err)
+	}
+	r.See(i, s.Cards[i].Type)
+}
+
+func TestRecallCompletesPair(t *testing.T) {
+	s := New(2, aiLayout)
+	r := NewRecall(0, rand.New(rand.NewSource(1)))
+	r.See(6, 2)
+	r.See(1, 1)
+	r.See(2, 2)
+
+	move := r.BestMove(s)
+	if move.CardIndex != 6 && move.CardIndex != 2 {
+		t.Fatalf("turned over %d, not the remembered pair", move.CardIndex)
+	}
+	flip(t, s, r, move.CardIndex)
+	if next := r.BestMove(s); next.CardIndex != 8-move.CardIndex {
+		t.Errorf("turned over %d after %d, not its pair", next.CardIndex, move.CardIndex)
+	}
+}
+
+func TestRecallMatchesFirstCard(t *testing.T) {
+	s := New(2, aiLayout)
+	r := NewRecall(0, rand.New(rand.NewSource(1)))
+	r.See(5, 1)
+	flip(t, s, r, 1)
+	if move := r.BestMove(s); move.CardIndex != 5 {
+		t.Errorf("turned over %d, not 5 to match the 1 just turned over", move.CardIndex)
+	}
+}
+
+func TestRecallPicksPlayableCards(t *testing.T) {
+	for seed := int64(0); seed < 20; seed++ {
+		rng := rand.New(rand.NewSource(seed))
+		s := New(2, aiLayout)
+		r := NewRecall(0.5, rng)
+		for !s.GameOver {
+			i := r.BestMove(s).CardIndex
+			card := s.Cards[i]
+			if card.Matched || (card.Flipped && !s.MismatchPending()) {
+				t.Fatalf("seed %d: turned over card %d, which is already %+v", seed, i, card)
+			}
+			flip(t, s, r, i)
+		}
+	}
+}
+
+func TestRecallForgetsEverything(t *testing.T) {
+	// Remembering both 2s, the computer always turns over the other one
+	// after the first; forgetting everything, it's a guess
+	picks := func(forget float64) map[int]bool {
+		chosen := make(map[int]bool)
+		for seed := int64(0); seed < 30; seed++ {
+			s := New(2, aiLayout)
+			r := NewRecall(forget, rand.New(rand.NewSource(seed)))
+			r.See(6, 2)
+			r.See(3, 3)
+			flip(t, s, r, 2)
+			chosen[r.BestMove(s).CardIndex] = true
+		}
+		return chosen
+	}
+	if got := picks(0); len(got) != 1 || !got[6] {
+		t.Errorf("remembering everything turned over %v, want just 6", got)
+	}
+	if got := picks(1); len(got) < 3 {
+		t.Errorf("forgetting everything only ever turned over %v", got)
+	}
+}
@@ -0,0 +1,177 @@
+// Package memory implements the rules of Memory Match for any number of
+// players.
+package memory
+
+import (
+	"errors"
+	"math/rand"
+
+	"olive_and_millies_game_room/rules"
+)
+
+const (
+	TotalPairs = 12
+	NumCards   = TotalPairs * 2
+)
+
+// Move turns over a card, or passes the rest of the turn to the next
+// player, e.g. when the player runs out of time. Type is the card's face,
+// filled in by the server once the card is turned over.
+type Move struct {
+	CardIndex int  `json:"card_index"`
+	Type      int  `json:"type"`
+	Pass      bool `json:"pass,omitempty"`
+}
+
+// Card is one position on the board. Type is -1 in a Public state until
+// the card has been turned over.
+type Card struct {
+	Type    int  `json:"type"`
+	Flipped bool `json:"flipped"`
+	Matched bool `json:"matched"`
+}
+
+// State is a Memory Match game. Flipped lists the cards turned over this
+// turn; after a mismatch the pair stays face up until TurnBack is called or
+// the next card is flipped.
+type State struct {
+	Cards         []Card `json:"cards"`
+	Flipped       []int  `json:"flipped"`
+	CurrentPlayer int    `json:"current_player"`
+	Scores        []int  `json:"scores"`
+	GameOver      bool   `json:"game_over"`
+	Winner        int    `json:"winner"` // -1 for a tie or no winner yet
+}
+
+// Shuffle deals the pairs into a layout of card types.
+func Shuffle(rng *rand.Rand) []int {
+	layout := make([]int, NumCards)
+	for i := range layout {
+		layout[i] = i / 2
+	}
+	rng.Shuffle(len(layout), func(i, j int) {
+		layout[i], layout[j] = layout[j], layout[i]
+	})
+	return layout
+}
+
+// Hidden is a layout of face-down cards whose types aren't known yet, as a
+// client sees a game the server has dealt. Each card takes its type from
+// the move that turns it over.
+func Hidden(numCards int) []int {
+	layout := make([]int, numCards)
+	for i := range layout {
+		layout[i] = -1
+	}
+	return layout
+}
+
+// New starts a game with the given card layout.
+func New(numPlayers int, layout []int) *State {
+	cards := make([]Card, len(layout))
+	for i, cardType := range layout {
+		cards[i].Type = cardType
+	}
+	return &State{
+		Cards:   cards,
+		Flipped: make([]int, 0),
+		Scores:  make([]int, numPlayers),
+		Winner:  -1,
+	}
+}
+
+// Apply validates a move by the player in the given seat and applies it.
+func (s *State) Apply(seat int, move Move) error {
+	if s.GameOver {
+		return rules.ErrGameOver
+	}
+	if seat != s.CurrentPlayer {
+		return rules.ErrNotYourTurn
+	}
+	if move.Pass {
+		// Any card turned over this turn goes face down again
+		for _, idx := range s.Flipped {
+			s.Cards[idx].Flipped = false
+		}
+		s.Flipped = s.Flipped[:0]
+		s.CurrentPlayer = (s.CurrentPlayer + 1) % len(s.Scores)
+		return nil
+	}
+	if move.CardIndex < 0 || move.CardIndex >= len(s.Cards) {
+		return errors.New("Card out of range")
+	}
+	card := &s.Cards[move.CardIndex]
+	if card.Matched || (card.Flipped && !s.MismatchPending()) {
+		return errors.New("Card is already face up")
+	}
+
+	s.TurnBack()
+	if card.Type < 0 {
+		card.Type = move.Type
+	}
+	card.Flipped = true
+	s.Flipped = append(s.Flipped, move.CardIndex)
+	if len(s.Flipped) < 2 {
+		return nil
+	}
+
+	first, second := &s.Cards[s.Flipped[0]], &s.Cards[s.Flipped[1]]
+	if first.Type != second.Type {
+		// No match, the next player goes
+		s.CurrentPlayer = (s.CurrentPlayer + 1) % len(s.Scores)
+		return nil
+	}
+
+	first.Matched, second.Matched = true, true
+	s.Scores[s.CurrentPlayer]++
+	s.Flipped = s.Flipped[:0]
+
+	for _, c := range s.Cards {
+		if !c.Matched {
+			return nil
+		}
+	}
+	s.GameOver = true
+	maxScore := -1
+	for i, score := range s.Scores {
+		if score > maxScore {
+			maxScore = score
+			s.Winner = i
+		} else if score == maxScore {
+			s.Winner = -1 // Tie
+		}
+	}
+	return nil
+}
+
+// MismatchPending reports whether a mismatched pair is still face up.
+func (s *State) MismatchPending() bool {
+	return len(s.Flipped) == 2
+}
+
+// TurnBack turns a mismatched pair face down again.
+func (s *State) TurnBack() {
+	if !s.MismatchPending() {
+		return
+	}
+	for _, idx := range s.Flipped {
+		s.Cards[idx].Flipped = false
+	}
+	s.Flipped = s.Flipped[:0]
+}
+
+// Public returns a copy of the state that hides the type of every card
+// that is face down, safe to send to players.
+func (s *State) Public() *State {
+	public := *s
+	public.Cards = make([]Card, len(s.Cards))
+	for i, c := range s.Cards {
+		public.Cards[i] = c
+		if !c.Flipped && !c.Matched {
+			public.Cards[i].Type = -1
+		}
+	}
+	public.Flipped = append(make([]int, 0), s.Flipped...)
+	public.Scores = append(make([]int, 0), s.Scores...)
+	return &public
+}
@@ -0,0 +1,138 @@
+package memory
+
+import (
+	"testing"
+
+	"olive_and_millies_game_room/rules"
+)
+
+// A small layout: pairs at 0 and 2, and at 1 and 3
+var testLayout = []int{0, 1, 0, 1}
+
+func TestApply(t *testing.T) {
+	tests := []struct {
+		name    string
+		flips   []int // Turned over by seat 0 first
+		seat    int
+		move    Move
+		wantErr error
+		wantAny bool
+	}{
+		{name: "first card", move: Move{CardIndex: 0}},
+		{name: "wrong seat", seat: 1, move: Move{CardIndex: 0}, wantErr: rules.ErrNotYourTurn},
+		{name: "card out of range", move: Move{CardIndex: 4}, wantAny: true},
+		{name: "card already face up", flips: []int{0}, move: Move{CardIndex: 0}, wantAny: true},
+		{name: "matched card", flips: []int{0, 2}, move: Move{CardIndex: 2}, wantAny: true},
+		{name: "pass", flips: []int{0}, move: Move{Pass: true}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := New(2, testLayout)
+			for _, i := range tt.flips {
+				if err := s.Apply(0, Move{CardIndex: i}); err != nil {
+					t.Fatalf("flipping %d: %v", i, err)
+				}
+			}
+			err := s.Apply(tt.seat, tt.move)
+			switch {
+			case tt.wantAny:
+				if err == nil {
+					t.Error("illegal move was accepted")
+				}
+			case err != tt.wantErr:
+				t.Errorf("got error %v, want %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestMatchAndMismatch(t *testing.T) {
+	s := New(2, testLayout)
+	flip := func(seat, i int) {
+		t.Helper()
+		if err := s.Apply(seat, Move{CardIndex: i}); err != nil {
+			t.Fatalf("seat %d flipping %d: %v", seat, i, err)
+		}
+	}
+
+	// A mismatch stays face up until the next player turns a card over
+	flip(0, 0)
+	flip(0, 1)
+	if !s.MismatchPending() || s.CurrentPlayer != 1 || s.Scores[0] != 0 {
+		t.Fatalf("after a mismatch: pending %v, player %d, score %d", s.MismatchPending(), s.CurrentPlayer, s.Scores[0])
+	}
+	flip(1, 1)
+	if s.Cards[0].Flipped || !s.Cards[1].Flipped {
+		t.Fatal("mismatched pair wasn't turned back before the next flip")
+	}
+
+	// A match scores and keeps the turn
+	flip(1, 3)
+	if !s.Cards[1].Matched || !s.Cards[3].Matched || s.Scores[1] != 1 || s.CurrentPlayer != 1 {
+		t.Fatalf("after a match: score %d, player %d", s.Scores[1], s.CurrentPlayer)
+	}
+	flip(1, 0)
+	flip(1, 2)
+	if !s.GameOver || s.Winner != 1 {
+		t.Errorf("all pairs found: over %v, winner %d", s.GameOver, s.Winner)
+	}
+	if err := s.Apply(1, Move{CardIndex: 0}); err != rules.ErrGameOver {
+		t.Errorf("flipping after the game: got %v", err)
+	}
+}
+
+func TestTie(t *testing.T) {
+	s := New(2, testLayout)
+	// Seat 0 finds a pair, turns another card and runs out of time; seat 1
+	// finds the last pair
+	moves := []struct {
+		seat int
+		move Move
+	}{
+		{0, Move{CardIndex: 0}},
+		{0, Move{CardIndex: 2}},
+		{0, Move{CardIndex: 1}},
+		{0, Move{Pass: true}},
+		{1, Move{CardIndex: 1}},
+		{1, Move{CardIndex: 3}},
+	}
+	for _, m := range moves {
+		if err := s.Apply(m.seat, m.move); err != nil {
+			t.Fatalf("seat %d %+v: %v", m.seat, m.move, err)
+		}
+	}
+	if !s.GameOver || s.Winner != -1 {
+		t.Errorf("one pair each: over %v, winner %d", s.GameOver, s.Winner)
+	}
+}
+
+func TestPublic(t *testing.T) {
+	s := New(2, testLayout)
+	s.Apply(0, Move{CardIndex: 1})
+	for i, c := range s.Public().Cards {
+		want := -1
+		if i == 1 {
+			want = testLayout[1]
+		}
+		if c.Type != want {
+			t.Errorf("card %d shows type %d, want %d", i, c.Type, want)
+		}
+	}
+}
+
+func TestHiddenTakesTypesFromMoves(t *testing.T) {
+	s := New(2, Hidden(len(testLayout)))
+	s.Apply(0, Move{CardIndex: 0, Type: 0})
+	s.Apply(0, Move{CardIndex: 2, Type: 0})
+	if !s.Cards[0].Matched || s.Scores[0] != 1 {
+		t.Fatal("pair turned over with their faces wasn't matched")
+	}
+
+	// The server's own game knows every face, whatever a move says
+	s = New(2, testLayout)
+	s.Apply(0, Move{CardIndex: 0, Type: 1})
+	s.Apply(0, Move{CardIndex: 1, Type: 0})
+	if s.Cards[0].Matched || s.CurrentPlayer != 1 {
+		t.Error("a move's type overrode a known face")
+	}
+}
@@ -0,0 +1,14 @@
+// Package rules holds what the per-game rules packages have in common.
+//
+// Each game lives in its own subpackage (connectfour, santorini, yahtzee
+// and memory) with a render-free State type and an Apply method. The
+// Ebiten client draws from that state and the server uses the same code to
+// validate moves, so both sides always agree on the rules.
+package rules
+
+import "errors"
+
+var (
+	ErrNotYourTurn = errors.New("Not your turn")
+	ErrGameOver    = errors.New("Game is already over")
+)
@@ -0,0 +1,261 @@
+package santorini
+
+import (
+	"math/rand"
+	"sort"
+
+	"olive_and_millies_game_room/rules"
+)
+
+// How many whole turns ahead the computer looks at each level, and how
+// often the easy level just plays any turn instead
+const (
+	easyDepth   = 1
+	mediumDepth = 2
+	hardDepth   = 3
+	easyBlunder = 0.3
+)
+
+// Scores for a position, from the point of view of the player to move. A
+// win scores higher the sooner it comes.
+const (
+	winScore = 1000000
+	infinity = 2 * winScore
+)
+
+// turn is everything a player does on their turn: pick a worker, move it
+// and build next to where it ends up. A move that wins has no build.
+type turn struct {
+	worker         int
+	moveX, moveY   int
+	buildX, buildY int
+	wins           bool
+	rise           int // How far the move climbs, for trying likely turns first
+}
+
+// BestMove picks the computer's next move for the player whose turn it
+// is, in whatever phase the game is in. Each phase of a turn is a move of
+// its own, so the computer works out its best whole turn and returns the
+// part of it that's due; later phases pick up from the worker it chose.
+// Turns that score the same are picked between at random, so games vary.
+func (s *State) BestMove(level rules.Difficulty, rng *rand.Rand) Move {
+	if s.Phase == PhasePlace {
+		return s.placement(level, rng)
+	}
+
+	turns := s.turns()
+	if len(turns) == 0 {
+		// The game is over: a player who can't move has already lost
+		return Move{X: -1, Y: -1, Phase: s.Phase}
+	}
+
+	var chosen turn
+	if level == rules.Easy && rng.Float64() < easyBlunder {
+		chosen = turns[rng.Intn(len(turns))]
+	} else {
+		chosen = s.bestTurn(turns, depthFor(level), rng)
+	}
+
+	switch s.Phase {
+	case PhaseSelect:
+		w := s.Workers[s.CurrentPlayer][chosen.worker]
+		return Move{X: w.X, Y: w.Y, Phase: PhaseSelect, Worker: chosen.worker}
+	case PhaseMove:
+		return Move{X: chosen.moveX, Y: chosen.moveY, Phase: PhaseMove, Worker: chosen.worker}
+	default:
+		return Move{X: chosen.buildX, Y: chosen.buildY, Phase: PhaseBuild, Worker: chosen.worker}
+	}
+}
+
+func depthFor(level rules.Difficulty) int {
+	switch level {
+	case rules.Easy:
+		return easyDepth
+	case rules.Medium:
+		return mediumDepth
+	default:
+		return hardDepth
+	}
+}
+
+// The best of the given turns, searching depth turns ahead
+func (s *State) bestTurn(turns []turn, depth int, rng *rand.Rand) turn {
+	best := -infinity
+	var bestTurns []turn
+	for _, t := range turns {
+		child := *s
+		child.play(t)
+		// The opponent's search stops at the first reply that leaves this
+		// turn short of the best one, but a turn that matches it gets its
+		// exact score and goes into the draw
+		score := -child.negamax(depth-1, -infinity, 1-best)
+		if score > best {
+			best = score
+			bestTurns = bestTurns[:0]
+		}
+		if score == best {
+			bestTurns = append(bestTurns, t)
+		}
+	}
+	return bestTurns[rng.Intn(len(bestTurns))]
+}
+
+// negamax scores the position for the player to move, searching depth
+// turns ahead with alpha-beta pruning. A player left unable to move has
+// already lost, as play ends the game for them the way the rules do.
+func (s *State) negamax(depth, alpha, beta int) int {
+	if s.IsOver() {
+		// The player who just moved won
+		return -winScore - depth
+	}
+	if depth == 0 {
+		return s.evaluate(s.CurrentPlayer) - s.evaluate(1-s.CurrentPlayer)
+	}
+
+	for _, t := range s.turns() {
+		child := *s
+		child.play(t)
+		score := -child.negamax(depth-1, -beta, -alpha)
+		if score > alpha {
+			alpha = score
+		}
+		if alpha >= beta {
+			break
+		}
+	}
+	return alpha
+}
+
+// Every turn open to the current player from the phase the game is in:
+// any worker while selecting, the selected worker once it's chosen, and
+// just the builds once it has moved. Winning and climbing turns come
+// first, as they're the likeliest to be best.
+func (s *State) turns() []turn {
+	var turns []turn
+	player := s.CurrentPlayer
+	for w, worker := range s.Workers[player] {
+		if s.Phase != PhaseSelect && w != s.SelectedWorker {
+			continue
+		}
+		if s.Phase == PhaseBuild {
+			turns = s.appendBuilds(turns, turn{worker: w, moveX: worker.X, moveY: worker.Y})
+			continue
+		}
+
+		from := s.Levels[worker.Y][worker.X]
+		for y := worker.Y - 1; y <= worker.Y+1; y++ {
+			for x := worker.X - 1; x <= worker.X+1; x++ {
+				if !onBoard(x, y) || !s.IsValidMove(worker, x, y) {
+					continue
+				}
+				to := s.Levels[y][x]
+				t := turn{worker: w, moveX: x, moveY: y, rise: to - from}
+				if from < 3 && to == 3 {
+					t.wins = true
+					turns = append(turns, t)
+					continue
+				}
+
+				// Build from where the worker has moved to
+				moved := *s
+				moved.Workers[player][w].X, moved.Workers[player][w].Y = x, y
+				turns = moved.appendBuilds(turns, t)
+			}
+		}
+	}
+
+	sort.SliceStable(turns, func(i, j int) bool {
+		if turns[i].wins != turns[j].wins {
+			return turns[i].wins
+		}
+		return turns[i].rise > turns[j].rise
+	})
+	return turns
+}
+
+// Add t with every build open to its worker once it's at its move's end
+func (s *State) appendBuilds(turns []turn, t turn) []turn {
+	worker := s.Workers[s.CurrentPlayer][t.worker]
+	for y := t.moveY - 1; y <= t.moveY+1; y++ {
+		for x := t.moveX - 1; x <= t.moveX+1; x++ {
+			if onBoard(x, y) && s.IsValidBuild(worker, x, y) {
+				built := t
+				built.buildX, built.buildY = x, y
+				turns = append(turns, built)
+			}
+		}
+	}
+	return turns
+}
+
+// Play a whole turn from turns() without checking it again, ending the
+// game if it leaves the next player unable to move
+func (s *State) play(t turn) {
+	worker := &s.Workers[s.CurrentPlayer][t.worker]
+	worker.X, worker.Y = t.moveX, t.moveY
+	if t.wins {
+		s.Winner = s.CurrentPlayer
+		s.Phase = PhaseGameOver
+		return
+	}
+	s.Levels[t.buildY][t.buildX]++
+	s.SelectedWorker = -1
+	s.CurrentPlayer = 1 - s.CurrentPlayer
+	s.Phase = PhaseSelect
+	s.checkStuck()
+}
+
+// evaluate scores how well placed a player's workers are: high up, next
+// to squares they can climb to, and away from the edges
+func (s *State) evaluate(player int) int {
+	score := 0
+	for _, w := range s.Workers[player] {
+		level := s.Levels[w.Y][w.X]
+		score += 40 * level
+		for y := w.Y - 1; y <= w.Y+1; y++ {
+			for x := w.X - 1; x <= w.X+1; x++ {
+				if !onBoard(x, y) || !s.IsValidMove(w, x, y) {
+					continue
+				}
+				to := s.Levels[y][x]
+				score += 2 + 4*to
+				if level == 2 && to == 3 {
+					// One step from winning
+					score += 60
+				}
+			}
+		}
+		score -= 3 * (abs(w.X-BoardSize/2) + abs(w.Y-BoardSize/2))
+	}
+	return score
+}
+
+// Where to put a worker during placement. Squares near the middle leave
+// the most room to move; easy just picks any free square.
+func (s *State) placement(level rules.Difficulty, rng *rand.Rand) Move {
+	var best []Move
+	bestDistance := BoardSize * 2
+	for y := 0; y < BoardSize; y++ {
+		for x := 0; x < BoardSize; x++ {
+			if s.IsOccupied(x, y) {
+				continue
+			}
+			distance := abs(x-BoardSize/2) + abs(y-BoardSize/2)
+			if level == rules.Easy {
+				distance = 0
+			}
+			if distance < bestDistance {
+				bestDistance = distance
+				best = best[:0]
+			}
+			if distance == bestDistance {
+				best = append(best, Move{X: x, Y: y, Phase: PhasePlace, Worker: s.PlacementCount / 2})
+			}
+		}
+	}
+	return best[rng.Intn(len(best))]
+}
+
+func onBoard(x, y int) bool {
+	return x >= 0 && x < BoardSize && y >= 0 && y < BoardSize
+}
@@ -0,0 +1,229 @@
+// Package santorini implements the rules of Santorini (without god powers).
+package santorini
+
+import (
+	"errors"
+
+	"olive_and_millies_game_room/rules"
+)
+
+const BoardSize = 5
+
+// Game phases. A turn goes select, move, build; the game starts with
+// each player placing two workers.
+const (
+	PhasePlace    = "place"
+	PhaseSelect   = "select"
+	PhaseMove     = "move"
+	PhaseBuild    = "build"
+	PhaseGameOver = "gameover"
+)
+
+// Move is a click on a square during the given phase. For select moves the
+// worker on that square is chosen, and a move phase click on the player's
+// own worker chooses it instead; Worker is informational. A Forfeit move
+// concedes the game in any phase, e.g. when the player runs out of time.
+type Move struct {
+	X       int    `json:"x"`
+	Y       int    `json:"y"`
+	Phase   string `json:"phase"`
+	Worker  int    `json:"worker"` // 0 or 1
+	Forfeit bool   `json:"forfeit,omitempty"`
+}
+
+// Worker is a worker's position; Placed is false until it is on the board.
+type Worker struct {
+	X      int  `json:"x"`
+	Y      int  `json:"y"`
+	Placed bool `json:"placed"`
+}
+
+// State is a Santorini game between seats 0 and 1.
+type State struct {
+	Levels         [BoardSize][BoardSize]int `json:"levels"` // indexed [y][x], 4 is a dome
+	Workers        [2][2]Worker              `json:"workers"`
+	CurrentPlayer  int                       `json:"current_player"`
+	Phase          string                    `json:"phase"`
+	SelectedWorker int                       `json:"selected_worker"` // -1 when none
+	PlacementCount int                       `json:"placement_count"`
+	Winner         int                       `json:"winner"` // -1 when none
+}
+
+func New() *State {
+	return &State{
+		Phase:          PhasePlace,
+		SelectedWorker: -1,
+		Winner:         -1,
+	}
+}
+
+// Apply validates a move by the player in the given seat and applies it.
+func (s *State) Apply(seat int, move Move) error {
+	if s.IsOver() {
+		return rules.ErrGameOver
+	}
+	if seat != s.CurrentPlayer {
+		return rules.ErrNotYourTurn
+	}
+	if move.Forfeit {
+		s.Forfeit(seat)
+		return nil
+	}
+	if move.Phase != s.Phase {
+		return errors.New("Move is for the wrong phase")
+	}
+	if move.X < 0 || move.X >= BoardSize || move.Y < 0 || move.Y >= BoardSize {
+		return errors.New("Square is off the board")
+	}
+
+	switch s.Phase {
+	case PhasePlace:
+		if s.IsOccupied(move.X, move.Y) {
+			return errors.New("Square is occupied")
+		}
+		s.Workers[s.CurrentPlayer][s.PlacementCount/2] = Worker{X: move.X, Y: move.Y, Placed: true}
+		s.PlacementCount++
+		if s.PlacementCount == 4 {
+			s.Phase = PhaseSelect
+			s.CurrentPlayer = 0
+			s.checkStuck()
+		} else {
+			s.CurrentPlayer = (s.CurrentPlayer + 1) % 2
+		}
+	case PhaseSelect:
+		player, idx, ok := s.WorkerAt(move.X, move.Y)
+		if !ok || player != s.CurrentPlayer {
+			return errors.New("No worker of yours on that square")
+		}
+		s.SelectedWorker = idx
+		s.Phase = PhaseMove
+	case PhaseMove:
+		if player, idx, ok := s.WorkerAt(move.X, move.Y); ok && player == s.CurrentPlayer {
+			// Changed their mind about which worker to move
+			s.SelectedWorker = idx
+			return nil
+		}
+		worker := &s.Workers[s.CurrentPlayer][s.SelectedWorker]
+		if !s.IsValidMove(*worker, move.X, move.Y) {
+			return errors.New("Illegal worker move")
+		}
+		oldLevel := s.Levels[worker.Y][worker.X]
+		worker.X, worker.Y = move.X, move.Y
+		if oldLevel < 3 && s.Levels[move.Y][move.X] == 3 {
+			s.Winner = s.CurrentPlayer
+			s.Phase = PhaseGameOver
+			return nil
+		}
+		s.Phase = PhaseBuild
+	case PhaseBuild:
+		if !s.IsValidBuild(s.Selected(), move.X, move.Y) {
+			return errors.New("Illegal build")
+		}
+		s.Levels[move.Y][move.X]++
+		s.SelectedWorker = -1
+		s.CurrentPlayer = (s.CurrentPlayer + 1) % 2
+		s.Phase = PhaseSelect
+		s.checkStuck()
+	}
+	return nil
+}
+
+// checkStuck ends the game if the player to move has no worker that can
+// move, which loses them the game
+func (s *State) checkStuck() {
+	if !s.CanMove(s.CurrentPlayer) {
+		s.Forfeit(s.CurrentPlayer)
+	}
+}
+
+// CanMove reports whether any of player's workers has a square to move to.
+func (s *State) CanMove(player int) bool {
+	for _, w := range s.Workers[player] {
+		for y := w.Y - 1; y <= w.Y+1; y++ {
+			for x := w.X - 1; x <= w.X+1; x++ {
+				if onBoard(x, y) && s.IsValidMove(w, x, y) {
+					return true
+				}
+			}
+		}
+	}
+	return false
+}
+
+// Forfeit ends the game with a win for the other player, e.g. when the
+// player in seat runs out of time.
+func (s *State) Forfeit(seat int) {
+	if s.IsOver() {
+		return
+	}
+	s.Winner = 1 - seat
+	s.SelectedWorker = -1
+	s.Phase = PhaseGameOver
+}
+
+// Selected returns the current player's selected worker.
+func (s *State) Selected() Worker {
+	if s.SelectedWorker < 0 {
+		return Worker{}
+	}
+	return s.Workers[s.CurrentPlayer][s.SelectedWorker]
+}
+
+// WorkerAt returns the owner and index of the worker standing on x, y.
+func (s *State) WorkerAt(x, y int) (player, index int, ok bool) {
+	for p, workers := range s.Workers {
+		for i, w := range workers {
+			if w.Placed && w.X == x && w.Y == y {
+				return p, i, true
+			}
+		}
+	}
+	return 0, 0, false
+}
+
+func (s *State) IsOccupied(x, y int) bool {
+	_, _, ok := s.WorkerAt(x, y)
+	return ok
+}
+
+// IsValidMove reports whether worker can step to x, y: an adjacent,
+// unoccupied square without a dome, at most one level higher.
+func (s *State) IsValidMove(worker Worker, x, y int) bool {
+	dx := abs(worker.X - x)
+	dy := abs(worker.Y - y)
+	if dx > 1 || dy > 1 || (dx == 0 && dy == 0) {
+		return false
+	}
+	if s.IsOccupied(x, y) {
+		return false
+	}
+	if s.Levels[y][x] == 4 {
+		return false
+	}
+	return s.Levels[y][x] <= s.Levels[worker.Y][worker.X]+1
+}
+
+// IsValidBuild reports whether worker can build on x, y: an adjacent,
+// unoccupied square that does not have a dome yet.
+func (s *State) IsValidBuild(worker Worker, x, y int) bool {
+	dx := abs(worker.X - x)
+	dy := abs(worker.Y - y)
+	if dx > 1 || dy > 1 {
+		return false
+	}
+	if s.IsOccupied(x, y) {
+		return false
+	}
+	return s.Levels[y][x] < 4
+}
+
+func (s *State) IsOver() bool {
+	return s.Phase == PhaseGameOver
+}
+
+func abs(x int) int {
+	if x < 0 {
+		return -x
+	}
+	return x
+}
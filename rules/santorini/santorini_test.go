@@ -0,0 +1,227 @@
+package santorini
+
+import (
+	"math/rand"
+	"testing"
+
+	"olive_and_millies_game_room/rules"
+)
+
+// placed returns a game with every worker placed, seat 0 to select
+//
+//	seat 0: (0,0) and (4,4)
+//	seat 1: (4,0) and (0,4)
+func placed(t *testing.T) *State {
+	t.Helper()
+	s := New()
+	for i, sq := range [][2]int{{0, 0}, {4, 0}, {4, 4}, {0, 4}} {
+		if err := s.Apply(i%2, Move{X: sq[0], Y: sq[1], Phase: PhasePlace, Worker: i / 2}); err != nil {
+			t.Fatalf("placing worker %d: %v", i, err)
+		}
+	}
+	return s
+}
+
+func TestApply(t *testing.T) {
+	tests := []struct {
+		name    string
+		setup   func(s *State)
+		seat    int
+		move    Move
+		wantErr bool
+		check   func(t *testing.T, s *State)
+	}{
+		{
+			name: "select own worker",
+			move: Move{X: 0, Y: 0, Phase: PhaseSelect},
+			check: func(t *testing.T, s *State) {
+				if s.Phase != PhaseMove || s.SelectedWorker != 0 {
+					t.Errorf("phase %s, selected %d", s.Phase, s.SelectedWorker)
+				}
+			},
+		},
+		{name: "select other player's worker", move: Move{X: 4, Y: 0, Phase: PhaseSelect}, wantErr: true},
+		{name: "select empty square", move: Move{X: 2, Y: 2, Phase: PhaseSelect}, wantErr: true},
+		{name: "wrong seat", seat: 1, move: Move{X: 4, Y: 0, Phase: PhaseSelect}, wantErr: true},
+		{name: "wrong phase", move: Move{X: 1, Y: 1, Phase: PhaseMove}, wantErr: true},
+		{name: "off the board", move: Move{X: 5, Y: 0, Phase: PhaseSelect}, wantErr: true},
+		{
+			name:  "move to adjacent square",
+			setup: func(s *State) { s.Apply(0, Move{X: 0, Y: 0, Phase: PhaseSelect}) },
+			move:  Move{X: 1, Y: 1, Phase: PhaseMove},
+			check: func(t *testing.T, s *State) {
+				if w := s.Workers[0][0]; w.X != 1 || w.Y != 1 || s.Phase != PhaseBuild {
+					t.Errorf("worker at %d,%d in phase %s", w.X, w.Y, s.Phase)
+				}
+			},
+		},
+		{
+			name:    "move too far",
+			setup:   func(s *State) { s.Apply(0, Move{X: 0, Y: 0, Phase: PhaseSelect}) },
+			move:    Move{X: 2, Y: 2, Phase: PhaseMove},
+			wantErr: true,
+		},
+		{
+			name: "climb two levels",
+			setup: func(s *State) {
+				s.Levels[1][1] = 2
+				s.Apply(0, Move{X: 0, Y: 0, Phase: PhaseSelect})
+			},
+			move:    Move{X: 1, Y: 1, Phase: PhaseMove},
+			wantErr: true,
+		},
+		{
+			name: "move onto a dome",
+			setup: func(s *State) {
+				s.Levels[0][1] = 4
+				s.Apply(0, Move{X: 0, Y: 0, Phase: PhaseSelect})
+			},
+			move:    Move{X: 1, Y: 0, Phase: PhaseMove},
+			wantErr: true,
+		},
+		{
+			name:  "reselect while moving",
+			setup: func(s *State) { s.Apply(0, Move{X: 0, Y: 0, Phase: PhaseSelect}) },
+			move:  Move{X: 4, Y: 4, Phase: PhaseMove},
+			check: func(t *testing.T, s *State) {
+				if s.Phase != PhaseMove || s.SelectedWorker != 1 {
+					t.Errorf("phase %s, selected %d", s.Phase, s.SelectedWorker)
+				}
+			},
+		},
+		{
+			name: "build next to moved worker",
+			setup: func(s *State) {
+				s.Apply(0, Move{X: 0, Y: 0, Phase: PhaseSelect})
+				s.Apply(0, Move{X: 1, Y: 1, Phase: PhaseMove})
+			},
+			move: Move{X: 2, Y: 2, Phase: PhaseBuild},
+			check: func(t *testing.T, s *State) {
+				if s.Levels[2][2] != 1 || s.CurrentPlayer != 1 || s.Phase != PhaseSelect {
+					t.Errorf("level %d, player %d, phase %s", s.Levels[2][2], s.CurrentPlayer, s.Phase)
+				}
+			},
+		},
+		{
+			name: "build on a worker",
+			setup: func(s *State) {
+				s.Apply(0, Move{X: 0, Y: 0, Phase: PhaseSelect})
+				s.Apply(0, Move{X: 1, Y: 1, Phase: PhaseMove})
+			},
+			move:    Move{X: 1, Y: 1, Phase: PhaseBuild},
+			wantErr: true,
+		},
+		{
+			name: "climb to level three wins",
+			setup: func(s *State) {
+				s.Levels[0][0], s.Levels[1][1] = 2, 3
+				s.Apply(0, Move{X: 0, Y: 0, Phase: PhaseSelect})
+			},
+			move: Move{X: 1, Y: 1, Phase: PhaseMove},
+			check: func(t *testing.T, s *State) {
+				if !s.IsOver() || s.Winner != 0 {
+					t.Errorf("over %v, winner %d", s.IsOver(), s.Winner)
+				}
+			},
+		},
+		{
+			name:  "forfeit while moving",
+			setup: func(s *State) { s.Apply(0, Move{X: 0, Y: 0, Phase: PhaseSelect}) },
+			move:  Move{Forfeit: true},
+			check: func(t *testing.T, s *State) {
+				if !s.IsOver() || s.Winner != 1 {
+					t.Errorf("over %v, winner %d", s.IsOver(), s.Winner)
+				}
+			},
+		},
+		{name: "forfeit out of turn", seat: 1, move: Move{Forfeit: true}, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := placed(t)
+			if tt.setup != nil {
+				tt.setup(s)
+			}
+			before := *s
+			err := s.Apply(tt.seat, tt.move)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("got error %v, want error %v", err, tt.wantErr)
+			}
+			if err != nil && *s != before {
+				t.Error("refused move changed the state")
+			}
+			if tt.check != nil {
+				tt.check(t, s)
+			}
+		})
+	}
+}
+
+func TestPlacement(t *testing.T) {
+	s := New()
+	if err := s.Apply(0, Move{X: 2, Y: 2, Phase: PhasePlace}); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Apply(1, Move{X: 2, Y: 2, Phase: PhasePlace}); err == nil {
+		t.Error("placed a worker on an occupied square")
+	}
+	if err := s.Apply(0, Move{X: 3, Y: 3, Phase: PhasePlace}); err != rules.ErrNotYourTurn {
+		t.Errorf("placing out of turn: got %v", err)
+	}
+	if s := placed(t); s.Phase != PhaseSelect || s.CurrentPlayer != 0 {
+		t.Errorf("after placement: phase %s, player %d", s.Phase, s.CurrentPlayer)
+	}
+}
+
+func TestNoLegalMoveLoses(t *testing.T) {
+	s := placed(t)
+	// Seat 1's workers in the top right and bottom left corners are walled
+	// in by domes, bar a step up to 4,1 that seat 0 is about to build on
+	for _, sq := range [][2]int{{3, 0}, {3, 1}, {0, 3}, {1, 3}, {1, 4}} {
+		s.Levels[sq[1]][sq[0]] = 4
+	}
+	s.Levels[1][4] = 1
+	s.Workers[0][1] = Worker{X: 4, Y: 3, Placed: true}
+
+	for _, m := range []Move{
+		{X: 4, Y: 3, Phase: PhaseSelect},
+		{X: 3, Y: 2, Phase: PhaseMove},
+	} {
+		if err := s.Apply(0, m); err != nil {
+			t.Fatalf("%s %d,%d: %v", m.Phase, m.X, m.Y, err)
+		}
+	}
+	if s.IsOver() || !s.CanMove(1) {
+		t.Fatal("seat 1 should still be able to move")
+	}
+	if err := s.Apply(0, Move{X: 4, Y: 1, Phase: PhaseBuild}); err != nil {
+		t.Fatal(err)
+	}
+	if !s.IsOver() || s.Winner != 0 {
+		t.Errorf("seat 1 can't move: over %v, winner %d", s.IsOver(), s.Winner)
+	}
+}
+
+func TestBestMoveBoxesIn(t *testing.T) {
+	// The same corners as above, so seat 0 wins by walling seat 1 in
+	s := placed(t)
+	for _, sq := range [][2]int{{3, 0}, {3, 1}, {0, 3}, {1, 3}, {1, 4}} {
+		s.Levels[sq[1]][sq[0]] = 4
+	}
+	s.Levels[1][4] = 1
+	s.Workers[0][1] = Worker{X: 4, Y: 3, Placed: true}
+
+	rng := rand.New(rand.NewSource(1))
+	for s.CurrentPlayer == 0 && !s.IsOver() {
+		move := s.BestMove(rules.Hard, rng)
+		if err := s.Apply(0, move); err != nil {
+			t.Fatalf("%s %d,%d: %v", move.Phase, move.X, move.Y, err)
+		}
+	}
+	if !s.IsOver() || s.Winner != 0 {
+		t.Fatalf("seat 0 didn't box seat 1 in: over %v, winner %d", s.IsOver(), s.Winner)
+	}
+	if err := s.Apply(1, s.BestMove(rules.Hard, rng)); err == nil {
+		t.Error("computer played on after the game")
+	}
+}
@@ -0,0 +1,54 @@
+package rules
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	mathrand "math/rand"
+	randv2 "math/rand/v2"
+)
+
+// SeedSize is the number of random bytes in a game seed.
+const SeedSize = 32
+
+// NewSeed returns a fresh random seed for a game's dice and shuffles.
+func NewSeed() []byte {
+	seed := make([]byte, SeedSize)
+	if _, err := rand.Read(seed); err != nil {
+		panic("rules: can't read random seed: " + err.Error())
+	}
+	return seed
+}
+
+// Commit returns the commitment to a seed. The server publishes it before
+// the game starts and reveals the seed once the game is over, so players
+// can check the seed wasn't changed along the way.
+func Commit(seed []byte) string {
+	sum := sha256.Sum256(seed)
+	return hex.EncodeToString(sum[:])
+}
+
+// NewRand returns the random number generator for a seed. The server and
+// clients derive it the same way, so anyone holding the revealed seed can
+// replay every roll and shuffle. It's keyed with the whole seed, so there
+// are too many seeds to try every one against the rolls seen so far.
+func NewRand(seed []byte) *mathrand.Rand {
+	var key [SeedSize]byte
+	copy(key[:], seed)
+	return mathrand.New(chachaSource{randv2.NewChaCha8(key)})
+}
+
+// chachaSource lets a ChaCha8 stream drive a math/rand.Rand, which is what
+// the rules take their randomness from
+type chachaSource struct {
+	*randv2.ChaCha8
+}
+
+func (s chachaSource) Int63() int64 {
+	return int64(s.Uint64() >> 1)
+}
+
+// Seed is never called: the stream is keyed once, from the game's seed
+func (s chachaSource) Seed(int64) {
+	panic("rules: a seeded generator can't be reseeded")
+}
@@ -0,0 +1,31 @@
+package rules
+
+import "testing"
+
+func TestNewRand(t *testing.T) {
+	rolls := func(seed []byte) [8]int {
+		rng := NewRand(seed)
+		var r [8]int
+		for i := range r {
+			r[i] = rng.Intn(6)
+		}
+		return r
+	}
+
+	seed := make([]byte, SeedSize)
+	if rolls(seed) != rolls(seed) {
+		t.Error("the same seed rolled differently")
+	}
+
+	// Every byte of the seed counts, not just the first few
+	other := make([]byte, SeedSize)
+	other[SeedSize-1] = 1
+	if rolls(seed) == rolls(other) {
+		t.Error("seeds differing only in their last byte rolled the same")
+	}
+	other = make([]byte, SeedSize)
+	other[8] = 1
+	if rolls(seed) == rolls(other) {
+		t.Error("seeds differing only after byte 8 rolled the same")
+	}
+}
@@ -0,0 +1,278 @@
+package yahtzee
+
+import (
+	"math/rand"
+	"sort"
+
+	"olive_and_millies_game_room/rules"
+)
+
+// Roughly what each category scores on average over a well played game.
+// The hard computer counts filling a category in as giving this up, so it
+// saves Chance and the straights for dice that deserve them.
+var par = [NumCategories]float64{
+	1.9, 5.3, 8.6, 12.2, 15.7, 19.2,
+	21.7, 13.1, 22.6, 29.5, 32.7, 16.9, 22.0,
+}
+
+// How much the hard computer values each point it scores in the upper
+// section above (or below) three of a kind, while the bonus is still to
+// be made
+const bonusWeight = 0.5
+
+// BestMove picks the computer's next move for the player whose turn it
+// is. A turn is played a move at a time, like a person clicking: roll,
+// hold the dice it wants to keep one by one, roll again, and score once
+// it's done rolling.
+//
+// Each level plays with its own personality. Easy keeps whichever face it
+// has most of and scores anywhere the dice are worth something. Medium is
+// greedy: it holds for, and scores, the most points it can this turn.
+// Hard holds for the best expected score over the rolls it has left, and
+// weighs each category against what it's usually worth and the upper
+// section bonus.
+func (s *State) BestMove(level rules.Difficulty, rng *rand.Rand) Move {
+	if s.RollsLeft == 3 {
+		return s.RollMove(rng)
+	}
+
+	if s.RollsLeft > 0 {
+		keep := s.keep(level)
+		for i := range keep {
+			if keep[i] != s.Held[i] {
+				return Move{Action: "hold", DiceIdx: i}
+			}
+		}
+		if keep != [5]bool{true, true, true, true, true} {
+			return s.RollMove(rng)
+		}
+	}
+	return Move{Action: "score", Category: int(s.category(level, rng))}
+}
+
+// keep returns the dice the computer wants to hold before its next roll.
+// It only depends on the dice, so holding them a move at a time settles
+// on the same choice.
+func (s *State) keep(level rules.Difficulty) [5]bool {
+	if level == rules.Easy {
+		counts := [7]int{}
+		for _, v := range s.Dice {
+			counts[v]++
+		}
+		most := 6
+		for face := 5; face >= 1; face-- {
+			if counts[face] > counts[most] {
+				most = face
+			}
+		}
+		var keep [5]bool
+		for i, v := range s.Dice {
+			keep[i] = v == most
+		}
+		return keep
+	}
+
+	p := newPlanner(s.worth(level))
+	var best [5]bool
+	bestValue := -1e9
+	for mask := 0; mask < 1<<5; mask++ {
+		var keep [5]bool
+		var kept []int
+		for i := range keep {
+			if mask&(1<<i) != 0 {
+				keep[i] = true
+				kept = append(kept, s.Dice[i])
+			}
+		}
+		var value float64
+		if len(kept) == 5 {
+			value = p.worth(newHand(kept))
+		} else {
+			value = p.expected(kept, s.RollsLeft)
+		}
+		if value > bestValue+1e-9 {
+			best, bestValue = keep, value
+		}
+	}
+	return best
+}
+
+// category returns the open category the computer scores its dice in
+func (s *State) category(level rules.Difficulty, rng *rand.Rand) Category {
+	switch level {
+	case rules.Easy:
+		var open, worthSomething []Category
+		for category := Ones; category < NumCategories; category++ {
+			if s.Scores[s.CurrentPlayer][category] != nil {
+				continue
+			}
+			open = append(open, category)
+			if Score(s.Dice, category) > 0 {
+				worthSomething = append(worthSomething, category)
+			}
+		}
+		if len(worthSomething) > 0 {
+			return worthSomething[rng.Intn(len(worthSomething))]
+		}
+		return open[rng.Intn(len(open))]
+	case rules.Medium:
+		return s.BestCategory()
+	}
+
+	best, bestValue := Category(-1), -1e9
+	for category := Ones; category < NumCategories; category++ {
+		if s.Scores[s.CurrentPlayer][category] != nil {
+			continue
+		}
+		if value := s.categoryValue(s.Dice, category); value > bestValue {
+			best, bestValue = category, value
+		}
+	}
+	return best
+}
+
+// worth returns how the computer values ending its turn with a hand: what
+// it would score in its best open category, as the level sees it
+func (s *State) worth(level rules.Difficulty) func(hand) float64 {
+	return func(h hand) float64 {
+		best := -1e9
+		for category := Ones; category < NumCategories; category++ {
+			if s.Scores[s.CurrentPlayer][category] != nil {
+				continue
+			}
+			value := float64(Score(h, category))
+			if level != rules.Medium {
+				value = s.categoryValue(h, category)
+			}
+			if value > best {
+				best = value
+			}
+		}
+		return best
+	}
+}
+
+// categoryValue is what the hard computer makes of scoring dice in a
+// category: the points, less what the category is usually worth, plus
+// its progress towards the upper section bonus
+func (s *State) categoryValue(dice [5]int, category Category) float64 {
+	score := Score(dice, category)
+	value := float64(score) - par[category]
+	if category > Sixes {
+		return value
+	}
+
+	upper := 0
+	for i := Ones; i <= Sixes; i++ {
+		if scored := s.Scores[s.CurrentPlayer][i]; scored != nil {
+			upper += *scored
+		}
+	}
+	switch {
+	case upper >= 63:
+	case upper+score >= 63:
+		value += 35
+	default:
+		value += bonusWeight * float64(score-3*(int(category)+1))
+	}
+	return value
+}
+
+// hand is five dice in order, so hands that only differ in the order of
+// their dice are worked out once
+type hand = [5]int
+
+func newHand(dice []int) hand {
+	var h hand
+	copy(h[:], dice)
+	sort.Ints(h[:])
+	return h
+}
+
+// planner works out the expected value of holding dice over the rolls
+// left in a turn, remembering what it has already worked out
+type planner struct {
+	score  func(hand) float64
+	scores map[hand]float64
+	values map[plan]float64 // Best expected value of a hand with rolls left
+	rolls  map[plan]float64 // Expected value of rolling the rest of some kept dice
+}
+
+type plan struct {
+	dice  hand // Unused dice are 0
+	rolls int
+}
+
+func newPlanner(score func(hand) float64) *planner {
+	return &planner{
+		score:  score,
+		scores: make(map[hand]float64),
+		values: make(map[plan]float64),
+		rolls:  make(map[plan]float64),
+	}
+}
+
+func (p *planner) worth(h hand) float64 {
+	value, ok := p.scores[h]
+	if !ok {
+		value = p.score(h)
+		p.scores[h] = value
+	}
+	return value
+}
+
+// value is the best expected value of having a hand with rolls left,
+// keeping whichever dice are best to keep
+func (p *planner) value(h hand, rolls int) float64 {
+	if rolls == 0 {
+		return p.worth(h)
+	}
+	key := plan{h, rolls}
+	if value, ok := p.values[key]; ok {
+		return value
+	}
+	best := p.worth(h)
+	for mask := 0; mask < 1<<5-1; mask++ {
+		var kept []int
+		for i, v := range h {
+			if mask&(1<<i) != 0 {
+				kept = append(kept, v)
+			}
+		}
+		if value := p.expected(kept, rolls); value > best {
+			best = value
+		}
+	}
+	p.values[key] = best
+	return best
+}
+
+// expected is the expected value of keeping some dice and rolling the
+// rest, with rolls left counting the roll about to be made
+func (p *planner) expected(kept []int, rolls int) float64 {
+	key := plan{newHand(kept), rolls}
+	if value, ok := p.rolls[key]; ok {
+		return value
+	}
+
+	dice := make([]int, 5)
+	copy(dice, kept)
+	total, outcomes := 0.0, 0
+	var roll func(i int)
+	roll = func(i int) {
+		if i == len(dice) {
+			total += p.value(newHand(dice), rolls-1)
+			outcomes++
+			return
+		}
+		for face := 1; face <= 6; face++ {
+			dice[i] = face
+			roll(i + 1)
+		}
+	}
+	roll(len(kept))
+
+	value := total / float64(outcomes)
+	p.rolls[key] = value
+	return value
+}
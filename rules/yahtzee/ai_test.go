@@ -0,0 +1,67 @@
+package yahtzee
+
+import (
+	"math/rand"
+	"testing"
+
+	"olive_and_millies_game_room/rules"
+)
+
+// rolled returns a new one-player game after its first roll
+func rolled(t *testing.T, dice ...int) *State {
+	t.Helper()
+	s := New(1)
+	move := Move{Action: "roll"}
+	copy(move.DiceVals[:], dice)
+	if err := s.Apply(0, move); err != nil {
+		t.Fatal(err)
+	}
+	return s
+}
+
+// playHolds plays the computer's holds until it makes some other move,
+// which it returns. Settling on the dice to keep means holding or letting
+// go of each die at most once.
+func playHolds(t *testing.T, s *State, level rules.Difficulty, rng *rand.Rand) Move {
+	t.Helper()
+	var toggled [5]bool
+	for {
+		move := s.BestMove(level, rng)
+		if move.Action != "hold" {
+			return move
+		}
+		if toggled[move.DiceIdx] {
+			t.Fatalf("%s went back on die %d with %v held", level, move.DiceIdx, s.Held)
+		}
+		toggled[move.DiceIdx] = true
+		if err := s.Apply(0, move); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func TestBestMoveSettlesHolds(t *testing.T) {
+	for _, level := range rules.Difficulties {
+		s := rolled(t, 3, 6, 3, 1, 3)
+		rng := rand.New(rand.NewSource(1))
+		if move := playHolds(t, s, level, rng); move.Action != "roll" {
+			t.Errorf("%s finished holding %v with a %s, want a roll", level, s.Held, move.Action)
+		}
+	}
+}
+
+func TestHardKeepsFourOfAKind(t *testing.T) {
+	s := rolled(t, 5, 5, 2, 5, 5)
+	move := playHolds(t, s, rules.Hard, rand.New(rand.NewSource(1)))
+	if want := [5]bool{true, true, false, true, true}; s.Held != want || move.Action != "roll" {
+		t.Errorf("held %v and played %s, want the fives held and the two rolled", s.Held, move.Action)
+	}
+}
+
+func TestHardScoresLargeStraight(t *testing.T) {
+	s := rolled(t, 4, 2, 6, 3, 5)
+	move := playHolds(t, s, rules.Hard, rand.New(rand.NewSource(1)))
+	if move.Action != "score" || Category(move.Category) != LargeStraight {
+		t.Errorf("played %s in %s, want the large straight scored", move.Action, CategoryNames[move.Category])
+	}
+}
@@ -0,0 +1,326 @@
+// Package yahtzee implements the rules of Yahtzee for any number of players.
+package yahtzee
+
+import (
+	"errors"
+	"math/rand"
+	"sort"
+
+	"olive_and_millies_game_room/rules"
+)
+
+type Category int
+
+const (
+	Ones Category = iota
+	Twos
+	Threes
+	Fours
+	Fives
+	Sixes
+	ThreeOfKind
+	FourOfKind
+	FullHouse
+	SmallStraight
+	LargeStraight
+	Yahtzee
+	Chance
+	NumCategories
+)
+
+var CategoryNames = []string{
+	"Ones", "Twos", "Threes", "Fours", "Fives", "Sixes",
+	"3 of a Kind", "4 of a Kind", "Full House",
+	"Small Straight", "Large Straight", "Yahtzee", "Chance",
+}
+
+// Move is a roll, a hold toggle or scoring a category.
+type Move struct {
+	Action   string `json:"action"` // "roll", "hold", "score"
+	DiceIdx  int    `json:"dice_idx,omitempty"`
+	Category int    `json:"category,omitempty"`
+	DiceVals [5]int `json:"dice_vals,omitempty"`
+}
+
+// Roll records which dice were held for a roll and the dice it produced.
+type Roll struct {
+	Held [5]bool `json:"held"`
+	Dice [5]int  `json:"dice"`
+}
+
+// Points for each Yahtzee rolled after one has been scored in the Yahtzee box
+const YahtzeeBonus = 100
+
+// State is a Yahtzee game. Unscored categories are nil.
+type State struct {
+	Dice           [5]int                `json:"dice"` // 0 before the first roll
+	Held           [5]bool               `json:"held"`
+	RollsLeft      int                   `json:"rolls_left"`
+	CurrentPlayer  int                   `json:"current_player"`
+	Scores         [][NumCategories]*int `json:"scores"`
+	YahtzeeBonuses []int                 `json:"yahtzee_bonuses"` // Bonus Yahtzees each player has rolled
+	Totals         []int                 `json:"totals"`
+	GameOver       bool                  `json:"game_over"`
+}
+
+func New(numPlayers int) *State {
+	return &State{
+		RollsLeft:      3,
+		Scores:         make([][NumCategories]*int, numPlayers),
+		YahtzeeBonuses: make([]int, numPlayers),
+		Totals:         make([]int, numPlayers),
+	}
+}
+
+// Clone copies the state, scorecards and all, so the copy can be played on
+// without touching the original. Scores are never changed once written, so
+// the copies share them.
+func (s *State) Clone() *State {
+	c := *s
+	c.Scores = append([][NumCategories]*int(nil), s.Scores...)
+	c.YahtzeeBonuses = append([]int(nil), s.YahtzeeBonuses...)
+	c.Totals = append([]int(nil), s.Totals...)
+	return &c
+}
+
+// Apply validates a move by the player in the given seat and applies it.
+// A roll carries the new dice values, which must leave held dice unchanged.
+func (s *State) Apply(seat int, move Move) error {
+	if s.GameOver {
+		return rules.ErrGameOver
+	}
+	if seat != s.CurrentPlayer {
+		return rules.ErrNotYourTurn
+	}
+
+	switch move.Action {
+	case "hold":
+		if s.RollsLeft == 3 || s.RollsLeft == 0 {
+			return errors.New("Dice can only be held between rolls")
+		}
+		if move.DiceIdx < 0 || move.DiceIdx >= 5 {
+			return errors.New("Die out of range")
+		}
+		s.Held[move.DiceIdx] = !s.Held[move.DiceIdx]
+	case "roll":
+		if err := s.CanRoll(seat); err != nil {
+			return err
+		}
+		for i, val := range move.DiceVals {
+			if val < 1 || val > 6 {
+				return errors.New("Dice values must be 1 to 6")
+			}
+			if s.Held[i] && val != s.Dice[i] {
+				return errors.New("Held dice cannot change")
+			}
+		}
+		s.Dice = move.DiceVals
+		s.RollsLeft--
+	case "score":
+		if s.RollsLeft == 3 {
+			return errors.New("Roll before scoring")
+		}
+		if move.Category < 0 || move.Category >= int(NumCategories) {
+			return errors.New("Category out of range")
+		}
+		scores := &s.Scores[s.CurrentPlayer]
+		if scores[move.Category] != nil {
+			return errors.New("Category already scored")
+		}
+		if yahtzee := scores[Yahtzee]; yahtzee != nil && *yahtzee > 0 && Score(s.Dice, Yahtzee) > 0 {
+			s.YahtzeeBonuses[s.CurrentPlayer]++
+		}
+		score := Score(s.Dice, Category(move.Category))
+		scores[move.Category] = &score
+		s.Totals[s.CurrentPlayer] = Total(*scores, s.YahtzeeBonuses[s.CurrentPlayer])
+		s.nextTurn()
+	default:
+		return errors.New("Unknown Yahtzee action")
+	}
+	return nil
+}
+
+// CanRoll reports why the player in the given seat can't roll, if they can't.
+func (s *State) CanRoll(seat int) error {
+	if s.GameOver {
+		return rules.ErrGameOver
+	}
+	if seat != s.CurrentPlayer {
+		return rules.ErrNotYourTurn
+	}
+	if s.RollsLeft <= 0 {
+		return errors.New("No rolls left")
+	}
+	return nil
+}
+
+// RollMove rolls every die that isn't held and returns the roll as a move.
+func (s *State) RollMove(rng *rand.Rand) Move {
+	move := Move{Action: "roll", DiceVals: s.Dice}
+	for i, held := range s.Held {
+		if !held {
+			move.DiceVals[i] = rng.Intn(6) + 1
+		}
+	}
+	return move
+}
+
+// VerifyRolls reports whether replaying rng over the rolls, in order,
+// reproduces every one of them.
+func VerifyRolls(rng *rand.Rand, rolls []Roll) bool {
+	for _, roll := range rolls {
+		for i, held := range roll.Held {
+			if !held && rng.Intn(6)+1 != roll.Dice[i] {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+func (s *State) nextTurn() {
+	allScored := true
+	for _, scores := range s.Scores {
+		for _, score := range scores {
+			if score == nil {
+				allScored = false
+			}
+		}
+	}
+	if allScored {
+		s.GameOver = true
+		return
+	}
+	s.CurrentPlayer = (s.CurrentPlayer + 1) % len(s.Scores)
+	s.RollsLeft = 3
+	s.Dice = [5]int{}
+	s.Held = [5]bool{}
+}
+
+// BestCategory returns the current player's open category that the dice
+// are worth the most in, the first one on a tie.
+func (s *State) BestCategory() Category {
+	best, bestScore := Category(-1), -1
+	for category := Ones; category < NumCategories; category++ {
+		if s.Scores[s.CurrentPlayer][category] != nil {
+			continue
+		}
+		if score := Score(s.Dice, category); score > bestScore {
+			best, bestScore = category, score
+		}
+	}
+	return best
+}
+
+// Winner returns the seat with the highest total, or -1 if more than one
+// seat shares it.
+func (s *State) Winner() int {
+	winner, best := -1, -1
+	for i, total := range s.Totals {
+		switch {
+		case total > best:
+			winner, best = i, total
+		case total == best:
+			winner = -1
+		}
+	}
+	return winner
+}
+
+// Total adds up a scorecard, including the 35 point upper section bonus
+// and a YahtzeeBonus for each bonus Yahtzee.
+func Total(scores [NumCategories]*int, yahtzeeBonuses int) int {
+	total := yahtzeeBonuses * YahtzeeBonus
+	upperTotal := 0
+	for i := Ones; i <= Sixes; i++ {
+		if scores[i] != nil {
+			upperTotal += *scores[i]
+		}
+	}
+	total += upperTotal
+	if upperTotal >= 63 {
+		total += 35
+	}
+	for i := ThreeOfKind; i < NumCategories; i++ {
+		if scores[i] != nil {
+			total += *scores[i]
+		}
+	}
+	return total
+}
+
+// Score returns what the dice are worth in a category.
+func Score(dice [5]int, category Category) int {
+	values := dice[:]
+	sort.Ints(values)
+	counts := make(map[int]int)
+	sum := 0
+	for _, v := range values {
+		counts[v]++
+		sum += v
+	}
+	switch category {
+	case Ones, Twos, Threes, Fours, Fives, Sixes:
+		target := int(category) + 1
+		return counts[target] * target
+	case ThreeOfKind:
+		for _, count := range counts {
+			if count >= 3 {
+				return sum
+			}
+		}
+		return 0
+	case FourOfKind:
+		for _, count := range counts {
+			if count >= 4 {
+				return sum
+			}
+		}
+		return 0
+	case FullHouse:
+		hasThree, hasTwo := false, false
+		for _, count := range counts {
+			if count == 3 {
+				hasThree = true
+			}
+			if count == 2 {
+				hasTwo = true
+			}
+		}
+		if hasThree && hasTwo {
+			return 25
+		}
+		return 0
+	case SmallStraight:
+		straights := [][]int{{1, 2, 3, 4}, {2, 3, 4, 5}, {3, 4, 5, 6}}
+		for _, straight := range straights {
+			found := true
+			for _, v := range straight {
+				if counts[v] == 0 {
+					found = false
+					break
+				}
+			}
+			if found {
+				return 30
+			}
+		}
+		return 0
+	case LargeStraight:
+		if (values[0] == 1 && values[1] == 2 && values[2] == 3 && values[3] == 4 && values[4] == 5) ||
+			(values[0] == 2 && values[1] == 3 && values[2] == 4 && values[3] == 5 && values[4] == 6) {
+			return 40
+		}
+		return 0
+	case Yahtzee:
+		for _, count := range counts {
+			if count == 5 {
+				return 50
+			}
+		}
+		return 0
+	case Chance:
+		return sum
+	}
+	return 0
+}
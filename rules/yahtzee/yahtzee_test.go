@@ -0,0 +1,221 @@
+package yahtzee
+
+import (
+	"testing"
+
+	"olive_and_millies_game_room/rules"
+)
+
+func TestScore(t *testing.T) {
+	tests := []struct {
+		dice     [5]int
+		category Category
+		want     int
+	}{
+		{[5]int{1, 1, 2, 3, 1}, Ones, 3},
+		{[5]int{6, 6, 6, 6, 2}, Sixes, 24},
+		{[5]int{2, 3, 4, 5, 6}, Ones, 0},
+		{[5]int{3, 3, 3, 4, 5}, ThreeOfKind, 18},
+		{[5]int{3, 3, 2, 4, 5}, ThreeOfKind, 0},
+		{[5]int{5, 5, 5, 5, 1}, FourOfKind, 21},
+		{[5]int{5, 5, 5, 1, 1}, FourOfKind, 0},
+		{[5]int{2, 2, 3, 3, 3}, FullHouse, 25},
+		{[5]int{2, 2, 3, 3, 4}, FullHouse, 0},
+		{[5]int{4, 4, 4, 4, 4}, FullHouse, 0},
+		{[5]int{1, 2, 3, 4, 6}, SmallStraight, 30},
+		{[5]int{6, 4, 3, 5, 3}, SmallStraight, 30},
+		{[5]int{1, 2, 3, 5, 6}, SmallStraight, 0},
+		{[5]int{5, 4, 3, 2, 1}, LargeStraight, 40},
+		{[5]int{2, 3, 4, 5, 6}, LargeStraight, 40},
+		{[5]int{1, 2, 3, 4, 6}, LargeStraight, 0},
+		{[5]int{6, 6, 6, 6, 6}, Yahtzee, 50},
+		{[5]int{6, 6, 6, 6, 5}, Yahtzee, 0},
+		{[5]int{1, 2, 3, 4, 6}, Chance, 16},
+	}
+	for _, tt := range tests {
+		t.Run(CategoryNames[tt.category], func(t *testing.T) {
+			if got := Score(tt.dice, tt.category); got != tt.want {
+				t.Errorf("%v in %s scores %d, want %d", tt.dice, CategoryNames[tt.category], got, tt.want)
+			}
+		})
+	}
+}
+
+func TestTotal(t *testing.T) {
+	tests := []struct {
+		name    string
+		scores  map[Category]int
+		bonuses int
+		want    int
+	}{
+		{name: "empty", want: 0},
+		{
+			name:   "upper section short of the bonus",
+			scores: map[Category]int{Ones: 3, Twos: 6, Threes: 9, Fours: 12, Fives: 15, Sixes: 12},
+			want:   57,
+		},
+		{
+			name:   "upper section bonus",
+			scores: map[Category]int{Ones: 3, Twos: 6, Threes: 9, Fours: 12, Fives: 15, Sixes: 18},
+			want:   63 + 35,
+		},
+		{
+			name:   "both sections",
+			scores: map[Category]int{Fours: 16, FullHouse: 25, Chance: 22},
+			want:   63,
+		},
+		{
+			name:    "yahtzee bonuses",
+			scores:  map[Category]int{Yahtzee: 50, Fives: 25},
+			bonuses: 2,
+			want:    50 + 25 + 2*YahtzeeBonus,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var scores [NumCategories]*int
+			for category, score := range tt.scores {
+				scores[category] = &score
+			}
+			if got := Total(scores, tt.bonuses); got != tt.want {
+				t.Errorf("total %d, want %d", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestApply(t *testing.T) {
+	rolled := func() *State {
+		s := New(2)
+		s.Apply(0, Move{Action: "roll", DiceVals: [5]int{1, 2, 3, 4, 5}})
+		return s
+	}
+	tests := []struct {
+		name    string
+		state   *State
+		seat    int
+		move    Move
+		wantErr bool
+	}{
+		{name: "roll", state: New(2), move: Move{Action: "roll", DiceVals: [5]int{1, 2, 3, 4, 5}}},
+		{name: "wrong seat", state: New(2), seat: 1, move: Move{Action: "roll", DiceVals: [5]int{1, 2, 3, 4, 5}}, wantErr: true},
+		{name: "die out of range", state: New(2), move: Move{Action: "roll", DiceVals: [5]int{0, 2, 3, 4, 5}}, wantErr: true},
+		{name: "hold before rolling", state: New(2), move: Move{Action: "hold"}, wantErr: true},
+		{name: "score before rolling", state: New(2), move: Move{Action: "score"}, wantErr: true},
+		{name: "unknown action", state: New(2), move: Move{Action: "shake"}, wantErr: true},
+		{name: "hold", state: rolled(), move: Move{Action: "hold", DiceIdx: 4}},
+		{name: "hold die out of range", state: rolled(), move: Move{Action: "hold", DiceIdx: 5}, wantErr: true},
+		{name: "score", state: rolled(), move: Move{Action: "score", Category: int(LargeStraight)}},
+		{name: "category out of range", state: rolled(), move: Move{Action: "score", Category: int(NumCategories)}, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.state.Apply(tt.seat, tt.move)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("got error %v, want error %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestTurns(t *testing.T) {
+	s := New(2)
+	roll := func(seat int, dice ...int) {
+		t.Helper()
+		move := Move{Action: "roll"}
+		copy(move.DiceVals[:], dice)
+		if err := s.Apply(seat, move); err != nil {
+			t.Fatalf("roll %v: %v", dice, err)
+		}
+	}
+
+	roll(0, 1, 2, 3, 4, 5)
+	if err := s.Apply(0, Move{Action: "hold", DiceIdx: 0}); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Apply(0, Move{Action: "roll", DiceVals: [5]int{6, 6, 6, 6, 6}}); err == nil {
+		t.Error("a held die changed")
+	}
+	roll(0, 1, 1, 1, 1, 1)
+	roll(0, 1, 1, 1, 1, 1)
+	if err := s.CanRoll(0); err == nil {
+		t.Error("rolled a fourth time")
+	}
+	if err := s.Apply(0, Move{Action: "score", Category: int(Yahtzee)}); err != nil {
+		t.Fatal(err)
+	}
+	if s.CurrentPlayer != 1 || s.RollsLeft != 3 || s.Totals[0] != 50 {
+		t.Fatalf("after scoring: player %d, rolls %d, total %d", s.CurrentPlayer, s.RollsLeft, s.Totals[0])
+	}
+	if err := s.Apply(0, Move{Action: "score", Category: int(Chance)}); err != rules.ErrNotYourTurn {
+		t.Errorf("scoring out of turn: got %v", err)
+	}
+
+	roll(1, 2, 2, 2, 3, 3)
+	if err := s.Apply(1, Move{Action: "score", Category: int(FullHouse)}); err != nil {
+		t.Fatal(err)
+	}
+
+	// A second Yahtzee earns the bonus on top of whatever it's scored as
+	roll(0, 4, 4, 4, 4, 4)
+	if err := s.Apply(0, Move{Action: "score", Category: int(Yahtzee)}); err == nil {
+		t.Error("scored Yahtzee twice")
+	}
+	if err := s.Apply(0, Move{Action: "score", Category: int(Fours)}); err != nil {
+		t.Fatal(err)
+	}
+	if want := 50 + 20 + YahtzeeBonus; s.Totals[0] != want || s.YahtzeeBonuses[0] != 1 {
+		t.Errorf("after a bonus Yahtzee: total %d, want %d; bonuses %d", s.Totals[0], want, s.YahtzeeBonuses[0])
+	}
+}
+
+func TestGameOver(t *testing.T) {
+	s := New(1)
+	for category := Ones; category < NumCategories; category++ {
+		if err := s.Apply(0, Move{Action: "roll", DiceVals: [5]int{6, 6, 6, 6, 6}}); err != nil {
+			t.Fatal(err)
+		}
+		if err := s.Apply(0, Move{Action: "score", Category: int(category)}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if !s.GameOver {
+		t.Fatal("game didn't end with every category scored")
+	}
+	if err := s.Apply(0, Move{Action: "roll", DiceVals: [5]int{1, 1, 1, 1, 1}}); err != rules.ErrGameOver {
+		t.Errorf("rolling after the game: got %v", err)
+	}
+}
+
+func TestClone(t *testing.T) {
+	s := New(2)
+	c := s.Clone()
+	if err := c.Apply(0, Move{Action: "roll", DiceVals: [5]int{5, 5, 5, 5, 5}}); err != nil {
+		t.Fatal(err)
+	}
+	if err := c.Apply(0, Move{Action: "score", Category: int(Yahtzee)}); err != nil {
+		t.Fatal(err)
+	}
+	if s.Scores[0][Yahtzee] != nil || s.Totals[0] != 0 || s.CurrentPlayer != 0 || s.Dice != [5]int{} {
+		t.Errorf("playing on the clone changed the original: %+v", s)
+	}
+}
+
+func TestWinner(t *testing.T) {
+	tests := []struct {
+		totals []int
+		want   int
+	}{
+		{[]int{120}, 0},
+		{[]int{150, 200, 180}, 1},
+		{[]int{200, 150, 200}, -1},
+		{[]int{200, 200, 250}, 2},
+		{[]int{0, 0}, -1},
+	}
+	for _, tt := range tests {
+		s := &State{Totals: tt.totals}
+		if got := s.Winner(); got != tt.want {
+			t.Errorf("totals %v: winner %d, want %d", tt.totals, got, tt.want)
+		}
+	}
+}
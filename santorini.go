@@ -4,64 +4,64 @@ import (
 	"encoding/json"
 	"fmt"
 	"image/color"
+	"math/rand"
+	"time"
 
 	"github.com/hajimehoshi/ebiten/v2"
 	"github.com/hajimehoshi/ebiten/v2/ebitenutil"
 	"github.com/hajimehoshi/ebiten/v2/inpututil"
 	"github.com/hajimehoshi/ebiten/v2/vector"
+
+	"olive_and_millies_game_room/protocol"
+	"olive_and_millies_game_room/rules"
+	"olive_and_millies_game_room/rules/santorini"
 )
 
 const (
-	boardSize = 5
+	boardSize = santorini.BoardSize
 	cellSize  = 80
-)
 
-type Worker struct {
-	x, y     int
-	playerID int
-}
-
-type Cell struct {
-	level int
-}
+	// The computer takes at least this long over each part of its turn,
+	// so the player can see what it's doing
+	santoriniComputerDelay = 700 * time.Millisecond
+)
 
 type SantoriniPlayer struct {
-	id      int
-	name    string
-	avatar  AvatarType
-	workers [2]*Worker
-}
-
-type SantoriniMove struct {
-	X      int    `json:"x"`
-	Y      int    `json:"y"`
-	Phase  string `json:"phase"`
-	Worker int    `json:"worker"` // 0 or 1
+	id     int
+	name   string
+	avatar AvatarType
+	rating int
 }
 
 type SantoriniGame struct {
-	board          [boardSize][boardSize]*Cell
-	players        [2]*SantoriniPlayer
-	currentPlayer  int
-	selectedWorker *Worker
-	gamePhase      string
-	winner         *SantoriniPlayer
-	placementCount int
-	boardOffsetX   float32
-	boardOffsetY   float32
-	networkClient  *NetworkClient
-	myPlayerNum    int
+	state         *santorini.State
+	players       [2]*SantoriniPlayer
+	boardOffsetX  float32
+	boardOffsetY  float32
+	networkClient *NetworkClient
+	myPlayerNum   int
+	turnTimer     *TurnTimer               // The room's time control, nil if it has none
+	roster        []protocol.PlayerInfo    // Who plays an offline game, for the next one
+	computers     map[int]rules.Difficulty // Seats the computer plays offline, and how well
+	computerMove  chan santorini.Move      // The computer's move once it has thought, nil when it isn't thinking
+	rng           *rand.Rand
 }
 
 func NewSantoriniGame() *SantoriniGame {
 	return NewSantoriniGameWithNetwork(nil, 0)
 }
 
+// NewSantoriniGameVsComputer starts an offline game against the computer,
+// with the player going first
+func NewSantoriniGameVsComputer(level rules.Difficulty) *SantoriniGame {
+	return NewSantoriniGameWithPlayers(nil, 0, vsComputer(level))
+}
+
 func NewSantoriniGameWithNetwork(nc *NetworkClient, playerNum int) *SantoriniGame {
 	return NewSantoriniGameWithPlayers(nc, playerNum, nil)
 }
 
-func NewSantoriniGameWithPlayers(nc *NetworkClient, playerNum int, playerData []map[string]interface{}) *SantoriniGame {
+func NewSantoriniGameWithPlayers(nc *NetworkClient, playerNum int, playerData []protocol.PlayerInfo) *SantoriniGame {
 	boardWidth := float32(boardSize * cellSize)
 	boardHeight := float32(boardSize * cellSize)
 
@@ -71,53 +71,52 @@ func NewSantoriniGameWithPlayers(nc *NetworkClient, playerNum int, playerData []
 	boardCenterY := topSpace + (availableHeight-boardHeight)/2
 
 	g := &SantoriniGame{
-		currentPlayer:  0,
-		gamePhase:      "place",
-		placementCount: 0,
-		boardOffsetX:   (screenWidth - boardWidth) / 2,
-		boardOffsetY:   boardCenterY,
-		networkClient:  nc,
-		myPlayerNum:    playerNum,
-	}
-
-	for i := 0; i < boardSize; i++ {
-		for j := 0; j < boardSize; j++ {
-			g.board[i][j] = &Cell{level: 0}
-		}
+		state:         santorini.New(),
+		boardOffsetX:  (screenWidth - boardWidth) / 2,
+		boardOffsetY:  boardCenterY,
+		networkClient: nc,
+		myPlayerNum:   playerNum,
+		roster:        playerData,
+		computers:     localComputers(nc, playerData),
+		rng:           rand.New(rand.NewSource(time.Now().UnixNano())),
 	}
 
 	// Initialize players with server data
 	for i := 0; i < 2; i++ {
 		name := fmt.Sprintf("Player %d", i+1)
 		avatar := i % int(AvatarNumTypes)
+		rating := 0
 
 		if playerData != nil && i < len(playerData) {
-			if n, ok := playerData[i]["name"].(string); ok {
-				name = n
-			}
-			if a, ok := playerData[i]["avatar"].(float64); ok {
-				avatar = int(a)
-			}
+			name = playerData[i].Name
+			avatar = playerData[i].Avatar
+			rating = playerData[i].Rating
 		}
 
-		g.players[i] = &SantoriniPlayer{id: i, name: name, avatar: AvatarType(avatar), workers: [2]*Worker{}}
+		g.players[i] = &SantoriniPlayer{id: i, name: name, avatar: AvatarType(avatar), rating: rating}
 	}
 
 	// Register network handler
 	if nc != nil {
-		nc.RegisterHandler(MsgGameMove, func(msg Message) {
-			var move SantoriniMove
+		nc.RegisterHandler(protocol.MsgGameMove, func(msg protocol.Message) {
+			var move santorini.Move
 			if err := json.Unmarshal(msg.Data, &move); err == nil {
 				g.applyMove(move)
 			}
 		})
+		nc.RegisterHandler(protocol.MsgGameState, func(msg protocol.Message) {
+			state := santorini.New()
+			if err := json.Unmarshal(msg.Data, state); err == nil {
+				g.state = state
+			}
+		})
 	}
 
 	return g
 }
 
 func (g *SantoriniGame) Reset() {
-	*g = *NewSantoriniGame()
+	*g = *NewSantoriniGameWithPlayers(nil, 0, g.roster)
 }
 
 func (g *SantoriniGame) Update(gr *GameRoom) error {
@@ -126,8 +125,13 @@ func (g *SantoriniGame) Update(gr *GameRoom) error {
 		return nil
 	}
 
+	if level, ok := g.computers[g.state.CurrentPlayer]; ok && !g.state.IsOver() {
+		g.updateComputer(level)
+		return nil
+	}
+
 	// Only allow input if it's my turn (or no network client)
-	isMyTurn := g.networkClient == nil || g.currentPlayer == g.myPlayerNum
+	isMyTurn := g.networkClient == nil || g.state.CurrentPlayer == g.myPlayerNum
 
 	if isMyTurn && inpututil.IsMouseButtonJustPressed(ebiten.MouseButtonLeft) {
 		x, y := ebiten.CursorPosition()
@@ -147,181 +151,58 @@ func (g *SantoriniGame) Update(gr *GameRoom) error {
 	return nil
 }
 
-func (g *SantoriniGame) handleClick(x, y int) *SantoriniMove {
-	var workerIdx int
-	if g.selectedWorker != nil {
-		// Find selected worker index
-		for i, w := range g.players[g.currentPlayer].workers {
-			if w == g.selectedWorker {
-				workerIdx = i
-				break
-			}
-		}
-	}
-
-	move := &SantoriniMove{
+func (g *SantoriniGame) handleClick(x, y int) *santorini.Move {
+	move := &santorini.Move{
 		X:      x,
 		Y:      y,
-		Phase:  g.gamePhase,
-		Worker: workerIdx,
-	}
-
-	switch g.gamePhase {
-	case "place":
-		if g.handlePlacement(x, y) {
-			return move
-		}
-	case "select":
-		if g.handleSelection(x, y) {
-			return move
-		}
-	case "move":
-		if g.handleMove(x, y) {
-			return move
-		}
-	case "build":
-		if g.handleBuild(x, y) {
-			return move
-		}
-	}
-	return nil
-}
-
-func (g *SantoriniGame) handlePlacement(x, y int) bool {
-	if g.isOccupied(x, y) {
-		return false
+		Phase:  g.state.Phase,
+		Worker: g.state.SelectedWorker,
 	}
-	player := g.players[g.currentPlayer]
-	workerIndex := g.placementCount / 2
-	if workerIndex < 2 {
-		player.workers[workerIndex] = &Worker{x: x, y: y, playerID: g.currentPlayer}
-		g.placementCount++
-		if g.placementCount == 4 {
-			g.gamePhase = "select"
-			g.currentPlayer = 0
-		} else {
-			g.currentPlayer = (g.currentPlayer + 1) % 2
-		}
-		return true
-	}
-	return false
-}
-
-func (g *SantoriniGame) handleSelection(x, y int) bool {
-	player := g.players[g.currentPlayer]
-	for _, worker := range player.workers {
-		if worker != nil && worker.x == x && worker.y == y {
-			g.selectedWorker = worker
-			g.gamePhase = "move"
-			return true
-		}
-	}
-	return false
-}
-
-func (g *SantoriniGame) handleMove(x, y int) bool {
-	if g.selectedWorker == nil {
-		return false
+	if player, idx, ok := g.state.WorkerAt(x, y); ok && player == g.state.CurrentPlayer {
+		move.Worker = idx
 	}
-	if !g.isValidMove(g.selectedWorker, x, y) {
-		return false
-	}
-	oldLevel := g.board[g.selectedWorker.y][g.selectedWorker.x].level
-	g.selectedWorker.x = x
-	g.selectedWorker.y = y
-	newLevel := g.board[y][x].level
-	if oldLevel < 3 && newLevel == 3 {
-		g.winner = g.players[g.currentPlayer]
-		g.gamePhase = "gameover"
-		return true
-	}
-	g.gamePhase = "build"
-	return true
-}
 
-func (g *SantoriniGame) handleBuild(x, y int) bool {
-	if g.selectedWorker == nil {
-		return false
-	}
-	if !g.isValidBuild(g.selectedWorker, x, y) {
-		return false
+	if !g.applyMove(*move) {
+		return nil
 	}
-	g.board[y][x].level++
-	g.selectedWorker = nil
-	g.currentPlayer = (g.currentPlayer + 1) % 2
-	g.gamePhase = "select"
-	return true
+	return move
 }
 
-func (g *SantoriniGame) applyMove(move SantoriniMove) {
-	switch move.Phase {
-	case "place":
-		g.handlePlacement(move.X, move.Y)
-	case "select":
-		// Select the worker
-		player := g.players[g.currentPlayer]
-		if move.Worker < len(player.workers) && player.workers[move.Worker] != nil {
-			g.selectedWorker = player.workers[move.Worker]
-			g.gamePhase = "move"
-		}
-	case "move":
-		g.handleMove(move.X, move.Y)
-	case "build":
-		g.handleBuild(move.X, move.Y)
+// Have the computer think about the next part of its turn in the
+// background, so the search doesn't hold up drawing, and play it once it's
+// ready
+func (g *SantoriniGame) updateComputer(level rules.Difficulty) {
+	if g.computerMove == nil {
+		// The search gets a generator of its own, as a rand.Rand isn't safe
+		// to share with the update loop
+		state := *g.state
+		rng := rand.New(rand.NewSource(g.rng.Int63()))
+		moves := make(chan santorini.Move, 1)
+		g.computerMove = moves
+		go func() {
+			start := time.Now()
+			move := state.BestMove(level, rng)
+			time.Sleep(santoriniComputerDelay - time.Since(start))
+			moves <- move
+		}()
+		return
 	}
-}
 
-func (g *SantoriniGame) isOccupied(x, y int) bool {
-	for _, player := range g.players {
-		for _, worker := range player.workers {
-			if worker != nil && worker.x == x && worker.y == y {
-				return true
-			}
+	select {
+	case move := <-g.computerMove:
+		g.computerMove = nil
+		if !g.applyMove(move) {
+			// Asking again would only get the same move back, so the
+			// computer loses rather than holding the game up for good
+			g.state.Forfeit(g.state.CurrentPlayer)
 		}
+	default:
 	}
-	return false
 }
 
-func (g *SantoriniGame) isValidMove(worker *Worker, x, y int) bool {
-	dx := abs(worker.x - x)
-	dy := abs(worker.y - y)
-	if dx > 1 || dy > 1 || (dx == 0 && dy == 0) {
-		return false
-	}
-	if g.isOccupied(x, y) {
-		return false
-	}
-	if g.board[y][x].level == 4 {
-		return false
-	}
-	currentLevel := g.board[worker.y][worker.x].level
-	targetLevel := g.board[y][x].level
-	if targetLevel > currentLevel+1 {
-		return false
-	}
-	return true
-}
-
-func (g *SantoriniGame) isValidBuild(worker *Worker, x, y int) bool {
-	dx := abs(worker.x - x)
-	dy := abs(worker.y - y)
-	if dx > 1 || dy > 1 {
-		return false
-	}
-	if g.isOccupied(x, y) {
-		return false
-	}
-	if g.board[y][x].level >= 4 {
-		return false
-	}
-	return true
-}
-
-func abs(x int) int {
-	if x < 0 {
-		return -x
-	}
-	return x
+// applyMove plays a move for the current player, reporting whether it was legal
+func (g *SantoriniGame) applyMove(move santorini.Move) bool {
+	return g.state.Apply(g.state.CurrentPlayer, move) == nil
 }
 
 func (g *SantoriniGame) Draw(screen *ebiten.Image, gr *GameRoom) {
@@ -332,7 +213,7 @@ func (g *SantoriniGame) Draw(screen *ebiten.Image, gr *GameRoom) {
 	g.drawBoard(screen)
 	g.drawWorkers(screen)
 	g.drawPlayerInfo(screen)
-	if g.gamePhase == "gameover" {
+	if g.state.IsOver() {
 		g.drawWinner(screen)
 	}
 }
@@ -353,15 +234,16 @@ func (g *SantoriniGame) drawGameInfo(screen *ebiten.Image) {
 	vector.StrokeRect(screen, infoX, 70, infoWidth, 50, 2, color.RGBA{100, 150, 220, 255}, false)
 
 	var phaseText string
-	switch g.gamePhase {
-	case "place":
-		phaseText = fmt.Sprintf("%s: Place Worker", g.players[g.currentPlayer].name)
-	case "select":
-		phaseText = fmt.Sprintf("%s: Select Worker", g.players[g.currentPlayer].name)
-	case "move":
-		phaseText = fmt.Sprintf("%s: Move Worker", g.players[g.currentPlayer].name)
-	case "build":
-		phaseText = fmt.Sprintf("%s: Build", g.players[g.currentPlayer].name)
+	currentName := g.players[g.state.CurrentPlayer].name
+	switch g.state.Phase {
+	case santorini.PhasePlace:
+		phaseText = fmt.Sprintf("%s: Place Worker", currentName)
+	case santorini.PhaseSelect:
+		phaseText = fmt.Sprintf("%s: Select Worker", currentName)
+	case santorini.PhaseMove:
+		phaseText = fmt.Sprintf("%s: Move Worker", currentName)
+	case santorini.PhaseBuild:
+		phaseText = fmt.Sprintf("%s: Build", currentName)
 	}
 
 	phaseTextX := int(infoX + (infoWidth-float32(len(phaseText)*6))/2)
@@ -378,15 +260,14 @@ func (g *SantoriniGame) drawBoard(screen *ebiten.Image) {
 			vector.DrawFilledRect(screen, x, y, cellSize, cellSize, cellColor, false)
 			vector.StrokeRect(screen, x, y, cellSize, cellSize, 2, color.RGBA{100, 80, 60, 255}, false)
 
-			cell := g.board[i][j]
-			g.drawBuilding(screen, x, y, cell.level)
+			g.drawBuilding(screen, x, y, g.state.Levels[i][j])
 
-			if g.gamePhase == "move" && g.selectedWorker != nil {
-				if g.isValidMove(g.selectedWorker, j, i) {
+			if g.state.Phase == santorini.PhaseMove && g.state.SelectedWorker >= 0 {
+				if g.state.IsValidMove(g.state.Selected(), j, i) {
 					vector.StrokeRect(screen, x+2, y+2, cellSize-4, cellSize-4, 3, color.RGBA{100, 255, 100, 200}, false)
 				}
-			} else if g.gamePhase == "build" && g.selectedWorker != nil {
-				if g.isValidBuild(g.selectedWorker, j, i) {
+			} else if g.state.Phase == santorini.PhaseBuild && g.state.SelectedWorker >= 0 {
+				if g.state.IsValidBuild(g.state.Selected(), j, i) {
 					vector.StrokeRect(screen, x+2, y+2, cellSize-4, cellSize-4, 3, color.RGBA{100, 150, 255, 200}, false)
 				}
 			}
@@ -417,15 +298,15 @@ func (g *SantoriniGame) drawBuilding(screen *ebiten.Image, x, y float32, level i
 }
 
 func (g *SantoriniGame) drawWorkers(screen *ebiten.Image) {
-	for _, player := range g.players {
-		for _, worker := range player.workers {
-			if worker != nil {
-				x := g.boardOffsetX + float32(worker.x)*cellSize + cellSize/2
-				y := g.boardOffsetY + float32(worker.y)*cellSize + cellSize/2
+	for p, player := range g.players {
+		for i, worker := range g.state.Workers[p] {
+			if worker.Placed {
+				x := g.boardOffsetX + float32(worker.X)*cellSize + cellSize/2
+				y := g.boardOffsetY + float32(worker.Y)*cellSize + cellSize/2
 
 				DrawAvatar(screen, player.avatar, x-25, y-25, 1.0)
 
-				if g.selectedWorker == worker {
+				if p == g.state.CurrentPlayer && i == g.state.SelectedWorker {
 					vector.StrokeRect(screen, x-27, y-27, 54, 54, 3, color.RGBA{255, 255, 100, 255}, false)
 				}
 			}
@@ -458,11 +339,25 @@ func (g *SantoriniGame) drawPlayerInfo(screen *ebiten.Image) {
 		vector.DrawFilledRect(screen, x, y, 320, 100, panelColor, false)
 		vector.StrokeRect(screen, x, y, 320, 100, 2, borderColor, false)
 		DrawAvatar(screen, player.avatar, x+10, y+10, 1.5)
-		ebitenutil.DebugPrintAt(screen, player.name, int(x+90), int(y+30))
-		ebitenutil.DebugPrintAt(screen, player.name, int(x+91), int(y+30))
-		if g.currentPlayer == i {
+		playerName := ratedName(player.name, player.rating)
+		ebitenutil.DebugPrintAt(screen, playerName, int(x+90), int(y+30))
+		ebitenutil.DebugPrintAt(screen, playerName, int(x+91), int(y+30))
+		if g.state.CurrentPlayer == i {
 			ebitenutil.DebugPrintAt(screen, "Current Turn", int(x+90), int(y+50))
 		}
+		g.turnTimer.DrawRing(screen, i, x+280, y+50, 26)
+	}
+}
+
+func (g *SantoriniGame) SetTurnTimer(t *TurnTimer) {
+	g.turnTimer = t
+}
+
+func (g *SantoriniGame) SetRatings(ratings []int) {
+	for i, rating := range ratings {
+		if i < len(g.players) {
+			g.players[i].rating = rating
+		}
 	}
 }
 
@@ -482,7 +377,7 @@ func (g *SantoriniGame) drawWinner(screen *ebiten.Image) {
 	vector.DrawFilledRect(screen, bannerX-20, bannerY+40, 10, 10, starColor, false)
 	vector.DrawFilledRect(screen, bannerX+bannerWidth+8, bannerY+40, 10, 10, starColor, false)
 
-	winnerText := fmt.Sprintf("WINNER: %s", g.winner.name)
+	winnerText := fmt.Sprintf("WINNER: %s", g.players[g.state.Winner].name)
 	winnerTextX := int(bannerX + (bannerWidth-float32(len(winnerText)*6))/2)
 	ebitenutil.DebugPrintAt(screen, winnerText, winnerTextX, int(bannerY+20))
 	ebitenutil.DebugPrintAt(screen, winnerText, winnerTextX+1, int(bannerY+20))
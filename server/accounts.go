@@ -0,0 +1,142 @@
+package main
+
+import (
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+// Account is a player's identity across sessions. The client keeps the ID
+// and key locally and presents them when it connects; the server only
+// keeps a hash of the key.
+type Account struct {
+	ID        string    `json:"id"`
+	KeyHash   string    `json:"key_hash"`
+	Name      string    `json:"name"`
+	Avatar    int       `json:"avatar"`
+	CreatedAt time.Time `json:"created_at"`
+	LastSeen  time.Time `json:"last_seen"`
+}
+
+// AccountStore keeps every player's account
+type AccountStore interface {
+	Get(id string) (Account, bool)
+	Save(account Account) error
+}
+
+// FileAccountStore keeps all accounts in memory and writes them to a single
+// JSON file after every change
+type FileAccountStore struct {
+	path     string
+	accounts map[string]Account // Keyed by account ID
+	mu       sync.RWMutex
+}
+
+func NewFileAccountStore(path string) (*FileAccountStore, error) {
+	fs := &FileAccountStore{
+		path:     path,
+		accounts: make(map[string]Account),
+	}
+
+	data, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return fs, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(data, &fs.accounts); err != nil {
+		return nil, err
+	}
+	return fs, nil
+}
+
+func (fs *FileAccountStore) Get(id string) (Account, bool) {
+	fs.mu.RLock()
+	defer fs.mu.RUnlock()
+
+	account, ok := fs.accounts[id]
+	return account, ok
+}
+
+func (fs *FileAccountStore) Save(account Account) error {
+	fs.mu.Lock()
+	defer fs.mu.Unlock()
+
+	fs.accounts[account.ID] = account
+
+	data, err := json.Marshal(fs.accounts)
+	if err != nil {
+		return err
+	}
+	return writeFileAtomic(fs.path, data)
+}
+
+// Write then rename so a crash never leaves a truncated file behind
+func writeFileAtomic(path string, data []byte) error {
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return err
+	}
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, path)
+}
+
+func hashKey(key string) string {
+	sum := sha256.Sum256([]byte(key))
+	return hex.EncodeToString(sum[:])
+}
+
+// signIn looks up the account for the credential a client presented. A
+// missing or wrong key doesn't sign in.
+func signIn(store AccountStore, id, key string) (Account, bool) {
+	if id == "" || key == "" {
+		return Account{}, false
+	}
+	account, ok := store.Get(id)
+	if !ok {
+		return Account{}, false
+	}
+	if subtle.ConstantTimeCompare([]byte(hashKey(key)), []byte(account.KeyHash)) != 1 {
+		return Account{}, false
+	}
+	return account, true
+}
+
+// newAccount makes an account for a player connecting for the first time.
+// The key is only ever sent to the client, which has to keep it.
+func newAccount() (account Account, key string) {
+	id := generateID()
+	key = generateToken()
+	now := time.Now()
+	return Account{
+		ID:        id,
+		KeyHash:   hashKey(key),
+		Name:      fmt.Sprintf("Player %s", id[len(id)-4:]),
+		CreatedAt: now,
+		LastSeen:  now,
+	}, key
+}
+
+// Save a player's name and avatar to their account
+func (s *Server) saveAccount(player *Player) {
+	account, ok := s.accounts.Get(player.ID)
+	if !ok {
+		return
+	}
+	account.Name = player.Name
+	account.Avatar = player.Avatar
+	account.LastSeen = time.Now()
+	if err := s.accounts.Save(account); err != nil {
+		log.Printf("Error saving account %s: %v\n", player.ID, err)
+	}
+}
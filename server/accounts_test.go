@@ -0,0 +1,79 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"olive_and_millies_game_room/protocol"
+)
+
+func TestSignIn(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "accounts", "accounts.json")
+	store, err := NewFileAccountStore(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	account, key := newAccount()
+	if err := store.Save(account); err != nil {
+		t.Fatal(err)
+	}
+
+	// The account is still there after a restart, with nothing left over
+	// from writing it
+	store, err = NewFileAccountStore(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(path + ".tmp"); !os.IsNotExist(err) {
+		t.Errorf("temporary file left behind: %v", err)
+	}
+
+	tests := []struct {
+		name    string
+		id, key string
+		ok      bool
+	}{
+		{"right key", account.ID, key, true},
+		{"wrong key", account.ID, key + "x", false},
+		{"stored hash as the key", account.ID, account.KeyHash, false},
+		{"no key", account.ID, "", false},
+		{"unknown account", generateID(), key, false},
+	}
+	for _, tt := range tests {
+		got, ok := signIn(store, tt.id, tt.key)
+		if ok != tt.ok || (ok && got.ID != account.ID) {
+			t.Errorf("%s: signed in %v as %q", tt.name, ok, got.ID)
+		}
+	}
+}
+
+func TestSetName(t *testing.T) {
+	s, url := newTestServer(t)
+	c := connectClient(t, url)
+	c.send(protocol.MsgCreateRoom, protocol.CreateRoom{GameType: "memory", RoomName: "Test"})
+	c.expect(protocol.MsgRoomCreated)
+
+	// Whitespace is tidied and the name cut to length, with no space left
+	// dangling where it was cut
+	c.send(protocol.MsgSetName, protocol.SetName{Name: "  Olive\tthe \n Great and a very long tail "})
+	var update protocol.PlayerUpdate
+	decode(t, c.expect(protocol.MsgPlayerUpdate).Data, &update)
+	const want = "Olive the Great and"
+	if update.Name != want {
+		t.Errorf("name set to %q, want %q", update.Name, want)
+	}
+	if account, _ := s.accounts.Get(c.id); account.Name != want {
+		t.Errorf("account saved as %q, want %q", account.Name, want)
+	}
+
+	c.send(protocol.MsgSetName, protocol.SetName{Name: " \t\n"})
+	var e protocol.Error
+	decode(t, c.expect(protocol.MsgError).Data, &e)
+	if e.Code != protocol.ErrBadRequest {
+		t.Errorf("blank name: got %s", e.Code)
+	}
+	if account, _ := s.accounts.Get(c.id); account.Name != want {
+		t.Errorf("blank name saved as %q", account.Name)
+	}
+}
@@ -0,0 +1,202 @@
+package main
+
+import (
+	"encoding/json"
+	"log"
+	"math/rand"
+	"time"
+
+	"olive_and_millies_game_room/protocol"
+	"olive_and_millies_game_room/rules"
+)
+
+// How long a computer player waits before each move, so the people
+// playing them can follow along
+const botMoveDelay = 800 * time.Millisecond
+
+// How long clients leave a mismatched pair of Memory Match cards face up
+const memoryFlipDelay = time.Second
+
+// Bot is what makes a Player a computer player. Bots sit in a room like
+// anyone else but have no connection; the server plays their moves.
+type Bot struct {
+	Level rules.Difficulty
+	rng   *rand.Rand // Only used by the bot's own moves, one at a time, and its Memory Match recall
+}
+
+// Engines for games with computer players
+type botEngine interface {
+	// BotMove returns a function that works out the computer's move for
+	// the seat from a copy of the game as it is now, so the thinking can
+	// be done without holding room.mu
+	BotMove(seat int, level rules.Difficulty, rng *rand.Rand) func() json.RawMessage
+}
+
+// Engines whose computer players wait longer before some moves than
+// botMoveDelay
+type botPacer interface {
+	BotDelay() time.Duration
+}
+
+func newBotPlayer(roomID string, level rules.Difficulty) *Player {
+	return &Player{
+		ID:     generateID(),
+		Name:   level.ComputerName(),
+		Avatar: rand.Intn(len(avatarNames)),
+		RoomID: roomID,
+		Bot: &Bot{
+			Level: level,
+			rng:   rand.New(rand.NewSource(time.Now().UnixNano())),
+		},
+	}
+}
+
+// Whether anyone in the room is a person rather than a computer player.
+// Must be called with room.mu held.
+func (room *Room) hasPeople() bool {
+	for _, p := range room.Players {
+		if p.Bot == nil {
+			return true
+		}
+	}
+	return false
+}
+
+// handleAddBot seats a computer player in the host's room before the game
+// starts. The host removes one again by kicking it.
+func (s *Server) handleAddBot(player *Player, msg protocol.Message) {
+	var data protocol.AddBot
+	if err := msg.Decode(&data); err != nil {
+		s.sendError(player, protocol.ErrBadRequest, "Invalid bot data")
+		return
+	}
+	level, err := rules.ParseDifficulty(data.Difficulty)
+	if err != nil {
+		s.sendError(player, protocol.ErrBadRequest, err.Error())
+		return
+	}
+	room := s.hostedRoom(player)
+	if room == nil {
+		return
+	}
+
+	room.mu.Lock()
+	if !protocol.HasComputerPlayers(room.GameType) {
+		room.mu.Unlock()
+		s.sendError(player, protocol.ErrBadRequest, "This game has no computer players")
+		return
+	}
+	if room.Started || room.countdown != nil {
+		room.mu.Unlock()
+		s.sendError(player, protocol.ErrGameStarted, "Game already started")
+		return
+	}
+	if len(room.Players) >= room.MaxPlayers {
+		room.mu.Unlock()
+		s.sendError(player, protocol.ErrRoomFull, "Room is full")
+		return
+	}
+	bot := newBotPlayer(room.ID, level)
+	room.Players = append(room.Players, bot)
+	room.mu.Unlock()
+
+	log.Printf("Host %s added %s bot %s to room %s\n", player.ID, level, bot.ID, room.ID)
+	s.broadcastToRoom(room, protocol.Message{
+		Type:      protocol.MsgPlayerJoined,
+		PlayerID:  bot.ID,
+		RoomID:    room.ID,
+		Timestamp: time.Now(),
+	})
+	s.broadcastRoomList()
+}
+
+// If it's a computer player's turn, have them move after a pause. Must be
+// called with room.mu held.
+func (s *Server) scheduleBotMove(room *Room) {
+	s.stopBotMove(room)
+	if room.Game == nil || room.Game.IsOver() {
+		return
+	}
+	if seat, _ := room.Game.Turn(); seat < 0 || seat >= len(room.Players) || room.Players[seat].Bot == nil {
+		return
+	}
+
+	delay := botMoveDelay
+	if pacer, ok := room.Game.(botPacer); ok {
+		delay = pacer.BotDelay()
+	}
+	var timer *time.Timer
+	timer = time.AfterFunc(delay, func() {
+		s.playBotMove(room, &timer)
+	})
+	room.botTimer = timer
+}
+
+// Must be called with room.mu held
+func (s *Server) stopBotMove(room *Room) {
+	if room.botTimer != nil {
+		room.botTimer.Stop()
+		room.botTimer = nil
+	}
+}
+
+// Work out and play the move of the computer player whose turn it is. As
+// with the turn timer, timer is only read with room.mu held.
+func (s *Server) playBotMove(room *Room, timer **time.Timer) {
+	room.mu.Lock()
+	if room.botTimer != *timer || room.Game == nil || room.Game.IsOver() {
+		// Cancelled since
+		room.mu.Unlock()
+		return
+	}
+	room.botTimer = nil
+	engine, ok := room.Game.(botEngine)
+	seat, _ := room.Game.Turn()
+	if !ok || seat < 0 || seat >= len(room.Players) || room.Players[seat].Bot == nil {
+		room.mu.Unlock()
+		return
+	}
+	game, moves, bot := room.Game, len(room.Moves), room.Players[seat]
+	think := engine.BotMove(seat, bot.Bot.Level, bot.Bot.rng)
+	room.mu.Unlock()
+
+	data := think()
+
+	room.mu.Lock()
+	// Someone may have left, or the clock run out, while the bot thought
+	if room.Game != game || len(room.Moves) != moves || room.Game.IsOver() {
+		room.mu.Unlock()
+		return
+	}
+	applied, err := room.Game.ApplyMove(seat, data)
+	if err != nil {
+		// Rather than leave the game waiting on the bot for good, play
+		// its turn as if it had run out of time
+		log.Printf("Bot %s in room %s made an illegal move: %v\n", bot.ID, room.ID, err)
+		record, watchers := s.playTimeOut(room, seat)
+		room.mu.Unlock()
+		s.saveMatch(room, record, watchers)
+		return
+	}
+	if applied != nil {
+		data = applied
+	}
+	room.Moves = append(room.Moves, protocol.MatchMove{Seat: seat, Data: data, Time: time.Now()})
+
+	watchers := append(append([]*Player{}, room.Players...), room.Spectators...)
+	msg := protocol.Message{
+		Type:      protocol.MsgGameMove,
+		PlayerID:  bot.ID,
+		RoomID:    room.ID,
+		GameType:  room.GameType,
+		Data:      data,
+		Timestamp: time.Now(),
+	}
+	for _, p := range watchers {
+		s.sendMessage(p, msg)
+	}
+	record := s.afterMove(room, watchers)
+	room.mu.Unlock()
+
+	s.saveMatch(room, record, watchers)
+}
@@ -0,0 +1,310 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/rand"
+	"time"
+
+	"olive_and_millies_game_room/protocol"
+	"olive_and_millies_game_room/rules"
+	"olive_and_millies_game_room/rules/connectfour"
+	"olive_and_millies_game_room/rules/memory"
+	"olive_and_millies_game_room/rules/santorini"
+	"olive_and_millies_game_room/rules/yahtzee"
+)
+
+// GameEngine holds the authoritative state of a game in progress.
+// The server applies every move a client sends through the engine, so a
+// modified client can no longer play out of turn or make an illegal move.
+type GameEngine interface {
+	// ApplyMove validates a move sent by the player in the given seat
+	// (their index in the room's player list) and applies it. If the
+	// server had to fill the move in, like rolling the dice for a roll
+	// request, the completed move is returned, otherwise nil.
+	ApplyMove(seat int, data json.RawMessage) (json.RawMessage, error)
+	// State returns a snapshot of the game that is sent to clients.
+	State() interface{}
+	// IsOver reports whether the game has finished.
+	IsOver() bool
+	// Result returns the final score of each seat, nil for games without
+	// scores, and the winning seat, -1 for a draw or tie.
+	Result() (scores []int, winner int)
+	// Turn returns the seat whose turn it is, and whether the last move
+	// started that turn rather than carrying on with it, which is when a
+	// per-turn timer starts over.
+	Turn() (seat int, started bool)
+	// TimeOut plays for the seat whose time ran out, or ends the game
+	// against them, and returns any moves made on their behalf.
+	TimeOut(seat int) []json.RawMessage
+}
+
+// Engines that deal something the players need before the first move,
+// like Memory's number of cards, add it to the start_game payload
+type startDataEngine interface {
+	StartData(data *protocol.StartGame)
+}
+
+// Engines that draw from the room's RNG during play reveal what they drew
+// along with the seed when the game is over, so players can replay it
+type randomHistoryEngine interface {
+	RandomHistory(reveal *protocol.SeedReveal)
+}
+
+var errBadMove = errors.New("Invalid move data")
+
+// The error code to send back with a move the engine rejected
+func moveErrorCode(err error) protocol.ErrorCode {
+	switch {
+	case errors.Is(err, rules.ErrNotYourTurn):
+		return protocol.ErrNotYourTurn
+	case errors.Is(err, errBadMove):
+		return protocol.ErrBadRequest
+	default:
+		return protocol.ErrIllegalMove
+	}
+}
+
+// Create a game engine for a room that is starting. All of the game's
+// randomness comes from rng.
+func newGameEngine(gameType string, numPlayers int, rng *rand.Rand) (GameEngine, error) {
+	switch gameType {
+	case "connect_four":
+		return &connectFourEngine{state: connectfour.New()}, nil
+	case "santorini":
+		return &santoriniEngine{state: santorini.New()}, nil
+	case "yahtzee":
+		return &yahtzeeEngine{state: yahtzee.New(numPlayers), rng: rng}, nil
+	case "memory":
+		layout := memory.Shuffle(rng)
+		return &memoryEngine{state: memory.New(numPlayers, layout), layout: layout}, nil
+	default:
+		return nil, fmt.Errorf("Unknown game type %s", gameType)
+	}
+}
+
+type connectFourEngine struct {
+	state *connectfour.State
+}
+
+func (e *connectFourEngine) ApplyMove(seat int, data json.RawMessage) (json.RawMessage, error) {
+	var move connectfour.Move
+	if err := json.Unmarshal(data, &move); err != nil {
+		return nil, errBadMove
+	}
+	return nil, e.state.Apply(seat, move)
+}
+
+func (e *connectFourEngine) State() interface{} { return e.state }
+func (e *connectFourEngine) IsOver() bool       { return e.state.IsOver() }
+
+// Connect Four numbers its players 1 and 2, with 0 for no winner
+func (e *connectFourEngine) Result() ([]int, int) { return nil, e.state.Winner - 1 }
+func (e *connectFourEngine) Turn() (int, bool)    { return e.state.CurrentPlayer - 1, true }
+
+// Running out of time on the clock loses the game, which goes down as a
+// forfeit move so the match history says how it ended
+func (e *connectFourEngine) TimeOut(seat int) []json.RawMessage {
+	move := connectfour.Move{Forfeit: true}
+	if err := e.state.Apply(seat, move); err != nil {
+		return nil
+	}
+	data, _ := json.Marshal(move)
+	return []json.RawMessage{data}
+}
+
+func (e *connectFourEngine) BotMove(seat int, level rules.Difficulty, rng *rand.Rand) func() json.RawMessage {
+	state := *e.state
+	return func() json.RawMessage {
+		return protocol.Encode(state.BestMove(level, rng))
+	}
+}
+
+type santoriniEngine struct {
+	state *santorini.State
+}
+
+func (e *santoriniEngine) ApplyMove(seat int, data json.RawMessage) (json.RawMessage, error) {
+	var move santorini.Move
+	if err := json.Unmarshal(data, &move); err != nil {
+		return nil, errBadMove
+	}
+	return nil, e.state.Apply(seat, move)
+}
+
+func (e *santoriniEngine) State() interface{}   { return e.state }
+func (e *santoriniEngine) IsOver() bool         { return e.state.IsOver() }
+func (e *santoriniEngine) Result() ([]int, int) { return nil, e.state.Winner }
+
+// A turn starts by placing a worker or by selecting one to move
+func (e *santoriniEngine) Turn() (int, bool) {
+	return e.state.CurrentPlayer, e.state.Phase == santorini.PhasePlace || e.state.Phase == santorini.PhaseSelect
+}
+
+// Running out of time on the clock loses the game
+func (e *santoriniEngine) TimeOut(seat int) []json.RawMessage {
+	move := santorini.Move{Forfeit: true}
+	if err := e.state.Apply(seat, move); err != nil {
+		return nil
+	}
+	data, _ := json.Marshal(move)
+	return []json.RawMessage{data}
+}
+
+// The computer plays its turn a phase at a time, like a person clicking
+func (e *santoriniEngine) BotMove(seat int, level rules.Difficulty, rng *rand.Rand) func() json.RawMessage {
+	state := *e.state
+	return func() json.RawMessage {
+		return protocol.Encode(state.BestMove(level, rng))
+	}
+}
+
+type yahtzeeEngine struct {
+	state *yahtzee.State
+	rng   *rand.Rand
+	rolls []yahtzee.Roll
+}
+
+func (e *yahtzeeEngine) ApplyMove(seat int, data json.RawMessage) (json.RawMessage, error) {
+	var move yahtzee.Move
+	if err := json.Unmarshal(data, &move); err != nil {
+		return nil, errBadMove
+	}
+	if move.Action != "roll" {
+		return nil, e.state.Apply(seat, move)
+	}
+
+	// The server rolls the dice, whatever the client asked for. Check the
+	// roll is allowed first so a bad request doesn't use up the RNG.
+	if err := e.state.CanRoll(seat); err != nil {
+		return nil, err
+	}
+	held := e.state.Held
+	move = e.state.RollMove(e.rng)
+	if err := e.state.Apply(seat, move); err != nil {
+		return nil, err
+	}
+	e.rolls = append(e.rolls, yahtzee.Roll{Held: held, Dice: move.DiceVals})
+	return json.Marshal(move)
+}
+
+func (e *yahtzeeEngine) RandomHistory(reveal *protocol.SeedReveal) {
+	reveal.Rolls = e.rolls
+}
+
+func (e *yahtzeeEngine) State() interface{}   { return e.state }
+func (e *yahtzeeEngine) IsOver() bool         { return e.state.GameOver }
+func (e *yahtzeeEngine) Result() ([]int, int) { return e.state.Totals, e.state.Winner() }
+func (e *yahtzeeEngine) Turn() (int, bool)    { return e.state.CurrentPlayer, e.state.RollsLeft == 3 }
+
+// Out of time, the server rolls for the player if they haven't yet and
+// scores the dice in whichever open category is worth the most
+func (e *yahtzeeEngine) TimeOut(seat int) []json.RawMessage {
+	var moves []json.RawMessage
+	if e.state.RollsLeft == 3 {
+		roll, err := e.ApplyMove(seat, json.RawMessage(`{"action":"roll"}`))
+		if err != nil {
+			return nil
+		}
+		moves = append(moves, roll)
+	}
+	move := yahtzee.Move{Action: "score", Category: int(e.state.BestCategory())}
+	if err := e.state.Apply(seat, move); err != nil {
+		return moves
+	}
+	data, _ := json.Marshal(move)
+	return append(moves, data)
+}
+
+// The computer plays its turn a move at a time too. The dice in a roll it
+// asks for don't matter, as the server rolls them.
+func (e *yahtzeeEngine) BotMove(seat int, level rules.Difficulty, rng *rand.Rand) func() json.RawMessage {
+	state := e.state.Clone()
+	return func() json.RawMessage {
+		return protocol.Encode(state.BestMove(level, rng))
+	}
+}
+
+type memoryEngine struct {
+	state   *memory.State
+	layout  []int
+	flips   []int                  // Every card turned over so far
+	recalls map[int]*memory.Recall // What each computer player remembers, by seat
+}
+
+func (e *memoryEngine) ApplyMove(seat int, data json.RawMessage) (json.RawMessage, error) {
+	var move memory.Move
+	if err := json.Unmarshal(data, &move); err != nil {
+		return nil, errBadMove
+	}
+	if err := e.state.Apply(seat, move); err != nil {
+		return nil, err
+	}
+	if move.Pass {
+		return nil, nil
+	}
+	e.flips = append(e.flips, move.CardIndex)
+	for _, recall := range e.recalls {
+		recall.See(move.CardIndex, e.layout[move.CardIndex])
+	}
+	// Everyone, the player included, learns the card's face from the move
+	move.Type = e.layout[move.CardIndex]
+	return protocol.Encode(move), nil
+}
+
+// Players only get the number of cards; each face is revealed by the move
+// that turns it over
+func (e *memoryEngine) StartData(data *protocol.StartGame) {
+	data.Cards = len(e.layout)
+}
+
+// Hide face-down cards, clients only learn a card's face once it's turned over
+func (e *memoryEngine) State() interface{}   { return e.state.Public() }
+func (e *memoryEngine) IsOver() bool         { return e.state.GameOver }
+func (e *memoryEngine) Result() ([]int, int) { return e.state.Scores, e.state.Winner }
+
+// Memory times every card turned over, not the whole turn
+func (e *memoryEngine) Turn() (int, bool) { return e.state.CurrentPlayer, true }
+
+// Out of time, the player passes to the next one
+func (e *memoryEngine) TimeOut(seat int) []json.RawMessage {
+	move := memory.Move{Pass: true}
+	if err := e.state.Apply(seat, move); err != nil {
+		return nil
+	}
+	data, _ := json.Marshal(move)
+	return []json.RawMessage{data}
+}
+
+// The computer only knows the cards it has seen turned over, and forgets
+// some of them. Its recall starts with its first move, catching up on the
+// cards turned over before then, and is kept up to date by ApplyMove.
+// Picking a card takes no time, so it's done here while room.mu is held,
+// which the recall needs.
+func (e *memoryEngine) BotMove(seat int, level rules.Difficulty, rng *rand.Rand) func() json.RawMessage {
+	recall, ok := e.recalls[seat]
+	if !ok {
+		recall = memory.NewRecall(memory.ForgetRates[level], rng)
+		for _, index := range e.flips {
+			recall.See(index, e.layout[index])
+		}
+		if e.recalls == nil {
+			e.recalls = make(map[int]*memory.Recall)
+		}
+		e.recalls[seat] = recall
+	}
+	data := protocol.Encode(recall.BestMove(e.state))
+	return func() json.RawMessage {
+		return data
+	}
+}
+
+// Clients leave a mismatched pair face up for a second, so a computer
+// player waits for it to be turned back before carrying on
+func (e *memoryEngine) BotDelay() time.Duration {
+	if e.state.MismatchPending() {
+		return memoryFlipDelay + botMoveDelay
+	}
+	return botMoveDelay
+}
@@ -0,0 +1,53 @@
+package main
+
+import (
+	"testing"
+
+	"olive_and_millies_game_room/protocol"
+	"olive_and_millies_game_room/rules/connectfour"
+)
+
+func TestRejectedMoves(t *testing.T) {
+	s, url := newTestServer(t)
+	first, second := connectClient(t, url), connectClient(t, url)
+	room := startedRoom(t, s, "connect_four", first, second)
+
+	tests := []struct {
+		name   string
+		client *testClient
+		move   connectfour.Move
+		code   protocol.ErrorCode
+	}{
+		{"out of turn", second, connectfour.Move{Column: 2}, protocol.ErrNotYourTurn},
+		{"off the board", first, connectfour.Move{Column: connectfour.Cols}, protocol.ErrIllegalMove},
+	}
+	for _, tt := range tests {
+		// The mover is told why and put back in step with the real board
+		tt.client.send(protocol.MsgGameMove, tt.move)
+		var e protocol.Error
+		decode(t, tt.client.expect(protocol.MsgError).Data, &e)
+		if e.Code != tt.code {
+			t.Errorf("%s: got %s, want %s", tt.name, e.Code, tt.code)
+		}
+		var state connectfour.State
+		decode(t, tt.client.expect(protocol.MsgGameState).Data, &state)
+		if state != *connectfour.New() {
+			t.Errorf("%s: resynced to %+v, want the empty board", tt.name, state)
+		}
+	}
+
+	// Neither went to anyone else or into the match, so the first move the
+	// second player hears of is the legal one
+	first.send(protocol.MsgGameMove, connectfour.Move{Column: 3})
+	var move connectfour.Move
+	decode(t, second.expect(protocol.MsgGameMove).Data, &move)
+	if move.Column != 3 {
+		t.Errorf("relayed column %d, want 3", move.Column)
+	}
+	room.mu.RLock()
+	moves := len(room.Moves)
+	room.mu.RUnlock()
+	if moves != 1 {
+		t.Errorf("room has %d moves, want 1", moves)
+	}
+}
@@ -1,7 +1,13 @@
 module github.com/yourusername/o_and_m_online/server
 
-go 1.21
+go 1.22.0
 
-require github.com/gorilla/websocket v1.5.1
+require (
+	github.com/gorilla/websocket v1.5.1
+	olive_and_millies_game_room v0.0.0
+)
 
 require golang.org/x/net v0.17.0 // indirect
+
+// The rules packages live in the client module one directory up
+replace olive_and_millies_game_room => ../
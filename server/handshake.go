@@ -0,0 +1,91 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gorilla/websocket"
+
+	"olive_and_millies_game_room/protocol"
+)
+
+// Client is what a connection told us about itself in its hello
+type Client struct {
+	Version  string            // The client's release, "" if it's too old to say
+	Protocol int               // The protocol version agreed for the connection
+	Encoding protocol.Encoding // How the client wants its messages
+}
+
+// Agree on a protocol version with a client from its hello. A client newer
+// than the server falls back to the version we speak.
+func newClient(hello protocol.Hello) Client {
+	client := Client{
+		Version:  hello.ClientVersion,
+		Protocol: hello.ProtocolVersion,
+		Encoding: hello.Encoding,
+	}
+	if client.Protocol > protocol.Version {
+		client.Protocol = protocol.Version
+	}
+	return client
+}
+
+// Check a new connection's client against what the server supports,
+// turning it away with a message for the player if it's too old, rather
+// than leaving them with a connection that fails in stranger ways later
+func (s *Server) admitClient(conn *websocket.Conn, client Client) bool {
+	var reason string
+	switch {
+	case client.Protocol < protocol.MinVersion:
+		reason = "This version of the game is too old to play online - please update"
+	case s.minClientVersion != "" && compareVersions(client.Version, s.minClientVersion) < 0:
+		reason = fmt.Sprintf("Version %s or later is needed to play online - please update", s.minClientVersion)
+	default:
+		return true
+	}
+
+	log.Printf("Turning away client version %q (protocol %d)\n", client.Version, client.Protocol)
+	conn.SetWriteDeadline(time.Now().Add(writeWait))
+	protocol.WriteMessage(conn, client.Encoding, protocol.NewError(protocol.ErrUpdateRequired, reason))
+	conn.WriteMessage(websocket.CloseMessage,
+		websocket.FormatCloseMessage(websocket.ClosePolicyViolation, "update required"))
+	conn.Close()
+	return false
+}
+
+// Compare two release versions like "1.0.20" part by part, returning -1, 0
+// or 1. A missing version is older than any other.
+func compareVersions(a, b string) int {
+	if a == "" || b == "" {
+		switch {
+		case a == b:
+			return 0
+		case a == "":
+			return -1
+		default:
+			return 1
+		}
+	}
+
+	aParts := strings.Split(strings.TrimPrefix(a, "v"), ".")
+	bParts := strings.Split(strings.TrimPrefix(b, "v"), ".")
+	for i := 0; i < len(aParts) || i < len(bParts); i++ {
+		var aNum, bNum int
+		if i < len(aParts) {
+			aNum, _ = strconv.Atoi(aParts[i])
+		}
+		if i < len(bParts) {
+			bNum, _ = strconv.Atoi(bParts[i])
+		}
+		if aNum != bNum {
+			if aNum < bNum {
+				return -1
+			}
+			return 1
+		}
+	}
+	return 0
+}
@@ -0,0 +1,41 @@
+package main
+
+import (
+	"testing"
+
+	"olive_and_millies_game_room/protocol"
+)
+
+func TestAdmitClient(t *testing.T) {
+	tests := []struct {
+		name  string
+		hello protocol.Hello
+		admit bool
+	}{
+		{name: "no hello"},
+		{name: "older protocol", hello: protocol.Hello{ClientVersion: "1.0.20", ProtocolVersion: protocol.MinVersion - 1}},
+		{name: "oldest protocol", hello: protocol.Hello{ClientVersion: "1.0.21", ProtocolVersion: protocol.MinVersion}, admit: true},
+		{name: "newer protocol", hello: protocol.Hello{ClientVersion: "2.0.0", ProtocolVersion: protocol.Version + 1}, admit: true},
+		{name: "binary", hello: protocol.Hello{ClientVersion: "1.0.21", ProtocolVersion: protocol.Version, Encoding: protocol.EncodingBinary}, admit: true},
+	}
+	_, url := newTestServer(t)
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			conn := dialHello(t, url, tt.hello)
+			msg, err := protocol.ReadMessage(conn)
+			if err != nil {
+				t.Fatal(err)
+			}
+			switch {
+			case tt.admit && msg.Type != protocol.MsgConnected:
+				t.Errorf("got %s, want connected", msg.Type)
+			case !tt.admit:
+				var e protocol.Error
+				decode(t, msg.Data, &e)
+				if e.Code != protocol.ErrUpdateRequired {
+					t.Errorf("got %s %s, want update_required", msg.Type, msg.Data)
+				}
+			}
+		})
+	}
+}
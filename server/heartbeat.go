@@ -0,0 +1,150 @@
+package main
+
+import (
+	"log"
+	"time"
+
+	"github.com/gorilla/websocket"
+
+	"olive_and_millies_game_room/protocol"
+)
+
+const (
+	// A connection that hasn't answered a ping in this long is dead, e.g.
+	// a half-open TCP connection the client's end has long forgotten
+	pongWait   = 45 * time.Second
+	pingPeriod = 15 * time.Second // Must be well under pongWait
+	writeWait  = 10 * time.Second
+
+	// Players who haven't sent anything in this long are moved out of a
+	// room that's waiting to start or whose game is over, or have their
+	// turn played for them, so they don't hold it up
+	idleTimeout       = 10 * time.Minute
+	idleCheckInterval = 30 * time.Second
+)
+
+// Start expecting regular pongs on a new connection, and ping it until
+// stop is closed. A connection that stops answering fails its next read,
+// which drops the player as if they'd disconnected.
+func (s *Server) startHeartbeat(player *Player, conn *websocket.Conn, stop chan struct{}) {
+	conn.SetReadDeadline(time.Now().Add(pongWait))
+	conn.SetPongHandler(func(string) error {
+		return conn.SetReadDeadline(time.Now().Add(pongWait))
+	})
+
+	go func() {
+		ticker := time.NewTicker(pingPeriod)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-stop:
+				return
+			case <-ticker.C:
+				// WriteControl is safe alongside sendMessage's writes
+				err := conn.WriteControl(websocket.PingMessage, nil, time.Now().Add(writeWait))
+				if err != nil {
+					log.Printf("Error pinging player %s: %v\n", player.ID, err)
+					conn.Close()
+					return
+				}
+			}
+		}
+	}()
+}
+
+// Note that the player is still there. Pings don't count; only messages
+// the player actually sends do.
+func (player *Player) touch() {
+	player.mu.Lock()
+	player.lastActive = time.Now()
+	player.mu.Unlock()
+}
+
+// reapIdlePlayers runs for the life of the server, moving players who've
+// gone quiet out of their rooms, or playing their turns for them
+func (s *Server) reapIdlePlayers() {
+	ticker := time.NewTicker(idleCheckInterval)
+	defer ticker.Stop()
+	for range ticker.C {
+		s.removeIdlePlayers()
+	}
+}
+
+// A game that ended with an idle player's turn, to save once the locks
+// are released
+type idleGameOver struct {
+	room     *Room
+	record   *protocol.MatchRecord
+	watchers []*Player
+}
+
+func (s *Server) removeIdlePlayers() {
+	now := time.Now()
+	var idle []*Player
+	var rooms []*Room
+	var finished []idleGameOver
+
+	s.mu.Lock()
+	for _, player := range s.players {
+		player.mu.Lock()
+		// Dropped players are already on their way out
+		quiet := player.Conn != nil && now.Sub(player.lastActive) > idleTimeout
+		player.mu.Unlock()
+		if !quiet || player.RoomID == "" || player.Spectating {
+			continue
+		}
+		room, exists := s.rooms[player.RoomID]
+		if !exists {
+			continue
+		}
+
+		// Leaving a game in progress would end it for everyone, so there
+		// the game plays the idle player's turn as if their time ran out.
+		// They get a fresh idle timeout for their next turn, so a sweep
+		// doesn't play every turn that comes round to them.
+		room.mu.Lock()
+		if room.Started && room.Game != nil && !room.Game.IsOver() {
+			if seat, ok := room.turnOf(player); ok {
+				log.Printf("Player %s idle on their turn in room %s, playing for them\n", player.ID, room.ID)
+				record, watchers := s.playTimeOut(room, seat)
+				finished = append(finished, idleGameOver{room, record, watchers})
+				player.touch()
+			}
+			room.mu.Unlock()
+			continue
+		}
+		room.mu.Unlock()
+
+		log.Printf("Player %s idle, moving them out of room %s\n", player.ID, room.ID)
+		s.removePlayerFromRoom(player)
+		idle = append(idle, player)
+		rooms = append(rooms, room)
+	}
+	s.mu.Unlock()
+
+	for _, f := range finished {
+		s.saveMatch(f.room, f.record, f.watchers)
+	}
+	if len(idle) == 0 {
+		return
+	}
+	for i, player := range idle {
+		s.sendMessage(player, protocol.Message{
+			Type:      protocol.MsgIdleTimeout,
+			RoomID:    rooms[i].ID,
+			GameType:  rooms[i].GameType,
+			Timestamp: time.Now(),
+		})
+	}
+	s.broadcastRoomList()
+}
+
+// The player's seat, if the room's game is in progress and waiting on
+// their move. Must be called with room.mu held.
+func (room *Room) turnOf(player *Player) (int, bool) {
+	if room.Game == nil || room.Game.IsOver() {
+		return 0, false
+	}
+	seat, _ := room.Game.Turn()
+	return seat, seat >= 0 && seat < len(room.Players) && room.Players[seat] == player
+}
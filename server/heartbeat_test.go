@@ -0,0 +1,149 @@
+package main
+
+import (
+	"testing"
+	"time"
+
+	"olive_and_millies_game_room/protocol"
+	"olive_and_millies_game_room/rules/memory"
+	"olive_and_millies_game_room/rules/yahtzee"
+)
+
+// Make the player look like they've said nothing for longer than the idle
+// timeout
+func goQuiet(player *Player) {
+	player.mu.Lock()
+	player.lastActive = time.Now().Add(-2 * idleTimeout)
+	player.mu.Unlock()
+}
+
+func TestIdleBeforeStart(t *testing.T) {
+	s, url := newTestServer(t)
+	host, guest := connectClient(t, url), connectClient(t, url)
+	host.send(protocol.MsgCreateRoom, protocol.CreateRoom{GameType: "yahtzee", RoomName: "Test"})
+	roomID := host.expect(protocol.MsgRoomCreated).RoomID
+	guest.send(protocol.MsgJoinRoom, protocol.JoinRoom{RoomID: roomID})
+	guest.expect(protocol.MsgPlayerJoined)
+
+	goQuiet(s.player(t, guest))
+	s.removeIdlePlayers()
+
+	if msg := guest.expect(protocol.MsgIdleTimeout); msg.RoomID != roomID {
+		t.Errorf("idle timeout for room %q, want %q", msg.RoomID, roomID)
+	}
+	player := s.player(t, guest)
+	s.mu.RLock()
+	left := player.RoomID
+	s.mu.RUnlock()
+	if left != "" {
+		t.Errorf("idle player still in room %s", left)
+	}
+}
+
+func TestIdleOnTurnPlaysForThem(t *testing.T) {
+	s, url := newTestServer(t)
+	first, second := connectClient(t, url), connectClient(t, url)
+	room := startedRoom(t, s, "memory", first, second)
+
+	// A quiet player isn't holding up a game that's waiting on someone else
+	goQuiet(s.player(t, second))
+	s.removeIdlePlayers()
+	room.mu.RLock()
+	moves := len(room.Moves)
+	room.mu.RUnlock()
+	if moves != 0 {
+		t.Fatalf("%d moves played for a player waiting their turn", moves)
+	}
+
+	s.player(t, second).touch()
+	goQuiet(s.player(t, first))
+	s.removeIdlePlayers()
+
+	var move memory.Move
+	decode(t, second.expect(protocol.MsgGameMove).Data, &move)
+	if !move.Pass {
+		t.Errorf("idle player's turn played as %+v, want a pass", move)
+	}
+	room.mu.RLock()
+	seat, _ := room.Game.Turn()
+	players := len(room.Players)
+	moves = len(room.Moves)
+	room.mu.RUnlock()
+	if seat != 1 || players != 2 || moves != 1 {
+		t.Errorf("after the idle turn: seat %d to play, %d players, %d moves", seat, players, moves)
+	}
+}
+
+func TestIdleTurnsOncePerSweep(t *testing.T) {
+	s, url := newTestServer(t)
+	first, second := connectClient(t, url), connectClient(t, url)
+	room := startedRoom(t, s, "yahtzee", first, second)
+	movesPlayed := func() int {
+		room.mu.RLock()
+		defer room.mu.RUnlock()
+		return len(room.Moves)
+	}
+
+	// The idle player's turn is rolled and scored for them
+	goQuiet(s.player(t, first))
+	s.removeIdlePlayers()
+	if moves := movesPlayed(); moves != 2 {
+		t.Fatalf("%d moves played for the idle player, want 2", moves)
+	}
+	second.send(protocol.MsgGameMove, yahtzee.Move{Action: "roll"})
+	second.expect(protocol.MsgGameMove)
+	second.send(protocol.MsgGameMove, yahtzee.Move{Action: "score", Category: int(yahtzee.Chance)})
+	for movesPlayed() != 4 {
+		time.Sleep(time.Millisecond)
+	}
+
+	// Back on their turn, they get the whole idle timeout again before the
+	// next sweep plays it
+	s.removeIdlePlayers()
+	if moves := movesPlayed(); moves != 4 {
+		t.Errorf("next sweep played %d more moves straight away", moves-4)
+	}
+	goQuiet(s.player(t, first))
+	s.removeIdlePlayers()
+	if moves := movesPlayed(); moves != 6 {
+		t.Errorf("%d moves after the idle timeout ran out again, want 6", moves)
+	}
+}
+
+func TestIdleOnTurnEndsTwoPlayerGame(t *testing.T) {
+	s, url := newTestServer(t)
+	first, second := connectClient(t, url), connectClient(t, url)
+	room := startedRoom(t, s, "santorini", first, second)
+
+	goQuiet(s.player(t, first))
+	s.removeIdlePlayers()
+
+	second.expect(protocol.MsgSeedReveal)
+	room.mu.RLock()
+	over := room.Game.IsOver()
+	_, winner := room.Game.Result()
+	room.mu.RUnlock()
+	if !over || winner != 1 {
+		t.Errorf("idle player's game: over %v, winner %d", over, winner)
+	}
+
+	// With the game over, they're moved out once they've been quiet for
+	// the idle timeout again
+	playersLeft := func() int {
+		room.mu.RLock()
+		defer room.mu.RUnlock()
+		return len(room.Players)
+	}
+	s.removeIdlePlayers()
+	if players := playersLeft(); players != 2 {
+		t.Fatalf("moved out as soon as the game ended, %d players left", players)
+	}
+	goQuiet(s.player(t, first))
+	s.removeIdlePlayers()
+	if msg := first.expect(protocol.MsgIdleTimeout); msg.RoomID != room.ID {
+		t.Errorf("idle timeout for room %q, want %q", msg.RoomID, room.ID)
+	}
+	if players := playersLeft(); players != 1 {
+		t.Errorf("%d players left in the room, want 1", players)
+	}
+}
@@ -0,0 +1,328 @@
+package main
+
+import (
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"olive_and_millies_game_room/protocol"
+)
+
+var errMatchNotFound = errors.New("Match not found")
+
+// HistoryQuery picks which matches to list. Empty fields match every game
+// or player.
+type HistoryQuery struct {
+	GameType string
+	PlayerID string // An account ID
+	Offset   int    // Matches to skip, newest first
+	Limit    int    // Most matches to return, 0 for all of them
+}
+
+// HistoryStore keeps finished games. The file store is the default; any
+// other storage only needs to implement these three methods.
+type HistoryStore interface {
+	Save(record *protocol.MatchRecord) error
+	// List returns a page of the matches the query picks, newest first and
+	// without their moves, and how many it picks in all. The records are
+	// shared and mustn't be changed.
+	List(query HistoryQuery) ([]*protocol.MatchRecord, int, error)
+	Get(id string) (*protocol.MatchRecord, error)
+}
+
+// FileHistoryStore keeps each match as a JSON file in a directory, with a
+// summary of every match, oldest first, in an index file alongside them
+// so listing them doesn't read every match's moves
+type FileHistoryStore struct {
+	dir       string
+	mu        sync.RWMutex
+	summaries []*protocol.MatchRecord // Oldest first, without moves
+}
+
+const historyIndexFile = "index.jsonl"
+
+func NewFileHistoryStore(dir string) (*FileHistoryStore, error) {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, err
+	}
+	fs := &FileHistoryStore{dir: dir}
+	if err := fs.loadIndex(); err != nil {
+		return nil, err
+	}
+	return fs, nil
+}
+
+// Read the summaries from the index, or build the index from the match
+// files if there isn't one yet
+func (fs *FileHistoryStore) loadIndex() error {
+	data, err := os.ReadFile(filepath.Join(fs.dir, historyIndexFile))
+	if os.IsNotExist(err) {
+		return fs.rebuildIndex()
+	}
+	if err != nil {
+		return err
+	}
+	for _, line := range strings.Split(string(data), "\n") {
+		if line == "" {
+			continue
+		}
+		var summary protocol.MatchRecord
+		if err := json.Unmarshal([]byte(line), &summary); err != nil {
+			log.Printf("Skipping unreadable match summary: %v\n", err)
+			continue
+		}
+		fs.summaries = append(fs.summaries, &summary)
+	}
+	sortOldestFirst(fs.summaries)
+	return nil
+}
+
+func (fs *FileHistoryStore) rebuildIndex() error {
+	files, err := filepath.Glob(filepath.Join(fs.dir, "*.json"))
+	if err != nil {
+		return err
+	}
+
+	var index []byte
+	for _, file := range files {
+		record, err := readMatchRecord(file)
+		if err != nil {
+			log.Printf("Skipping unreadable match record %s: %v\n", file, err)
+			continue
+		}
+		record.Moves = nil
+		fs.summaries = append(fs.summaries, record)
+		line, _ := json.Marshal(record)
+		index = append(append(index, line...), '\n')
+	}
+	sortOldestFirst(fs.summaries)
+	log.Printf("Indexed %d past matches\n", len(fs.summaries))
+	return writeFileAtomic(filepath.Join(fs.dir, historyIndexFile), index)
+}
+
+func sortOldestFirst(records []*protocol.MatchRecord) {
+	sort.SliceStable(records, func(i, j int) bool {
+		return records[i].EndedAt.Before(records[j].EndedAt)
+	})
+}
+
+func (fs *FileHistoryStore) Save(record *protocol.MatchRecord) error {
+	data, err := json.Marshal(record)
+	if err != nil {
+		return err
+	}
+	summary := *record
+	summary.Moves = nil
+	line, err := json.Marshal(&summary)
+	if err != nil {
+		return err
+	}
+
+	fs.mu.Lock()
+	defer fs.mu.Unlock()
+
+	if err := writeFileAtomic(fs.path(record.ID), data); err != nil {
+		return err
+	}
+
+	index, err := os.OpenFile(filepath.Join(fs.dir, historyIndexFile), os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+	if err != nil {
+		return err
+	}
+	defer index.Close()
+	if _, err := index.Write(append(line, '\n')); err != nil {
+		return err
+	}
+
+	// Matches nearly always end in order, so this is almost always an append
+	i := sort.Search(len(fs.summaries), func(i int) bool {
+		return fs.summaries[i].EndedAt.After(summary.EndedAt)
+	})
+	fs.summaries = append(fs.summaries, nil)
+	copy(fs.summaries[i+1:], fs.summaries[i:])
+	fs.summaries[i] = &summary
+	return nil
+}
+
+func (fs *FileHistoryStore) List(query HistoryQuery) ([]*protocol.MatchRecord, int, error) {
+	fs.mu.RLock()
+	defer fs.mu.RUnlock()
+
+	records := make([]*protocol.MatchRecord, 0)
+	total := 0
+	for i := len(fs.summaries) - 1; i >= 0; i-- {
+		record := fs.summaries[i]
+		if !query.matches(record) {
+			continue
+		}
+		if total >= query.Offset && (query.Limit == 0 || len(records) < query.Limit) {
+			records = append(records, record)
+		}
+		total++
+	}
+	return records, total, nil
+}
+
+func (q HistoryQuery) matches(record *protocol.MatchRecord) bool {
+	if q.GameType != "" && record.GameType != q.GameType {
+		return false
+	}
+	if q.PlayerID == "" {
+		return true
+	}
+	for _, p := range record.Players {
+		if p.ID == q.PlayerID {
+			return true
+		}
+	}
+	return false
+}
+
+func (fs *FileHistoryStore) Get(id string) (*protocol.MatchRecord, error) {
+	if !validMatchID(id) {
+		return nil, errMatchNotFound
+	}
+
+	fs.mu.RLock()
+	defer fs.mu.RUnlock()
+
+	record, err := readMatchRecord(fs.path(id))
+	if os.IsNotExist(err) {
+		return nil, errMatchNotFound
+	}
+	return record, err
+}
+
+func (fs *FileHistoryStore) path(id string) string {
+	return filepath.Join(fs.dir, id+".json")
+}
+
+func readMatchRecord(path string) (*protocol.MatchRecord, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var record protocol.MatchRecord
+	if err := json.Unmarshal(data, &record); err != nil {
+		return nil, err
+	}
+	return &record, nil
+}
+
+// Match IDs come from generateID, so anything else can't be a match and
+// mustn't reach the filesystem
+func validMatchID(id string) bool {
+	if id == "" {
+		return false
+	}
+	for _, c := range id {
+		if !strings.ContainsRune("abcdefghijklmnopqrstuvwxyz0123456789", c) {
+			return false
+		}
+	}
+	return true
+}
+
+// How many matches GET /history returns at most, and when not asked for
+// a number
+const (
+	historyPageSize    = 20
+	maxHistoryPageSize = 100
+)
+
+// GET /history lists past matches a page at a time, with ?limit= and
+// ?offset=, optionally filtered with ?game_type= and ?player= (an account
+// ID). The total is how many matches the filters pick, for paging.
+func (s *Server) handleHistoryList(w http.ResponseWriter, r *http.Request) {
+	params := r.URL.Query()
+	query := HistoryQuery{
+		GameType: params.Get("game_type"),
+		PlayerID: params.Get("player"),
+		Limit:    historyPageSize,
+	}
+	if limit, err := strconv.Atoi(params.Get("limit")); err == nil && limit > 0 {
+		query.Limit = min(limit, maxHistoryPageSize)
+	}
+	if offset, err := strconv.Atoi(params.Get("offset")); err == nil && offset > 0 {
+		query.Offset = offset
+	}
+
+	records, total, err := s.history.List(query)
+	if err != nil {
+		log.Printf("Error listing match history: %v\n", err)
+		http.Error(w, "Could not read match history", http.StatusInternalServerError)
+		return
+	}
+
+	writeJSON(w, map[string]interface{}{
+		"matches": records,
+		"total":   total,
+	})
+}
+
+// GET /history/{id} fetches one match with all of its moves
+func (s *Server) handleHistoryGet(w http.ResponseWriter, r *http.Request) {
+	record, err := s.history.Get(r.PathValue("id"))
+	if err == errMatchNotFound {
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		log.Printf("Error reading match %s: %v\n", r.PathValue("id"), err)
+		http.Error(w, "Could not read match", http.StatusInternalServerError)
+		return
+	}
+
+	writeJSON(w, record)
+}
+
+func writeJSON(w http.ResponseWriter, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	// The web client is served from a different origin
+	w.Header().Set("Access-Control-Allow-Origin", "*")
+	if err := json.NewEncoder(w).Encode(v); err != nil {
+		log.Printf("Error writing response: %v\n", err)
+	}
+}
+
+func newMatchPlayer(p *Player) protocol.MatchPlayer {
+	player := protocol.MatchPlayer{
+		ID:     p.ID,
+		Name:   p.Name,
+		Avatar: p.Avatar,
+	}
+	if p.Bot != nil {
+		player.Bot = p.Bot.Level.String()
+	}
+	return player
+}
+
+// Build the record of a room's finished game. Must be called with room.mu held.
+func newMatchRecord(room *Room) *protocol.MatchRecord {
+	players := make([]protocol.MatchPlayer, len(room.Players))
+	for i, p := range room.Players {
+		players[i] = newMatchPlayer(p)
+	}
+
+	scores, winner := room.Game.Result()
+	return &protocol.MatchRecord{
+		ID:        generateID(),
+		GameType:  room.GameType,
+		Players:   players,
+		Moves:     room.Moves,
+		Scores:    scores,
+		Winner:    winner,
+		Seed:      hex.EncodeToString(room.Seed),
+		StartedAt: room.StartedAt,
+		EndedAt:   time.Now(),
+	}
+}
@@ -0,0 +1,102 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"olive_and_millies_game_room/protocol"
+)
+
+func saveMatches(t *testing.T, fs *FileHistoryStore, n int) {
+	t.Helper()
+	start := time.Now()
+	for i := 0; i < n; i++ {
+		gameType := "yahtzee"
+		if i%2 == 1 {
+			gameType = "memory"
+		}
+		record := &protocol.MatchRecord{
+			ID:       fmt.Sprintf("match%d", i),
+			GameType: gameType,
+			Players:  []protocol.MatchPlayer{{ID: fmt.Sprintf("p%d", i%3)}},
+			Moves:    []protocol.MatchMove{{Data: json.RawMessage(`{}`)}},
+			EndedAt:  start.Add(time.Duration(i) * time.Minute),
+		}
+		if err := fs.Save(record); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func TestHistoryList(t *testing.T) {
+	fs, err := NewFileHistoryStore(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	saveMatches(t, fs, 10)
+
+	tests := []struct {
+		name  string
+		query HistoryQuery
+		ids   []string
+		total int
+	}{
+		{name: "first page", query: HistoryQuery{Limit: 3}, ids: []string{"match9", "match8", "match7"}, total: 10},
+		{name: "last page", query: HistoryQuery{Offset: 9, Limit: 3}, ids: []string{"match0"}, total: 10},
+		{name: "past the end", query: HistoryQuery{Offset: 10, Limit: 3}, total: 10},
+		{name: "game type", query: HistoryQuery{GameType: "memory", Limit: 2}, ids: []string{"match9", "match7"}, total: 5},
+		{name: "player", query: HistoryQuery{PlayerID: "p0"}, ids: []string{"match9", "match6", "match3", "match0"}, total: 4},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			records, total, err := fs.List(tt.query)
+			if err != nil {
+				t.Fatal(err)
+			}
+			var ids []string
+			for _, r := range records {
+				ids = append(ids, r.ID)
+				if r.Moves != nil {
+					t.Errorf("%s listed with its moves", r.ID)
+				}
+			}
+			if fmt.Sprint(ids) != fmt.Sprint(tt.ids) || total != tt.total {
+				t.Errorf("got %v of %d, want %v of %d", ids, total, tt.ids, tt.total)
+			}
+		})
+	}
+
+	record, err := fs.Get("match4")
+	if err != nil || len(record.Moves) != 1 {
+		t.Errorf("Get: %v, %+v", err, record)
+	}
+}
+
+func TestHistoryIndex(t *testing.T) {
+	dir := t.TempDir()
+	fs, err := NewFileHistoryStore(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	saveMatches(t, fs, 4)
+
+	// The index is read back on restart, and rebuilt from the matches if
+	// it's lost
+	for _, lose := range []bool{false, true} {
+		if lose {
+			os.Remove(filepath.Join(dir, historyIndexFile))
+		}
+		fs, err := NewFileHistoryStore(dir)
+		if err != nil {
+			t.Fatal(err)
+		}
+		records, total, _ := fs.List(HistoryQuery{})
+		if total != 4 || records[0].ID != "match3" {
+			t.Errorf("index lost %v: %d matches, newest %s", lose, total, records[0].ID)
+		}
+	}
+}
@@ -0,0 +1,152 @@
+package main
+
+import (
+	"log"
+	"time"
+
+	"olive_and_millies_game_room/protocol"
+)
+
+// Find the room the player is hosting. Sends the player an error and
+// returns nil if they aren't in a room or aren't its host.
+func (s *Server) hostedRoom(player *Player) *Room {
+	s.mu.RLock()
+	room, exists := s.rooms[player.RoomID]
+	s.mu.RUnlock()
+
+	if !exists || player.Spectating {
+		s.sendError(player, protocol.ErrNotInRoom, "Not in a room")
+		return nil
+	}
+	room.mu.RLock()
+	isHost := room.Host == player.ID
+	room.mu.RUnlock()
+	if !isHost {
+		s.sendError(player, protocol.ErrNotHost, "Only the host can do that")
+		return nil
+	}
+	return room
+}
+
+// Seated player with the given ID. Must be called with room.mu held.
+func (room *Room) seatedPlayer(playerID string) *Player {
+	for _, p := range room.Players {
+		if p.ID == playerID {
+			return p
+		}
+	}
+	return nil
+}
+
+// handleKickPlayer removes a player from the host's room before the game
+// starts. Kicked players can't come back to the same room.
+func (s *Server) handleKickPlayer(player *Player, msg protocol.Message) {
+	var data protocol.KickPlayer
+	if err := msg.Decode(&data); err != nil {
+		s.sendError(player, protocol.ErrBadRequest, "Invalid kick data")
+		return
+	}
+	room := s.hostedRoom(player)
+	if room == nil {
+		return
+	}
+	if data.PlayerID == player.ID {
+		s.sendError(player, protocol.ErrBadRequest, "You can't kick yourself")
+		return
+	}
+
+	s.mu.Lock()
+	room.mu.Lock()
+	target := room.seatedPlayer(data.PlayerID)
+	started := room.Started
+	if target != nil && !started {
+		room.Kicked[target.ID] = true
+	}
+	room.mu.Unlock()
+
+	if target == nil {
+		s.mu.Unlock()
+		s.sendError(player, protocol.ErrPlayerNotFound, "Player not found")
+		return
+	}
+	if started {
+		s.mu.Unlock()
+		s.sendError(player, protocol.ErrGameStarted, "Can't kick players once the game has started")
+		return
+	}
+
+	log.Printf("Host %s kicked player %s from room %s\n", player.ID, target.ID, room.ID)
+	s.removePlayerFromRoom(target)
+	s.mu.Unlock()
+
+	s.sendMessage(target, protocol.Message{
+		Type:      protocol.MsgKicked,
+		RoomID:    room.ID,
+		GameType:  room.GameType,
+		Timestamp: time.Now(),
+	})
+	s.broadcastRoomList()
+}
+
+// handleTransferHost hands host rights to another player in the room
+func (s *Server) handleTransferHost(player *Player, msg protocol.Message) {
+	var data protocol.TransferHost
+	if err := msg.Decode(&data); err != nil {
+		s.sendError(player, protocol.ErrBadRequest, "Invalid transfer host data")
+		return
+	}
+	room := s.hostedRoom(player)
+	if room == nil {
+		return
+	}
+
+	room.mu.Lock()
+	target := room.seatedPlayer(data.PlayerID)
+	if target != nil && target.Bot == nil {
+		room.Host = target.ID
+	}
+	room.mu.Unlock()
+
+	if target == nil {
+		s.sendError(player, protocol.ErrPlayerNotFound, "Player not found")
+		return
+	}
+	if target.Bot != nil {
+		s.sendError(player, protocol.ErrBadRequest, "Computer players can't host")
+		return
+	}
+	log.Printf("Player %s handed host of room %s to %s\n", player.ID, room.ID, target.ID)
+	s.broadcastRoomList()
+}
+
+// handleRoomSettings lets the host lock the room and change its seat count
+func (s *Server) handleRoomSettings(player *Player, msg protocol.Message) {
+	var data protocol.RoomSettings
+	if err := msg.Decode(&data); err != nil {
+		s.sendError(player, protocol.ErrBadRequest, "Invalid room settings")
+		return
+	}
+	room := s.hostedRoom(player)
+	if room == nil {
+		return
+	}
+
+	room.mu.Lock()
+	min, max := protocol.SeatLimits(room.GameType)
+	if data.MaxPlayers < min || data.MaxPlayers > max {
+		room.mu.Unlock()
+		s.sendError(player, protocol.ErrBadRequest, "Seat count out of range for this game")
+		return
+	}
+	if data.MaxPlayers < len(room.Players) {
+		room.mu.Unlock()
+		s.sendError(player, protocol.ErrBadRequest, "More players in the room than that")
+		return
+	}
+	room.MaxPlayers = data.MaxPlayers
+	room.Locked = data.Locked
+	room.mu.Unlock()
+
+	log.Printf("Room %s settings: %d seats, locked=%v\n", room.ID, data.MaxPlayers, data.Locked)
+	s.broadcastRoomList()
+}
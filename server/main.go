@@ -1,17 +1,27 @@
 package main
 
 import (
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/hex"
 	"encoding/json"
+	"fmt"
 	"log"
 	"net/http"
 	"os"
+	"strings"
 	"sync"
 	"time"
 
 	"github.com/gorilla/websocket"
+
+	"olive_and_millies_game_room/protocol"
+	"olive_and_millies_game_room/rules"
 )
 
 var upgrader = websocket.Upgrader{
+	// Compress messages for clients that support permessage-deflate
+	EnableCompression: true,
 	CheckOrigin: func(r *http.Request) bool {
 		// Log origin for debugging
 		origin := r.Header.Get("Origin")
@@ -20,73 +30,83 @@ var upgrader = websocket.Upgrader{
 	},
 }
 
-type MessageType string
-
-const (
-	MsgJoinLobby    MessageType = "join_lobby"
-	MsgLeaveLobby   MessageType = "leave_lobby"
-	MsgCreateRoom   MessageType = "create_room"
-	MsgJoinRoom     MessageType = "join_room"
-	MsgLeaveRoom    MessageType = "leave_room"
-	MsgStartGame    MessageType = "start_game"
-	MsgGameMove     MessageType = "game_move"
-	MsgGameState    MessageType = "game_state"
-	MsgPlayerList   MessageType = "player_list"
-	MsgRoomList     MessageType = "room_list"
-	MsgError        MessageType = "error"
-	MsgChat         MessageType = "chat"
-	MsgSetAvatar    MessageType = "set_avatar"
-	MsgPlayerUpdate MessageType = "player_update"
-)
-
-type Message struct {
-	Type      MessageType     `json:"type"`
-	PlayerID  string          `json:"player_id,omitempty"`
-	RoomID    string          `json:"room_id,omitempty"`
-	GameType  string          `json:"game_type,omitempty"`
-	Data      json.RawMessage `json:"data,omitempty"`
-	Timestamp time.Time       `json:"timestamp"`
-}
+// How long a dropped player's seat is held for them to reconnect
+const sessionGracePeriod = 2 * time.Minute
 
 type Player struct {
-	ID     string
-	Name   string
-	Avatar int
-	Conn   *websocket.Conn
-	RoomID string
-	mu     sync.Mutex
+	ID         string
+	Token      string // Secret the client presents to resume this session
+	Name       string
+	Avatar     int
+	Conn       *websocket.Conn       // nil while the player is disconnected
+	send       chan protocol.Message // Queue drained by the connection's writer, nil when disconnected
+	RoomID     string
+	Spectating bool        // Watching RoomID rather than playing in it
+	graceTimer *time.Timer // Removes the player if they don't come back in time
+	lastActive time.Time   // When the player last sent a message
+	client     Client      // The client on the current connection
+	lobby      string      // Game type whose room list the player is following, "" for none
+	listed     roomView    // What the player's room list was last sent for, guarded by s.listMu
+	Bot        *Bot        // Set for a computer player, nil for people
+	mu         sync.Mutex
 }
 
 type Room struct {
-	ID         string
-	Name       string
-	GameType   string
-	Players    []*Player
-	MaxPlayers int
-	Started    bool
-	mu         sync.RWMutex
+	ID            string
+	Name          string
+	GameType      string
+	Code          string                  // Short code players type in to join
+	Private       bool                    // Left out of the public room list, joined by code
+	Password      string                  // Hash of the optional password for a private room
+	Host          string                  // ID of the player running the room
+	Locked        bool                    // The host has closed the room to new players
+	Kicked        map[string]bool         // Players the host removed, who can't rejoin
+	Ready         map[string]bool         // Players ready to start, by ID
+	Countdown     int                     // Seconds until the game starts, 0 when not counting down
+	countdown     *time.Timer             // Next countdown tick, nil when not counting down
+	Rematch       map[string]bool         // Players voting to play again once the game is over, by ID
+	Series        map[string]*SeriesScore // Running tally of every game in the room, by player ID
+	Games         int                     // Games finished in the room
+	TimeLimit     int                     // Seconds per move, per turn or on each player's clock, 0 for none
+	Clocks        []time.Duration         // Time left on each seat's clock, for clocked games
+	TimerSeat     int                     // Seat whose time is running, -1 for none
+	TimerStarted  time.Time               // When the running seat's time started this move
+	TimerDeadline time.Time               // When the running seat runs out of time
+	turnTimer     *time.Timer             // Fires when TimerDeadline passes
+	botTimer      *time.Timer             // Plays a computer player's next move, nil when none is due
+	Players       []*Player
+	Spectators    []*Player // Read-only observers, they don't take a seat
+	MaxPlayers    int
+	Started       bool
+	Game          GameEngine           // Authoritative game state, set when the game starts
+	Seed          []byte               // Fresh for every game; its commitment goes out in start_game
+	Moves         []protocol.MatchMove // Every move applied this game, for the match history
+	StartedAt     time.Time
+	mu            sync.RWMutex
 }
 
 type Server struct {
-	players map[string]*Player
-	rooms   map[string]*Room
-	mu      sync.RWMutex
+	history          HistoryStore
+	ratings          RatingStore
+	accounts         AccountStore
+	players          map[string]*Player
+	sessions         map[string]*Player // Keyed by session token
+	rooms            map[string]*Room
+	minClientVersion string                       // Older clients are asked to update, "" to allow any
+	listed           map[string]protocol.RoomInfo // Every room as last broadcast, guarded by listMu
+	listMu           sync.Mutex                   // Held while sending room lists, before s.mu
+	mu               sync.RWMutex
 }
 
-func NewServer() *Server {
+func NewServer(history HistoryStore, ratings RatingStore, accounts AccountStore) *Server {
 	return &Server{
-		players: make(map[string]*Player),
-		rooms:   make(map[string]*Room),
-	}
-}
-
-// Get max players for a game type
-func getMaxPlayers(gameType string) int {
-	switch gameType {
-	case "yahtzee", "memory":
-		return 20
-	default:
-		return 2
+		history:  history,
+		ratings:  ratings,
+		accounts: accounts,
+		players:  make(map[string]*Player),
+		sessions: make(map[string]*Player),
+		rooms:    make(map[string]*Room),
+		listed:   make(map[string]protocol.RoomInfo),
 	}
 }
 
@@ -97,52 +117,228 @@ func (s *Server) handleConnection(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	playerID := generateID()
-	player := &Player{
-		ID:     playerID,
-		Name:   avatarNames[0], // Default to "Human"
-		Avatar: 0,              // Default to human avatar
-		Conn:   conn,
+	// The client's hello says which version it is
+	query := r.URL.Query()
+	client := newClient(protocol.ReadHello(query))
+	if !s.admitClient(conn, client) {
+		return
+	}
+
+	// A client coming back from a dropped connection presents its session
+	// token to take its old seat back
+	if token := query.Get("session"); token != "" {
+		s.mu.Lock()
+		player, exists := s.sessions[token]
+		if exists {
+			s.resumeSession(player, conn, client)
+		}
+		s.mu.Unlock()
+
+		if exists {
+			log.Printf("Player %s resumed their session\n", player.ID)
+			s.finishResume(player, conn)
+			return
+		}
+		log.Println("Unknown or expired session token, starting a new session")
+	}
+
+	// Returning players present the ID and key they were given the first
+	// time they connected; anyone else gets a new account
+	account, known := signIn(s.accounts, query.Get("player_id"), query.Get("player_key"))
+	key := ""
+	if !known {
+		account, key = newAccount()
+	}
+	account.LastSeen = time.Now()
+	if err := s.accounts.Save(account); err != nil {
+		log.Printf("Error saving account %s: %v\n", account.ID, err)
 	}
 
 	s.mu.Lock()
-	s.players[playerID] = player
+	// Signing in while already connected, e.g. from a second window, or
+	// after losing the session token, takes over the existing session
+	if player, online := s.players[account.ID]; online {
+		s.resumeSession(player, conn, client)
+		s.mu.Unlock()
+		log.Printf("Player %s signed in again, taking over their session\n", player.ID)
+		s.finishResume(player, conn)
+		return
+	}
+
+	player := &Player{
+		ID:         account.ID,
+		Token:      generateToken(),
+		Name:       account.Name,
+		Avatar:     account.Avatar,
+		lastActive: time.Now(),
+		client:     client,
+	}
+	player.attach(conn)
+	s.players[player.ID] = player
+	s.sessions[player.Token] = player
 	s.mu.Unlock()
 
-	log.Printf("Player %s connected\n", playerID)
+	if known {
+		log.Printf("Player %s (%s) connected\n", player.ID, player.Name)
+	} else {
+		log.Printf("New player %s connected\n", player.ID)
+	}
 
-	// Send initial player ID
-	s.sendMessage(player, Message{
-		Type:      "connected",
-		PlayerID:  playerID,
-		Timestamp: time.Now(),
-	})
+	// Send player ID, session token and, for a new account, its key
+	s.sendConnected(player, false, key)
 
 	// Send current room list
 	s.sendRoomList(player)
 
 	// Handle messages from this player
-	go s.handlePlayer(player)
+	go s.handlePlayer(player, conn)
+}
+
+// Tell a player who they are. The account key is only sent when the
+// account is new; after that the client is the only one that has it.
+func (s *Server) sendConnected(player *Player, resumed bool, key string) {
+	player.mu.Lock()
+	client := player.client
+	player.mu.Unlock()
+
+	s.sendMessage(player, protocol.Message{
+		Type:     protocol.MsgConnected,
+		PlayerID: player.ID,
+		Data: protocol.Encode(protocol.Connected{
+			SessionToken:    player.Token,
+			Resumed:         resumed,
+			Name:            player.Name,
+			Avatar:          player.Avatar,
+			PlayerKey:       key,
+			ProtocolVersion: client.Protocol,
+			Encoding:        client.Encoding,
+		}),
+		Timestamp: time.Now(),
+	})
 }
 
-func (s *Server) handlePlayer(player *Player) {
+// Attach a new connection to a player whose session is being resumed.
+// Must be called with s.mu held.
+func (s *Server) resumeSession(player *Player, conn *websocket.Conn, client Client) {
+	if player.graceTimer != nil {
+		player.graceTimer.Stop()
+		player.graceTimer = nil
+	}
+
+	player.mu.Lock()
+	player.client = client
+	oldConn := player.attach(conn)
+	player.lastActive = time.Now()
+	player.mu.Unlock()
+
+	// The old connection may not have noticed it dropped yet
+	if oldConn != nil {
+		oldConn.Close()
+	}
+}
+
+// Finish handing a resumed session over to its new connection
+func (s *Server) finishResume(player *Player, conn *websocket.Conn) {
+	s.sendConnected(player, true, "")
+	s.sendRoomList(player)
+	s.resyncPlayer(player)
+	go s.handlePlayer(player, conn)
+}
+
+// Bring a resumed player back up to date with the room they were in
+func (s *Server) resyncPlayer(player *Player) {
+	s.mu.RLock()
+	room, exists := s.rooms[player.RoomID]
+	s.mu.RUnlock()
+
+	if !exists {
+		return
+	}
+
+	room.mu.RLock()
+	defer room.mu.RUnlock()
+
+	if !room.Started || room.Game == nil {
+		s.sendMessage(player, protocol.Message{
+			Type:      protocol.MsgPlayerJoined,
+			PlayerID:  player.ID,
+			RoomID:    room.ID,
+			Timestamp: time.Now(),
+		})
+		return
+	}
+
+	if player.Spectating {
+		s.sendMessage(player, s.startGameMessage(room, -1))
+	}
+	for i, p := range room.Players {
+		if p.ID == player.ID {
+			s.sendMessage(player, s.startGameMessage(room, i))
+			break
+		}
+	}
+	stateData := protocol.Encode(room.Game.State())
+	s.sendMessage(player, protocol.Message{
+		Type:      protocol.MsgGameState,
+		RoomID:    room.ID,
+		GameType:  room.GameType,
+		Data:      stateData,
+		Timestamp: time.Now(),
+	})
+	if room.TimeLimit > 0 {
+		s.sendMessage(player, s.turnTimerMessage(room))
+	}
+	if room.Game.IsOver() {
+		s.sendMessage(player, s.rematchMessage(room, false))
+	}
+}
+
+func (s *Server) handlePlayer(player *Player, conn *websocket.Conn) {
+	leftOnPurpose := false
+	stopPings := make(chan struct{})
+	s.startHeartbeat(player, conn, stopPings)
 	defer func() {
-		// Clean up on disconnect
+		close(stopPings)
+		conn.Close()
+
 		s.mu.Lock()
-		if player.RoomID != "" {
-			s.removePlayerFromRoom(player)
+		player.mu.Lock()
+		current := player.Conn == conn
+		if current {
+			player.detach()
 		}
-		delete(s.players, player.ID)
+		player.mu.Unlock()
+
+		if !current {
+			// The player has already resumed on a newer connection
+			s.mu.Unlock()
+			return
+		}
+
+		if leftOnPurpose {
+			s.removePlayer(player)
+			s.mu.Unlock()
+			log.Printf("Player %s disconnected\n", player.ID)
+			s.broadcastRoomList()
+			return
+		}
+
+		// Hold the player's seat in case they're coming back
+		var timer *time.Timer
+		timer = time.AfterFunc(sessionGracePeriod, func() {
+			s.expireSession(player, &timer)
+		})
+		player.graceTimer = timer
 		s.mu.Unlock()
-		player.Conn.Close()
-		log.Printf("Player %s disconnected\n", player.ID)
+		log.Printf("Player %s dropped, holding their session for %v\n", player.ID, sessionGracePeriod)
 	}()
 
 	for {
-		var msg Message
-		err := player.Conn.ReadJSON(&msg)
+		msg, err := protocol.ReadMessage(conn)
 		if err != nil {
-			if websocket.IsUnexpectedCloseError(err, websocket.CloseGoingAway, websocket.CloseAbnormalClosure) {
+			if websocket.IsCloseError(err, websocket.CloseNormalClosure) {
+				leftOnPurpose = true
+			} else if websocket.IsUnexpectedCloseError(err, websocket.CloseGoingAway, websocket.CloseAbnormalClosure) {
 				log.Printf("Error reading from player %s: %v\n", player.ID, err)
 			}
 			break
@@ -150,73 +346,144 @@ func (s *Server) handlePlayer(player *Player) {
 
 		msg.PlayerID = player.ID
 		msg.Timestamp = time.Now()
+		player.touch()
 
 		s.handleMessage(player, msg)
 	}
 }
 
-func (s *Server) handleMessage(player *Player, msg Message) {
+// Remove a player whose grace period ran out without them reconnecting.
+// timer points at the timer that fired; it's only read with s.mu held, as
+// it's set after the timer has already started.
+func (s *Server) expireSession(player *Player, timer **time.Timer) {
+	s.mu.Lock()
+	if player.graceTimer != *timer {
+		// The player came back, possibly dropping again since
+		s.mu.Unlock()
+		return
+	}
+
+	s.removePlayer(player)
+	s.mu.Unlock()
+	log.Printf("Player %s session expired\n", player.ID)
+
+	s.broadcastRoomList()
+}
+
+// Forget a player entirely. Must be called with s.mu held.
+func (s *Server) removePlayer(player *Player) {
+	if player.RoomID != "" {
+		s.removePlayerFromRoom(player)
+	}
+	delete(s.players, player.ID)
+	delete(s.sessions, player.Token)
+}
+
+func (s *Server) handleMessage(player *Player, msg protocol.Message) {
 	log.Printf("SERVER: Received message type=%s from player %s\n", msg.Type, player.ID)
 
 	switch msg.Type {
-	case MsgCreateRoom:
+	case protocol.MsgJoinLobby:
+		s.handleJoinLobby(player, msg)
+	case protocol.MsgLeaveLobby:
+		s.handleLeaveLobby(player)
+	case protocol.MsgCreateRoom:
 		s.handleCreateRoom(player, msg)
-	case MsgJoinRoom:
+	case protocol.MsgJoinRoom:
 		s.handleJoinRoom(player, msg)
-	case MsgLeaveRoom:
+	case protocol.MsgSpectate:
+		s.handleSpectate(player, msg)
+	case protocol.MsgLeaveRoom:
 		s.handleLeaveRoom(player, msg)
-	case MsgStartGame:
+	case protocol.MsgStartGame:
 		s.handleStartGame(player, msg)
-	case MsgGameMove:
+	case protocol.MsgGameMove:
 		s.handleGameMove(player, msg)
-	case MsgChat:
+	case protocol.MsgChat:
 		s.handleChat(player, msg)
-	case MsgSetAvatar:
+	case protocol.MsgSetAvatar:
 		s.handleSetAvatar(player, msg)
+	case protocol.MsgSetName:
+		s.handleSetName(player, msg)
+	case protocol.MsgKickPlayer:
+		s.handleKickPlayer(player, msg)
+	case protocol.MsgTransferHost:
+		s.handleTransferHost(player, msg)
+	case protocol.MsgAddBot:
+		s.handleAddBot(player, msg)
+	case protocol.MsgRoomSettings:
+		s.handleRoomSettings(player, msg)
+	case protocol.MsgSetReady:
+		s.handleSetReady(player, msg)
+	case protocol.MsgRematch:
+		s.handleRematch(player, msg)
 	default:
-		s.sendError(player, "Unknown message type")
+		s.sendError(player, protocol.ErrBadRequest, "Unknown message type")
 	}
 }
 
-func (s *Server) handleCreateRoom(player *Player, msg Message) {
-	var data struct {
-		GameType string `json:"game_type"`
-		RoomName string `json:"room_name"`
+func (s *Server) handleCreateRoom(player *Player, msg protocol.Message) {
+	var data protocol.CreateRoom
+	if err := msg.Decode(&data); err != nil {
+		s.sendError(player, protocol.ErrBadRequest, "Invalid create room data")
+		return
 	}
-	if err := json.Unmarshal(msg.Data, &data); err != nil {
-		s.sendError(player, "Invalid create room data")
+	if !protocol.KnownGame(data.GameType) {
+		s.sendError(player, protocol.ErrBadRequest, "Unknown game type")
 		return
 	}
+	if !protocol.ValidTimeControl(data.GameType, data.TimeLimit) {
+		s.sendError(player, protocol.ErrBadRequest, "Invalid time control")
+		return
+	}
+	data.RoomName = protocol.CleanText(data.RoomName, protocol.MaxRoomNameLength)
+	if data.RoomName == "" {
+		data.RoomName = player.Name + "'s Room"
+	}
 
 	s.mu.Lock()
 	// Remove player from any existing room first
 	if player.RoomID != "" {
 		log.Printf("Player %s leaving old room %s to create new room\n", player.ID, player.RoomID)
 		s.removePlayerFromRoom(player)
-		s.broadcastRoomList()
+		// Broadcasting takes s.mu, so it has to wait until we're done
+		go s.broadcastRoomList()
 	}
 
 	roomID := generateID()
+	_, maxPlayers := protocol.SeatLimits(data.GameType)
 	room := &Room{
 		ID:         roomID,
 		Name:       data.RoomName,
 		GameType:   data.GameType,
+		Code:       s.generateRoomCode(),
+		Private:    data.Private,
+		Host:       player.ID,
+		Kicked:     make(map[string]bool),
+		Ready:      make(map[string]bool),
+		Series:     make(map[string]*SeriesScore),
 		Players:    []*Player{player},
-		MaxPlayers: getMaxPlayers(data.GameType),
+		MaxPlayers: maxPlayers,
 		Started:    false,
+		TimeLimit:  data.TimeLimit,
+		TimerSeat:  -1,
+	}
+	if data.Private && data.Password != "" {
+		room.Password = hashKey(data.Password)
 	}
 
 	s.rooms[roomID] = room
 	player.RoomID = roomID
 	s.mu.Unlock()
 
-	log.Printf("Player %s created room %s for game %s (Players: %d/%d)\n", player.ID, roomID, data.GameType, len(room.Players), room.MaxPlayers)
+	log.Printf("Player %s created room %s (code %s, private=%v) for game %s (Players: %d/%d)\n", player.ID, roomID, room.Code, room.Private, data.GameType, len(room.Players), room.MaxPlayers)
 
-	// Send confirmation to creator
-	s.sendMessage(player, Message{
-		Type:      "room_created",
+	// Send confirmation to creator, with the code to share
+	s.sendMessage(player, protocol.Message{
+		Type:      protocol.MsgRoomCreated,
 		RoomID:    roomID,
 		GameType:  data.GameType,
+		Data:      protocol.Encode(protocol.RoomCreated{Code: room.Code, Private: room.Private}),
 		Timestamp: time.Now(),
 	})
 
@@ -224,12 +491,12 @@ func (s *Server) handleCreateRoom(player *Player, msg Message) {
 	s.broadcastRoomList()
 }
 
-func (s *Server) handleJoinRoom(player *Player, msg Message) {
-	var data struct {
-		RoomID string `json:"room_id"`
-	}
-	if err := json.Unmarshal(msg.Data, &data); err != nil {
-		s.sendError(player, "Invalid join room data")
+func (s *Server) handleJoinRoom(player *Player, msg protocol.Message) {
+	// Rooms are joined from the room list by ID, or by code for private
+	// rooms and invite links
+	var data protocol.JoinRoom
+	if err := msg.Decode(&data); err != nil {
+		s.sendError(player, protocol.ErrBadRequest, "Invalid join room data")
 		return
 	}
 
@@ -238,28 +505,70 @@ func (s *Server) handleJoinRoom(player *Player, msg Message) {
 	if player.RoomID != "" {
 		log.Printf("Player %s leaving old room %s to join new room\n", player.ID, player.RoomID)
 		s.removePlayerFromRoom(player)
-		s.broadcastRoomList()
+		// Broadcasting takes s.mu, so it has to wait until we're done
+		go s.broadcastRoomList()
 	}
 
-	room, exists := s.rooms[data.RoomID]
+	var room *Room
+	exists := false
+	if data.Code != "" {
+		room, exists = s.roomByCode(data.Code)
+	} else {
+		room, exists = s.rooms[data.RoomID]
+		// Private rooms can only be found by their code
+		exists = exists && !room.Private
+	}
 	if !exists {
 		s.mu.Unlock()
-		s.sendError(player, "Room not found")
+		s.sendError(player, protocol.ErrRoomNotFound, "Room not found")
 		return
 	}
+	data.RoomID = room.ID
 
 	room.mu.Lock()
+	if room.Password != "" && subtle.ConstantTimeCompare([]byte(hashKey(data.Password)), []byte(room.Password)) != 1 {
+		room.mu.Unlock()
+		s.mu.Unlock()
+		if data.Password == "" {
+			s.sendError(player, protocol.ErrPasswordRequired, "Password required")
+		} else {
+			s.sendError(player, protocol.ErrWrongPassword, "Wrong password")
+		}
+		return
+	}
+
+	if room.Kicked[player.ID] {
+		room.mu.Unlock()
+		s.mu.Unlock()
+		s.sendError(player, protocol.ErrRemoved, "You were removed from this room")
+		return
+	}
+
+	if room.Locked {
+		room.mu.Unlock()
+		s.mu.Unlock()
+		s.sendError(player, protocol.ErrRoomLocked, "Room is locked")
+		return
+	}
+
 	if len(room.Players) >= room.MaxPlayers {
 		room.mu.Unlock()
 		s.mu.Unlock()
-		s.sendError(player, "Room is full")
+		s.sendError(player, protocol.ErrRoomFull, "Room is full")
 		return
 	}
 
 	if room.Started {
 		room.mu.Unlock()
 		s.mu.Unlock()
-		s.sendError(player, "Game already started")
+		s.sendError(player, protocol.ErrGameStarted, "Game already started")
+		return
+	}
+
+	if room.countdown != nil {
+		room.mu.Unlock()
+		s.mu.Unlock()
+		s.sendError(player, protocol.ErrGameStarted, "Game is about to start")
 		return
 	}
 
@@ -273,8 +582,8 @@ func (s *Server) handleJoinRoom(player *Player, msg Message) {
 	log.Printf("Player %s joined room %s (Players: %d/%d)\n", player.ID, data.RoomID, len(room.Players), room.MaxPlayers)
 
 	// Notify all players in room
-	s.broadcastToRoom(room, Message{
-		Type:      "player_joined",
+	s.broadcastToRoom(room, protocol.Message{
+		Type:      protocol.MsgPlayerJoined,
 		PlayerID:  player.ID,
 		RoomID:    data.RoomID,
 		Timestamp: time.Now(),
@@ -284,12 +593,62 @@ func (s *Server) handleJoinRoom(player *Player, msg Message) {
 	s.broadcastRoomList()
 }
 
-func (s *Server) handleLeaveRoom(player *Player, msg Message) {
+func (s *Server) handleSpectate(player *Player, msg protocol.Message) {
+	var data protocol.Spectate
+	if err := msg.Decode(&data); err != nil {
+		s.sendError(player, protocol.ErrBadRequest, "Invalid spectate data")
+		return
+	}
+
+	s.mu.Lock()
+	// Remove player from any existing room first
+	if player.RoomID != "" {
+		log.Printf("Player %s leaving old room %s to spectate\n", player.ID, player.RoomID)
+		s.removePlayerFromRoom(player)
+	}
+
+	room, exists := s.rooms[data.RoomID]
+	if !exists || room.Private {
+		s.mu.Unlock()
+		s.sendError(player, protocol.ErrRoomNotFound, "Room not found")
+		return
+	}
+
+	room.mu.Lock()
+	if !room.Started || room.Game == nil {
+		room.mu.Unlock()
+		s.mu.Unlock()
+		s.sendError(player, protocol.ErrGameNotStarted, "Game has not started")
+		return
+	}
+
+	room.Spectators = append(room.Spectators, player)
+	player.RoomID = room.ID
+	player.Spectating = true
+	log.Printf("Player %s is spectating room %s (Watchers: %d)\n", player.ID, room.ID, len(room.Spectators))
+
+	// Bring the spectator straight into the game in progress
+	s.sendMessage(player, s.startGameMessage(room, -1))
+	stateData := protocol.Encode(room.Game.State())
+	s.sendMessage(player, protocol.Message{
+		Type:      protocol.MsgGameState,
+		RoomID:    room.ID,
+		GameType:  room.GameType,
+		Data:      stateData,
+		Timestamp: time.Now(),
+	})
+	room.mu.Unlock()
+	s.mu.Unlock()
+
+	s.broadcastRoomList()
+}
+
+func (s *Server) handleLeaveRoom(player *Player, msg protocol.Message) {
 	s.mu.Lock()
 
 	if player.RoomID == "" {
 		s.mu.Unlock()
-		s.sendError(player, "Not in a room")
+		s.sendError(player, protocol.ErrNotInRoom, "Not in a room")
 		return
 	}
 
@@ -300,127 +659,309 @@ func (s *Server) handleLeaveRoom(player *Player, msg Message) {
 	s.broadcastRoomList()
 }
 
-func (s *Server) handleStartGame(player *Player, msg Message) {
+func (s *Server) handleStartGame(player *Player, msg protocol.Message) {
 	s.mu.RLock()
 	room, exists := s.rooms[player.RoomID]
 	s.mu.RUnlock()
 
 	if !exists {
-		s.sendError(player, "Not in a room")
+		s.sendError(player, protocol.ErrNotInRoom, "Not in a room")
+		return
+	}
+	if player.Spectating {
+		s.sendError(player, protocol.ErrSpectator, "Spectators can't start the game")
 		return
 	}
 
 	room.mu.Lock()
-	// For games that support many players (Yahtzee, Memory), allow 1+ players
-	// For 2-player only games, need exactly 2
-	if room.MaxPlayers == 2 && len(room.Players) != 2 {
+	if room.Host != player.ID {
+		room.mu.Unlock()
+		s.sendError(player, protocol.ErrNotHost, "Only the host can start the game")
+		return
+	}
+	if room.Started || room.countdown != nil {
 		room.mu.Unlock()
-		s.sendError(player, "Need exactly 2 players to start")
+		s.sendError(player, protocol.ErrGameStarted, "Game already started")
+		return
+	}
+	// Multi-player games (Yahtzee, Memory) can start with 1+ players,
+	// 2-player only games need exactly 2
+	if min, _ := protocol.SeatLimits(room.GameType); len(room.Players) < min {
+		room.mu.Unlock()
+		s.sendError(player, protocol.ErrNotEnoughPlayers, fmt.Sprintf("Need at least %d players to start", min))
 		return
 	}
 
-	// For multi-player games, need at least 1 player (which we always have)
-	if len(room.Players) < 1 {
+	// The host can override players who haven't readied up
+	var data protocol.StartRequest
+	if len(msg.Data) > 0 {
+		msg.Decode(&data)
+	}
+	if !data.Force && !room.everyoneReady() {
 		room.mu.Unlock()
-		s.sendError(player, "Need at least 1 player to start")
+		s.sendError(player, protocol.ErrNotReady, "Not everyone is ready")
 		return
 	}
 
-	room.Started = true
+	log.Printf("Counting down to game in room %s\n", room.ID)
+	s.startCountdown(room)
 	room.mu.Unlock()
+}
 
-	log.Printf("Game starting in room %s\n", room.ID)
+// Build the start_game message for the player in the given seat, with their
+// player number and all player info. A seat of -1 builds the message for a
+// spectator. Must be called with room.mu held.
+func (s *Server) startGameMessage(room *Room, seat int) protocol.Message {
+	playerInfos := make([]protocol.PlayerInfo, len(room.Players))
+	for i, p := range room.Players {
+		playerInfos[i] = protocol.PlayerInfo{
+			ID:     p.ID,
+			Name:   p.Name,
+			Avatar: p.Avatar,
+			Rating: s.playerRating(room.GameType, p),
+		}
+		if p.Bot != nil {
+			playerInfos[i].Bot = p.Bot.Level.String()
+		}
+	}
 
-	// Notify each player with their player number and all player info
-	room.mu.RLock()
+	data := protocol.StartGame{
+		PlayerNumber:   seat, // 0 for first player, 1 for second
+		Spectator:      seat < 0,
+		TotalPlayers:   len(room.Players),
+		Players:        playerInfos,
+		SeedCommitment: rules.Commit(room.Seed),
+	}
+	if engine, ok := room.Game.(startDataEngine); ok {
+		engine.StartData(&data)
+	}
+	return protocol.Message{
+		Type:      protocol.MsgStartGame,
+		RoomID:    room.ID,
+		GameType:  room.GameType,
+		Data:      protocol.Encode(data),
+		Timestamp: time.Now(),
+	}
+}
 
-	// Build player info array
-	playerInfos := make([]map[string]interface{}, len(room.Players))
+func (s *Server) handleGameMove(player *Player, msg protocol.Message) {
+	s.mu.RLock()
+	room, exists := s.rooms[player.RoomID]
+	s.mu.RUnlock()
+
+	if !exists {
+		s.sendError(player, protocol.ErrNotInRoom, "Not in a room")
+		return
+	}
+	if player.Spectating {
+		s.sendError(player, protocol.ErrSpectator, "Spectators can't make moves")
+		return
+	}
+
+	room.mu.Lock()
+	if !room.Started || room.Game == nil {
+		room.mu.Unlock()
+		s.sendError(player, protocol.ErrGameNotStarted, "Game has not started")
+		return
+	}
+
+	seat := -1
 	for i, p := range room.Players {
-		playerInfos[i] = map[string]interface{}{
-			"id":     p.ID,
-			"name":   p.Name,
-			"avatar": p.Avatar,
+		if p.ID == player.ID {
+			seat = i
+			break
 		}
 	}
 
-	for i, p := range room.Players {
-		playerData, _ := json.Marshal(map[string]interface{}{
-			"player_number": i, // 0 for first player, 1 for second
-			"total_players": len(room.Players),
-			"players":       playerInfos,
-		})
-		s.sendMessage(p, Message{
-			Type:      MsgStartGame,
+	// Validate the move against the authoritative game state
+	applied, err := room.Game.ApplyMove(seat, msg.Data)
+	if err != nil {
+		stateData := protocol.Encode(room.Game.State())
+		room.mu.Unlock()
+		log.Printf("Rejected move from player %s in room %s: %v\n", player.ID, room.ID, err)
+		s.sendError(player, moveErrorCode(err), err.Error())
+		// Resync the offending client with the real state
+		s.sendMessage(player, protocol.Message{
+			Type:      protocol.MsgGameState,
 			RoomID:    room.ID,
 			GameType:  room.GameType,
-			Data:      playerData,
+			Data:      stateData,
 			Timestamp: time.Now(),
 		})
+		return
+	}
+	moveData := msg.Data
+	if applied != nil {
+		moveData = applied
 	}
-	room.mu.RUnlock()
+	room.Moves = append(room.Moves, protocol.MatchMove{Seat: seat, Data: moveData, Time: time.Now()})
+
+	// Relay the validated move to the other players and spectators, then
+	// send everyone the resulting authoritative state. A move the server
+	// filled in goes back to the sender too, since they don't know the
+	// result yet.
+	if applied != nil {
+		msg.Data = applied
+	}
+	watchers := append(append([]*Player{}, room.Players...), room.Spectators...)
+	for _, p := range watchers {
+		if p.ID != player.ID || applied != nil {
+			s.sendMessage(p, msg)
+		}
+	}
+	record := s.afterMove(room, watchers)
+	room.mu.Unlock()
 
-	s.broadcastRoomList()
+	s.saveMatch(room, record, watchers)
 }
 
-func (s *Server) handleGameMove(player *Player, msg Message) {
-	s.mu.RLock()
-	room, exists := s.rooms[player.RoomID]
-	s.mu.RUnlock()
+// Send everyone watching the state after a move, restart the turn timer
+// and wrap the game up if it's over. Returns the match record to save once
+// room.mu is released, or nil while the game goes on. Must be called with
+// room.mu held.
+func (s *Server) afterMove(room *Room, watchers []*Player) *protocol.MatchRecord {
+	stateData := protocol.Encode(room.Game.State())
+	for _, p := range watchers {
+		s.sendMessage(p, protocol.Message{
+			Type:      protocol.MsgGameState,
+			RoomID:    room.ID,
+			GameType:  room.GameType,
+			Data:      stateData,
+			Timestamp: time.Now(),
+		})
+	}
+	s.updateTurnTimer(room)
+	s.scheduleBotMove(room)
 
-	if !exists {
-		s.sendError(player, "Not in a room")
+	if !room.Game.IsOver() {
+		return nil
+	}
+	log.Printf("Game over in room %s\n", room.ID)
+	record := newMatchRecord(room)
+	revealData := s.seedRevealData(room)
+	for _, p := range watchers {
+		s.sendMessage(p, protocol.Message{
+			Type:      protocol.MsgSeedReveal,
+			RoomID:    room.ID,
+			GameType:  room.GameType,
+			Data:      revealData,
+			Timestamp: time.Now(),
+		})
+	}
+	room.recordSeries()
+	s.sendRematch(room, false)
+	return record
+}
+
+// Save a finished game to the history and update everyone's ratings
+func (s *Server) saveMatch(room *Room, record *protocol.MatchRecord, watchers []*Player) {
+	if record == nil {
 		return
 	}
+	if err := s.history.Save(record); err != nil {
+		log.Printf("Error saving match from room %s: %v\n", room.ID, err)
+	}
+	s.recordRatings(record, watchers)
+}
 
-	// Broadcast move to all other players in room
-	room.mu.RLock()
-	for _, p := range room.Players {
-		if p.ID != player.ID {
-			s.sendMessage(p, msg)
-		}
+// Reveal the seed behind a finished game, along with everything the game
+// drew from it, so players can check it against the commitment they got
+// in start_game. Must be called with room.mu held.
+func (s *Server) seedRevealData(room *Room) json.RawMessage {
+	data := protocol.SeedReveal{
+		Seed:       hex.EncodeToString(room.Seed),
+		Commitment: rules.Commit(room.Seed),
+	}
+	if engine, ok := room.Game.(randomHistoryEngine); ok {
+		engine.RandomHistory(&data)
 	}
-	room.mu.RUnlock()
+	return protocol.Encode(data)
 }
 
-func (s *Server) handleChat(player *Player, msg Message) {
+func (s *Server) handleChat(player *Player, msg protocol.Message) {
 	s.mu.RLock()
 	room, exists := s.rooms[player.RoomID]
 	s.mu.RUnlock()
 
 	if !exists {
-		s.sendError(player, "Not in a room")
+		s.sendError(player, protocol.ErrNotInRoom, "Not in a room")
 		return
 	}
 
-	// Broadcast chat to all players in room
-	s.broadcastToRoom(room, msg)
+	var data protocol.Chat
+	if err := msg.Decode(&data); err != nil || data.Text == "" {
+		s.sendError(player, protocol.ErrBadRequest, "Invalid chat data")
+		return
+	}
+	if len(data.Text) > maxChatLength {
+		data.Text = data.Text[:maxChatLength]
+	}
+	msg.Data = protocol.Encode(protocol.Chat{Name: player.Name, Text: data.Text})
+
+	// Spectators have their own chat channel so they can talk about
+	// the game without distracting the players
+	if player.Spectating {
+		s.broadcastToSpectators(room, msg)
+	} else {
+		s.broadcastToRoom(room, msg)
+	}
 }
 
-// Avatar names matching client side
+const maxChatLength = 200
+
+// Avatar names matching client side, one per avatar
 var avatarNames = []string{
 	"Human", "Teddy", "Kaycat", "Zach Rabbit", "Kiraffe", "Owlive", "Milliepede", "Sweet Puppy Paw", "Tygler", "Chimpancici", "Papapus", "Kaitlynx", "Reagator", "Ocelivia", "Hen-ry", "Tomouse", "Karabou", "Valkyrie", "Eleanor", "Stella", "Huckleberry", "Winston", "Baxter", "Ribbon & Puddles",
 }
 
-func (s *Server) handleSetAvatar(player *Player, msg Message) {
-	var data struct {
-		Avatar int `json:"avatar"`
+func (s *Server) handleSetAvatar(player *Player, msg protocol.Message) {
+	var data protocol.SetAvatar
+	if err := msg.Decode(&data); err != nil {
+		s.sendError(player, protocol.ErrBadRequest, "Invalid avatar data")
+		return
 	}
-	if err := json.Unmarshal(msg.Data, &data); err != nil {
-		s.sendError(player, "Invalid avatar data")
+
+	if data.Avatar < 0 || data.Avatar >= len(avatarNames) {
+		s.sendError(player, protocol.ErrBadRequest, "Invalid avatar")
 		return
 	}
 
-	// Update player's avatar and name
 	s.mu.Lock()
 	player.Avatar = data.Avatar
-	// Set player name to avatar name
-	if data.Avatar >= 0 && data.Avatar < len(avatarNames) {
-		player.Name = avatarNames[data.Avatar]
+	s.mu.Unlock()
+	s.saveAccount(player)
+
+	s.broadcastPlayerUpdate(player)
+}
+
+// handleSetName changes the player's display name, which is separate from
+// their avatar
+func (s *Server) handleSetName(player *Player, msg protocol.Message) {
+	var data protocol.SetName
+	if err := msg.Decode(&data); err != nil {
+		s.sendError(player, protocol.ErrBadRequest, "Invalid name data")
+		return
+	}
+	name := protocol.CleanName(data.Name)
+	if name == "" {
+		s.sendError(player, protocol.ErrBadRequest, "Name can't be empty")
+		return
 	}
+
+	s.mu.Lock()
+	player.Name = name
 	s.mu.Unlock()
+	s.saveAccount(player)
 
-	// If player is in a room, notify other players
+	s.broadcastPlayerUpdate(player)
+	// Room members are listed by name
+	if player.RoomID != "" {
+		s.broadcastRoomList()
+	}
+}
+
+// If the player is in a room, tell everyone there their avatar and name
+func (s *Server) broadcastPlayerUpdate(player *Player) {
 	if player.RoomID != "" {
 		s.mu.RLock()
 		room, exists := s.rooms[player.RoomID]
@@ -428,15 +969,14 @@ func (s *Server) handleSetAvatar(player *Player, msg Message) {
 
 		if exists {
 			// Broadcast player update to room with both avatar and name
-			updateData, _ := json.Marshal(map[string]interface{}{
-				"player_id": player.ID,
-				"avatar":    data.Avatar,
-				"name":      player.Name,
-			})
-			s.broadcastToRoom(room, Message{
-				Type:      MsgPlayerUpdate,
-				PlayerID:  player.ID,
-				Data:      updateData,
+			s.broadcastToRoom(room, protocol.Message{
+				Type:     protocol.MsgPlayerUpdate,
+				PlayerID: player.ID,
+				Data: protocol.Encode(protocol.PlayerUpdate{
+					PlayerID: player.ID,
+					Avatar:   player.Avatar,
+					Name:     player.Name,
+				}),
 				Timestamp: time.Now(),
 			})
 		}
@@ -451,6 +991,25 @@ func (s *Server) removePlayerFromRoom(player *Player) {
 	room, exists := s.rooms[player.RoomID]
 	if !exists {
 		player.RoomID = ""
+		player.Spectating = false
+		return
+	}
+
+	// A spectator leaving doesn't affect the game
+	if player.Spectating {
+		room.mu.Lock()
+		newSpectators := make([]*Player, 0)
+		for _, p := range room.Spectators {
+			if p.ID != player.ID {
+				newSpectators = append(newSpectators, p)
+			}
+		}
+		room.Spectators = newSpectators
+		room.mu.Unlock()
+		log.Printf("Spectator %s left room %s\n", player.ID, room.ID)
+
+		player.RoomID = ""
+		player.Spectating = false
 		return
 	}
 
@@ -467,11 +1026,38 @@ func (s *Server) removePlayerFromRoom(player *Player) {
 		}
 	}
 	room.Players = newPlayers
+	delete(room.Ready, player.ID)
+	s.cancelCountdown(room)
 
 	log.Printf("After removal: Room %s has %d players\n", room.ID, len(room.Players))
 
-	// Check if game was in progress
-	wasStarted := room.Started
+	// Whoever has been in the room longest takes over from a host who
+	// left, as long as they aren't a computer player
+	if room.Host == player.ID {
+		for _, p := range room.Players {
+			if p.Bot == nil {
+				room.Host = p.ID
+				log.Printf("Player %s is now host of room %s\n", room.Host, room.ID)
+				break
+			}
+		}
+	}
+
+	// Check if game was in progress. Once it's over the rest of the room
+	// stays together and goes back to waiting for the next game.
+	finished := room.Started && room.Game != nil && room.Game.IsOver()
+	wasStarted := room.Started && !finished
+	if wasStarted {
+		s.stopTurnTimer(room)
+		s.stopBotMove(room)
+	}
+	if finished {
+		room.Started = false
+		room.Game = nil
+		room.Rematch = nil
+		s.sendRematch(room, true)
+		log.Printf("Room %s back to waiting (player left after the game)\n", room.ID)
+	}
 
 	// Reset room state if someone left during game
 	if room.Started && len(room.Players) < room.MaxPlayers {
@@ -479,20 +1065,27 @@ func (s *Server) removePlayerFromRoom(player *Player) {
 		log.Printf("Room %s reset to not-started (player left during game)\n", room.ID)
 	}
 
-	// If room is empty, delete it
-	isEmpty := len(room.Players) == 0
+	// If room is empty, or only computer players are left, delete it
+	isEmpty := !room.hasPeople()
 	roomID := room.ID
 	room.mu.Unlock()
 
 	if isEmpty {
+		room.mu.Lock()
+		for _, p := range room.Players {
+			p.RoomID = ""
+		}
+		room.Players = make([]*Player, 0)
+		room.mu.Unlock()
+		s.endSpectating(room, player)
 		delete(s.rooms, roomID)
 		log.Printf("Room %s deleted (empty)\n", roomID)
 	} else {
 		// If game was started, end it and kick everyone out
 		if wasStarted {
 			log.Printf("Game was in progress, ending room %s and removing all remaining players\n", roomID)
-			s.broadcastToRoom(room, Message{
-				Type:      "game_ended",
+			s.broadcastToRoom(room, protocol.Message{
+				Type:      protocol.MsgGameEnded,
 				PlayerID:  player.ID,
 				RoomID:    roomID,
 				Timestamp: time.Now(),
@@ -506,14 +1099,18 @@ func (s *Server) removePlayerFromRoom(player *Player) {
 			}
 			room.Players = make([]*Player, 0)
 			room.mu.Unlock()
+			s.endSpectating(room, player)
 
 			// Delete the room since the game ended
 			delete(s.rooms, roomID)
 			log.Printf("Room %s deleted (game ended)\n", roomID)
 		} else {
+			if finished {
+				s.endSpectating(room, player)
+			}
 			// Game hadn't started yet, just notify remaining players
-			s.broadcastToRoom(room, Message{
-				Type:      "player_left",
+			s.broadcastToRoom(room, protocol.Message{
+				Type:      protocol.MsgPlayerLeft,
 				PlayerID:  player.ID,
 				RoomID:    roomID,
 				Timestamp: time.Now(),
@@ -524,25 +1121,51 @@ func (s *Server) removePlayerFromRoom(player *Player) {
 	player.RoomID = ""
 }
 
-func (s *Server) sendMessage(player *Player, msg Message) {
+// Send a room's spectators back to the lobby when the room goes away
+func (s *Server) endSpectating(room *Room, leaver *Player) {
+	s.broadcastToSpectators(room, protocol.Message{
+		Type:      protocol.MsgGameEnded,
+		PlayerID:  leaver.ID,
+		RoomID:    room.ID,
+		Timestamp: time.Now(),
+	})
+
+	room.mu.Lock()
+	for _, p := range room.Spectators {
+		p.RoomID = ""
+		p.Spectating = false
+	}
+	room.Spectators = make([]*Player, 0)
+	room.mu.Unlock()
+}
+
+func (s *Server) sendMessage(player *Player, msg protocol.Message) {
 	player.mu.Lock()
 	defer player.mu.Unlock()
 
-	err := player.Conn.WriteJSON(msg)
-	if err != nil {
-		log.Printf("Error sending to player %s: %v\n", player.ID, err)
+	// Messages to a disconnected player are dropped; they get a full
+	// resync if they resume their session
+	if player.send == nil {
+		return
+	}
+
+	select {
+	case player.send <- msg:
+	default:
+		// The client can't keep up. Dropping the connection lets them
+		// resume and resync once they can.
+		log.Printf("Player %s fell too far behind, dropping their connection\n", player.ID)
+		close(player.send)
+		player.send = nil
+		player.Conn.Close()
 	}
 }
 
-func (s *Server) sendError(player *Player, errMsg string) {
-	s.sendMessage(player, Message{
-		Type:      MsgError,
-		Data:      json.RawMessage(`{"error":"` + errMsg + `"}`),
-		Timestamp: time.Now(),
-	})
+func (s *Server) sendError(player *Player, code protocol.ErrorCode, errMsg string) {
+	s.sendMessage(player, protocol.NewError(code, errMsg))
 }
 
-func (s *Server) broadcastToRoom(room *Room, msg Message) {
+func (s *Server) broadcastToRoom(room *Room, msg protocol.Message) {
 	room.mu.RLock()
 	defer room.mu.RUnlock()
 
@@ -551,57 +1174,61 @@ func (s *Server) broadcastToRoom(room *Room, msg Message) {
 	}
 }
 
-func (s *Server) broadcastRoomList() {
-	s.mu.RLock()
-	defer s.mu.RUnlock()
+func (s *Server) broadcastToSpectators(room *Room, msg protocol.Message) {
+	room.mu.RLock()
+	defer room.mu.RUnlock()
 
-	for _, player := range s.players {
-		s.sendRoomList(player)
+	for _, player := range room.Spectators {
+		s.sendMessage(player, msg)
 	}
 }
 
-func (s *Server) sendRoomList(player *Player) {
-	s.mu.RLock()
-	defer s.mu.RUnlock()
+// Room codes leave out letters and digits that are easy to mix up
+const roomCodeChars = "ABCDEFGHJKLMNPQRSTUVWXYZ23456789"
+const roomCodeLength = 6
 
-	type RoomInfo struct {
-		ID         string `json:"id"`
-		Name       string `json:"name"`
-		GameType   string `json:"game_type"`
-		Players    int    `json:"players"`
-		MaxPlayers int    `json:"max_players"`
-		Started    bool   `json:"started"`
+// Generate a short code for a new room that's easy to read out and type.
+// Must be called with s.mu held.
+func (s *Server) generateRoomCode() string {
+	for {
+		b := make([]byte, roomCodeLength)
+		if _, err := rand.Read(b); err != nil {
+			log.Fatalf("Failed to generate room code: %v", err)
+		}
+		for i := range b {
+			b[i] = roomCodeChars[int(b[i])%len(roomCodeChars)]
+		}
+		code := string(b)
+		if _, taken := s.roomByCode(code); !taken {
+			return code
+		}
 	}
+}
 
-	rooms := make([]RoomInfo, 0)
+// Find a room by its code, ignoring case. Must be called with s.mu held.
+func (s *Server) roomByCode(code string) (*Room, bool) {
+	code = strings.ToUpper(strings.TrimSpace(code))
 	for _, room := range s.rooms {
-		room.mu.RLock()
-		rooms = append(rooms, RoomInfo{
-			ID:         room.ID,
-			Name:       room.Name,
-			GameType:   room.GameType,
-			Players:    len(room.Players),
-			MaxPlayers: room.MaxPlayers,
-			Started:    room.Started,
-		})
-		room.mu.RUnlock()
+		if room.Code == code {
+			return room, true
+		}
 	}
-
-	data, _ := json.Marshal(map[string]interface{}{
-		"rooms": rooms,
-	})
-
-	s.sendMessage(player, Message{
-		Type:      MsgRoomList,
-		Data:      data,
-		Timestamp: time.Now(),
-	})
+	return nil, false
 }
 
 func generateID() string {
 	return time.Now().Format("20060102150405") + randomString(6)
 }
 
+// Generate an unguessable session token
+func generateToken() string {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		log.Fatalf("Failed to generate session token: %v", err)
+	}
+	return hex.EncodeToString(b)
+}
+
 func randomString(n int) string {
 	const letters = "abcdefghijklmnopqrstuvwxyz0123456789"
 	b := make([]byte, n)
@@ -613,9 +1240,47 @@ func randomString(n int) string {
 }
 
 func main() {
-	server := NewServer()
+	// Finished games are kept on disk; point HISTORY_DIR at a persistent
+	// disk in production
+	historyDir := os.Getenv("HISTORY_DIR")
+	if historyDir == "" {
+		historyDir = "history"
+	}
+	history, err := NewFileHistoryStore(historyDir)
+	if err != nil {
+		log.Fatalf("Failed to open match history in %s: %v", historyDir, err)
+	}
+
+	ratingsFile := os.Getenv("RATINGS_FILE")
+	if ratingsFile == "" {
+		ratingsFile = "ratings.json"
+	}
+	ratings, err := NewFileRatingStore(ratingsFile)
+	if err != nil {
+		log.Fatalf("Failed to load ratings from %s: %v", ratingsFile, err)
+	}
+
+	accountsFile := os.Getenv("ACCOUNTS_FILE")
+	if accountsFile == "" {
+		accountsFile = "accounts.json"
+	}
+	accounts, err := NewFileAccountStore(accountsFile)
+	if err != nil {
+		log.Fatalf("Failed to load accounts from %s: %v", accountsFile, err)
+	}
+
+	server := NewServer(history, ratings, accounts)
+	// Clients older than MIN_CLIENT_VERSION, e.g. 1.0.21, are asked to
+	// update before they can play
+	server.minClientVersion = os.Getenv("MIN_CLIENT_VERSION")
+	go server.reapIdlePlayers()
+	go server.sendRoomSnapshots()
 
 	http.HandleFunc("/ws", server.handleConnection)
+	http.HandleFunc("GET /history", server.handleHistoryList)
+	http.HandleFunc("GET /history/{id}", server.handleHistoryGet)
+	http.HandleFunc("GET /leaderboard", server.handleLeaderboard)
+	http.HandleFunc("GET /leaderboard/{game_type}", server.handleLeaderboardGame)
 
 	// Simple root handler
 	http.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
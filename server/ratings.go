@@ -0,0 +1,288 @@
+package main
+
+import (
+	"encoding/json"
+	"log"
+	"math"
+	"net/http"
+	"os"
+	"sort"
+	"sync"
+	"time"
+
+	"olive_and_millies_game_room/protocol"
+)
+
+const (
+	initialRating   = 1200.0
+	eloK            = 32.0
+	leaderboardSize = 20 // Entries per game in GET /leaderboard
+)
+
+// ratedGames lists the games that keep ratings, and whether the game is
+// strictly two-player (plain Elo) or any number of players (pairwise Elo).
+var ratedGames = map[string]bool{
+	"santorini":    true,
+	"connect_four": true,
+	"yahtzee":      false,
+	"memory":       false,
+}
+
+// Rating is one player's standing in one game
+type Rating struct {
+	Player    string    `json:"player"` // See ratingKey
+	Name      string    `json:"name"`
+	Rating    float64   `json:"rating"`
+	Games     int       `json:"games"`
+	Wins      int       `json:"wins"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+// RatingStore keeps every player's rating in every game
+type RatingStore interface {
+	// Get returns the player's rating, or a fresh one if they haven't
+	// played the game yet
+	Get(gameType, player string) Rating
+	// Update gets the players' ratings, has change work them out anew and
+	// saves the result, as one step so that matches ending at the same
+	// time don't overwrite each other's changes
+	Update(gameType string, players []string, change func(current []Rating) []Rating) error
+	// Leaderboard returns the game's ratings, highest first
+	Leaderboard(gameType string) []Rating
+}
+
+// FileRatingStore keeps all ratings in memory and writes them to a single
+// JSON file after every change
+type FileRatingStore struct {
+	path    string
+	ratings map[string]map[string]Rating // Game type, then rating key
+	mu      sync.RWMutex
+}
+
+func NewFileRatingStore(path string) (*FileRatingStore, error) {
+	fs := &FileRatingStore{
+		path:    path,
+		ratings: make(map[string]map[string]Rating),
+	}
+
+	data, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return fs, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(data, &fs.ratings); err != nil {
+		return nil, err
+	}
+	return fs, nil
+}
+
+func (fs *FileRatingStore) Get(gameType, player string) Rating {
+	fs.mu.RLock()
+	defer fs.mu.RUnlock()
+	return fs.get(gameType, player)
+}
+
+// Must be called with fs.mu held
+func (fs *FileRatingStore) get(gameType, player string) Rating {
+	if rating, ok := fs.ratings[gameType][player]; ok {
+		return rating
+	}
+	return Rating{Player: player, Rating: initialRating}
+}
+
+func (fs *FileRatingStore) Update(gameType string, players []string, change func(current []Rating) []Rating) error {
+	fs.mu.Lock()
+	defer fs.mu.Unlock()
+
+	current := make([]Rating, len(players))
+	for i, player := range players {
+		current[i] = fs.get(gameType, player)
+	}
+	return fs.save(gameType, change(current))
+}
+
+// Must be called with fs.mu held
+func (fs *FileRatingStore) save(gameType string, ratings []Rating) error {
+	if fs.ratings[gameType] == nil {
+		fs.ratings[gameType] = make(map[string]Rating)
+	}
+	for _, rating := range ratings {
+		fs.ratings[gameType][rating.Player] = rating
+	}
+
+	data, err := json.Marshal(fs.ratings)
+	if err != nil {
+		return err
+	}
+	return writeFileAtomic(fs.path, data)
+}
+
+func (fs *FileRatingStore) Leaderboard(gameType string) []Rating {
+	fs.mu.RLock()
+	defer fs.mu.RUnlock()
+
+	ratings := make([]Rating, 0, len(fs.ratings[gameType]))
+	for _, rating := range fs.ratings[gameType] {
+		ratings = append(ratings, rating)
+	}
+	sort.Slice(ratings, func(i, j int) bool {
+		if ratings[i].Rating != ratings[j].Rating {
+			return ratings[i].Rating > ratings[j].Rating
+		}
+		return ratings[i].Name < ratings[j].Name
+	})
+	return ratings
+}
+
+// ratingKey identifies a player across sessions: their account ID, so
+// ratings survive reconnects and name changes
+func ratingKey(player protocol.MatchPlayer) string {
+	return player.ID
+}
+
+// playerRating is the player's rounded rating in the game, or 0 if the
+// game isn't rated or they're a computer player
+func (s *Server) playerRating(gameType string, player *Player) int {
+	if _, rated := ratedGames[gameType]; !rated || player.Bot != nil {
+		return 0
+	}
+	return displayRating(s.ratings.Get(gameType, ratingKey(newMatchPlayer(player))).Rating)
+}
+
+// ratedMatch reports whether a finished match changes anyone's rating.
+// Solo games, games against computer players and unrated game types don't.
+func ratedMatch(record *protocol.MatchRecord) bool {
+	if _, rated := ratedGames[record.GameType]; !rated || len(record.Players) < 2 {
+		return false
+	}
+	for _, p := range record.Players {
+		if p.Bot != "" {
+			return false
+		}
+	}
+	return true
+}
+
+// updateRatings works out everyone's new rating after a rated match from
+// their current ones, by seat. Two-player games use plain Elo on the
+// result; multi-player games treat the match as a round of head-to-head
+// games between every pair of players, decided by score, with K split
+// between the opponents. A draw or tie is half a win against each player
+// it's shared with, and only counts as a win for nobody.
+func updateRatings(record *protocol.MatchRecord, current []Rating) []Rating {
+	twoPlayer := ratedGames[record.GameType]
+
+	// outcome is seat i's result against seat j: 1 win, 0.5 draw, 0 loss
+	outcome := func(i, j int) float64 {
+		if twoPlayer || len(record.Scores) != len(record.Players) {
+			switch record.Winner {
+			case i:
+				return 1
+			case j:
+				return 0
+			}
+			return 0.5
+		}
+		switch {
+		case record.Scores[i] > record.Scores[j]:
+			return 1
+		case record.Scores[i] < record.Scores[j]:
+			return 0
+		}
+		return 0.5
+	}
+
+	k := eloK / float64(len(record.Players)-1)
+	updated := make([]Rating, len(current))
+	for i := range current {
+		change := 0.0
+		for j := range current {
+			if i == j {
+				continue
+			}
+			expected := 1 / (1 + math.Pow(10, (current[j].Rating-current[i].Rating)/400))
+			change += k * (outcome(i, j) - expected)
+		}
+
+		updated[i] = current[i]
+		updated[i].Name = record.Players[i].Name
+		updated[i].Rating = current[i].Rating + change
+		updated[i].Games++
+		if record.Winner == i {
+			updated[i].Wins++
+		}
+		updated[i].UpdatedAt = record.EndedAt
+	}
+	return updated
+}
+
+// Update the ratings after a finished match and send everyone watching the
+// new ratings by seat
+func (s *Server) recordRatings(record *protocol.MatchRecord, watchers []*Player) {
+	if !ratedMatch(record) {
+		return
+	}
+	keys := make([]string, len(record.Players))
+	for i, p := range record.Players {
+		keys[i] = ratingKey(p)
+	}
+	var before, after []Rating
+	err := s.ratings.Update(record.GameType, keys, func(current []Rating) []Rating {
+		before, after = current, updateRatings(record, current)
+		return after
+	})
+	if err != nil {
+		log.Printf("Error saving ratings for match %s: %v\n", record.ID, err)
+	}
+
+	seats := make([]protocol.RatingChange, len(after))
+	for i := range after {
+		seats[i] = protocol.RatingChange{
+			Rating: displayRating(after[i].Rating),
+			Change: displayRating(after[i].Rating) - displayRating(before[i].Rating),
+		}
+	}
+	data := protocol.Encode(protocol.RatingUpdate{Ratings: seats})
+	for _, p := range watchers {
+		s.sendMessage(p, protocol.Message{
+			Type:      protocol.MsgRatingUpdate,
+			GameType:  record.GameType,
+			Data:      data,
+			Timestamp: time.Now(),
+		})
+	}
+}
+
+func displayRating(rating float64) int {
+	return int(math.Round(rating))
+}
+
+// GET /leaderboard lists the top players in every rated game
+func (s *Server) handleLeaderboard(w http.ResponseWriter, r *http.Request) {
+	leaderboards := make(map[string][]Rating)
+	for gameType := range ratedGames {
+		ratings := s.ratings.Leaderboard(gameType)
+		if len(ratings) > leaderboardSize {
+			ratings = ratings[:leaderboardSize]
+		}
+		leaderboards[gameType] = ratings
+	}
+	writeJSON(w, map[string]interface{}{
+		"leaderboards": leaderboards,
+	})
+}
+
+// GET /leaderboard/{game_type} lists every rated player in one game
+func (s *Server) handleLeaderboardGame(w http.ResponseWriter, r *http.Request) {
+	gameType := r.PathValue("game_type")
+	if _, ok := ratedGames[gameType]; !ok {
+		http.Error(w, "Unknown game type", http.StatusNotFound)
+		return
+	}
+	writeJSON(w, map[string]interface{}{
+		"game_type": gameType,
+		"ratings":   s.ratings.Leaderboard(gameType),
+	})
+}
@@ -0,0 +1,83 @@
+package main
+
+import (
+	"fmt"
+	"path/filepath"
+	"sync"
+	"testing"
+
+	"olive_and_millies_game_room/protocol"
+)
+
+func ratedRecord(gameType string, scores []int, winner int, players ...string) *protocol.MatchRecord {
+	record := &protocol.MatchRecord{ID: generateID(), GameType: gameType, Scores: scores, Winner: winner}
+	for _, p := range players {
+		record.Players = append(record.Players, protocol.MatchPlayer{ID: p, Name: p})
+	}
+	return record
+}
+
+func TestUpdateRatings(t *testing.T) {
+	fresh := []Rating{{Rating: initialRating}, {Rating: initialRating}, {Rating: initialRating}}
+	tests := []struct {
+		name    string
+		record  *protocol.MatchRecord
+		changes []float64
+		wins    []int
+	}{
+		{
+			name:    "two-player win",
+			record:  ratedRecord("connect_four", nil, 1, "a", "b"),
+			changes: []float64{-16, 16},
+			wins:    []int{0, 1},
+		},
+		{
+			name:    "two-player draw",
+			record:  ratedRecord("santorini", nil, -1, "a", "b"),
+			changes: []float64{0, 0},
+			wins:    []int{0, 0},
+		},
+		{
+			name:    "tied top score",
+			record:  ratedRecord("yahtzee", []int{200, 200, 100}, -1, "a", "b", "c"),
+			changes: []float64{8, 8, -16},
+			wins:    []int{0, 0, 0},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			current := fresh[:len(tt.record.Players)]
+			updated := updateRatings(tt.record, current)
+			for i, r := range updated {
+				if change := r.Rating - current[i].Rating; change != tt.changes[i] || r.Wins != tt.wins[i] || r.Games != 1 {
+					t.Errorf("seat %d: change %g, wins %d, games %d; want %g, %d, 1", i, change, r.Wins, r.Games, tt.changes[i], tt.wins[i])
+				}
+			}
+		})
+	}
+}
+
+func TestRatingsConcurrentMatches(t *testing.T) {
+	store, err := NewFileRatingStore(filepath.Join(t.TempDir(), "ratings.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := &Server{ratings: store}
+
+	// Every match has player a in it, so any change lost to another match
+	// ending at the same time shows up in a's games
+	const matches = 20
+	var wg sync.WaitGroup
+	for i := 0; i < matches; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			s.recordRatings(ratedRecord("connect_four", nil, 0, "a", fmt.Sprintf("b%d", i)), nil)
+		}(i)
+	}
+	wg.Wait()
+
+	if a := store.Get("connect_four", "a"); a.Games != matches || a.Wins != matches {
+		t.Errorf("a played %d and won %d, want %d of each", a.Games, a.Wins, matches)
+	}
+}
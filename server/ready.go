@@ -0,0 +1,174 @@
+package main
+
+import (
+	"log"
+	"time"
+
+	"olive_and_millies_game_room/protocol"
+	"olive_and_millies_game_room/rules"
+)
+
+// Seconds counted down to everyone in the room before a game starts
+const countdownSeconds = 3
+
+// handleSetReady marks the player ready, or not, to start the game. Backing
+// out during the countdown stops it.
+func (s *Server) handleSetReady(player *Player, msg protocol.Message) {
+	var data protocol.SetReady
+	if err := msg.Decode(&data); err != nil {
+		s.sendError(player, protocol.ErrBadRequest, "Invalid ready data")
+		return
+	}
+
+	s.mu.RLock()
+	room, exists := s.rooms[player.RoomID]
+	s.mu.RUnlock()
+
+	if !exists || player.Spectating {
+		s.sendError(player, protocol.ErrNotInRoom, "Not in a room")
+		return
+	}
+
+	room.mu.Lock()
+	if room.Started {
+		room.mu.Unlock()
+		s.sendError(player, protocol.ErrGameStarted, "Game already started")
+		return
+	}
+	room.Ready[player.ID] = data.Ready
+	if !data.Ready {
+		s.cancelCountdown(room)
+	}
+	room.mu.Unlock()
+
+	s.broadcastRoomList()
+}
+
+// Whether every player but the host has said they're ready. The host
+// starting the game counts as them being ready, and computer players are
+// always ready. Must be called with room.mu held.
+func (room *Room) everyoneReady() bool {
+	for _, p := range room.Players {
+		if p.ID != room.Host && p.Bot == nil && !room.Ready[p.ID] {
+			return false
+		}
+	}
+	return true
+}
+
+// Start counting down to the game, sending every tick to the whole room so
+// all the clients show the same number. Must be called with room.mu held.
+func (s *Server) startCountdown(room *Room) {
+	room.Countdown = countdownSeconds
+	s.sendCountdown(room)
+
+	var timer *time.Timer
+	timer = time.AfterFunc(time.Second, func() {
+		s.tickCountdown(room, &timer)
+	})
+	room.countdown = timer
+}
+
+// A second of the countdown has passed. timer points at the timer that
+// fired; it's only read with room.mu held, as it's set after the timer has
+// already started.
+func (s *Server) tickCountdown(room *Room, timer **time.Timer) {
+	room.mu.Lock()
+	if room.countdown != *timer {
+		// Cancelled since
+		room.mu.Unlock()
+		return
+	}
+
+	room.Countdown--
+	if room.Countdown > 0 {
+		s.sendCountdown(room)
+		var next *time.Timer
+		next = time.AfterFunc(time.Second, func() {
+			s.tickCountdown(room, &next)
+		})
+		room.countdown = next
+		room.mu.Unlock()
+		return
+	}
+	room.countdown = nil
+	room.mu.Unlock()
+
+	s.beginGame(room)
+}
+
+// Stop the countdown, if there is one, and tell the room. Must be called
+// with room.mu held.
+func (s *Server) cancelCountdown(room *Room) {
+	if room.countdown == nil {
+		return
+	}
+	room.countdown.Stop()
+	room.countdown = nil
+	room.Countdown = 0
+	log.Printf("Countdown cancelled in room %s\n", room.ID)
+	s.sendCountdown(room)
+}
+
+// Send the seconds left before the game starts, 0 if the countdown was
+// cancelled. Must be called with room.mu held.
+func (s *Server) sendCountdown(room *Room) {
+	msg := protocol.Message{
+		Type:      protocol.MsgCountdown,
+		RoomID:    room.ID,
+		GameType:  room.GameType,
+		Data:      protocol.Encode(protocol.Countdown{Seconds: room.Countdown}),
+		Timestamp: time.Now(),
+	}
+	for _, p := range room.Players {
+		s.sendMessage(p, msg)
+	}
+}
+
+// Start the game once the countdown is over
+func (s *Server) beginGame(room *Room) {
+	room.mu.Lock()
+	// Someone may have left as the countdown ran out
+	if min, _ := protocol.SeatLimits(room.GameType); len(room.Players) < min || room.Started {
+		room.mu.Unlock()
+		return
+	}
+	if err := s.startGame(room); err != nil {
+		log.Printf("Error starting game in room %s: %v\n", room.ID, err)
+	}
+	room.mu.Unlock()
+
+	s.broadcastRoomList()
+}
+
+// Set up the authoritative game and send each player their seat, and any
+// spectators still watching from the last game the new one. Must be called
+// with room.mu held.
+func (s *Server) startGame(room *Room) error {
+	seed := rules.NewSeed()
+	game, err := newGameEngine(room.GameType, len(room.Players), rules.NewRand(seed))
+	if err != nil {
+		return err
+	}
+	room.Game = game
+	room.Seed = seed
+	room.Moves = nil
+	room.StartedAt = time.Now()
+	room.Started = true
+	// Everyone readies up again for the next game
+	room.Ready = make(map[string]bool)
+	room.Rematch = nil
+
+	log.Printf("Game starting in room %s\n", room.ID)
+
+	// Notify each player with their player number and all player info
+	for i, p := range room.Players {
+		s.sendMessage(p, s.startGameMessage(room, i))
+	}
+	for _, p := range room.Spectators {
+		s.sendMessage(p, s.startGameMessage(room, -1))
+	}
+	s.startTurnTimer(room)
+	s.scheduleBotMove(room)
+	return nil
+}
@@ -0,0 +1,143 @@
+package main
+
+import (
+	"log"
+	"time"
+
+	"olive_and_millies_game_room/protocol"
+)
+
+// SeriesScore is a player's running tally over every game played in a room
+type SeriesScore struct {
+	Wins   int `json:"wins"`
+	Points int `json:"points"` // Summed scores, for games that keep score
+}
+
+// Add a finished game to the room's series. Must be called with room.mu
+// held.
+func (room *Room) recordSeries() {
+	scores, winner := room.Game.Result()
+	for i, p := range room.Players {
+		score, ok := room.Series[p.ID]
+		if !ok {
+			score = &SeriesScore{}
+			room.Series[p.ID] = score
+		}
+		if i < len(scores) {
+			score.Points += scores[i]
+		}
+		if i == winner {
+			score.Wins++
+		}
+	}
+	room.Games++
+	room.Rematch = make(map[string]bool)
+	// Computer players are always up for another game
+	for _, p := range room.Players {
+		if p.Bot != nil {
+			room.Rematch[p.ID] = true
+		}
+	}
+}
+
+// Whether every seated player has voted for a rematch. Must be called with
+// room.mu held.
+func (room *Room) everyoneWantsRematch() bool {
+	for _, p := range room.Players {
+		if !room.Rematch[p.ID] {
+			return false
+		}
+	}
+	return true
+}
+
+// handleRematch records a player's vote, or change of heart, for playing
+// the same room again once the game is over. When everyone's in, the game
+// restarts with the seats rotated so someone else goes first.
+func (s *Server) handleRematch(player *Player, msg protocol.Message) {
+	var data protocol.RematchVote
+	if err := msg.Decode(&data); err != nil {
+		s.sendError(player, protocol.ErrBadRequest, "Invalid rematch data")
+		return
+	}
+
+	s.mu.RLock()
+	room, exists := s.rooms[player.RoomID]
+	s.mu.RUnlock()
+
+	if !exists || player.Spectating {
+		s.sendError(player, protocol.ErrNotInRoom, "Not in a room")
+		return
+	}
+
+	room.mu.Lock()
+	if !room.Started || room.Game == nil || !room.Game.IsOver() {
+		room.mu.Unlock()
+		s.sendError(player, protocol.ErrGameNotOver, "The game isn't over yet")
+		return
+	}
+	room.Rematch[player.ID] = data.Accept
+	s.sendRematch(room, false)
+
+	if !room.everyoneWantsRematch() {
+		room.mu.Unlock()
+		return
+	}
+
+	log.Printf("Rematch in room %s\n", room.ID)
+	room.Players = append(room.Players[1:], room.Players[0])
+	if err := s.startGame(room); err != nil {
+		log.Printf("Error starting rematch in room %s: %v\n", room.ID, err)
+	}
+	room.mu.Unlock()
+
+	s.broadcastRoomList()
+}
+
+// Send the room's players and spectators who wants a rematch so far, along
+// with the series tally in seat order. cancelled means the vote is off
+// because someone left, and the players go back to the waiting room. Must
+// be called with room.mu held.
+func (s *Server) sendRematch(room *Room, cancelled bool) {
+	msg := s.rematchMessage(room, cancelled)
+	for _, p := range room.Players {
+		s.sendMessage(p, msg)
+	}
+	for _, p := range room.Spectators {
+		s.sendMessage(p, msg)
+	}
+}
+
+// Must be called with room.mu held
+func (s *Server) rematchMessage(room *Room, cancelled bool) protocol.Message {
+	accepted := make([]string, 0)
+	series := make([]protocol.SeriesScore, len(room.Players))
+	for i, p := range room.Players {
+		if room.Rematch[p.ID] {
+			accepted = append(accepted, p.ID)
+		}
+		score := room.Series[p.ID]
+		if score == nil {
+			score = &SeriesScore{}
+		}
+		series[i] = protocol.SeriesScore{
+			ID:     p.ID,
+			Name:   p.Name,
+			Wins:   score.Wins,
+			Points: score.Points,
+		}
+	}
+
+	return protocol.Message{
+		Type:     protocol.MsgRematch,
+		RoomID:   room.ID,
+		GameType: room.GameType,
+		Data: protocol.Encode(protocol.RematchStatus{
+			Accepted:  accepted,
+			Games:     room.Games,
+			Series:    series,
+			Cancelled: cancelled,
+		}),
+		Timestamp: time.Now(),
+	}
+}
@@ -0,0 +1,233 @@
+package main
+
+import (
+	"log"
+	"reflect"
+	"time"
+
+	"olive_and_millies_game_room/protocol"
+)
+
+// How often subscribers get their whole room list again, in case a change
+// went astray
+const roomSnapshotInterval = 30 * time.Second
+
+// roomView is the part of the room list a player is shown: the public rooms
+// for the game they're browsing, and the room they're in even if it's
+// private
+type roomView struct {
+	gameType string
+	roomID   string
+}
+
+func (v roomView) shows(room protocol.RoomInfo) bool {
+	if room.ID == v.roomID {
+		return true
+	}
+	return !room.Private && room.GameType == v.gameType
+}
+
+// The view a player's room list is built for. Must be called with s.mu
+// held.
+func (s *Server) viewOf(player *Player) roomView {
+	return roomView{
+		gameType: player.lobby,
+		roomID:   player.RoomID,
+	}
+}
+
+// Subscribe to the room list for a game type, which also ends any earlier
+// subscription, starting with a snapshot of it
+func (s *Server) handleJoinLobby(player *Player, msg protocol.Message) {
+	var data protocol.JoinLobby
+	if err := msg.Decode(&data); err != nil {
+		s.sendError(player, protocol.ErrBadRequest, "Invalid lobby data")
+		return
+	}
+	if !protocol.KnownGame(data.GameType) {
+		s.sendError(player, protocol.ErrBadRequest, "Unknown game type")
+		return
+	}
+
+	s.mu.Lock()
+	player.lobby = data.GameType
+	s.mu.Unlock()
+	s.sendRoomList(player)
+}
+
+// Stop following the room list, apart from the player's own room
+func (s *Server) handleLeaveLobby(player *Player) {
+	s.mu.Lock()
+	player.lobby = ""
+	s.mu.Unlock()
+	s.sendRoomList(player)
+}
+
+// Every room as the room list shows it, by ID. Must be called with s.mu
+// held.
+func (s *Server) roomInfos() map[string]protocol.RoomInfo {
+	infos := make(map[string]protocol.RoomInfo, len(s.rooms))
+	for _, room := range s.rooms {
+		room.mu.RLock()
+		members := make([]protocol.RoomMember, len(room.Players))
+		for i, p := range room.Players {
+			members[i] = protocol.RoomMember{
+				ID:     p.ID,
+				Name:   p.Name,
+				Rating: s.playerRating(room.GameType, p),
+				Ready:  room.Ready[p.ID] || p.Bot != nil,
+			}
+			if p.Bot != nil {
+				members[i].Bot = p.Bot.Level.String()
+			}
+		}
+		infos[room.ID] = protocol.RoomInfo{
+			ID:         room.ID,
+			Name:       room.Name,
+			GameType:   room.GameType,
+			Players:    len(room.Players),
+			MaxPlayers: room.MaxPlayers,
+			Started:    room.Started,
+			Watchers:   len(room.Spectators),
+			Members:    members,
+			Code:       room.Code,
+			Private:    room.Private,
+			Host:       room.Host,
+			Locked:     room.Locked,
+			TimeLimit:  room.TimeLimit,
+		}
+		room.mu.RUnlock()
+	}
+	return infos
+}
+
+// A player and the view their room list is built for
+type roomListTarget struct {
+	player *Player
+	view   roomView
+}
+
+// Everyone connected and what they should see. Must be called with s.mu
+// held.
+func (s *Server) roomListTargets() []roomListTarget {
+	targets := make([]roomListTarget, 0, len(s.players))
+	for _, player := range s.players {
+		targets = append(targets, roomListTarget{player, s.viewOf(player)})
+	}
+	return targets
+}
+
+// broadcastRoomList tells everyone what has changed in the room list since
+// the last broadcast. Subscribers get each room added, updated or removed
+// that they can see. Anyone whose view has changed, e.g. by joining a room,
+// gets a fresh snapshot.
+func (s *Server) broadcastRoomList() {
+	s.listMu.Lock()
+	defer s.listMu.Unlock()
+
+	s.mu.RLock()
+	rooms := s.roomInfos()
+	targets := s.roomListTargets()
+	s.mu.RUnlock()
+
+	// Each change is encoded once for everyone who gets it
+	type change struct {
+		room protocol.RoomInfo
+		msg  protocol.Message
+	}
+	var changes []change
+	for id, room := range rooms {
+		old, listed := s.listed[id]
+		msgType := protocol.MsgRoomAdded
+		if listed {
+			if reflect.DeepEqual(old, room) {
+				continue
+			}
+			msgType = protocol.MsgRoomUpdated
+		}
+		msg := protocol.NewMessage(msgType, room)
+		msg.RoomID = id
+		changes = append(changes, change{room, msg})
+	}
+	for id, old := range s.listed {
+		if _, exists := rooms[id]; !exists {
+			msg := protocol.NewMessage(protocol.MsgRoomRemoved, nil)
+			msg.RoomID = id
+			changes = append(changes, change{old, msg})
+		}
+	}
+	s.listed = rooms
+
+	for _, target := range targets {
+		player, view := target.player, target.view
+		switch {
+		case view != player.listed:
+			s.sendRoomSnapshot(player, view, rooms)
+		default:
+			for _, c := range changes {
+				if view.shows(c.room) {
+					s.sendMessage(player, c.msg)
+				}
+			}
+		}
+	}
+}
+
+// sendRoomList sends a player a snapshot of their room list
+func (s *Server) sendRoomList(player *Player) {
+	s.listMu.Lock()
+	defer s.listMu.Unlock()
+
+	s.mu.RLock()
+	rooms := s.roomInfos()
+	view := s.viewOf(player)
+	s.mu.RUnlock()
+
+	s.sendRoomSnapshot(player, view, rooms)
+}
+
+// Send the rooms in a player's view, which the changes that follow build
+// on. Must be called with s.listMu held.
+func (s *Server) sendRoomSnapshot(player *Player, view roomView, rooms map[string]protocol.RoomInfo) {
+	list := make([]protocol.RoomInfo, 0)
+	for _, room := range rooms {
+		if view.shows(room) {
+			list = append(list, room)
+		}
+	}
+	player.listed = view
+	s.sendMessage(player, protocol.NewMessage(protocol.MsgRoomList, protocol.RoomList{Rooms: list}))
+}
+
+// sendRoomSnapshots runs for the life of the server, sending subscribers
+// their whole room list every so often
+func (s *Server) sendRoomSnapshots() {
+	ticker := time.NewTicker(roomSnapshotInterval)
+	defer ticker.Stop()
+	for range ticker.C {
+		s.snapshotRoomLists()
+	}
+}
+
+func (s *Server) snapshotRoomLists() {
+	s.listMu.Lock()
+	defer s.listMu.Unlock()
+
+	s.mu.RLock()
+	rooms := s.roomInfos()
+	targets := s.roomListTargets()
+	s.mu.RUnlock()
+
+	sent := 0
+	for _, target := range targets {
+		view := target.view
+		if view.gameType == "" && view.roomID == "" {
+			continue
+		}
+		s.sendRoomSnapshot(target.player, view, rooms)
+		sent++
+	}
+	if sent > 0 {
+		log.Printf("Sent room list snapshots to %d players\n", sent)
+	}
+}
@@ -0,0 +1,67 @@
+package main
+
+import (
+	"testing"
+
+	"olive_and_millies_game_room/protocol"
+)
+
+func TestLobbySubscription(t *testing.T) {
+	s, url := newTestServer(t)
+	sub, host, guest, other := connectClient(t, url), connectClient(t, url), connectClient(t, url), connectClient(t, url)
+	sub.send(protocol.MsgJoinLobby, protocol.JoinLobby{GameType: "yahtzee"})
+	var list protocol.RoomList
+	decode(t, sub.expect(protocol.MsgRoomList).Data, &list)
+	if len(list.Rooms) != 0 {
+		t.Fatalf("snapshot of an empty lobby has %d rooms", len(list.Rooms))
+	}
+
+	other.send(protocol.MsgCreateRoom, protocol.CreateRoom{GameType: "memory", RoomName: "Memory"})
+	otherRoom := other.expect(protocol.MsgRoomCreated).RoomID
+	host.send(protocol.MsgCreateRoom, protocol.CreateRoom{GameType: "yahtzee", RoomName: "Yahtzee"})
+	roomID := host.expect(protocol.MsgRoomCreated).RoomID
+
+	// The subscriber follows the Yahtzee room as it changes, and never
+	// hears about the Memory one
+	next := func(msgType protocol.MessageType) protocol.Message {
+		t.Helper()
+		for {
+			msg := sub.expect(msgType)
+			if msg.RoomID == otherRoom {
+				t.Fatalf("got %s for a room in another game", msg.Type)
+			}
+			if msg.RoomID == roomID || msgType == protocol.MsgRoomList {
+				return msg
+			}
+		}
+	}
+	var room protocol.RoomInfo
+	decode(t, next(protocol.MsgRoomAdded).Data, &room)
+	if room.GameType != "yahtzee" || room.Players != 1 {
+		t.Errorf("added %s room with %d players", room.GameType, room.Players)
+	}
+	guest.send(protocol.MsgJoinRoom, protocol.JoinRoom{RoomID: roomID})
+	decode(t, next(protocol.MsgRoomUpdated).Data, &room)
+	if room.Players != 2 {
+		t.Errorf("updated room has %d players, want 2", room.Players)
+	}
+	guest.send(protocol.MsgLeaveRoom, nil)
+	host.send(protocol.MsgLeaveRoom, nil)
+	next(protocol.MsgRoomRemoved)
+
+	// The periodic snapshot only lists the subscribed game's rooms
+	other.send(protocol.MsgCreateRoom, protocol.CreateRoom{GameType: "memory", RoomName: "Memory"})
+	otherRoom = other.expect(protocol.MsgRoomCreated).RoomID
+	s.snapshotRoomLists()
+	decode(t, next(protocol.MsgRoomList).Data, &list)
+	if len(list.Rooms) != 0 {
+		t.Errorf("snapshot lists %d rooms, want none", len(list.Rooms))
+	}
+
+	sub.send(protocol.MsgJoinLobby, protocol.JoinLobby{GameType: "chess"})
+	var e protocol.Error
+	decode(t, sub.expect(protocol.MsgError).Data, &e)
+	if e.Code != protocol.ErrBadRequest {
+		t.Errorf("joining an unknown game's lobby: got %s", e.Code)
+	}
+}
@@ -0,0 +1,146 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+
+	"olive_and_millies_game_room/protocol"
+)
+
+// How long a test client waits for a message before giving up
+const testWait = 5 * time.Second
+
+// newTestServer starts a server with its stores in a temporary directory,
+// and returns it with the URL to connect to
+func newTestServer(t *testing.T) (*Server, string) {
+	t.Helper()
+	dir := t.TempDir()
+	history, err := NewFileHistoryStore(filepath.Join(dir, "history"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	ratings, err := NewFileRatingStore(filepath.Join(dir, "ratings.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	accounts, err := NewFileAccountStore(filepath.Join(dir, "accounts.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := NewServer(history, ratings, accounts)
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/ws", s.handleConnection)
+	ts := httptest.NewServer(mux)
+	t.Cleanup(ts.Close)
+	return s, "ws" + strings.TrimPrefix(ts.URL, "http") + "/ws"
+}
+
+// testClient is a player's connection, speaking JSON
+type testClient struct {
+	t    *testing.T
+	conn *websocket.Conn
+	id   string
+}
+
+// dialHello connects with the given hello, which is left out if it's the
+// zero Hello
+func dialHello(t *testing.T, rawURL string, hello protocol.Hello) *websocket.Conn {
+	t.Helper()
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if hello != (protocol.Hello{}) {
+		q := u.Query()
+		hello.Add(q)
+		u.RawQuery = q.Encode()
+	}
+	conn, _, err := websocket.DefaultDialer.Dial(u.String(), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	return conn
+}
+
+// connectClient connects as an up to date client
+func connectClient(t *testing.T, url string) *testClient {
+	t.Helper()
+	conn := dialHello(t, url, protocol.Hello{ClientVersion: "1.0.21", ProtocolVersion: protocol.Version})
+	c := &testClient{t: t, conn: conn}
+	c.id = c.expect(protocol.MsgConnected).PlayerID
+	return c
+}
+
+func (c *testClient) send(msgType protocol.MessageType, payload interface{}) {
+	c.t.Helper()
+	msg := protocol.Message{Type: msgType, Data: protocol.Encode(payload)}
+	if err := c.conn.WriteJSON(msg); err != nil {
+		c.t.Fatalf("sending %s: %v", msgType, err)
+	}
+}
+
+// expect reads messages until one of the given type arrives
+func (c *testClient) expect(msgType protocol.MessageType) protocol.Message {
+	c.t.Helper()
+	c.conn.SetReadDeadline(time.Now().Add(testWait))
+	for {
+		var msg protocol.Message
+		if err := c.conn.ReadJSON(&msg); err != nil {
+			c.t.Fatalf("waiting for %s: %v", msgType, err)
+		}
+		if msg.Type == msgType {
+			return msg
+		}
+	}
+}
+
+// startedRoom seats the clients in a new room of the game, the first one
+// hosting, and starts the game without waiting out the countdown
+func startedRoom(t *testing.T, s *Server, gameType string, clients ...*testClient) *Room {
+	t.Helper()
+	host := clients[0]
+	host.send(protocol.MsgCreateRoom, protocol.CreateRoom{GameType: gameType, RoomName: "Test"})
+	roomID := host.expect(protocol.MsgRoomCreated).RoomID
+	for _, c := range clients[1:] {
+		c.send(protocol.MsgJoinRoom, protocol.JoinRoom{RoomID: roomID})
+		c.expect(protocol.MsgPlayerJoined)
+	}
+
+	s.mu.RLock()
+	room := s.rooms[roomID]
+	s.mu.RUnlock()
+	s.beginGame(room)
+	for _, c := range clients {
+		c.expect(protocol.MsgStartGame)
+	}
+	return room
+}
+
+// player is the server's side of a client's connection
+func (s *Server) player(t *testing.T, c *testClient) *Player {
+	t.Helper()
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	player, ok := s.players[c.id]
+	if !ok {
+		t.Fatalf("no player %s", c.id)
+	}
+	return player
+}
+
+func decode(t *testing.T, data json.RawMessage, v interface{}) {
+	t.Helper()
+	if err := json.Unmarshal(data, v); err != nil {
+		t.Fatalf("decoding %s: %v", data, err)
+	}
+}
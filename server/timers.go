@@ -0,0 +1,159 @@
+package main
+
+import (
+	"log"
+	"time"
+
+	"olive_and_millies_game_room/protocol"
+)
+
+// Set the clocks for a game that's just started and start the first turn's
+// timer. Must be called with room.mu held.
+func (s *Server) startTurnTimer(room *Room) {
+	s.stopTurnTimer(room)
+	room.Clocks = nil
+	room.TimerSeat = -1
+	if room.TimeLimit == 0 {
+		return
+	}
+	if protocol.ClockedGame(room.GameType) {
+		room.Clocks = make([]time.Duration, len(room.Players))
+		for i := range room.Clocks {
+			room.Clocks[i] = time.Duration(room.TimeLimit) * time.Second
+		}
+	}
+	s.updateTurnTimer(room)
+}
+
+// Charge the time the last move took to the player who made it and time
+// whoever's turn it is now. A per-turn timer keeps running until the turn
+// is over. Must be called with room.mu held.
+func (s *Server) updateTurnTimer(room *Room) {
+	if room.TimeLimit == 0 || room.Game == nil {
+		return
+	}
+
+	now := time.Now()
+	if room.Clocks != nil && room.TimerSeat >= 0 {
+		room.Clocks[room.TimerSeat] -= now.Sub(room.TimerStarted)
+		if room.Clocks[room.TimerSeat] < 0 {
+			room.Clocks[room.TimerSeat] = 0
+		}
+	}
+	room.TimerStarted = now
+
+	if room.Game.IsOver() {
+		s.stopTurnTimer(room)
+		room.TimerSeat = -1
+		s.sendTurnTimer(room)
+		return
+	}
+
+	seat, started := room.Game.Turn()
+	if room.Clocks == nil && !started && room.turnTimer != nil {
+		return
+	}
+
+	left := time.Duration(room.TimeLimit) * time.Second
+	if room.Clocks != nil {
+		left = room.Clocks[seat]
+	}
+	s.stopTurnTimer(room)
+	room.TimerSeat = seat
+	room.TimerDeadline = now.Add(left)
+
+	var timer *time.Timer
+	timer = time.AfterFunc(left, func() {
+		s.turnTimedOut(room, &timer)
+	})
+	room.turnTimer = timer
+	s.sendTurnTimer(room)
+}
+
+// Must be called with room.mu held
+func (s *Server) stopTurnTimer(room *Room) {
+	if room.turnTimer != nil {
+		room.turnTimer.Stop()
+		room.turnTimer = nil
+	}
+}
+
+// The player whose turn it is ran out of time. The game plays for them
+// (Yahtzee scores their dice, Memory passes) or, on a chess clock, they
+// lose. Like a countdown tick, timer is only read with room.mu held.
+func (s *Server) turnTimedOut(room *Room, timer **time.Timer) {
+	room.mu.Lock()
+	if room.turnTimer != *timer || room.Game == nil || room.Game.IsOver() {
+		// Moved or cancelled since
+		room.mu.Unlock()
+		return
+	}
+	room.turnTimer = nil
+	seat := room.TimerSeat
+	if seat < 0 || seat >= len(room.Players) {
+		room.mu.Unlock()
+		return
+	}
+	log.Printf("Seat %d ran out of time in room %s\n", seat, room.ID)
+	record, watchers := s.playTimeOut(room, seat)
+	room.mu.Unlock()
+
+	s.saveMatch(room, record, watchers)
+}
+
+// Have the game play for the seat, or end it against them, when they've
+// run out of time or stopped playing, and pass on the moves made for them.
+// Must be called with room.mu held; the record of a game this ends, with
+// who was watching, goes to saveMatch once room.mu is released.
+func (s *Server) playTimeOut(room *Room, seat int) (*protocol.MatchRecord, []*Player) {
+	player := room.Players[seat]
+	watchers := append(append([]*Player{}, room.Players...), room.Spectators...)
+	for _, data := range room.Game.TimeOut(seat) {
+		room.Moves = append(room.Moves, protocol.MatchMove{Seat: seat, Data: data, Time: time.Now()})
+		msg := protocol.Message{
+			Type:      protocol.MsgGameMove,
+			PlayerID:  player.ID,
+			RoomID:    room.ID,
+			GameType:  room.GameType,
+			Data:      data,
+			Timestamp: time.Now(),
+		}
+		for _, p := range watchers {
+			s.sendMessage(p, msg)
+		}
+	}
+	return s.afterMove(room, watchers), watchers
+}
+
+// Send the room's players and spectators whose time is running and how
+// much of it is left. Must be called with room.mu held.
+func (s *Server) sendTurnTimer(room *Room) {
+	msg := s.turnTimerMessage(room)
+	for _, p := range room.Players {
+		s.sendMessage(p, msg)
+	}
+	for _, p := range room.Spectators {
+		s.sendMessage(p, msg)
+	}
+}
+
+// Must be called with room.mu held
+func (s *Server) turnTimerMessage(room *Room) protocol.Message {
+	data := protocol.TurnTimer{
+		Seat:  room.TimerSeat,
+		Limit: room.TimeLimit,
+	}
+	if room.TimerSeat >= 0 {
+		data.SecondsLeft = time.Until(room.TimerDeadline).Seconds()
+	}
+	for _, clock := range room.Clocks {
+		data.Clocks = append(data.Clocks, clock.Seconds())
+	}
+	return protocol.Message{
+		Type:      protocol.MsgTurnTimer,
+		RoomID:    room.ID,
+		GameType:  room.GameType,
+		Data:      protocol.Encode(data),
+		Timestamp: time.Now(),
+	}
+}
@@ -0,0 +1,110 @@
+package main
+
+import (
+	"testing"
+	"time"
+
+	"olive_and_millies_game_room/protocol"
+	"olive_and_millies_game_room/rules/connectfour"
+	"olive_and_millies_game_room/rules/yahtzee"
+)
+
+// timedRoom starts a game like startedRoom, with a time limit
+func timedRoom(t *testing.T, s *Server, gameType string, limit int, clients ...*testClient) *Room {
+	t.Helper()
+	room := startedRoom(t, s, gameType, clients...)
+	room.mu.Lock()
+	room.TimeLimit = limit
+	s.startTurnTimer(room)
+	room.mu.Unlock()
+	return room
+}
+
+func timerOf(room *Room) (int, time.Time, []time.Duration) {
+	room.mu.RLock()
+	defer room.mu.RUnlock()
+	return room.TimerSeat, room.TimerDeadline, append([]time.Duration{}, room.Clocks...)
+}
+
+func TestTurnTimerResets(t *testing.T) {
+	s, url := newTestServer(t)
+	first, second := connectClient(t, url), connectClient(t, url)
+	room := timedRoom(t, s, "yahtzee", 30, first, second)
+	_, deadline, _ := timerOf(room)
+
+	// The timer keeps running through the rolls of a turn
+	first.send(protocol.MsgGameMove, yahtzee.Move{Action: "roll"})
+	second.expect(protocol.MsgGameMove)
+	if seat, d, _ := timerOf(room); seat != 0 || !d.Equal(deadline) {
+		t.Errorf("after a roll: seat %d, deadline moved by %v", seat, d.Sub(deadline))
+	}
+
+	// and starts over for the next player's turn
+	time.Sleep(10 * time.Millisecond)
+	first.send(protocol.MsgGameMove, yahtzee.Move{Action: "score", Category: int(yahtzee.Chance)})
+	second.expect(protocol.MsgGameMove)
+	if seat, d, _ := timerOf(room); seat != 1 || !d.After(deadline) {
+		t.Errorf("after scoring: seat %d, deadline moved by %v", seat, d.Sub(deadline))
+	}
+}
+
+func TestChessClockCharged(t *testing.T) {
+	s, url := newTestServer(t)
+	first, second := connectClient(t, url), connectClient(t, url)
+	room := timedRoom(t, s, "connect_four", 60, first, second)
+
+	const think = 50 * time.Millisecond
+	time.Sleep(think)
+	first.send(protocol.MsgGameMove, connectfour.Move{Column: 3})
+	second.expect(protocol.MsgGameMove)
+
+	seat, deadline, clocks := timerOf(room)
+	if clocks[0] > 60*time.Second-think || clocks[0] < 59*time.Second {
+		t.Errorf("first player's clock at %v after thinking for %v", clocks[0], think)
+	}
+	if clocks[1] != 60*time.Second {
+		t.Errorf("second player's clock ran on the first's turn, now %v", clocks[1])
+	}
+	if left := time.Until(deadline); seat != 1 || left > clocks[1] {
+		t.Errorf("timing seat %d with %v left", seat, left)
+	}
+}
+
+func TestLossOnTimeout(t *testing.T) {
+	s, url := newTestServer(t)
+	first, second := connectClient(t, url), connectClient(t, url)
+	room := timedRoom(t, s, "connect_four", 60, first, second)
+
+	room.mu.Lock()
+	room.Clocks[0] = 20 * time.Millisecond
+	s.updateTurnTimer(room)
+	room.mu.Unlock()
+
+	// Everyone is told of the forfeit, and it's kept with the match
+	var move connectfour.Move
+	decode(t, second.expect(protocol.MsgGameMove).Data, &move)
+	if !move.Forfeit {
+		t.Fatalf("timed out with %+v, want a forfeit", move)
+	}
+	second.expect(protocol.MsgRatingUpdate)
+
+	room.mu.RLock()
+	_, winner := room.Game.Result()
+	moves := len(room.Moves)
+	room.mu.RUnlock()
+	if winner != 1 || moves != 1 {
+		t.Errorf("after the timeout: winner %d, %d moves", winner, moves)
+	}
+	records, _, err := s.history.List(HistoryQuery{})
+	if err != nil || len(records) != 1 {
+		t.Fatalf("history: %v, %d matches", err, len(records))
+	}
+	record, err := s.history.Get(records[0].ID)
+	if err != nil || len(record.Moves) != 1 {
+		t.Fatalf("match %s: %v, %+v", records[0].ID, err, record)
+	}
+	decode(t, record.Moves[0].Data, &move)
+	if !move.Forfeit || record.Moves[0].Seat != 0 {
+		t.Errorf("recorded seat %d playing %+v, want seat 0's forfeit", record.Moves[0].Seat, move)
+	}
+}
@@ -0,0 +1,67 @@
+package main
+
+import (
+	"log"
+	"time"
+
+	"github.com/gorilla/websocket"
+
+	"olive_and_millies_game_room/protocol"
+)
+
+// How many messages can wait to go out to a player. A client that falls
+// this far behind is dropped rather than allowed to hold anyone else up.
+const sendQueueSize = 256
+
+// Concurrency model:
+//
+// Locks are always taken in the order s.listMu, s.mu, room.mu, player.mu.
+// s.listMu is only held while working out and sending room lists, so that
+// the changes each player gets build on the list they were last sent.
+// Nothing holding player.mu takes any of the others, so sending is safe
+// with any of them held.
+//
+// sendMessage never blocks. It queues the message for the connection's
+// writer goroutine, which is the only thing that writes messages to the
+// connection; pings and Close, which gorilla/websocket allows alongside
+// it, are the only other writes. Each connection gets its own queue and
+// writer, so one stalled client only ever stalls itself.
+
+// attach gives the player a new connection, with its own send queue and
+// writer using the encoding in player.client, and returns the connection it
+// replaces, if any. The old writer finishes whatever was queued for it and
+// stops. Must be called with player.mu held.
+func (player *Player) attach(conn *websocket.Conn) *websocket.Conn {
+	oldConn := player.Conn
+	if player.send != nil {
+		close(player.send)
+	}
+	player.Conn = conn
+	player.send = make(chan protocol.Message, sendQueueSize)
+	go writePump(player.ID, conn, player.client.Encoding, player.send)
+	return oldConn
+}
+
+// detach marks the player disconnected and stops their writer. Must be
+// called with player.mu held.
+func (player *Player) detach() {
+	player.Conn = nil
+	if player.send != nil {
+		close(player.send)
+		player.send = nil
+	}
+}
+
+// writePump writes a connection's queued messages out in order until the
+// queue is closed. If a write fails or stalls past writeWait, it closes the
+// connection, which ends the player's read loop too.
+func writePump(playerID string, conn *websocket.Conn, encoding protocol.Encoding, send <-chan protocol.Message) {
+	for msg := range send {
+		conn.SetWriteDeadline(time.Now().Add(writeWait))
+		if err := protocol.WriteMessage(conn, encoding, msg); err != nil {
+			log.Printf("Error sending to player %s: %v\n", playerID, err)
+			conn.Close()
+			return
+		}
+	}
+}
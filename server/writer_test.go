@@ -0,0 +1,166 @@
+package main
+
+import (
+	"net"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+
+	"olive_and_millies_game_room/protocol"
+)
+
+func chat(name string, n int) protocol.Message {
+	return protocol.Message{Type: protocol.MsgChat, Data: protocol.Encode(protocol.Chat{Name: name, Text: strconv.Itoa(n)})}
+}
+
+// stallWriter stops the player's writer and gives them a queue that nothing
+// drains, as if their connection had stopped taking writes
+func stallWriter(player *Player) {
+	player.mu.Lock()
+	close(player.send)
+	player.send = make(chan protocol.Message, sendQueueSize)
+	player.mu.Unlock()
+}
+
+// expectClosed reads until the server closes the connection
+func (c *testClient) expectClosed() {
+	c.t.Helper()
+	c.conn.SetReadDeadline(time.Now().Add(testWait))
+	for {
+		var msg protocol.Message
+		err := c.conn.ReadJSON(&msg)
+		if ne, ok := err.(net.Error); ok && ne.Timeout() {
+			c.t.Fatal("connection still open")
+		}
+		if err != nil {
+			return
+		}
+	}
+}
+
+// expectChats reads n chat messages, checking each sender's arrive in the
+// order they were sent
+func (c *testClient) expectChats(n int) {
+	c.t.Helper()
+	next := make(map[string]int)
+	for i := 0; i < n; i++ {
+		var chat protocol.Chat
+		decode(c.t, c.expect(protocol.MsgChat).Data, &chat)
+		if chat.Text != strconv.Itoa(next[chat.Name]) {
+			c.t.Fatalf("chat %s from %s, want %d", chat.Text, chat.Name, next[chat.Name])
+		}
+		next[chat.Name]++
+	}
+}
+
+func TestSlowClientDropped(t *testing.T) {
+	s, url := newTestServer(t)
+	slow, fast := connectClient(t, url), connectClient(t, url)
+	room := startedRoom(t, s, "memory", slow, fast)
+	player := s.player(t, slow)
+	stallWriter(player)
+
+	// A full queue is as far behind as a client gets before being dropped,
+	// and everyone else still gets every message
+	for i := 0; i < sendQueueSize; i++ {
+		s.broadcastToRoom(room, chat("test", i))
+	}
+	player.mu.Lock()
+	queued := player.send != nil
+	player.mu.Unlock()
+	if !queued {
+		t.Fatal("dropped before the queue was full")
+	}
+	s.broadcastToRoom(room, chat("test", sendQueueSize))
+
+	player.mu.Lock()
+	dropped := player.send == nil
+	player.mu.Unlock()
+	if !dropped {
+		t.Error("not dropped with the queue full")
+	}
+	slow.expectClosed()
+	fast.expectChats(sendQueueSize + 1)
+
+	// Sending to the dropped player is a no-op until they resume
+	s.sendMessage(player, chat("test", 0))
+}
+
+func TestConcurrentBroadcasts(t *testing.T) {
+	const senders, each = 4, 50
+	s, url := newTestServer(t)
+	clients := []*testClient{connectClient(t, url), connectClient(t, url), connectClient(t, url)}
+	room := startedRoom(t, s, "memory", clients...)
+
+	var wg sync.WaitGroup
+	for i := 0; i < senders; i++ {
+		wg.Add(1)
+		go func(name string) {
+			defer wg.Done()
+			for n := 0; n < each; n++ {
+				s.broadcastToRoom(room, chat(name, n))
+			}
+		}(strconv.Itoa(i))
+	}
+	// Room lists go out alongside, taking s.mu and room.mu in their order
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		for n := 0; n < each; n++ {
+			s.broadcastRoomList()
+		}
+	}()
+
+	for _, c := range clients {
+		c.expectChats(senders * each)
+	}
+	wg.Wait()
+}
+
+func TestResumeWhileDraining(t *testing.T) {
+	s, url := newTestServer(t)
+	old := connectClient(t, url)
+	player := s.player(t, old)
+
+	// Messages keep going out while the session moves to its new
+	// connection, some queued for the old writer and the rest for the new
+	const sent = 200
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for n := 0; n < sent; n++ {
+			s.sendMessage(player, chat("test", n))
+		}
+	}()
+	resumed := connectClient(t, url+"?session="+player.Token)
+	<-done
+	if resumed.id != player.ID {
+		t.Fatalf("resumed as %s, want %s", resumed.id, player.ID)
+	}
+
+	// Whatever the old connection got before it closed came in order, and
+	// the new one gets everything after
+	old.conn.SetReadDeadline(time.Now().Add(testWait))
+	last := -1
+	for {
+		var msg protocol.Message
+		if err := old.conn.ReadJSON(&msg); err != nil {
+			break
+		}
+		if msg.Type != protocol.MsgChat {
+			continue
+		}
+		var c protocol.Chat
+		decode(t, msg.Data, &c)
+		if n, _ := strconv.Atoi(c.Text); n != last+1 {
+			t.Fatalf("old connection got chat %d after %d", n, last)
+		}
+		last++
+	}
+	s.sendMessage(player, chat("after", 0))
+	var c protocol.Chat
+	for c.Name != "after" {
+		decode(t, resumed.expect(protocol.MsgChat).Data, &c)
+	}
+}
@@ -1,12 +1,17 @@
 package main
 
 import (
+	"fmt"
 	"image/color"
+	"strings"
 
 	"github.com/hajimehoshi/ebiten/v2"
 	"github.com/hajimehoshi/ebiten/v2/ebitenutil"
 	"github.com/hajimehoshi/ebiten/v2/inpututil"
 	"github.com/hajimehoshi/ebiten/v2/vector"
+
+	"olive_and_millies_game_room/protocol"
+	"olive_and_millies_game_room/rules"
 )
 
 
@@ -17,6 +22,51 @@ type GameInterface interface {
 	Reset()
 }
 
+// RatedGame is implemented by games that show each player's rating, so
+// they can be updated when the server sends the post-game ratings
+type RatedGame interface {
+	SetRatings(ratings []int)
+}
+
+// ratedName labels a player with their rating, if they have one
+func ratedName(name string, rating int) string {
+	if rating == 0 {
+		return name
+	}
+	return fmt.Sprintf("%s (%d)", name, rating)
+}
+
+// vsComputer is who plays an offline game against the computer: the
+// player, who goes first, and the computer
+func vsComputer(level rules.Difficulty) []protocol.PlayerInfo {
+	return []protocol.PlayerInfo{
+		{Name: "You", Avatar: 0},
+		{Name: level.ComputerName(), Avatar: 1, Bot: level.String()},
+	}
+}
+
+// localComputers returns the seats the computer plays in an offline game,
+// and how well, from the players' bot difficulties. Online the server
+// plays its own computer players, so there are none.
+func localComputers(nc *NetworkClient, playerData []protocol.PlayerInfo) map[int]rules.Difficulty {
+	if nc != nil {
+		return nil
+	}
+	computers := make(map[int]rules.Difficulty)
+	for seat, p := range playerData {
+		if level, err := rules.ParseDifficulty(p.Bot); err == nil {
+			computers[seat] = level
+		}
+	}
+	return computers
+}
+
+// SeedVerifier is implemented by games that use the server's dice or
+// shuffles, to check them against the seed it reveals when the game ends
+type SeedVerifier interface {
+	VerifySeed(seed []byte, reveal protocol.SeedReveal) bool
+}
+
 // Button represents a clickable button
 type Button struct {
 	x, y, width, height float64
@@ -30,6 +80,85 @@ func (b *Button) Contains(x, y int) bool {
 	return fx >= b.x && fx <= b.x+b.width && fy >= b.y && fy <= b.y+b.height
 }
 
+// TextField is a single-line text input. Only the focused field takes
+// typing; clicking a field focuses it.
+type TextField struct {
+	x, y, width float64
+	label       string // Drawn above the field
+	text        []rune
+	maxLength   int
+	focused     bool
+	masked      bool // Draw the text as asterisks, for passwords
+}
+
+const textFieldHeight = 24
+
+func (f *TextField) Contains(x, y int) bool {
+	fx, fy := float64(x), float64(y)
+	return fx >= f.x && fx <= f.x+f.width && fy >= f.y && fy <= f.y+textFieldHeight
+}
+
+func (f *TextField) Text() string {
+	return string(f.text)
+}
+
+func (f *TextField) SetText(text string) {
+	f.text = []rune(text)
+	if len(f.text) > f.maxLength {
+		f.text = f.text[:f.maxLength]
+	}
+}
+
+// Update takes typing into the field while it's focused
+func (f *TextField) Update() {
+	if !f.focused {
+		return
+	}
+	f.text = ebiten.AppendInputChars(f.text)
+	if len(f.text) > f.maxLength {
+		f.text = f.text[:f.maxLength]
+	}
+	if inpututil.IsKeyJustPressed(ebiten.KeyBackspace) && len(f.text) > 0 {
+		f.text = f.text[:len(f.text)-1]
+	}
+}
+
+// focusTextField focuses whichever field was clicked, if any
+func focusTextField(mx, my int, fields ...*TextField) {
+	if !inpututil.IsMouseButtonJustPressed(ebiten.MouseButtonLeft) {
+		return
+	}
+	for _, f := range fields {
+		if f.Contains(mx, my) {
+			for _, other := range fields {
+				other.focused = other == f
+			}
+			return
+		}
+	}
+}
+
+func DrawTextField(screen *ebiten.Image, f *TextField) {
+	borderColor := color.RGBA{100, 150, 220, 255}
+	if f.focused {
+		borderColor = color.RGBA{255, 220, 100, 255}
+	}
+	vector.DrawFilledRect(screen, float32(f.x), float32(f.y), float32(f.width), textFieldHeight, color.RGBA{20, 30, 50, 255}, false)
+	vector.StrokeRect(screen, float32(f.x), float32(f.y), float32(f.width), textFieldHeight, 2, borderColor, false)
+
+	if f.label != "" {
+		ebitenutil.DebugPrintAt(screen, f.label, int(f.x), int(f.y)-18)
+	}
+	text := string(f.text)
+	if f.masked {
+		text = strings.Repeat("*", len(f.text))
+	}
+	if f.focused {
+		text += "_"
+	}
+	ebitenutil.DebugPrintAt(screen, text, int(f.x)+8, int(f.y)+5)
+}
+
 // Check if O&M logo was clicked
 func IsLogoClicked() bool {
 	if !inpututil.IsMouseButtonJustPressed(ebiten.MouseButtonLeft) {
@@ -0,0 +1,153 @@
+package main
+
+import (
+	"fmt"
+	"image/color"
+	"math"
+	"sync"
+	"time"
+
+	"github.com/hajimehoshi/ebiten/v2"
+	"github.com/hajimehoshi/ebiten/v2/ebitenutil"
+	"github.com/hajimehoshi/ebiten/v2/vector"
+
+	"olive_and_millies_game_room/protocol"
+)
+
+// The time control after seconds, wrapping back round to no limit
+func nextTimeControl(gameType string, seconds int) int {
+	controls := protocol.TimeControls(gameType)
+	for i, limit := range controls {
+		if limit == seconds {
+			return controls[(i+1)%len(controls)]
+		}
+	}
+	return 0
+}
+
+// Describe a time control, e.g. "20s per move" or "5 min clock"
+func timeControlText(gameType string, seconds int) string {
+	if seconds == 0 {
+		return "No time limit"
+	}
+	amount := fmt.Sprintf("%ds", seconds)
+	if seconds%60 == 0 {
+		amount = fmt.Sprintf("%d min", seconds/60)
+	}
+	switch gameType {
+	case "memory":
+		return amount + " per move"
+	case "yahtzee":
+		return amount + " per turn"
+	default:
+		return amount + " clock"
+	}
+}
+
+// TimedGame is implemented by games that show the room's turn timer
+type TimedGame interface {
+	SetTurnTimer(t *TurnTimer)
+}
+
+// TurnTimer tracks the server's timer for the game in progress. The server
+// sends the time left whenever the turn changes and the client counts down
+// from there. A nil TurnTimer (no time control) draws nothing.
+type TurnTimer struct {
+	seat     int             // Whose time is running, -1 for nobody's
+	deadline time.Time       // When the running time runs out
+	limit    time.Duration   // The full time per move, turn or game
+	clocks   []time.Duration // Time left per seat, for chess clocks
+	mu       sync.Mutex
+}
+
+func NewTurnTimer() *TurnTimer {
+	return &TurnTimer{seat: -1}
+}
+
+// Set is called from the network goroutine with the server's latest timer
+func (t *TurnTimer) Set(seat int, secondsLeft float64, limit int, clocks []float64) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	t.seat = seat
+	t.deadline = time.Now().Add(time.Duration(secondsLeft * float64(time.Second)))
+	t.limit = time.Duration(limit) * time.Second
+	t.clocks = nil
+	for _, clock := range clocks {
+		t.clocks = append(t.clocks, time.Duration(clock*float64(time.Second)))
+	}
+}
+
+// Left returns how much time seat has left, and whether it has a timer to
+// show at all
+func (t *TurnTimer) Left(seat int) (time.Duration, bool) {
+	if t == nil {
+		return 0, false
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if t.limit == 0 {
+		return 0, false
+	}
+	if seat == t.seat {
+		left := time.Until(t.deadline)
+		if left < 0 {
+			left = 0
+		}
+		return left, true
+	}
+	if seat < len(t.clocks) {
+		// A stopped chess clock
+		return t.clocks[seat], true
+	}
+	return 0, false
+}
+
+// DrawRing draws seat's time left as a ring centred on (cx, cy) that empties
+// as the time runs down, with the seconds left in the middle
+func (t *TurnTimer) DrawRing(screen *ebiten.Image, seat int, cx, cy, radius float32) {
+	left, ok := t.Left(seat)
+	if !ok {
+		return
+	}
+	t.mu.Lock()
+	running := seat == t.seat
+	fraction := float64(left) / float64(t.limit)
+	t.mu.Unlock()
+	if fraction > 1 {
+		fraction = 1
+	}
+
+	ringColor := color.RGBA{120, 200, 120, 255}
+	if fraction < 0.25 {
+		ringColor = color.RGBA{220, 80, 80, 255}
+	} else if fraction < 0.5 {
+		ringColor = color.RGBA{230, 190, 80, 255}
+	}
+	if !running {
+		ringColor = color.RGBA{140, 140, 140, 255}
+	}
+
+	vector.DrawFilledCircle(screen, cx, cy, radius, color.RGBA{20, 20, 30, 200}, true)
+	vector.StrokeCircle(screen, cx, cy, radius, 1, color.RGBA{80, 80, 90, 255}, true)
+
+	// The arc runs clockwise from the top, in short straight segments
+	const segments = 48
+	end := int(math.Ceil(fraction * segments))
+	for i := 0; i < end; i++ {
+		a1 := -math.Pi/2 + 2*math.Pi*float64(i)/segments
+		a2 := -math.Pi/2 + 2*math.Pi*math.Min(float64(i+1)/segments, fraction)
+		vector.StrokeLine(screen,
+			cx+radius*float32(math.Cos(a1)), cy+radius*float32(math.Sin(a1)),
+			cx+radius*float32(math.Cos(a2)), cy+radius*float32(math.Sin(a2)),
+			3, ringColor, true)
+	}
+
+	seconds := int(math.Ceil(left.Seconds()))
+	leftText := fmt.Sprintf("%d", seconds)
+	if seconds >= 60 {
+		leftText = fmt.Sprintf("%d:%02d", seconds/60, seconds%60)
+	}
+	ebitenutil.DebugPrintAt(screen, leftText, int(cx)-len(leftText)*3, int(cy)-8)
+}
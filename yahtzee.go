@@ -5,148 +5,103 @@ import (
 	"fmt"
 	"image/color"
 	"math/rand"
-	"sort"
 	"time"
 
 	"github.com/hajimehoshi/ebiten/v2"
 	"github.com/hajimehoshi/ebiten/v2/ebitenutil"
 	"github.com/hajimehoshi/ebiten/v2/inpututil"
 	"github.com/hajimehoshi/ebiten/v2/vector"
-)
 
-type ScoreCategory int
-
-const (
-	Ones ScoreCategory = iota
-	Twos
-	Threes
-	Fours
-	Fives
-	Sixes
-	ThreeOfKind
-	FourOfKind
-	FullHouse
-	SmallStraight
-	LargeStraight
-	Yahtzee
-	Chance
-	NumCategories
+	"olive_and_millies_game_room/protocol"
+	"olive_and_millies_game_room/rules"
+	"olive_and_millies_game_room/rules/yahtzee"
 )
 
-var categoryNames = []string{
-	"Ones", "Twos", "Threes", "Fours", "Fives", "Sixes",
-	"3 of a Kind", "4 of a Kind", "Full House",
-	"Small Straight", "Large Straight", "Yahtzee", "Chance",
-}
+// The computer takes at least this long over each roll, hold and score, so
+// the player can see what it's doing
+const yahtzeeComputerDelay = 600 * time.Millisecond
 
 type Die struct {
-	value  int
-	held   bool
 	x, y   float64
 	width  float64
 	height float64
 }
 
 type YahtzeePlayer struct {
-	name       string
-	avatar     AvatarType
-	scores     [NumCategories]*int
-	totalScore int
-}
-
-func (p *YahtzeePlayer) calculateTotal() int {
-	total := 0
-	upperTotal := 0
-	for i := Ones; i <= Sixes; i++ {
-		if p.scores[i] != nil {
-			upperTotal += *p.scores[i]
-		}
-	}
-	total += upperTotal
-	if upperTotal >= 63 {
-		total += 35
-	}
-	for i := ThreeOfKind; i < NumCategories; i++ {
-		if p.scores[i] != nil {
-			total += *p.scores[i]
-		}
-	}
-	return total
-}
-
-type YahtzeeMove struct {
-	Action   string `json:"action"` // "roll", "hold", "score"
-	DiceIdx  int    `json:"dice_idx,omitempty"`
-	Category int    `json:"category,omitempty"`
-	DiceVals [5]int `json:"dice_vals,omitempty"`
+	name   string
+	avatar AvatarType
+	rating int
 }
 
 type YahtzeeGame struct {
+	state         *yahtzee.State
 	dice          [5]*Die
 	players       []*YahtzeePlayer
-	currentPlayer int
-	rollsLeft     int
 	rollButton    *Button
-	scoreButtons  [NumCategories]*Button
+	scoreButtons  [yahtzee.NumCategories]*Button
 	newGameButton *Button
-	rng           *rand.Rand
+	rng           *rand.Rand     // Offline dice; online the server rolls
+	rolls         []yahtzee.Roll // Rolls the server made, checked against its seed
+	rollPending   bool           // Waiting for the server to roll for us
 	networkClient *NetworkClient
 	myPlayerNum   int
 	numPlayers    int
 	playerAvatars []AvatarType
+	turnTimer     *TurnTimer               // The room's time control, nil if it has none
+	roster        []protocol.PlayerInfo    // Who plays an offline game, for the next one
+	computers     map[int]rules.Difficulty // Seats the computer plays offline, and how well
+	computerMove  chan yahtzee.Move        // The computer's move once it has thought, nil when it isn't thinking
 }
 
 func NewYahtzeeGame() *YahtzeeGame {
 	return NewYahtzeeGameWithNetwork(nil, 0)
 }
 
-func NewYahtzeeGameWithPlayers(nc *NetworkClient, playerNum int, playerData []map[string]interface{}) *YahtzeeGame {
+// NewYahtzeeGameVsComputer starts an offline game against the computer,
+// with the player going first
+func NewYahtzeeGameVsComputer(level rules.Difficulty) *YahtzeeGame {
+	return NewYahtzeeGameWithPlayers(nil, 0, vsComputer(level))
+}
+
+func NewYahtzeeGameWithPlayers(nc *NetworkClient, playerNum int, playerData []protocol.PlayerInfo) *YahtzeeGame {
 	numPlayers := len(playerData)
 	if numPlayers == 0 {
 		numPlayers = 2
 	}
 
 	g := &YahtzeeGame{
+		state:         yahtzee.New(numPlayers),
 		players:       make([]*YahtzeePlayer, numPlayers),
-		currentPlayer: 0,
-		rollsLeft:     3,
 		rng:           rand.New(rand.NewSource(time.Now().UnixNano())),
 		networkClient: nc,
 		myPlayerNum:   playerNum,
 		numPlayers:    numPlayers,
 		playerAvatars: make([]AvatarType, numPlayers),
+		roster:        playerData,
+		computers:     localComputers(nc, playerData),
 	}
 
 	// Initialize players from server data
 	for i := 0; i < numPlayers; i++ {
 		name := fmt.Sprintf("Player %d", i+1)
 		avatar := i % int(AvatarNumTypes)
+		rating := 0
 
 		if i < len(playerData) {
-			if n, ok := playerData[i]["name"].(string); ok {
-				name = n
-			}
-			if a, ok := playerData[i]["avatar"].(float64); ok {
-				avatar = int(a)
-			}
+			name = playerData[i].Name
+			avatar = playerData[i].Avatar
+			rating = playerData[i].Rating
 		}
 
 		g.players[i] = &YahtzeePlayer{
 			name:   name,
 			avatar: AvatarType(avatar),
+			rating: rating,
 		}
 		g.playerAvatars[i] = AvatarType(avatar)
 	}
 
-	// Register network handler
-	if nc != nil {
-		nc.RegisterHandler(MsgGameMove, func(msg Message) {
-			var move YahtzeeMove
-			if err := json.Unmarshal(msg.Data, &move); err == nil {
-				g.applyMove(move)
-			}
-		})
-	}
+	g.registerHandlers(nc)
 
 	// Setup UI elements
 	g.setupUI()
@@ -164,9 +119,8 @@ func NewYahtzeeGameWithNetwork(nc *NetworkClient, playerNum int) *YahtzeeGame {
 	}
 
 	g := &YahtzeeGame{
+		state:         yahtzee.New(numPlayers),
 		players:       make([]*YahtzeePlayer, numPlayers),
-		currentPlayer: 0,
-		rollsLeft:     3,
 		rng:           rand.New(rand.NewSource(time.Now().UnixNano())),
 		networkClient: nc,
 		myPlayerNum:   playerNum,
@@ -183,15 +137,7 @@ func NewYahtzeeGameWithNetwork(nc *NetworkClient, playerNum int) *YahtzeeGame {
 		g.playerAvatars[i] = AvatarType(i % int(AvatarNumTypes))
 	}
 
-	// Register network handler
-	if nc != nil {
-		nc.RegisterHandler(MsgGameMove, func(msg Message) {
-			var move YahtzeeMove
-			if err := json.Unmarshal(msg.Data, &move); err == nil {
-				g.applyMove(move)
-			}
-		})
-	}
+	g.registerHandlers(nc)
 
 	// Setup UI elements
 	g.setupUI()
@@ -199,14 +145,39 @@ func NewYahtzeeGameWithNetwork(nc *NetworkClient, playerNum int) *YahtzeeGame {
 	return g
 }
 
+// Register network handlers for opponent moves and server state
+func (g *YahtzeeGame) registerHandlers(nc *NetworkClient) {
+	if nc == nil {
+		return
+	}
+	nc.RegisterHandler(protocol.MsgGameMove, func(msg protocol.Message) {
+		var move yahtzee.Move
+		if err := json.Unmarshal(msg.Data, &move); err != nil {
+			return
+		}
+		held := g.state.Held
+		if g.applyMove(move) == nil && move.Action == "roll" {
+			g.rolls = append(g.rolls, yahtzee.Roll{Held: held, Dice: move.DiceVals})
+		}
+		if move.Action == "roll" {
+			g.rollPending = false
+		}
+	})
+	nc.RegisterHandler(protocol.MsgGameState, func(msg protocol.Message) {
+		state := yahtzee.New(g.numPlayers)
+		if err := json.Unmarshal(msg.Data, state); err == nil {
+			g.state = state
+			g.rollPending = false
+		}
+	})
+}
+
 func (g *YahtzeeGame) setupUI() {
 	diceY := 150.0
 	diceSpacing := 100.0
 	diceStartX := 150.0
 	for i := 0; i < 5; i++ {
 		g.dice[i] = &Die{
-			value:  0,
-			held:   false,
 			x:      diceStartX + float64(i)*diceSpacing,
 			y:      diceY,
 			width:  80,
@@ -227,13 +198,13 @@ func (g *YahtzeeGame) setupUI() {
 	scoreX := 720.0
 	scoreY := 70.0
 	scoreSpacing := 38.0
-	for i := 0; i < int(NumCategories); i++ {
+	for i := 0; i < int(yahtzee.NumCategories); i++ {
 		g.scoreButtons[i] = &Button{
 			x:       scoreX,
 			y:       scoreY + float64(i)*scoreSpacing,
 			width:   250,
 			height:  33,
-			text:    categoryNames[i],
+			text:    yahtzee.CategoryNames[i],
 			enabled: false,
 		}
 	}
@@ -250,7 +221,7 @@ func (g *YahtzeeGame) setupUI() {
 }
 
 func (g *YahtzeeGame) Reset() {
-	*g = *NewYahtzeeGame()
+	*g = *NewYahtzeeGameWithPlayers(nil, 0, g.roster)
 }
 
 func (g *YahtzeeGame) Update(gr *GameRoom) error {
@@ -260,24 +231,31 @@ func (g *YahtzeeGame) Update(gr *GameRoom) error {
 		return nil
 	}
 
+	g.updateButtons()
+
+	if level, ok := g.computers[g.state.CurrentPlayer]; ok && !g.state.GameOver {
+		g.updateComputer(level)
+		return nil
+	}
+
 	// Only allow input if it's my turn (or no network client)
-	isMyTurn := g.networkClient == nil || g.currentPlayer == g.myPlayerNum
+	isMyTurn := g.networkClient == nil || g.state.CurrentPlayer == g.myPlayerNum
 
 	if isMyTurn && inpututil.IsMouseButtonJustPressed(ebiten.MouseButtonLeft) {
 		x, y := ebiten.CursorPosition()
 
-		if g.rollsLeft < 3 && g.rollsLeft > 0 {
+		if g.state.RollsLeft < 3 && g.state.RollsLeft > 0 {
 			for i, die := range g.dice {
 				if float64(x) >= die.x && float64(x) <= die.x+die.width &&
 					float64(y) >= die.y && float64(y) <= die.y+die.height {
-					die.held = !die.held
+					move := yahtzee.Move{
+						Action:  "hold",
+						DiceIdx: i,
+					}
+					g.applyMove(move)
 
 					// Send hold action
 					if g.networkClient != nil {
-						move := YahtzeeMove{
-							Action:  "hold",
-							DiceIdx: i,
-						}
 						g.networkClient.SendGameMove(move)
 					}
 				}
@@ -286,28 +264,15 @@ func (g *YahtzeeGame) Update(gr *GameRoom) error {
 
 		if g.rollButton.enabled && g.rollButton.Contains(x, y) {
 			g.rollDice()
-
-			// Send roll action with dice values
-			if g.networkClient != nil {
-				var diceVals [5]int
-				for i, die := range g.dice {
-					diceVals[i] = die.value
-				}
-				move := YahtzeeMove{
-					Action:   "roll",
-					DiceVals: diceVals,
-				}
-				g.networkClient.SendGameMove(move)
-			}
 		}
 
 		for i, btn := range g.scoreButtons {
 			if btn.enabled && btn.Contains(x, y) {
-				g.scoreCategory(ScoreCategory(i))
+				g.scoreCategory(yahtzee.Category(i))
 
 				// Send score action
 				if g.networkClient != nil {
-					move := YahtzeeMove{
+					move := yahtzee.Move{
 						Action:   "score",
 						Category: i,
 					}
@@ -331,176 +296,88 @@ func (g *YahtzeeGame) Update(gr *GameRoom) error {
 	return nil
 }
 
+// Enable the buttons that make sense for the current state
+func (g *YahtzeeGame) updateButtons() {
+	s := g.state
+	g.rollButton.enabled = s.RollsLeft > 0 && !s.GameOver && !g.rollPending
+	scores := s.Scores[s.CurrentPlayer]
+	for i, btn := range g.scoreButtons {
+		btn.enabled = s.RollsLeft < 3 && !s.GameOver && scores[i] == nil
+	}
+	// Online games end with a rematch vote instead, which keeps the room
+	// together
+	g.newGameButton.enabled = s.GameOver && g.networkClient == nil
+}
+
+// rollDice rolls every die that isn't held. Online the server rolls for us
+// and sends the result back as a game move.
 func (g *YahtzeeGame) rollDice() {
-	if g.rollsLeft <= 0 {
+	if g.networkClient != nil {
+		g.rollPending = true
+		g.networkClient.SendGameMove(yahtzee.Move{Action: "roll"})
 		return
 	}
-	for _, die := range g.dice {
-		if !die.held {
-			die.value = g.rng.Intn(6) + 1
-		}
-	}
-	g.rollsLeft--
-	g.enableScoreButtons()
-	if g.rollsLeft == 0 {
-		g.rollButton.enabled = false
-	}
+	g.applyMove(g.state.RollMove(g.rng))
 }
 
-func (g *YahtzeeGame) enableScoreButtons() {
-	player := g.players[g.currentPlayer]
-	for i := 0; i < int(NumCategories); i++ {
-		if player.scores[i] == nil {
-			g.scoreButtons[i].enabled = true
-		}
+// Have the computer think about its next roll, hold or score in the
+// background, so working out the odds doesn't hold up drawing, and play it
+// once it's ready
+func (g *YahtzeeGame) updateComputer(level rules.Difficulty) {
+	if g.computerMove == nil {
+		// The search gets a copy of the game and a generator of its own,
+		// as neither is safe to share with the update loop
+		state := g.state.Clone()
+		rng := rand.New(rand.NewSource(g.rng.Int63()))
+		moves := make(chan yahtzee.Move, 1)
+		g.computerMove = moves
+		go func() {
+			start := time.Now()
+			move := state.BestMove(level, rng)
+			time.Sleep(yahtzeeComputerDelay - time.Since(start))
+			moves <- move
+		}()
+		return
 	}
-}
 
-func (g *YahtzeeGame) disableScoreButtons() {
-	for i := 0; i < int(NumCategories); i++ {
-		g.scoreButtons[i].enabled = false
+	select {
+	case move := <-g.computerMove:
+		g.computerMove = nil
+		g.applyMove(move)
+	default:
 	}
 }
 
-func (g *YahtzeeGame) scoreCategory(category ScoreCategory) {
-	player := g.players[g.currentPlayer]
-	if player.scores[category] != nil {
-		return
-	}
-	score := g.calculateScore(category)
-	player.scores[category] = &score
-	player.totalScore = player.calculateTotal()
-	g.disableScoreButtons()
-	g.nextTurn()
+func (g *YahtzeeGame) scoreCategory(category yahtzee.Category) {
+	g.applyMove(yahtzee.Move{Action: "score", Category: int(category)})
 }
 
-func (g *YahtzeeGame) nextTurn() {
-	allScored := true
-	for _, player := range g.players {
-		for i := 0; i < int(NumCategories); i++ {
-			if player.scores[i] == nil {
-				allScored = false
-				break
-			}
-		}
-		if !allScored {
-			break
-		}
-	}
-	if allScored {
-		g.newGameButton.enabled = true
-		return
-	}
-	g.currentPlayer = (g.currentPlayer + 1) % len(g.players)
-	g.rollsLeft = 3
-	g.rollButton.enabled = true
-	for _, die := range g.dice {
-		die.held = false
-		die.value = 0
-	}
+// applyMove plays a move for the current player; illegal moves are ignored
+func (g *YahtzeeGame) applyMove(move yahtzee.Move) error {
+	return g.state.Apply(g.state.CurrentPlayer, move)
 }
 
-func (g *YahtzeeGame) applyMove(move YahtzeeMove) {
-	switch move.Action {
-	case "hold":
-		if move.DiceIdx >= 0 && move.DiceIdx < 5 {
-			g.dice[move.DiceIdx].held = !g.dice[move.DiceIdx].held
-		}
-	case "roll":
-		// Apply the dice values from opponent's roll
-		for i, val := range move.DiceVals {
-			if i < 5 {
-				g.dice[i].value = val
-			}
-		}
-		g.rollsLeft--
-		g.enableScoreButtons()
-		if g.rollsLeft == 0 {
-			g.rollButton.enabled = false
-		}
-	case "score":
-		if move.Category >= 0 && move.Category < int(NumCategories) {
-			g.scoreCategory(ScoreCategory(move.Category))
+// VerifySeed checks the server's dice against its revealed seed. Every
+// revealed roll has to replay from the seed, and they have to end with the
+// rolls we saw ourselves.
+func (g *YahtzeeGame) VerifySeed(seed []byte, reveal protocol.SeedReveal) bool {
+	if !yahtzee.VerifyRolls(rules.NewRand(seed), reveal.Rolls) {
+		return false
+	}
+	if len(g.rolls) > len(reveal.Rolls) {
+		return false
+	}
+	offset := len(reveal.Rolls) - len(g.rolls)
+	for i, roll := range g.rolls {
+		if roll != reveal.Rolls[offset+i] {
+			return false
 		}
 	}
+	return true
 }
 
-func (g *YahtzeeGame) calculateScore(category ScoreCategory) int {
-	values := make([]int, 5)
-	for i, die := range g.dice {
-		values[i] = die.value
-	}
-	sort.Ints(values)
-	counts := make(map[int]int)
-	sum := 0
-	for _, v := range values {
-		counts[v]++
-		sum += v
-	}
-	switch category {
-	case Ones, Twos, Threes, Fours, Fives, Sixes:
-		target := int(category) + 1
-		return counts[target] * target
-	case ThreeOfKind:
-		for _, count := range counts {
-			if count >= 3 {
-				return sum
-			}
-		}
-		return 0
-	case FourOfKind:
-		for _, count := range counts {
-			if count >= 4 {
-				return sum
-			}
-		}
-		return 0
-	case FullHouse:
-		hasThree, hasTwo := false, false
-		for _, count := range counts {
-			if count == 3 {
-				hasThree = true
-			}
-			if count == 2 {
-				hasTwo = true
-			}
-		}
-		if hasThree && hasTwo {
-			return 25
-		}
-		return 0
-	case SmallStraight:
-		straights := [][]int{{1, 2, 3, 4}, {2, 3, 4, 5}, {3, 4, 5, 6}}
-		for _, straight := range straights {
-			found := true
-			for _, v := range straight {
-				if counts[v] == 0 {
-					found = false
-					break
-				}
-			}
-			if found {
-				return 30
-			}
-		}
-		return 0
-	case LargeStraight:
-		if (values[0] == 1 && values[1] == 2 && values[2] == 3 && values[3] == 4 && values[4] == 5) ||
-			(values[0] == 2 && values[1] == 3 && values[2] == 4 && values[3] == 5 && values[4] == 6) {
-			return 40
-		}
-		return 0
-	case Yahtzee:
-		for _, count := range counts {
-			if count == 5 {
-				return 50
-			}
-		}
-		return 0
-	case Chance:
-		return sum
-	}
-	return 0
+func (g *YahtzeeGame) calculateScore(category yahtzee.Category) int {
+	return yahtzee.Score(g.state.Dice, category)
 }
 
 func (g *YahtzeeGame) Draw(screen *ebiten.Image, gr *GameRoom) {
@@ -520,7 +397,7 @@ func (g *YahtzeeGame) Draw(screen *ebiten.Image, gr *GameRoom) {
 	ebitenutil.DebugPrintAt(screen, "YAHTZEE", titleTextX, 32)
 	ebitenutil.DebugPrintAt(screen, "YAHTZEE", titleTextX+1, 32)
 
-	player := g.players[g.currentPlayer]
+	player := g.players[g.state.CurrentPlayer]
 	playerInfoWidth := float32(270)
 	playerInfoX := thirdDieCenterX - playerInfoWidth/2
 	vector.DrawFilledRect(screen, playerInfoX, 70, playerInfoWidth, 50, color.RGBA{30, 50, 80, 255}, false)
@@ -530,21 +407,21 @@ func (g *YahtzeeGame) Draw(screen *ebiten.Image, gr *GameRoom) {
 	turnTextX := int(playerInfoX + (playerInfoWidth-float32(len(turnText)*6))/2)
 	ebitenutil.DebugPrintAt(screen, turnText, turnTextX, 82)
 
-	rollsText := fmt.Sprintf("Rolls Left: %d", g.rollsLeft)
+	rollsText := fmt.Sprintf("Rolls Left: %d", g.state.RollsLeft)
 	rollsTextX := int(playerInfoX + (playerInfoWidth-float32(len(rollsText)*6))/2)
 	ebitenutil.DebugPrintAt(screen, rollsText, rollsTextX, 100)
 
-	for _, die := range g.dice {
+	for i, die := range g.dice {
 		var dieColor color.Color = color.RGBA{255, 255, 255, 255}
 		var borderColor color.Color = color.RGBA{100, 150, 220, 255}
-		if die.held {
+		if g.state.Held[i] {
 			dieColor = color.RGBA{200, 230, 255, 255}
 			borderColor = color.RGBA{70, 120, 200, 255}
 		}
 		vector.DrawFilledRect(screen, float32(die.x+2), float32(die.y+2), float32(die.width), float32(die.height), color.RGBA{0, 0, 0, 20}, false)
 		vector.DrawFilledRect(screen, float32(die.x), float32(die.y), float32(die.width), float32(die.height), dieColor, false)
 		vector.StrokeRect(screen, float32(die.x), float32(die.y), float32(die.width), float32(die.height), 2, borderColor, false)
-		g.drawDieDots(screen, die)
+		g.drawDieDots(screen, die, g.state.Dice[i])
 	}
 
 	DrawButton(screen, g.rollButton)
@@ -556,18 +433,18 @@ func (g *YahtzeeGame) Draw(screen *ebiten.Image, gr *GameRoom) {
 	ebitenutil.DebugPrintAt(screen, "SCORECARD", scorecardTextX+1, 32)
 
 	for i, btn := range g.scoreButtons {
-		g.drawScoreButton(screen, btn, ScoreCategory(i))
+		g.drawScoreButton(screen, btn, yahtzee.Category(i))
 	}
 
 	g.drawScoreSummary(screen)
 
-	if g.newGameButton.enabled {
+	if g.state.GameOver {
 		g.drawWinner(screen)
 	}
 }
 
-func (g *YahtzeeGame) drawDieDots(screen *ebiten.Image, die *Die) {
-	if die.value == 0 {
+func (g *YahtzeeGame) drawDieDots(screen *ebiten.Image, die *Die, value int) {
+	if value == 0 {
 		return
 	}
 	dotRadius := float32(6)
@@ -575,7 +452,7 @@ func (g *YahtzeeGame) drawDieDots(screen *ebiten.Image, die *Die) {
 	cy := float32(die.y + die.height/2)
 	offset := float32(20)
 	dotColor := color.RGBA{40, 40, 40, 255}
-	switch die.value {
+	switch value {
 	case 1:
 		vector.DrawFilledCircle(screen, cx, cy, dotRadius, dotColor, false)
 	case 2:
@@ -606,11 +483,11 @@ func (g *YahtzeeGame) drawDieDots(screen *ebiten.Image, die *Die) {
 	}
 }
 
-func (g *YahtzeeGame) drawScoreButton(screen *ebiten.Image, btn *Button, category ScoreCategory) {
-	player := g.players[g.currentPlayer]
+func (g *YahtzeeGame) drawScoreButton(screen *ebiten.Image, btn *Button, category yahtzee.Category) {
+	scores := g.state.Scores[g.state.CurrentPlayer]
 	btnColor := color.RGBA{40, 60, 90, 255}
 	borderColor := color.RGBA{100, 150, 220, 255}
-	if player.scores[category] != nil {
+	if scores[category] != nil {
 		btnColor = color.RGBA{60, 100, 150, 255}
 		borderColor = color.RGBA{120, 170, 230, 255}
 	} else if !btn.enabled {
@@ -624,8 +501,8 @@ func (g *YahtzeeGame) drawScoreButton(screen *ebiten.Image, btn *Button, categor
 	vector.StrokeRect(screen, float32(btn.x), float32(btn.y), float32(btn.width), float32(btn.height), 1, borderColor, false)
 	textX := int(btn.x + 8)
 	textY := int(btn.y + btn.height/2 - 5)
-	if player.scores[category] != nil {
-		ebitenutil.DebugPrintAt(screen, fmt.Sprintf("%s: %d", btn.text, *player.scores[category]), textX, textY)
+	if scores[category] != nil {
+		ebitenutil.DebugPrintAt(screen, fmt.Sprintf("%s: %d", btn.text, *scores[category]), textX, textY)
 	} else if btn.enabled {
 		potentialScore := g.calculateScore(category)
 		ebitenutil.DebugPrintAt(screen, fmt.Sprintf("%s: (%d)", btn.text, potentialScore), textX, textY)
@@ -709,7 +586,7 @@ func (g *YahtzeeGame) drawPlayerPanel(screen *ebiten.Image, player *YahtzeePlaye
 	borderColor := color.RGBA{100, 150, 220, 255}
 
 	// Highlight current player
-	if index == g.currentPlayer {
+	if index == g.state.CurrentPlayer {
 		borderColor = color.RGBA{255, 220, 100, 255}
 		panelColor = color.RGBA{50, 70, 100, 255}
 	}
@@ -744,42 +621,60 @@ func (g *YahtzeeGame) drawPlayerPanel(screen *ebiten.Image, player *YahtzeePlaye
 		// Use short format if width is tight
 		var combinedText string
 		if availableTextWidth < 80 {
-			combinedText = fmt.Sprintf("%d", player.totalScore) // Just score number
+			combinedText = fmt.Sprintf("%d", g.state.Totals[index]) // Just score number
 		} else {
-			combinedText = fmt.Sprintf("%s: %d", player.name, player.totalScore)
+			combinedText = fmt.Sprintf("%s: %d", player.name, g.state.Totals[index])
 		}
 		ebitenutil.DebugPrintAt(screen, combinedText, textX, int(y+height/2-4))
-		if index == g.currentPlayer {
+		if index == g.state.CurrentPlayer {
 			ebitenutil.DebugPrintAt(screen, combinedText, textX+1, int(y+height/2-4))
 		}
 	} else {
-		// Normal two-line display
-		ebitenutil.DebugPrintAt(screen, player.name, textX, nameY)
-		if index == g.currentPlayer {
-			ebitenutil.DebugPrintAt(screen, player.name, textX+1, nameY)
+		// Normal two-line display, with the rating if it fits
+		nameText := ratedName(player.name, player.rating)
+		if float64(len(nameText)*6) > availableTextWidth {
+			nameText = player.name
+		}
+		ebitenutil.DebugPrintAt(screen, nameText, textX, nameY)
+		if index == g.state.CurrentPlayer {
+			ebitenutil.DebugPrintAt(screen, nameText, textX+1, nameY)
 		}
 
 		// Use shorter score format when width is limited
 		var scoreText string
 		if availableTextWidth < 80 {
-			scoreText = fmt.Sprintf("%d", player.totalScore) // Just the number
+			scoreText = fmt.Sprintf("%d", g.state.Totals[index]) // Just the number
 		} else {
-			scoreText = fmt.Sprintf("Score: %d", player.totalScore)
+			scoreText = fmt.Sprintf("Score: %d", g.state.Totals[index])
 		}
 		ebitenutil.DebugPrintAt(screen, scoreText, textX, scoreY)
-		if index == g.currentPlayer {
+		if index == g.state.CurrentPlayer {
 			ebitenutil.DebugPrintAt(screen, scoreText, textX+1, scoreY)
 		}
 	}
+
+	// The turn timer, on the right of the panel
+	radius := height * 0.35
+	if radius > 22 {
+		radius = 22
+	}
+	g.turnTimer.DrawRing(screen, index, float32(x+width-radius-6), float32(y+height/2), float32(radius))
 }
 
-func (g *YahtzeeGame) drawWinner(screen *ebiten.Image) {
-	winner := g.players[0]
-	for _, player := range g.players {
-		if player.totalScore > winner.totalScore {
-			winner = player
+func (g *YahtzeeGame) SetRatings(ratings []int) {
+	for i, rating := range ratings {
+		if i < len(g.players) {
+			g.players[i].rating = rating
 		}
 	}
+}
+
+func (g *YahtzeeGame) SetTurnTimer(t *TurnTimer) {
+	g.turnTimer = t
+}
+
+func (g *YahtzeeGame) drawWinner(screen *ebiten.Image) {
+	winnerIndex := g.state.Winner()
 
 	// Center the winner banner vertically and horizontally
 	bannerWidth := float32(450)
@@ -797,12 +692,19 @@ func (g *YahtzeeGame) drawWinner(screen *ebiten.Image) {
 	vector.DrawFilledRect(screen, bannerX-20, bannerY+40, 10, 10, starColor, false)
 	vector.DrawFilledRect(screen, bannerX+bannerWidth+8, bannerY+40, 10, 10, starColor, false)
 
-	winnerText := fmt.Sprintf("WINNER: %s", winner.name)
+	winnerText := "IT'S A TIE!"
+	topTotal := 0
+	for _, total := range g.state.Totals {
+		topTotal = max(topTotal, total)
+	}
+	if winnerIndex >= 0 {
+		winnerText = fmt.Sprintf("WINNER: %s", g.players[winnerIndex].name)
+	}
 	winnerTextX := int(bannerX + (bannerWidth-float32(len(winnerText)*6))/2)
 	ebitenutil.DebugPrintAt(screen, winnerText, winnerTextX, int(bannerY+20))
 	ebitenutil.DebugPrintAt(screen, winnerText, winnerTextX+1, int(bannerY+20))
 
-	scoreText := fmt.Sprintf("Score: %d points!", winner.totalScore)
+	scoreText := fmt.Sprintf("Score: %d points!", topTotal)
 	scoreTextX := int(bannerX + (bannerWidth-float32(len(scoreText)*6))/2)
 	ebitenutil.DebugPrintAt(screen, scoreText, scoreTextX, int(bannerY+40))
 	ebitenutil.DebugPrintAt(screen, scoreText, scoreTextX+1, int(bannerY+40))